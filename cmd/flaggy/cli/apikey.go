@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -19,36 +21,49 @@ var apikeyCmd = &cobra.Command{
 
 var apikeyListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all API keys",
+	Short: "List API keys",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		data, status, err := doRequest("GET", "/api/v1/api-keys", nil)
-		if err != nil {
-			return err
-		}
-		if status != 200 {
-			return fmt.Errorf("server error (%d): %s", status, string(data))
-		}
-
 		var keys []struct {
-			ID          string `json:"id"`
-			Name        string `json:"name"`
-			Environment string `json:"environment"`
-			Prefix      string `json:"prefix"`
-			Revoked     bool   `json:"revoked"`
-			CreatedAt   string `json:"created_at"`
-		}
-		if err := json.Unmarshal(data, &keys); err != nil {
-			return fmt.Errorf("parse response: %w", err)
+			ID          string     `json:"id"`
+			Name        string     `json:"name"`
+			Environment string     `json:"environment"`
+			Scopes      []string   `json:"scopes"`
+			Prefix      string     `json:"prefix"`
+			Revoked     bool       `json:"revoked"`
+			ExpiresAt   *time.Time `json:"expires_at"`
+			ReplacedBy  string     `json:"replaced_by"`
+			RateLimit   float64    `json:"rate_limit"`
+			RateBurst   int        `json:"rate_burst"`
+			CreatedAt   string     `json:"created_at"`
+			LastUsedAt  *time.Time `json:"last_used_at"`
+		}
+		if err := listAll("/api/v1/api-keys", "keys", &keys); err != nil {
+			return err
 		}
 
+		now := time.Now()
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT\tPREFIX\tREVOKED")
+		fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT\tSCOPES\tPREFIX\tSTATUS\tRATE LIMIT\tEXPIRES\tLAST USED")
 		for _, k := range keys {
-			revoked := "no"
-			if k.Revoked {
-				revoked = "yes"
+			status := "active"
+			switch {
+			case k.Revoked:
+				status = "revoked"
+			case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+				status = "expired"
+			case k.ReplacedBy != "":
+				status = "rotated → " + k.ReplacedBy
+			}
+			expires := "never"
+			if k.ExpiresAt != nil {
+				expires = k.ExpiresAt.Local().Format(time.RFC3339)
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Environment, k.Prefix, revoked)
+			lastUsed := "never"
+			if k.LastUsedAt != nil {
+				lastUsed = k.LastUsedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Environment,
+				strings.Join(k.Scopes, ","), k.Prefix, status, formatRateLimit(k.RateLimit, k.RateBurst), expires, lastUsed)
 		}
 		w.Flush()
 		return nil
@@ -58,7 +73,11 @@ var apikeyListCmd = &cobra.Command{
 // --- apikey create ---
 
 var (
-	apikeyEnv string
+	apikeyEnv       string
+	apikeyScopes    []string
+	apikeyExpiresIn time.Duration
+	apikeyRate      float64
+	apikeyBurst     int
 )
 
 var apikeyCreateCmd = &cobra.Command{
@@ -70,6 +89,16 @@ var apikeyCreateCmd = &cobra.Command{
 			"name":        args[0],
 			"environment": apikeyEnv,
 		}
+		if len(apikeyScopes) > 0 {
+			body["scopes"] = apikeyScopes
+		}
+		if apikeyExpiresIn > 0 {
+			body["expires_at"] = time.Now().Add(apikeyExpiresIn).UTC().Format(time.RFC3339)
+		}
+		if apikeyRate > 0 {
+			body["rate_limit"] = apikeyRate
+			body["rate_burst"] = apikeyBurst
+		}
 
 		data, status, err := doRequest("POST", "/api/v1/api-keys", body)
 		if err != nil {
@@ -79,22 +108,122 @@ var apikeyCreateCmd = &cobra.Command{
 			return fmt.Errorf("server error (%d): %s", status, string(data))
 		}
 
+		var result createdAPIKey
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		fmt.Printf("API key created:\n")
+		result.print()
+		return nil
+	},
+}
+
+type createdAPIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Environment string     `json:"environment"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Key         string     `json:"key"`
+}
+
+func (k createdAPIKey) print() {
+	fmt.Printf("  ID:          %s\n", k.ID)
+	fmt.Printf("  Name:        %s\n", k.Name)
+	fmt.Printf("  Environment: %s\n", k.Environment)
+	fmt.Printf("  Scopes:      %s\n", strings.Join(k.Scopes, ", "))
+	if k.ExpiresAt != nil {
+		fmt.Printf("  Expires:     %s\n", k.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	fmt.Printf("  Key:         %s\n", k.Key)
+	fmt.Printf("\nSave this key now — it won't be shown again.\n")
+}
+
+func formatRateLimit(rate float64, burst int) string {
+	if rate == 0 {
+		return "default"
+	}
+	if burst == 0 {
+		return fmt.Sprintf("%g/s", rate)
+	}
+	return fmt.Sprintf("%g/s, burst %d", rate, burst)
+}
+
+// --- apikey limit ---
+
+var apikeyLimitCmd = &cobra.Command{
+	Use:   "limit <id>",
+	Short: "Set an API key's rate limit (--rate 0 to use the server default)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{}
+		if cmd.Flags().Changed("rate") {
+			body["rate_limit"] = apikeyRate
+		}
+		if cmd.Flags().Changed("burst") {
+			body["rate_burst"] = apikeyBurst
+		}
+		if len(body) == 0 {
+			return fmt.Errorf("nothing to update: pass --rate and/or --burst")
+		}
+
+		data, status, err := doRequest("PATCH", "/api/v1/api-keys/"+args[0], body)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var result struct {
+			RateLimit float64 `json:"rate_limit"`
+			RateBurst int     `json:"rate_burst"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		fmt.Printf("API key %q rate limit: %s\n", args[0], formatRateLimit(result.RateLimit, result.RateBurst))
+		return nil
+	},
+}
+
+// --- apikey rotate ---
+
+var apikeyGrace string
+
+var apikeyRotateCmd = &cobra.Command{
+	Use:   "rotate <id>",
+	Short: "Issue a successor key; the old one keeps working for a grace period",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{}
+		if apikeyGrace != "" {
+			body["grace_period"] = apikeyGrace
+		}
+
+		data, status, err := doRequest("POST", "/api/v1/api-keys/"+args[0]+"/rotate", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
 		var result struct {
-			ID          string `json:"id"`
-			Name        string `json:"name"`
-			Environment string `json:"environment"`
-			Key         string `json:"key"`
+			createdAPIKey
+			Previous struct {
+				ID        string     `json:"id"`
+				ExpiresAt *time.Time `json:"expires_at"`
+			} `json:"previous"`
 		}
 		if err := json.Unmarshal(data, &result); err != nil {
 			return fmt.Errorf("parse response: %w", err)
 		}
 
-		fmt.Printf("API key created:\n")
-		fmt.Printf("  ID:          %s\n", result.ID)
-		fmt.Printf("  Name:        %s\n", result.Name)
-		fmt.Printf("  Environment: %s\n", result.Environment)
-		fmt.Printf("  Key:         %s\n", result.Key)
-		fmt.Printf("\nSave this key now — it won't be shown again.\n")
+		fmt.Printf("API key %s rotated; it stops working at %s.\n", result.Previous.ID,
+			result.Previous.ExpiresAt.Local().Format(time.RFC3339))
+		fmt.Printf("New key:\n")
+		result.createdAPIKey.print()
 		return nil
 	},
 }
@@ -120,7 +249,18 @@ var apikeyRevokeCmd = &cobra.Command{
 
 func init() {
 	apikeyCreateCmd.Flags().StringVar(&apikeyEnv, "env", "live", "Environment (live, test, staging)")
+	apikeyCreateCmd.Flags().StringSliceVar(&apikeyScopes, "scope", nil,
+		"Scopes (evaluate, stream, read_flags, read_segments); repeat or comma-separate (default evaluate,stream)")
+
+	apikeyCreateCmd.Flags().DurationVar(&apikeyExpiresIn, "expires-in", 0, "Expire the key after this long, e.g. 2160h (default never)")
+	apikeyCreateCmd.Flags().Float64Var(&apikeyRate, "rate", 0, "Requests per second (default: server setting)")
+	apikeyCreateCmd.Flags().IntVar(&apikeyBurst, "burst", 0, "Burst size (default: the rate, rounded up)")
+	apikeyLimitCmd.Flags().Float64Var(&apikeyRate, "rate", 0, "Requests per second; 0 uses the server default")
+	apikeyLimitCmd.Flags().IntVar(&apikeyBurst, "burst", 0, "Burst size; 0 uses the rate, rounded up")
+	apikeyRotateCmd.Flags().StringVar(&apikeyGrace, "grace", "", "How long the old key keeps working, e.g. 1h or 0s (default: server setting)")
+
+	addListFlags(apikeyListCmd, "created_at or name")
 
-	apikeyCmd.AddCommand(apikeyListCmd, apikeyCreateCmd, apikeyRevokeCmd)
+	apikeyCmd.AddCommand(apikeyListCmd, apikeyCreateCmd, apikeyLimitCmd, apikeyRotateCmd, apikeyRevokeCmd)
 	rootCmd.AddCommand(apikeyCmd)
 }
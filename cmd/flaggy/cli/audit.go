@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditActor        string
+	auditAction       string
+	auditResourceType string
+	auditResource     string
+	auditSince        string
+	auditLimit        int
+	auditCursor       string
+	auditShowDiff     bool
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of admin changes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q := url.Values{}
+		if auditActor != "" {
+			q.Set("actor_id", auditActor)
+		}
+		if auditAction != "" {
+			q.Set("action", auditAction)
+		}
+		if auditResourceType != "" {
+			q.Set("resource_type", auditResourceType)
+		}
+		if auditResource != "" {
+			q.Set("resource_key", auditResource)
+		}
+		if auditSince != "" {
+			q.Set("since", auditSince)
+		}
+		if auditCursor != "" {
+			q.Set("cursor", auditCursor)
+		}
+		q.Set("limit", strconv.Itoa(auditLimit))
+
+		data, status, err := doRequest("GET", "/api/v1/audit?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var page struct {
+			Entries []struct {
+				ID    int64 `json:"id"`
+				Actor struct {
+					Type string `json:"type"`
+					ID   string `json:"id"`
+				} `json:"actor"`
+				Action       string          `json:"action"`
+				ResourceType string          `json:"resource_type"`
+				ResourceKey  string          `json:"resource_key"`
+				Before       json.RawMessage `json:"before"`
+				After        json.RawMessage `json:"after"`
+				CreatedAt    string          `json:"created_at"`
+			} `json:"entries"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		if auditShowDiff {
+			for _, e := range page.Entries {
+				fmt.Printf("#%d  %s  %s:%s  %s %s/%s\n", e.ID, e.CreatedAt,
+					e.Actor.Type, e.Actor.ID, e.Action, e.ResourceType, e.ResourceKey)
+				if len(e.Before) > 0 {
+					fmt.Printf("  before: %s\n", string(e.Before))
+				}
+				if len(e.After) > 0 {
+					fmt.Printf("  after:  %s\n", string(e.After))
+				}
+			}
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tACTOR\tACTION\tRESOURCE")
+			for _, e := range page.Entries {
+				fmt.Fprintf(w, "%d\t%s\t%s:%s\t%s\t%s/%s\n", e.ID, e.CreatedAt,
+					e.Actor.Type, e.Actor.ID, e.Action, e.ResourceType, e.ResourceKey)
+			}
+			w.Flush()
+		}
+
+		if page.NextCursor != "" {
+			fmt.Printf("\nMore entries: flaggy audit --cursor %s\n", page.NextCursor)
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditActor, "actor", "", "Filter by actor ID")
+	auditCmd.Flags().StringVar(&auditAction, "action", "", "Filter by action (e.g. flag.update)")
+	auditCmd.Flags().StringVar(&auditResourceType, "resource-type", "", "Filter by resource type (flag, rule, segment, api_key)")
+	auditCmd.Flags().StringVar(&auditResource, "resource", "", "Filter by resource key (flag key, segment key or API key ID)")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only entries at or after this RFC 3339 time")
+	auditCmd.Flags().IntVar(&auditLimit, "limit", 50, "Entries per page")
+	auditCmd.Flags().StringVar(&auditCursor, "cursor", "", "Cursor from a previous page")
+	auditCmd.Flags().BoolVar(&auditShowDiff, "diff", false, "Show before/after state for each entry")
+
+	rootCmd.AddCommand(auditCmd)
+}
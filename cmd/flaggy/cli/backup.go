@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/getflaggy/flaggy/internal/config"
+	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/migrations"
+)
+
+var (
+	backupOutput string
+	restoreDB    string
+	restoreYes   bool
+)
+
+// backupName is the file name of a backup taken at t. Names sort by time.
+func backupName(t time.Time) string {
+	return "flaggy-" + t.UTC().Format("20060102-150405") + ".db"
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Download a consistent copy of the server's database",
+	Long: `Download a copy of the server's database, taken while it keeps serving.
+Unlike copying flaggy.db, the copy is consistent even while the server writes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := backupOutput
+		if out == "" {
+			out = backupName(time.Now())
+		}
+
+		req, err := newRequest("GET", "/api/v1/backup", nil)
+		if err != nil {
+			return err
+		}
+		// No timeout: large databases take a while to copy and download
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			data, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("server error (%d): %s", resp.StatusCode, string(data))
+		}
+
+		tmp := out + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		n, err := io.Copy(f, resp.Body)
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("download backup: %w", err)
+		}
+		if err := os.Rename(tmp, out); err != nil {
+			return err
+		}
+		fmt.Printf("Backup written to %s (%d bytes)\n", out, n)
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup>",
+	Short: "Replace the database with a backup",
+	Long: `Replace the database with a backup, after checking that the backup is intact
+and that this version of Flaggy can open it. Stop the server first; restore
+refuses to run while the database is open. The replaced database is kept next
+to it with a .before-restore suffix.
+
+The database is FLAGGY_DB_PATH unless --db is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbPath := restoreDB
+		if dbPath == "" {
+			dbPath = config.Load().DBPath
+		}
+
+		info, err := store.CheckBackup(args[0], migrations.FS)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup %s: %d flags, %d segments, %d migrations applied.\n",
+			args[0], info.Flags, info.Segments, info.Migrations)
+		if len(info.Pending) > 0 {
+			fmt.Printf("The server will apply %s when it starts.\n", strings.Join(info.Pending, ", "))
+		}
+		if !restoreYes && !confirm(fmt.Sprintf("Replace %s with it?", dbPath)) {
+			return fmt.Errorf("restore canceled")
+		}
+
+		if _, err := store.Restore(dbPath, args[0], migrations.FS); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s to %s\n", args[0], dbPath)
+		if _, err := os.Stat(dbPath + ".before-restore"); err == nil {
+			fmt.Printf("The previous database is at %s.before-restore\n", dbPath)
+		}
+		return nil
+	},
+}
+
+func init() {
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "File to write (default flaggy-<time>.db)")
+	restoreCmd.Flags().StringVar(&restoreDB, "db", "", "Database to replace (default FLAGGY_DB_PATH)")
+	restoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "Restore without asking for confirmation")
+
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+}
+
+// runBackups backs the database up into cfg.Dir every cfg.Interval, keeping
+// the newest cfg.Keep backups, until stop is closed. The first backup is due
+// an interval after the newest one already in the directory.
+func runBackups(b store.Backups, cfg config.BackupConfig, stop <-chan struct{}) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		slog.Error("failed to create backup directory", "error", err)
+		return
+	}
+
+	next := time.Now()
+	if backups, err := listBackups(cfg.Dir); err == nil && len(backups) > 0 {
+		if fi, err := os.Stat(filepath.Join(cfg.Dir, backups[len(backups)-1])); err == nil {
+			next = fi.ModTime().Add(cfg.Interval)
+		}
+	}
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+
+		path := filepath.Join(cfg.Dir, backupName(time.Now()))
+		if err := b.Backup(context.Background(), path); err != nil {
+			slog.Error("scheduled backup failed", "error", err)
+		} else {
+			slog.Info("database backed up", "path", path)
+			pruneBackups(cfg.Dir, cfg.Keep)
+		}
+		next = time.Now().Add(cfg.Interval)
+	}
+}
+
+// listBackups returns the names of the backups in dir, oldest first.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasPrefix(name, "flaggy-") && strings.HasSuffix(name, ".db") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// pruneBackups deletes all but the newest keep backups in dir. A keep of 0
+// keeps them all.
+func pruneBackups(dir string, keep int) {
+	names, err := listBackups(dir)
+	if err != nil || keep <= 0 || len(names) <= keep {
+		return
+	}
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			slog.Warn("failed to delete old backup", "error", err)
+		} else {
+			slog.Info("deleted old backup", "path", filepath.Join(dir, name))
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var changeCmd = &cobra.Command{
+	Use:     "change",
+	Aliases: []string{"cr"},
+	Short:   "Propose and review change requests",
+}
+
+type changeRequest struct {
+	ID                int64  `json:"id"`
+	Environment       string `json:"environment"`
+	ResourceType      string `json:"resource_type"`
+	Action            string `json:"action"`
+	ResourceKey       string `json:"resource_key"`
+	RuleID            int64  `json:"rule_id"`
+	Comment           string `json:"comment"`
+	Status            string `json:"status"`
+	RequiredApprovals int    `json:"required_approvals"`
+	Proposer          struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} `json:"proposer"`
+	Reviews []struct {
+		Actor struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		} `json:"actor"`
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+	} `json:"reviews"`
+	Diff []struct {
+		Path   string          `json:"path"`
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	} `json:"diff"`
+	ApplyError string `json:"apply_error"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func (cr *changeRequest) target() string {
+	if cr.ResourceType == "rule" && cr.RuleID != 0 {
+		return fmt.Sprintf("%s/rule %d", cr.ResourceKey, cr.RuleID)
+	}
+	return cr.ResourceKey
+}
+
+func (cr *changeRequest) approvals() int {
+	n := 0
+	for _, r := range cr.Reviews {
+		if r.Decision == "approve" {
+			n++
+		}
+	}
+	return n
+}
+
+func printChangeRequest(cr *changeRequest) {
+	fmt.Printf("Change request #%d (%s) — %s\n", cr.ID, cr.Environment, cr.Status)
+	fmt.Printf("  %s %s %s, proposed by %s:%s\n", cr.Action, cr.ResourceType, cr.target(), cr.Proposer.Type, cr.Proposer.ID)
+	if cr.Comment != "" {
+		fmt.Printf("  %q\n", cr.Comment)
+	}
+	fmt.Printf("  Approvals: %d of %d\n", cr.approvals(), cr.RequiredApprovals)
+	for _, r := range cr.Reviews {
+		line := fmt.Sprintf("    %s by %s:%s", r.Decision, r.Actor.Type, r.Actor.ID)
+		if r.Comment != "" {
+			line += fmt.Sprintf(" — %q", r.Comment)
+		}
+		fmt.Println(line)
+	}
+	if cr.ApplyError != "" {
+		fmt.Printf("  Apply failed: %s\n", cr.ApplyError)
+	}
+	fmt.Println("  Changes:")
+	if len(cr.Diff) == 0 {
+		fmt.Println("    (none)")
+	}
+	for _, c := range cr.Diff {
+		printChange(c.Path, c.Before, c.After)
+	}
+}
+
+// --- change list ---
+
+var changeListStatus string
+
+var changeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List change requests",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "/api/v1/change-requests"
+		if changeListStatus != "" {
+			path += "?status=" + url.QueryEscape(changeListStatus)
+		}
+		data, status, err := doRequest("GET", path, nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var crs []changeRequest
+		if err := json.Unmarshal(data, &crs); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tCHANGE\tAPPROVALS\tPROPOSER\tCREATED")
+		for _, cr := range crs {
+			fmt.Fprintf(w, "%d\t%s\t%s %s %s\t%d/%d\t%s\t%s\n", cr.ID, cr.Status,
+				cr.Action, cr.ResourceType, cr.target(), cr.approvals(), cr.RequiredApprovals,
+				cr.Proposer.ID, cr.CreatedAt)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- change get ---
+
+var changeGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Show a change request with its diff and reviews",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/change-requests/"+args[0], nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var cr changeRequest
+		if err := json.Unmarshal(data, &cr); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		printChangeRequest(&cr)
+		return nil
+	},
+}
+
+// --- change propose ---
+
+var (
+	proposeRuleID  int64
+	proposePayload string
+	proposeComment string
+)
+
+var changeProposeCmd = &cobra.Command{
+	Use:   "propose <flag|rule|segment> <create|update|delete|toggle|restore|clone> <key>",
+	Short: "Propose a change for review",
+	Long: `Propose a change for review. --payload is the JSON body the equivalent
+direct write would take; for rules, <key> is the flag key.
+
+Examples:
+  flaggy change propose flag toggle new_checkout --comment "launch"
+  flaggy change propose flag update new_checkout --payload '{"default_value":true}'
+  flaggy change propose rule delete new_checkout --rule 4
+  flaggy change propose flag restore new_checkout --payload '{"version":3}'
+  flaggy change propose flag clone new_checkout --payload '{"key":"new_checkout_v2"}'`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{
+			"resource_type": args[0],
+			"action":        args[1],
+			"resource_key":  args[2],
+			"comment":       proposeComment,
+		}
+		if proposeRuleID != 0 {
+			body["rule_id"] = proposeRuleID
+		}
+		if proposePayload != "" {
+			if !json.Valid([]byte(proposePayload)) {
+				return fmt.Errorf("--payload is not valid JSON")
+			}
+			body["payload"] = json.RawMessage(proposePayload)
+		}
+
+		data, status, err := doRequest("POST", "/api/v1/change-requests", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var cr changeRequest
+		if err := json.Unmarshal(data, &cr); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		printChangeRequest(&cr)
+		return nil
+	},
+}
+
+// --- change approve / reject ---
+
+var reviewComment string
+
+func reviewCommand(decision, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   decision + " <id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+				return fmt.Errorf("invalid change request ID %q", args[0])
+			}
+			body := map[string]string{"comment": reviewComment}
+			data, status, err := doRequest("POST", "/api/v1/change-requests/"+args[0]+"/"+decision, body)
+			if err != nil {
+				return err
+			}
+			if status != 200 {
+				return fmt.Errorf("server error (%d): %s", status, string(data))
+			}
+			var cr changeRequest
+			if err := json.Unmarshal(data, &cr); err != nil {
+				return fmt.Errorf("parse response: %w", err)
+			}
+			printChangeRequest(&cr)
+			return nil
+		},
+	}
+}
+
+func init() {
+	changeListCmd.Flags().StringVar(&changeListStatus, "status", "", "Filter by status (pending, applied, rejected, failed)")
+	changeProposeCmd.Flags().Int64Var(&proposeRuleID, "rule", 0, "Rule ID (rule update/delete)")
+	changeProposeCmd.Flags().StringVar(&proposePayload, "payload", "", "Request body of the equivalent direct write (JSON)")
+	changeProposeCmd.Flags().StringVar(&proposeComment, "comment", "", "Why this change is needed")
+
+	approveCmd := reviewCommand("approve", "Approve a change request (applies it once it has enough approvals)")
+	rejectCmd := reviewCommand("reject", "Reject a change request")
+	for _, c := range []*cobra.Command{approveCmd, rejectCmd} {
+		c.Flags().StringVar(&reviewComment, "comment", "", "Review comment")
+	}
+
+	changeCmd.AddCommand(changeListCmd, changeGetCmd, changeProposeCmd, approveCmd, rejectCmd)
+	rootCmd.AddCommand(changeCmd)
+}
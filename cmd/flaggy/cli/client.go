@@ -6,14 +6,30 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/spf13/cobra"
 )
 
 var httpClient = &http.Client{Timeout: 10 * time.Second}
 
+// listPageSize is how many items list commands fetch per request.
+const listPageSize = 200
+
+// Search and sort options shared by the list commands.
+var (
+	listQuery string
+	listSort  string
+)
+
 func doRequest(method, path string, body interface{}) ([]byte, int, error) {
-	url := serverURL + path
+	return doRequestWithHeaders(method, path, body, nil)
+}
 
+// doRequestWithHeaders is doRequest with extra request headers.
+func doRequestWithHeaders(method, path string, body interface{}, headers map[string]string) ([]byte, int, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		b, err := json.Marshal(body)
@@ -23,14 +39,12 @@ func doRequest(method, path string, body interface{}) ([]byte, int, error) {
 		bodyReader = bytes.NewReader(b)
 	}
 
-	req, err := http.NewRequest(method, url, bodyReader)
+	req, err := newRequest(method, path, bodyReader)
 	if err != nil {
-		return nil, 0, fmt.Errorf("create request: %w", err)
+		return nil, 0, err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
 
 	resp, err := httpClient.Do(req)
@@ -47,6 +61,94 @@ func doRequest(method, path string, body interface{}) ([]byte, int, error) {
 	return data, resp.StatusCode, nil
 }
 
+// newRequest creates a request to the server with the credentials and actor
+// set.
+func newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, serverURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if actorName != "" {
+		req.Header.Set("X-Flaggy-Actor", actorName)
+	}
+	return req, nil
+}
+
+// listAll fetches every page of a list endpoint, following next_cursor, and
+// decodes the items under field into out, a pointer to a slice.
+func listAll(path, field string, out any) error {
+	q := url.Values{}
+	if listQuery != "" {
+		q.Set("q", listQuery)
+	}
+	if listSort != "" {
+		q.Set("sort", listSort)
+	}
+	q.Set("limit", strconv.Itoa(listPageSize))
+
+	var items []json.RawMessage
+	for {
+		data, status, err := doRequest("GET", path+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var page map[string]json.RawMessage
+		if err := json.Unmarshal(data, &page); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		var pageItems []json.RawMessage
+		if err := json.Unmarshal(page[field], &pageItems); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		items = append(items, pageItems...)
+
+		var next string
+		if c, ok := page["next_cursor"]; ok {
+			if err := json.Unmarshal(c, &next); err != nil {
+				return fmt.Errorf("parse response: %w", err)
+			}
+		}
+		if next == "" {
+			break
+		}
+		q.Set("cursor", next)
+	}
+
+	all, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(all, out)
+}
+
+// addListFlags adds the search and sort options to a list command.
+func addListFlags(cmd *cobra.Command, sorts string) {
+	cmd.Flags().StringVarP(&listQuery, "query", "q", "", "Only list items containing this text")
+	cmd.Flags().StringVar(&listSort, "sort", "", "Sort by "+sorts+"; prefix with - for descending")
+}
+
+// ifMatchHeader returns an If-Match header for the given resource version,
+// or nil when version is 0 (no check).
+func ifMatchHeader(version int) map[string]string {
+	if version == 0 {
+		return nil
+	}
+	return map[string]string{"If-Match": strconv.Quote(strconv.Itoa(version))}
+}
+
+// versionConflict formats the error for a 412 response.
+func versionConflict(kind, key string, version int) error {
+	return fmt.Errorf("%s %q is no longer at version %d; fetch it again and retry", kind, key, version)
+}
+
 func prettyJSON(data []byte) string {
 	var buf bytes.Buffer
 	if err := json.Indent(&buf, data, "", "  "); err != nil {
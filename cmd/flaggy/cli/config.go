@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configPlan is the response of /config/plan and /config/apply.
+type configPlan struct {
+	Changes []struct {
+		Action       string `json:"action"`
+		ResourceType string `json:"resource_type"`
+		Key          string `json:"key"`
+		Changes      []struct {
+			Path   string          `json:"path"`
+			Before json.RawMessage `json:"before"`
+			After  json.RawMessage `json:"after"`
+		} `json:"changes"`
+	} `json:"changes"`
+	Applied bool `json:"applied"`
+}
+
+// --- export ---
+
+var (
+	exportFormat string
+	exportOutput string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all flags and segments as YAML or JSON",
+	Long: `Export all flags, rules and segments as a config file that
+'flaggy apply' can read, e.g. to keep flags in git.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportFormat != "yaml" && exportFormat != "json" {
+			return fmt.Errorf("--format must be yaml or json")
+		}
+		data, status, err := doRequest("GET", "/api/v1/config", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var out []byte
+		if exportFormat == "json" {
+			out = []byte(prettyJSON(data) + "\n")
+		} else if out, err = jsonToYAML(data); err != nil {
+			return err
+		}
+		if exportOutput == "" || exportOutput == "-" {
+			_, err = os.Stdout.Write(out)
+			return err
+		}
+		return os.WriteFile(exportOutput, out, 0o644)
+	},
+}
+
+// --- apply ---
+
+var (
+	applyFile   string
+	applyDryRun bool
+	applyYes    bool
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply -f <file>",
+	Short: "Make the server's flags and segments match a config file",
+	Long: `Compare a config file (as written by 'flaggy export') with the server,
+show the flags and segments that would be created, updated and deleted, and
+apply the changes after confirmation. Flags and segments missing from the file
+are deleted. The changes are applied in one transaction: if one fails, none is
+made.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if applyFile == "" {
+			return fmt.Errorf("--file is required")
+		}
+		if applyFile == "-" && !applyYes && !applyDryRun {
+			return fmt.Errorf("--yes is required when the config is read from stdin")
+		}
+		cfg, err := readConfigFile(applyFile)
+		if err != nil {
+			return err
+		}
+
+		plan, err := postConfig("/api/v1/config/plan", cfg)
+		if err != nil {
+			return err
+		}
+		if len(plan.Changes) == 0 {
+			fmt.Println("No changes. The server matches the config.")
+			return nil
+		}
+		printPlan(plan)
+		if applyDryRun {
+			return nil
+		}
+		if !applyYes && !confirm("Apply these changes?") {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+
+		applied, err := postConfig("/api/v1/config/apply", cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d changes.\n", len(applied.Changes))
+		return nil
+	},
+}
+
+// readConfigFile reads a YAML or JSON config file and returns it as JSON.
+func readConfigFile(path string) (json.RawMessage, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".json" {
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%s is not valid JSON", path)
+		}
+		return data, nil
+	}
+
+	// JSON is valid YAML, so this reads either
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return out, nil
+}
+
+func postConfig(path string, cfg json.RawMessage) (*configPlan, error) {
+	data, status, err := doRequest("POST", path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("server error (%d): %s", status, string(data))
+	}
+	var plan configPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return &plan, nil
+}
+
+// printPlan prints each planned change, with field changes under updates.
+func printPlan(plan *configPlan) {
+	counts := map[string]int{}
+	for _, c := range plan.Changes {
+		counts[c.Action]++
+		sign := map[string]string{"create": "+", "update": "~", "delete": "-"}[c.Action]
+		fmt.Printf("%s %s %s\n", sign, c.ResourceType, c.Key)
+		for _, ch := range c.Changes {
+			printChange(ch.Path, ch.Before, ch.After)
+		}
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to delete.\n",
+		counts["create"], counts["update"], counts["delete"])
+}
+
+// confirm asks a yes/no question on stdin. Anything but y or yes is no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// jsonToYAML converts a JSON document to block-style YAML, keeping the order
+// of object keys.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	var clearStyle func(n *yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, c := range n.Content {
+			clearStyle(c)
+		}
+	}
+	clearStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, fmt.Errorf("encode YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "yaml", "Output format (yaml or json)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to this file instead of stdout")
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Config file to apply (YAML or JSON; - for stdin)")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Only show the changes")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Apply without asking for confirmation")
+
+	rootCmd.AddCommand(exportCmd, applyCmd)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -18,34 +19,27 @@ var flagCmd = &cobra.Command{
 
 var flagListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all flags",
+	Short: "List flags",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		data, status, err := doRequest("GET", "/api/v1/flags", nil)
-		if err != nil {
-			return err
-		}
-		if status != 200 {
-			return fmt.Errorf("server error (%d): %s", status, string(data))
-		}
-
 		var flags []struct {
 			Key         string `json:"key"`
 			Type        string `json:"type"`
 			Enabled     bool   `json:"enabled"`
 			Description string `json:"description"`
+			Version     int    `json:"version"`
 		}
-		if err := json.Unmarshal(data, &flags); err != nil {
-			return fmt.Errorf("parse response: %w", err)
+		if err := listAll("/api/v1/flags", "flags", &flags); err != nil {
+			return err
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "KEY\tTYPE\tENABLED\tDESCRIPTION")
+		fmt.Fprintln(w, "KEY\tTYPE\tENABLED\tVERSION\tDESCRIPTION")
 		for _, f := range flags {
 			status := "off"
 			if f.Enabled {
 				status = "on"
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Key, f.Type, status, f.Description)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", f.Key, f.Type, status, f.Version, f.Description)
 		}
 		w.Flush()
 		return nil
@@ -78,19 +72,42 @@ var (
 	createDescription string
 	createEnabled     bool
 	createDefault     string
+	createTemplate    string
+	createValues      []string
 )
 
 var flagCreateCmd = &cobra.Command{
 	Use:   "create <key>",
 	Short: "Create a new flag",
-	Args:  cobra.ExactArgs(1),
+	Long: `Create a new flag. With --from-template, its type, default value and
+rules come from a template (see 'flaggy template'); --set fills in the
+template's placeholders. Values are JSON, or else taken as strings.
+
+  flaggy flag create dark_mode --type boolean --default false
+  flaggy flag create new_checkout --from-template staged_variant --set variant=short`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		body := map[string]interface{}{
-			"key":           args[0],
-			"type":          createType,
-			"description":   createDescription,
-			"enabled":       createEnabled,
-			"default_value": json.RawMessage(createDefault),
+			"key":         args[0],
+			"description": createDescription,
+			"enabled":     createEnabled,
+		}
+		if createTemplate == "" {
+			if len(createValues) > 0 {
+				return fmt.Errorf("--set requires --from-template")
+			}
+			body["type"] = createType
+			body["default_value"] = json.RawMessage(createDefault)
+		} else {
+			if cmd.Flags().Changed("type") || cmd.Flags().Changed("default") {
+				return fmt.Errorf("--type and --default come from the template")
+			}
+			values, err := parseValues(createValues)
+			if err != nil {
+				return err
+			}
+			body["template"] = createTemplate
+			body["values"] = values
 		}
 
 		data, status, err := doRequest("POST", "/api/v1/flags", body)
@@ -105,6 +122,54 @@ var flagCreateCmd = &cobra.Command{
 	},
 }
 
+// parseValues parses name=value pairs. A value that isn't JSON is a string.
+func parseValues(pairs []string) (map[string]json.RawMessage, error) {
+	values := map[string]json.RawMessage{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid value %q: want name=value", pair)
+		}
+		if json.Valid([]byte(value)) {
+			values[name] = json.RawMessage(value)
+		} else {
+			values[name], _ = json.Marshal(value)
+		}
+	}
+	return values, nil
+}
+
+// --- flag clone ---
+
+var cloneDescription string
+
+var flagCloneCmd = &cobra.Command{
+	Use:   "clone <key> <new-key>",
+	Short: "Copy a flag with its rules under a new key",
+	Long: `Copy a flag's type, description, default value and rules, including
+their segment references, under a new key. The copy is created disabled.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{"key": args[1]}
+		if cmd.Flags().Changed("description") {
+			body["description"] = cloneDescription
+		}
+		data, status, err := doRequest("POST", "/api/v1/flags/"+args[0]+"/clone", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Flag %q cloned to %q (disabled)\n", args[0], args[1])
+		return nil
+	},
+}
+
+// ifVersion is the expected resource version sent as If-Match by
+// commands that modify an existing flag or segment (0 = no check).
+var ifVersion int
+
 // --- flag enable ---
 
 var flagEnableCmd = &cobra.Command{
@@ -129,10 +194,13 @@ var flagDisableCmd = &cobra.Command{
 
 func setEnabled(key string, enabled bool) error {
 	body := map[string]interface{}{"enabled": enabled}
-	data, status, err := doRequest("PUT", "/api/v1/flags/"+key, body)
+	data, status, err := doRequestWithHeaders("PUT", "/api/v1/flags/"+key, body, ifMatchHeader(ifVersion))
 	if err != nil {
 		return err
 	}
+	if status == 412 {
+		return versionConflict("flag", key, ifVersion)
+	}
 	if status != 200 {
 		return fmt.Errorf("server error (%d): %s", status, string(data))
 	}
@@ -152,10 +220,13 @@ var flagDeleteCmd = &cobra.Command{
 	Short: "Delete a flag",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		data, status, err := doRequest("DELETE", "/api/v1/flags/"+args[0], nil)
+		data, status, err := doRequestWithHeaders("DELETE", "/api/v1/flags/"+args[0], nil, ifMatchHeader(ifVersion))
 		if err != nil {
 			return err
 		}
+		if status == 412 {
+			return versionConflict("flag", args[0], ifVersion)
+		}
 		if status != 204 {
 			return fmt.Errorf("server error (%d): %s", status, string(data))
 		}
@@ -169,7 +240,15 @@ func init() {
 	flagCreateCmd.Flags().StringVar(&createDescription, "description", "", "Flag description")
 	flagCreateCmd.Flags().BoolVar(&createEnabled, "enabled", false, "Enable the flag on creation")
 	flagCreateCmd.Flags().StringVar(&createDefault, "default", "false", "Default value (JSON)")
+	flagCreateCmd.Flags().StringVar(&createTemplate, "from-template", "", "Create the flag from this template")
+	flagCreateCmd.Flags().StringArrayVar(&createValues, "set", nil, "Template placeholder value as name=value (repeatable)")
+	flagCloneCmd.Flags().StringVar(&cloneDescription, "description", "", "Description of the copy (default: the original's)")
+	for _, c := range []*cobra.Command{flagEnableCmd, flagDisableCmd, flagDeleteCmd} {
+		c.Flags().IntVar(&ifVersion, "if-version", 0, "Only apply if the flag is still at this version (see 'flag get')")
+	}
+
+	addListFlags(flagListCmd, "key, created_at or updated_at")
 
-	flagCmd.AddCommand(flagListCmd, flagGetCmd, flagCreateCmd, flagEnableCmd, flagDisableCmd, flagDeleteCmd)
+	flagCmd.AddCommand(flagListCmd, flagGetCmd, flagCreateCmd, flagCloneCmd, flagEnableCmd, flagDisableCmd, flagDeleteCmd)
 	rootCmd.AddCommand(flagCmd)
 }
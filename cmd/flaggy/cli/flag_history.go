@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// --- flag history ---
+
+var flagHistoryCmd = &cobra.Command{
+	Use:   "history <key>",
+	Short: "List the versions of a flag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/flags/"+args[0]+"/versions", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var versions []struct {
+			Version int    `json:"version"`
+			Action  string `json:"action"`
+			Actor   struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			} `json:"actor"`
+			CreatedAt string `json:"created_at"`
+		}
+		if err := json.Unmarshal(data, &versions); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tTIME\tACTOR\tACTION")
+		for _, v := range versions {
+			fmt.Fprintf(w, "%d\t%s\t%s:%s\t%s\n", v.Version, v.CreatedAt, v.Actor.Type, v.Actor.ID, v.Action)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- flag diff ---
+
+var (
+	diffFrom int
+	diffTo   int
+)
+
+var flagDiffCmd = &cobra.Command{
+	Use:   "diff <key>",
+	Short: "Show changes between two versions of a flag (default: the last change)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q := url.Values{}
+		if cmd.Flags().Changed("from") {
+			q.Set("from", strconv.Itoa(diffFrom))
+		}
+		if cmd.Flags().Changed("to") {
+			q.Set("to", strconv.Itoa(diffTo))
+		}
+
+		data, status, err := doRequest("GET", "/api/v1/flags/"+args[0]+"/versions/diff?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var diff struct {
+			From    int `json:"from"`
+			To      int `json:"to"`
+			Changes []struct {
+				Path   string          `json:"path"`
+				Before json.RawMessage `json:"before"`
+				After  json.RawMessage `json:"after"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal(data, &diff); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		fmt.Printf("Flag %q: version %d → %d\n", args[0], diff.From, diff.To)
+		if len(diff.Changes) == 0 {
+			fmt.Println("  no changes")
+		}
+		for _, c := range diff.Changes {
+			printChange(c.Path, c.Before, c.After)
+		}
+		return nil
+	},
+}
+
+// printChange prints one diff entry as + (added), - (removed) or ~ (changed).
+func printChange(path string, before, after json.RawMessage) {
+	if path == "" {
+		path = "(whole resource)"
+	}
+	switch {
+	case len(before) == 0:
+		fmt.Printf("  + %s: %s\n", path, string(after))
+	case len(after) == 0:
+		fmt.Printf("  - %s: %s\n", path, string(before))
+	default:
+		fmt.Printf("  ~ %s: %s → %s\n", path, string(before), string(after))
+	}
+}
+
+// --- flag rollback ---
+
+var flagRollbackCmd = &cobra.Command{
+	Use:   "rollback <key> <version>",
+	Short: "Restore a flag to a previous version",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		data, status, err := doRequest("POST", "/api/v1/flags/"+args[0]+"/versions/"+args[1]+"/restore", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Flag %q restored to version %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+func init() {
+	flagDiffCmd.Flags().IntVar(&diffFrom, "from", 0, "Base version (default: the version before --to)")
+	flagDiffCmd.Flags().IntVar(&diffTo, "to", 0, "Target version (default: latest)")
+
+	flagCmd.AddCommand(flagHistoryCmd, flagDiffCmd, flagRollbackCmd)
+}
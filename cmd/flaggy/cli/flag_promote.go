@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	promoteFrom   string
+	promoteTo     string
+	promoteDryRun bool
+	promoteYes    bool
+)
+
+type promotion struct {
+	Key     string `json:"key"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Action  string `json:"action"`
+	Changes []struct {
+		Path   string          `json:"path"`
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	} `json:"changes"`
+	MissingSegments []string `json:"missing_segments"`
+	Applied         bool     `json:"applied"`
+}
+
+func postPromotion(key string, dryRun bool) (*promotion, error) {
+	q := url.Values{"from": {promoteFrom}}
+	if promoteTo != "" {
+		q.Set("to", promoteTo)
+	}
+	if dryRun {
+		q.Set("dry_run", "true")
+	}
+	data, status, err := doRequest("POST", "/api/v1/flags/"+key+"/promote?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("server error (%d): %s", status, string(data))
+	}
+	var p promotion
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return &p, nil
+}
+
+var flagPromoteCmd = &cobra.Command{
+	Use:   "promote <key> --from <env>",
+	Short: "Copy a flag's rules and default value from another environment",
+	Long: `Copy a flag's description, default value and rules from the server of
+another environment to this one, after showing the changes. The flag keeps
+its enabled state here; a flag new to this environment is created disabled.
+Segments aren't copied: the ones its rules reference must already exist.
+
+--server is the server of the target environment, which fetches the flag
+from the server configured for --from in its FLAGGY_PEER_URLS.
+
+  flaggy flag promote new_checkout --from staging --dry-run
+  flaggy flag promote new_checkout --from staging --to live`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if promoteFrom == "" {
+			return fmt.Errorf("--from is required")
+		}
+		plan, err := postPromotion(args[0], true)
+		if err != nil {
+			return err
+		}
+		if plan.Action == "" {
+			fmt.Printf("No changes. Flag %q in %s matches %s.\n", plan.Key, plan.To, plan.From)
+			return nil
+		}
+		fmt.Printf("Promote flag %q from %s to %s (%s):\n", plan.Key, plan.From, plan.To, plan.Action)
+		for _, c := range plan.Changes {
+			printChange(c.Path, c.Before, c.After)
+		}
+		if len(plan.MissingSegments) > 0 {
+			return fmt.Errorf("segments missing in %s: %s; create them first", plan.To, strings.Join(plan.MissingSegments, ", "))
+		}
+		if promoteDryRun {
+			return nil
+		}
+		if !promoteYes && !confirm("Promote?") {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+
+		if _, err := postPromotion(args[0], false); err != nil {
+			return err
+		}
+		fmt.Printf("Flag %q promoted from %s to %s\n", plan.Key, plan.From, plan.To)
+		return nil
+	},
+}
+
+func init() {
+	flagPromoteCmd.Flags().StringVar(&promoteFrom, "from", "", "Environment to copy the flag from (required)")
+	flagPromoteCmd.Flags().StringVar(&promoteTo, "to", "", "Environment to copy the flag to (default: the server's)")
+	flagPromoteCmd.Flags().BoolVar(&promoteDryRun, "dry-run", false, "Show the changes without making them")
+	flagPromoteCmd.Flags().BoolVarP(&promoteYes, "yes", "y", false, "Promote without asking for confirmation")
+
+	flagCmd.AddCommand(flagPromoteCmd)
+}
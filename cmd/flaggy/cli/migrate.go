@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/getflaggy/flaggy/internal/config"
+	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/migrations"
+)
+
+var (
+	migrateDB  string
+	migrateYes bool
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Inspect, apply and revert database migrations",
+	Long: `Inspect, apply and revert the database's schema migrations. flaggy serve
+applies pending migrations when it starts; up and down need it stopped.
+
+The database is FLAGGY_DB_PATH unless --db is given.`,
+}
+
+// openMigrator opens the database to migrate, which must exist.
+func openMigrator(exclusive bool) (*store.Migrator, error) {
+	dbPath := migrateDB
+	if dbPath == "" {
+		dbPath = config.Load().DBPath
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	return store.OpenMigrator(dbPath, migrations.FS, exclusive)
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := openMigrator(false)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		status, err := m.Status(context.Background())
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT\tDOWN")
+		for _, mig := range status {
+			state, appliedAt, down := "pending", "", "no"
+			switch {
+			case mig.Unknown:
+				state = "unknown" // Applied by a newer version
+			case mig.Modified:
+				state = "modified"
+			case mig.Applied:
+				state = "applied"
+			}
+			if mig.Applied {
+				appliedAt = mig.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if mig.Reversible {
+				down = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mig.Name, state, appliedAt, down)
+		}
+		return w.Flush()
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := openMigrator(true)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		applied, err := m.Up(context.Background())
+		for _, name := range applied {
+			fmt.Printf("Applied %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [n]",
+	Short: "Revert the last n applied migrations (default 1)",
+	Long: `Revert the last n applied migrations, newest first, with their down
+migrations. Data in the tables and columns they added is lost.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n := 1
+		if len(args) == 1 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+				return fmt.Errorf("n must be a positive integer")
+			}
+		}
+
+		m, err := openMigrator(true)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		if !migrateYes && !confirm(fmt.Sprintf("Revert the last %d migration(s)? Data they added is lost.", n)) {
+			return fmt.Errorf("migrate down canceled")
+		}
+		reverted, err := m.Down(context.Background(), n)
+		for _, name := range reverted {
+			fmt.Printf("Reverted %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+		return nil
+	},
+}
+
+func init() {
+	migrateCmd.PersistentFlags().StringVar(&migrateDB, "db", "", "Database to migrate (default FLAGGY_DB_PATH)")
+	migrateDownCmd.Flags().BoolVarP(&migrateYes, "yes", "y", false, "Revert without asking for confirmation")
+
+	migrateCmd.AddCommand(migrateStatusCmd, migrateUpCmd, migrateDownCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage per-environment write policies",
+}
+
+type environmentPolicy struct {
+	Environment       string `json:"environment"`
+	RequiredApprovals int    `json:"required_approvals"`
+	AllowDirectWrites bool   `json:"allow_direct_writes"`
+}
+
+func printPolicy(p *environmentPolicy) {
+	writes := "allowed"
+	if !p.AllowDirectWrites {
+		writes = "blocked (changes need a change request)"
+	}
+	fmt.Printf("Environment:        %s\n", p.Environment)
+	fmt.Printf("Required approvals: %d\n", p.RequiredApprovals)
+	fmt.Printf("Direct writes:      %s\n", writes)
+}
+
+func getPolicy(env string) (*environmentPolicy, error) {
+	data, status, err := doRequest("GET", "/api/v1/environments/"+env+"/policy", nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("server error (%d): %s", status, string(data))
+	}
+	var p environmentPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return &p, nil
+}
+
+// --- policy get ---
+
+var policyGetCmd = &cobra.Command{
+	Use:   "get <env>",
+	Short: "Show an environment's write policy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := getPolicy(args[0])
+		if err != nil {
+			return err
+		}
+		printPolicy(p)
+		return nil
+	},
+}
+
+// --- policy set ---
+
+var (
+	policyApprovals    int
+	policyDirectWrites bool
+)
+
+var policySetCmd = &cobra.Command{
+	Use:   "set <env>",
+	Short: "Update an environment's write policy",
+	Long: `Update an environment's write policy. Unset flags keep their current value.
+
+Example (four-eyes on live):
+  flaggy policy set live --approvals 1 --direct-writes=false`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := getPolicy(args[0])
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("approvals") {
+			p.RequiredApprovals = policyApprovals
+		}
+		if cmd.Flags().Changed("direct-writes") {
+			p.AllowDirectWrites = policyDirectWrites
+		}
+
+		data, status, err := doRequest("PUT", "/api/v1/environments/"+args[0]+"/policy", p)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		if err := json.Unmarshal(data, p); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		printPolicy(p)
+		return nil
+	},
+}
+
+func init() {
+	policySetCmd.Flags().IntVar(&policyApprovals, "approvals", 1, "Approvals a change request needs, from reviewers other than the proposer")
+	policySetCmd.Flags().BoolVar(&policyDirectWrites, "direct-writes", true, "Allow flag, rule and segment writes without a change request")
+
+	policyCmd.AddCommand(policyGetCmd, policySetCmd)
+	rootCmd.AddCommand(policyCmd)
+}
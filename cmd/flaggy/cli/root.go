@@ -10,6 +10,7 @@ import (
 var (
 	serverURL string
 	apiKey    string
+	actorName string
 	Version   = "dev"
 )
 
@@ -27,10 +28,14 @@ func init() {
 	}
 	defaultServer := "http://localhost" + port
 
-	defaultKey := os.Getenv("FLAGGY_MASTER_KEY")
+	defaultKey := os.Getenv("FLAGGY_TOKEN")
+	if defaultKey == "" {
+		defaultKey = os.Getenv("FLAGGY_MASTER_KEY")
+	}
 
 	rootCmd.PersistentFlags().StringVar(&serverURL, "server", defaultServer, "Flaggy server URL")
-	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", defaultKey, "API key or master key for authentication")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", defaultKey, "Master key, API key, personal token or JWT for authentication (env FLAGGY_TOKEN)")
+	rootCmd.PersistentFlags().StringVar(&actorName, "as", os.Getenv("FLAGGY_ACTOR"), "Your name, recorded in the audit log when using the master key")
 }
 
 func Execute() error {
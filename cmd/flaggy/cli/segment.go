@@ -18,28 +18,21 @@ var segmentCmd = &cobra.Command{
 
 var segmentListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all segments",
+	Short: "List segments",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		data, status, err := doRequest("GET", "/api/v1/segments", nil)
-		if err != nil {
-			return err
-		}
-		if status != 200 {
-			return fmt.Errorf("server error (%d): %s", status, string(data))
-		}
-
 		var segments []struct {
 			Key         string `json:"key"`
 			Description string `json:"description"`
+			Version     int    `json:"version"`
 		}
-		if err := json.Unmarshal(data, &segments); err != nil {
-			return fmt.Errorf("parse response: %w", err)
+		if err := listAll("/api/v1/segments", "segments", &segments); err != nil {
+			return err
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "KEY\tDESCRIPTION")
+		fmt.Fprintln(w, "KEY\tVERSION\tDESCRIPTION")
 		for _, s := range segments {
-			fmt.Fprintf(w, "%s\t%s\n", s.Key, s.Description)
+			fmt.Fprintf(w, "%s\t%d\t%s\n", s.Key, s.Version, s.Description)
 		}
 		w.Flush()
 		return nil
@@ -107,10 +100,13 @@ var segmentDeleteCmd = &cobra.Command{
 	Short: "Delete a segment",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		data, status, err := doRequest("DELETE", "/api/v1/segments/"+args[0], nil)
+		data, status, err := doRequestWithHeaders("DELETE", "/api/v1/segments/"+args[0], nil, ifMatchHeader(ifVersion))
 		if err != nil {
 			return err
 		}
+		if status == 412 {
+			return versionConflict("segment", args[0], ifVersion)
+		}
 		if status != 204 {
 			return fmt.Errorf("server error (%d): %s", status, string(data))
 		}
@@ -122,6 +118,9 @@ var segmentDeleteCmd = &cobra.Command{
 func init() {
 	segmentCreateCmd.Flags().StringVar(&segCreateDescription, "description", "", "Segment description")
 	segmentCreateCmd.Flags().StringVar(&segCreateConditions, "conditions", "[]", "Conditions as JSON array")
+	segmentDeleteCmd.Flags().IntVar(&ifVersion, "if-version", 0, "Only delete if the segment is still at this version (see 'segment get')")
+
+	addListFlags(segmentListCmd, "key, created_at or updated_at")
 
 	segmentCmd.AddCommand(segmentListCmd, segmentGetCmd, segmentCreateCmd, segmentDeleteCmd)
 	rootCmd.AddCommand(segmentCmd)
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -13,8 +14,14 @@ import (
 
 	"github.com/getflaggy/flaggy/internal/api"
 	"github.com/getflaggy/flaggy/internal/config"
+	"github.com/getflaggy/flaggy/internal/exposure"
+	"github.com/getflaggy/flaggy/internal/metrics"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/oidc"
+	"github.com/getflaggy/flaggy/internal/ratelimit"
 	"github.com/getflaggy/flaggy/internal/sse"
 	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/internal/webhook"
 	"github.com/getflaggy/flaggy/migrations"
 )
 
@@ -28,23 +35,122 @@ var serveCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := config.Load()
 
-		slog.Info("starting flaggy", "version", Version, "port", cfg.Port, "db", cfg.DBPath)
-
-		db, err := store.NewSQLiteStore(cfg.DBPath, migrations.FS)
-		if err != nil {
-			slog.Error("failed to open database", "error", err)
+		// An unset FLAGGY_ENVIRONMENT manages live without scoping streams
+		// to it, so keys of every environment get events.
+		env := models.Environment(cfg.Environment)
+		if env == "" {
+			env = models.EnvLive
+		}
+		if err := models.ValidateEnvironment(env); err != nil {
+			slog.Error("invalid FLAGGY_ENVIRONMENT", "error", err)
 			os.Exit(1)
 		}
-		defer db.Close()
+		slog.Info("starting flaggy", "version", Version, "port", cfg.Port, "db", cfg.DBPath, "environment", env)
+
+		// The file store serves flags read-only, without a database
+		var st store.Store
+		var db *store.SQLiteStore
+		if cfg.FlagsFile != "" {
+			fs, err := store.NewFileStore(cfg.FlagsFile)
+			if err != nil {
+				slog.Error("failed to load flags file", "error", err)
+				os.Exit(1)
+			}
+			watchCtx, stopWatch := context.WithCancel(context.Background())
+			defer stopWatch()
+			go fs.Watch(watchCtx, cfg.FlagsFilePoll)
+			slog.Info("serving flags read-only from file", "path", cfg.FlagsFile)
+			st = fs
+		} else {
+			var err error
+			db, err = store.NewSQLiteStore(cfg.DBPath, migrations.FS, store.SQLiteOptions{
+				QueryTimeout: cfg.DBTimeout,
+				Environment:  env,
+			})
+			if err != nil {
+				slog.Error("failed to open database", "error", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+			st = db
+		}
 
 		broadcaster := sse.NewBroadcaster()
 		defer broadcaster.Close()
 
+		if db != nil && cfg.EventRetention > 0 {
+			stop := make(chan struct{})
+			defer close(stop)
+			go pruneEvents(db, cfg.EventRetention, stop)
+		}
+
+		if db != nil && cfg.Backups.Dir != "" {
+			stop := make(chan struct{})
+			defer close(stop)
+			go runBackups(db, cfg.Backups, stop)
+			slog.Info("scheduled backups enabled", "dir", cfg.Backups.Dir, "interval", cfg.Backups.Interval.String(), "keep", cfg.Backups.Keep)
+		}
+
 		if cfg.MasterKey == "" {
 			slog.Warn("FLAGGY_MASTER_KEY not set — auth disabled (dev mode)")
 		}
 
-		router := api.NewRouter(db, broadcaster, cfg.MasterKey, cfg.CORSEnabled)
+		var m *metrics.Metrics
+		if cfg.MetricsEnabled {
+			m = metrics.New()
+			m.RegisterSSE(broadcaster.ClientCount, broadcaster.Dropped)
+			if db != nil {
+				db.SetQueryObserver(m.ObserveQuery)
+			}
+		}
+
+		exposures, err := newExposurePipeline(cfg.Exposure)
+		if err != nil {
+			slog.Error("failed to start exposure pipeline", "error", err)
+			os.Exit(1)
+		}
+		if exposures != nil {
+			defer exposures.Close()
+			if m != nil {
+				m.RegisterExposures(exposures.Dropped, exposures.Duplicates, exposures.SinkErrors)
+			}
+		}
+
+		jwt, err := newJWTVerifier(cfg.OIDC)
+		if err != nil {
+			slog.Error("failed to set up OIDC authentication", "error", err)
+			os.Exit(1)
+		}
+
+		keyUsage := api.NewKeyUsage(st, cfg.APIKeys.UsageFlush)
+		defer keyUsage.Close()
+
+		var dispatcher *webhook.Dispatcher
+		if db != nil {
+			dispatcher = webhook.New(db, webhook.Options{
+				MaxAttempts: cfg.Webhooks.MaxAttempts,
+				RetryBase:   cfg.Webhooks.RetryBase,
+				Timeout:     cfg.Webhooks.Timeout,
+			})
+			defer dispatcher.Close()
+		}
+
+		router := api.NewRouter(api.Options{
+			Store:         st,
+			Broadcaster:   broadcaster,
+			Metrics:       m,
+			MetricsPublic: cfg.MetricsPublic,
+			Exposures:     exposures,
+			MasterKey:     cfg.MasterKey,
+			CORSEnabled:   cfg.CORSEnabled,
+			Environment:   models.Environment(cfg.Environment),
+			KeyUsage:      keyUsage,
+			RotationGrace: cfg.APIKeys.RotationGrace,
+			RateLimit:     ratelimit.Limit{Rate: cfg.APIKeys.RateLimit, Burst: cfg.APIKeys.RateBurst},
+			JWT:           jwt,
+			Webhooks:      dispatcher,
+			Peers:         peers(cfg.Peers),
+		})
 
 		srv := &http.Server{
 			Addr:        cfg.Port,
@@ -79,3 +185,107 @@ var serveCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// peers returns the servers of the other environments, which flags are
+// promoted from.
+func peers(cfg config.PeerConfig) map[models.Environment]api.Peer {
+	out := make(map[models.Environment]api.Peer, len(cfg.URLs))
+	for env, url := range cfg.URLs {
+		out[models.Environment(env)] = api.Peer{URL: url, Token: cfg.Tokens[env]}
+	}
+	return out
+}
+
+// newJWTVerifier builds the admin JWT verifier from config.
+// Returns nil if no JWKS source is configured.
+func newJWTVerifier(cfg config.OIDCConfig) (*oidc.Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var keys oidc.KeySource
+	var err error
+	if cfg.JWKSFile != "" {
+		keys, err = oidc.NewFileSource(cfg.JWKSFile)
+	} else {
+		keys, err = oidc.NewURLSource(cfg.JWKSURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	roleMap := make(map[string]models.Role, len(cfg.RoleMap))
+	for value, role := range cfg.RoleMap {
+		roleMap[value] = models.Role(role)
+	}
+	v, err := oidc.NewVerifier(oidc.Config{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		NameClaim:   cfg.NameClaim,
+		RoleClaim:   cfg.RoleClaim,
+		RoleMap:     roleMap,
+		DefaultRole: models.Role(cfg.DefaultRole),
+	}, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("OIDC authentication enabled", "issuer", cfg.Issuer, "audience", cfg.Audience)
+	return v, nil
+}
+
+// newExposurePipeline builds the exposure pipeline from config.
+// Returns nil if no sinks are configured.
+func newExposurePipeline(cfg config.ExposureConfig) (*exposure.Pipeline, error) {
+	if len(cfg.Sinks) == 0 {
+		return nil, nil
+	}
+
+	var sinks []exposure.Sink
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, exposure.NewStdoutSink())
+		case "file":
+			fs, err := exposure.NewFileSink(cfg.FilePath, cfg.FileMaxBytes, cfg.FileMaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, fs)
+		case "webhook":
+			if cfg.WebhookURL == "" {
+				return nil, fmt.Errorf("webhook sink requires FLAGGY_EXPOSURE_WEBHOOK_URL")
+			}
+			sinks = append(sinks, exposure.NewWebhookSink(cfg.WebhookURL))
+		default:
+			return nil, fmt.Errorf("unknown exposure sink %q", name)
+		}
+	}
+
+	slog.Info("exposure pipeline enabled", "sinks", cfg.Sinks, "dedup_window", cfg.DedupWindow.String())
+	return exposure.NewPipeline(exposure.Options{
+		BufferSize:  cfg.BufferSize,
+		DedupWindow: cfg.DedupWindow,
+		Attributes:  cfg.Attributes,
+	}, sinks...), nil
+}
+
+// pruneEvents deletes change events older than retention, on start and then
+// hourly (or every retention, if shorter), until stop is closed.
+func pruneEvents(log store.EventLog, retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(min(retention, time.Hour))
+	defer ticker.Stop()
+	for {
+		n, err := log.PruneEvents(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			slog.Warn("failed to prune events", "error", err)
+		} else if n > 0 {
+			slog.Info("pruned events", "count", n)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
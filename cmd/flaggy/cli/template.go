@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage templates that new flags are created from",
+	Long: `Manage flag templates. A template gives a flag's type, default value and
+rules; the default value and rule values may be placeholders, strings of
+the form "{{name}}", filled in when a flag is created from the template:
+
+  flaggy flag create checkout_copy --from-template staged_variant --set variant=short
+
+A template file is YAML or JSON. Placeholders must be quoted in YAML:
+
+  description: A variant for internal users, then 10% of pro users
+  type: string
+  default_value: control
+  rules:
+    - description: Internal users
+      segment_keys: [internal]
+      value: "{{variant}}"
+    - description: Pro users
+      conditions:
+        - attribute: plan
+          operator: equals
+          value: pro
+      rollout_percentage: 10
+      value: "{{variant}}"
+  defaults:
+    variant: treatment`,
+}
+
+func templatePath(name string) string {
+	return "/api/v1/templates/" + url.PathEscape(name)
+}
+
+// --- template list ---
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List templates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/templates", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var templates []struct {
+			Name        string            `json:"name"`
+			Type        string            `json:"type"`
+			Description string            `json:"description"`
+			Rules       []json.RawMessage `json:"rules"`
+		}
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tRULES\tDESCRIPTION")
+		for _, t := range templates {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", t.Name, t.Type, len(t.Rules), t.Description)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- template get ---
+
+var templateGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Get a template by name",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", templatePath(args[0]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Println(prettyJSON(data))
+		return nil
+	},
+}
+
+// --- template create / update ---
+
+var templateFile string
+
+// readTemplateFile reads a template file and names the template.
+func readTemplateFile(name string) (map[string]json.RawMessage, error) {
+	if templateFile == "" {
+		return nil, fmt.Errorf("--file is required")
+	}
+	data, err := readConfigFile(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	var t map[string]json.RawMessage
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%s: a template must be an object", templateFile)
+	}
+	t["name"], _ = json.Marshal(name)
+	return t, nil
+}
+
+var templateCreateCmd = &cobra.Command{
+	Use:   "create <name> --file <file>",
+	Short: "Create a template from a YAML or JSON file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := readTemplateFile(args[0])
+		if err != nil {
+			return err
+		}
+		data, status, err := doRequest("POST", "/api/v1/templates", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Template %q created\n", args[0])
+		return nil
+	},
+}
+
+var templateUpdateCmd = &cobra.Command{
+	Use:   "update <name> --file <file>",
+	Short: "Replace a template; flags already made from it don't change",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := readTemplateFile(args[0])
+		if err != nil {
+			return err
+		}
+		data, status, err := doRequest("PUT", templatePath(args[0]), body)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Template %q updated\n", args[0])
+		return nil
+	},
+}
+
+// --- template delete ---
+
+var templateDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("DELETE", templatePath(args[0]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 204 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Template %q deleted\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{templateCreateCmd, templateUpdateCmd} {
+		c.Flags().StringVarP(&templateFile, "file", "f", "", "Template file (YAML or JSON; - for stdin)")
+	}
+
+	templateCmd.AddCommand(templateListCmd, templateGetCmd, templateCreateCmd, templateUpdateCmd, templateDeleteCmd)
+	rootCmd.AddCommand(templateCmd)
+}
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage admin users, service accounts and their tokens",
+}
+
+type user struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+func userPath(idOrName string) string {
+	return "/api/v1/users/" + url.PathEscape(idOrName)
+}
+
+// --- whoami ---
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show who the server thinks you are",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/me", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var me struct {
+			Actor struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			} `json:"actor"`
+			Role   string   `json:"role"`
+			Scopes []string `json:"scopes"`
+		}
+		if err := json.Unmarshal(data, &me); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		if len(me.Scopes) > 0 {
+			fmt.Printf("%s:%s (scopes: %s)\n", me.Actor.Type, me.Actor.ID, strings.Join(me.Scopes, ", "))
+			return nil
+		}
+		fmt.Printf("%s:%s (%s)\n", me.Actor.Type, me.Actor.ID, me.Role)
+		return nil
+	},
+}
+
+// --- user list ---
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users and service accounts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/users", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var users []user
+		if err := json.Unmarshal(data, &users); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tKIND\tROLE\tDISABLED")
+		for _, u := range users {
+			disabled := "no"
+			if u.Disabled {
+				disabled = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.ID, u.Name, u.Kind, u.Role, disabled)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- user create ---
+
+var (
+	userRole    string
+	userService bool
+)
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a user (or a service account with --service)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kind := "user"
+		if userService {
+			kind = "service"
+		}
+		body := map[string]string{"name": args[0], "kind": kind, "role": userRole}
+
+		data, status, err := doRequest("POST", "/api/v1/users", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var u user
+		if err := json.Unmarshal(data, &u); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		fmt.Printf("Created %s %q (%s) with role %s\n", u.Kind, u.Name, u.ID, u.Role)
+		fmt.Printf("Create a token with: flaggy user token create %s\n", u.Name)
+		return nil
+	},
+}
+
+// --- user update ---
+
+var userDisable bool
+
+var userUpdateCmd = &cobra.Command{
+	Use:   "update <user>",
+	Short: "Change a user's role or disable/enable them",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{}
+		if cmd.Flags().Changed("role") {
+			body["role"] = userRole
+		}
+		if cmd.Flags().Changed("disabled") {
+			body["disabled"] = userDisable
+		}
+		if len(body) == 0 {
+			return fmt.Errorf("nothing to update: pass --role and/or --disabled")
+		}
+
+		data, status, err := doRequest("PATCH", userPath(args[0]), body)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		var u user
+		if err := json.Unmarshal(data, &u); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		fmt.Printf("User %q: role %s, disabled %t\n", u.Name, u.Role, u.Disabled)
+		return nil
+	},
+}
+
+// --- user delete ---
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <user>",
+	Short: "Delete a user and all of their tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("DELETE", userPath(args[0]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 204 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("User %q deleted\n", args[0])
+		return nil
+	},
+}
+
+// --- user token ---
+
+var userTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage a user's personal tokens",
+}
+
+var userTokenName string
+
+var userTokenCreateCmd = &cobra.Command{
+	Use:   "create <user>",
+	Short: "Create a personal token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]string{"name": userTokenName}
+		data, status, err := doRequest("POST", userPath(args[0])+"/tokens", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var result struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		fmt.Printf("Token created:\n")
+		fmt.Printf("  ID:    %s\n", result.ID)
+		fmt.Printf("  Name:  %s\n", result.Name)
+		fmt.Printf("  Token: %s\n", result.Token)
+		fmt.Printf("\nSave this token now — it won't be shown again. Use it with --api-key.\n")
+		return nil
+	},
+}
+
+var userTokenListCmd = &cobra.Command{
+	Use:   "list <user>",
+	Short: "List a user's tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", userPath(args[0])+"/tokens", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var tokens []struct {
+			ID         string  `json:"id"`
+			Name       string  `json:"name"`
+			Prefix     string  `json:"prefix"`
+			Revoked    bool    `json:"revoked"`
+			LastUsedAt *string `json:"last_used_at"`
+		}
+		if err := json.Unmarshal(data, &tokens); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tREVOKED\tLAST USED")
+		for _, t := range tokens {
+			revoked := "no"
+			if t.Revoked {
+				revoked = "yes"
+			}
+			lastUsed := "never"
+			if t.LastUsedAt != nil {
+				lastUsed = *t.LastUsedAt
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Prefix, revoked, lastUsed)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var userTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <user> <token-id>",
+	Short: "Revoke a personal token",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("DELETE", userPath(args[0])+"/tokens/"+url.PathEscape(args[1]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 204 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Token %q revoked\n", args[1])
+		return nil
+	},
+}
+
+func init() {
+	userCreateCmd.Flags().StringVar(&userRole, "role", "viewer", "Role (viewer, editor, key-manager, admin)")
+	userCreateCmd.Flags().BoolVar(&userService, "service", false, "Create a service account instead of a user")
+	userUpdateCmd.Flags().StringVar(&userRole, "role", "", "New role (viewer, editor, key-manager, admin)")
+	userUpdateCmd.Flags().BoolVar(&userDisable, "disabled", false, "Disable (true) or re-enable (false) the user")
+	userTokenCreateCmd.Flags().StringVar(&userTokenName, "name", "", "Token name, e.g. the machine or CI job using it")
+
+	userTokenCmd.AddCommand(userTokenCreateCmd, userTokenListCmd, userTokenRevokeCmd)
+	userCmd.AddCommand(userListCmd, userCreateCmd, userUpdateCmd, userDeleteCmd, userTokenCmd)
+	rootCmd.AddCommand(userCmd, whoamiCmd)
+}
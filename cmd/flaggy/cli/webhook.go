@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage webhooks that receive flag and segment changes",
+}
+
+type webhookDelivery struct {
+	ID            int64      `json:"id"`
+	EventID       string     `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	AttemptLog    []struct {
+		Attempt    int       `json:"attempt"`
+		StatusCode int       `json:"status_code"`
+		Error      string    `json:"error"`
+		DurationMS int64     `json:"duration_ms"`
+		CreatedAt  time.Time `json:"created_at"`
+	} `json:"attempt_log"`
+}
+
+func webhookPath(id string) string {
+	return "/api/v1/webhooks/" + url.PathEscape(id)
+}
+
+// --- webhook list ---
+
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhooks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", "/api/v1/webhooks", nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var hooks []struct {
+			ID        string    `json:"id"`
+			URL       string    `json:"url"`
+			Events    []string  `json:"events"`
+			CreatedAt time.Time `json:"created_at"`
+		}
+		if err := json.Unmarshal(data, &hooks); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tURL\tEVENTS\tCREATED")
+		for _, h := range hooks {
+			events := "all"
+			if len(h.Events) > 0 {
+				events = strings.Join(h.Events, ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.ID, h.URL, events, h.CreatedAt.Local().Format(time.RFC3339))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- webhook create ---
+
+var (
+	webhookEvents []string
+	webhookSecret string
+)
+
+var webhookCreateCmd = &cobra.Command{
+	Use:   "create <url>",
+	Short: "Register a webhook endpoint",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body := map[string]interface{}{"url": args[0]}
+		if len(webhookEvents) > 0 {
+			body["events"] = webhookEvents
+		}
+		if webhookSecret != "" {
+			body["secret"] = webhookSecret
+		}
+
+		data, status, err := doRequest("POST", "/api/v1/webhooks", body)
+		if err != nil {
+			return err
+		}
+		if status != 201 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var result struct {
+			ID     string   `json:"id"`
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Secret string   `json:"secret"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		events := "all"
+		if len(result.Events) > 0 {
+			events = strings.Join(result.Events, ", ")
+		}
+
+		fmt.Printf("Webhook created:\n")
+		fmt.Printf("  ID:     %s\n", result.ID)
+		fmt.Printf("  URL:    %s\n", result.URL)
+		fmt.Printf("  Events: %s\n", events)
+		fmt.Printf("  Secret: %s\n", result.Secret)
+		fmt.Printf("\nSave the secret now — it won't be shown again.\n")
+		return nil
+	},
+}
+
+// --- webhook delete ---
+
+var webhookDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a webhook and its delivery history",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("DELETE", webhookPath(args[0]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 204 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Webhook %q deleted\n", args[0])
+		return nil
+	},
+}
+
+// --- webhook deliveries ---
+
+var webhookDeliveryStatus string
+
+var webhookDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries <id>",
+	Short: "List a webhook's recent deliveries",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := webhookPath(args[0]) + "/deliveries"
+		if webhookDeliveryStatus != "" {
+			path += "?status=" + url.QueryEscape(webhookDeliveryStatus)
+		}
+		data, status, err := doRequest("GET", path, nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var deliveries []webhookDelivery
+		if err := json.Unmarshal(data, &deliveries); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEVENT\tSTATUS\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		for _, d := range deliveries {
+			next := "-"
+			if d.NextAttemptAt != nil {
+				next = d.NextAttemptAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", d.ID, d.EventType, d.Status, d.Attempts, next, d.LastError)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- webhook delivery ---
+
+var webhookDeliveryCmd = &cobra.Command{
+	Use:   "delivery <id> <delivery-id>",
+	Short: "Show a delivery and its attempts",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("GET", webhookPath(args[0])+"/deliveries/"+url.PathEscape(args[1]), nil)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+
+		var d webhookDelivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+		fmt.Printf("Delivery %d: %s (event %s), %s after %d attempt(s)\n", d.ID, d.EventType, d.EventID, d.Status, d.Attempts)
+		if d.NextAttemptAt != nil {
+			fmt.Printf("Next attempt: %s\n", d.NextAttemptAt.Local().Format(time.RFC3339))
+		}
+		if len(d.AttemptLog) == 0 {
+			return nil
+		}
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ATTEMPT\tTIME\tSTATUS\tDURATION\tERROR")
+		for _, a := range d.AttemptLog {
+			code := "-"
+			if a.StatusCode != 0 {
+				code = fmt.Sprintf("%d", a.StatusCode)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%dms\t%s\n", a.Attempt, a.CreatedAt.Local().Format(time.RFC3339),
+				code, a.DurationMS, a.Error)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// --- webhook redeliver ---
+
+var webhookRedeliverCmd = &cobra.Command{
+	Use:   "redeliver <id> <delivery-id>",
+	Short: "Send a delivery again, whatever its status",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, status, err := doRequest("POST", webhookPath(args[0])+"/deliveries/"+url.PathEscape(args[1])+"/redeliver", nil)
+		if err != nil {
+			return err
+		}
+		if status != 202 {
+			return fmt.Errorf("server error (%d): %s", status, string(data))
+		}
+		fmt.Printf("Delivery %s queued for redelivery\n", args[1])
+		return nil
+	},
+}
+
+func init() {
+	webhookCreateCmd.Flags().StringSliceVar(&webhookEvents, "event", nil,
+		"Event types to send, e.g. flag_updated; repeat or comma-separate (default all)")
+	webhookCreateCmd.Flags().StringVar(&webhookSecret, "secret", "", "Signing secret, at least 16 characters (default generated)")
+	webhookDeliveriesCmd.Flags().StringVar(&webhookDeliveryStatus, "status", "", "Only show pending, delivered or dead deliveries")
+
+	webhookCmd.AddCommand(webhookListCmd, webhookCreateCmd, webhookDeleteCmd,
+		webhookDeliveriesCmd, webhookDeliveryCmd, webhookRedeliverCmd)
+	rootCmd.AddCommand(webhookCmd)
+}
@@ -0,0 +1,212 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/migrations"
+)
+
+const testMasterKey = "test-master-key"
+
+// testServer is a router over a SQLite store, served by httptest.
+type testServer struct {
+	*httptest.Server
+	store *store.SQLiteStore
+}
+
+// newTestStore opens a SQLite store in a temporary directory.
+func newTestStore(t *testing.T, env models.Environment) *store.SQLiteStore {
+	t.Helper()
+	if env == "" {
+		env = models.EnvLive // as serve does
+	}
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "flaggy.db"), migrations.FS, store.SQLiteOptions{Environment: env})
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// newTestServer serves a router built from opts. The store, broadcaster and
+// master key are filled in unless opts sets them; a store set must be a
+// *store.SQLiteStore.
+func newTestServer(t *testing.T, opts api.Options) *testServer {
+	t.Helper()
+	if opts.Store == nil {
+		opts.Store = newTestStore(t, opts.Environment)
+	}
+	if opts.Broadcaster == nil {
+		opts.Broadcaster = sse.NewBroadcaster()
+	}
+	if opts.MasterKey == "" {
+		opts.MasterKey = testMasterKey
+	}
+	srv := httptest.NewServer(api.NewRouter(opts))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, store: opts.Store.(*store.SQLiteStore)}
+}
+
+// do sends a request authenticated with token, if set. body is encoded as
+// JSON unless it is nil.
+func (s *testServer) do(t *testing.T, method, path, token string, body any) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(t.Context(), method, s.URL+path, r)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// expectStatus sends a request and checks its response status.
+func (s *testServer) expectStatus(t *testing.T, want int, method, path, token string, body any) *http.Response {
+	t.Helper()
+	resp := s.do(t, method, path, token, body)
+	if resp.StatusCode != want {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: got %d, want %d: %s", method, path, resp.StatusCode, want, data)
+	}
+	return resp
+}
+
+// createKey adds an API key to the store and returns the raw key.
+func (s *testServer) createKey(t *testing.T, env models.Environment, scopes ...models.Scope) (*models.APIKey, string) {
+	t.Helper()
+	if scopes == nil {
+		scopes = models.DefaultScopes
+	}
+	k, hashed := models.GenerateAPIKey("test", env, scopes)
+	require.NoError(t, s.store.CreateAPIKey(t.Context(), models.ActorMasterKey, &k.APIKey, hashed))
+	return &k.APIKey, k.RawKey
+}
+
+// createUser adds a user with role to the store and returns a token for it.
+func (s *testServer) createUser(t *testing.T, name string, role models.Role) string {
+	t.Helper()
+	user := &models.User{ID: models.GenerateUserID(), Name: name, Kind: models.UserKindUser, Role: role}
+	require.NoError(t, s.store.CreateUser(t.Context(), models.ActorMasterKey, user))
+	token, hashed := models.GenerateUserToken(user.ID, "test")
+	require.NoError(t, s.store.CreateUserToken(t.Context(), models.ActorMasterKey, &token.UserToken, hashed))
+	return token.RawToken
+}
+
+// createFlag creates a boolean flag through the store.
+func (s *testServer) createFlag(t *testing.T, key string) {
+	t.Helper()
+	flag := &models.Flag{Key: key, Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	require.NoError(t, s.store.CreateFlag(t.Context(), models.ActorMasterKey, flag))
+}
+
+func decodeBody[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	return v
+}
+
+// sseEvent is one server-sent event read by an sseReader.
+type sseEvent struct {
+	ID, Event, Data string
+}
+
+// sseReader reads server-sent events from a response on a goroutine, so
+// tests can wait for them with a timeout.
+type sseReader struct {
+	events chan sseEvent
+}
+
+func newSSEReader(resp *http.Response) *sseReader {
+	r := &sseReader{events: make(chan sseEvent, 64)}
+	go func() {
+		defer close(r.events)
+		var e sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if e.Event != "" || e.Data != "" {
+					r.events <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return r
+}
+
+// next returns the next event, failing the test if none comes in time.
+func (r *sseReader) next(t *testing.T) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-r.events:
+		require.True(t, ok, "stream closed")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event within 5s")
+		return sseEvent{}
+	}
+}
+
+// none checks that no event arrives within d.
+func (r *sseReader) none(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case e, ok := <-r.events:
+		if ok {
+			t.Fatalf("unexpected event %s: %s", e.Event, e.Data)
+		}
+	case <-time.After(d):
+	}
+}
+
+// openStream starts a GET request for a streaming route and returns the
+// response, canceled when the test ends.
+func (s *testServer) openStream(t *testing.T, path, token string, header http.Header) *http.Response {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
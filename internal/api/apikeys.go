@@ -1,16 +1,23 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
 )
 
 type createAPIKeyRequest struct {
-	Name        string            `json:"name"`
+	Name        string             `json:"name"`
 	Environment models.Environment `json:"environment"`
+	Scopes      []models.Scope     `json:"scopes"`
+	ExpiresAt   *time.Time         `json:"expires_at"`
+	RateLimit   float64            `json:"rate_limit"`
+	RateBurst   int                `json:"rate_burst"`
 }
 
 func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
@@ -29,10 +36,32 @@ func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	keyWithRaw, hashedKey := models.GenerateAPIKey(req.Name, req.Environment)
+	if req.Scopes == nil {
+		req.Scopes = models.DefaultScopes
+	}
+	if err := models.ValidateScopes(req.Scopes); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := models.ValidateRateLimit(req.RateLimit, req.RateBurst); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	keyWithRaw, hashedKey := models.GenerateAPIKey(req.Name, req.Environment, req.Scopes)
+	if req.ExpiresAt != nil {
+		expires := req.ExpiresAt.UTC()
+		keyWithRaw.ExpiresAt = &expires
+	}
+	keyWithRaw.RateLimit, keyWithRaw.RateBurst = req.RateLimit, req.RateBurst
 
-	if err := s.store.CreateAPIKey(&keyWithRaw.APIKey, hashedKey); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	if err := s.store.CreateAPIKey(r.Context(), actorFrom(r), &keyWithRaw.APIKey, hashedKey); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -40,22 +69,151 @@ func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, keyWithRaw)
 }
 
+// ListAPIKeys returns API keys, newest first unless sort says otherwise.
+// q searches names and IDs. Paging works as for ListFlags.
 func (s *Server) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
-	keys, err := s.store.ListAPIKeys()
+	opts, paged, ok := parseListOptions(w, r, models.APIKeySorts)
+	if !ok {
+		return
+	}
+	keys, info, err := s.store.ListAPIKeys(r.Context(), opts)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondListError(w, err)
 		return
 	}
 	if keys == nil {
 		keys = []models.APIKey{}
 	}
+	if paged {
+		respondJSON(w, http.StatusOK, apiKeyPage{Keys: keys, PageInfo: info})
+		return
+	}
 	respondJSON(w, http.StatusOK, keys)
 }
 
+type rotateAPIKeyRequest struct {
+	// GracePeriod is how long the old key keeps working, as a Go duration
+	// ("0s" to stop it immediately). Defaults to the server's setting.
+	GracePeriod string `json:"grace_period"`
+}
+
+type rotateAPIKeyResponse struct {
+	*models.APIKeyWithRaw
+	Previous *models.APIKey `json:"previous"`
+}
+
+type updateAPIKeyRequest struct {
+	RateLimit *float64 `json:"rate_limit"`
+	RateBurst *int     `json:"rate_burst"`
+}
+
+// UpdateAPIKey changes a key's rate limit. Omitted fields are kept.
+func (s *Server) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req updateAPIKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	key, err := s.store.GetAPIKey(r.Context(), id)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if key == nil {
+		respondError(w, http.StatusNotFound, store.ErrAPIKeyNotFound.Error())
+		return
+	}
+	rate, burst := key.RateLimit, key.RateBurst
+	if req.RateLimit != nil {
+		rate = *req.RateLimit
+	}
+	if req.RateBurst != nil {
+		burst = *req.RateBurst
+	}
+	if rate == 0 {
+		burst = 0
+	}
+	if err := models.ValidateRateLimit(rate, burst); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := s.store.SetAPIKeyRateLimit(r.Context(), actorFrom(r), id, rate, burst)
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// RotateAPIKey issues a successor with the same name, environment, scopes
+// and rate limit.
+// A key with an expiry passes its lifetime on to the successor.
+func (s *Server) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req rotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+	grace := s.rotationGrace
+	if req.GracePeriod != "" {
+		d, err := time.ParseDuration(req.GracePeriod)
+		if err != nil || d < 0 {
+			respondError(w, http.StatusBadRequest, "grace_period must be a non-negative duration such as 24h")
+			return
+		}
+		grace = d
+	}
+
+	old, err := s.store.GetAPIKey(r.Context(), id)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if old == nil {
+		respondError(w, http.StatusNotFound, store.ErrAPIKeyNotFound.Error())
+		return
+	}
+
+	successor, hashedKey := models.GenerateAPIKey(old.Name, old.Environment, old.Scopes)
+	successor.RateLimit, successor.RateBurst = old.RateLimit, old.RateBurst
+	if old.ExpiresAt != nil {
+		expires := successor.CreatedAt.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		successor.ExpiresAt = &expires
+	}
+
+	previous, err := s.store.RotateAPIKey(r.Context(), actorFrom(r), id, &successor.APIKey, hashedKey, time.Now().Add(grace))
+	switch {
+	case errors.Is(err, store.ErrAPIKeyNotFound):
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, store.ErrAPIKeyInactive):
+		respondStoreError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Return the raw key — shown only this once
+	respondJSON(w, http.StatusCreated, rotateAPIKeyResponse{APIKeyWithRaw: successor, Previous: previous})
+}
+
 func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.store.RevokeAPIKey(id); err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+	if err := s.store.RevokeAPIKey(r.Context(), actorFrom(r), id); err != nil {
+		respondStoreError(w, http.StatusNotFound, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var allScopes = []models.Scope{models.ScopeEvaluate, models.ScopeStream, models.ScopeReadFlags, models.ScopeReadSegments}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	s.createFlag(t, "checkout")
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+
+	routes := []struct {
+		scope        models.Scope
+		method, path string
+		body         any
+	}{
+		{models.ScopeEvaluate, http.MethodPost, "/api/v1/evaluate", evaluate},
+		{models.ScopeEvaluate, http.MethodPost, "/api/v1/evaluate/batch", models.BatchEvaluateRequest{Flags: []string{"checkout"}}},
+		{models.ScopeReadFlags, http.MethodGet, "/api/v1/flags", nil},
+		{models.ScopeReadFlags, http.MethodGet, "/api/v1/flags/checkout", nil},
+		{models.ScopeReadSegments, http.MethodGet, "/api/v1/segments", nil},
+	}
+	for _, rt := range routes {
+		for _, scope := range allScopes {
+			_, key := s.createKey(t, models.EnvLive, scope)
+			want := http.StatusForbidden
+			if scope == rt.scope {
+				want = http.StatusOK
+			}
+			s.expectStatus(t, want, rt.method, rt.path, key, rt.body)
+		}
+	}
+
+	// The stream needs its scope before it starts
+	_, key := s.createKey(t, models.EnvLive, models.ScopeEvaluate)
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/stream", key, nil)
+
+	// Routes without a scope refuse every key
+	_, key = s.createKey(t, models.EnvLive, allScopes...)
+	s.expectStatus(t, http.StatusForbidden, http.MethodPut, "/api/v1/flags/checkout", key, models.UpdateFlagRequest{})
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/audit", key, nil)
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/api-keys", key, nil)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	s.createFlag(t, "checkout")
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+
+	k, hashed := models.GenerateAPIKey("expired", models.EnvLive, models.DefaultScopes)
+	past := time.Now().Add(-time.Minute)
+	k.ExpiresAt = &past
+	require.NoError(t, s.store.CreateAPIKey(t.Context(), models.ActorMasterKey, &k.APIKey, hashed))
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodPost, "/api/v1/evaluate", k.RawKey, evaluate)
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodGet, "/api/v1/stream", k.RawKey, nil)
+
+	s.expectStatus(t, http.StatusBadRequest, http.MethodPost, "/api/v1/api-keys", testMasterKey,
+		map[string]any{"name": "late", "environment": "live", "expires_at": past})
+}
+
+func TestAPIKeyRotationGrace(t *testing.T) {
+	s := newTestServer(t, api.Options{RotationGrace: time.Hour})
+	s.createFlag(t, "checkout")
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+	rotate := func(id string, body any) string {
+		t.Helper()
+		resp := s.expectStatus(t, http.StatusCreated, http.MethodPost, "/api/v1/api-keys/"+id+"/rotate", testMasterKey, body)
+		return decodeBody[models.APIKeyWithRaw](t, resp).RawKey
+	}
+
+	// Within the default grace period both keys work
+	old, oldKey := s.createKey(t, models.EnvLive)
+	newKey := rotate(old.ID, nil)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", oldKey, evaluate)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", newKey, evaluate)
+
+	// Without one the old key stops working at once
+	old, oldKey = s.createKey(t, models.EnvLive)
+	newKey = rotate(old.ID, map[string]string{"grace_period": "0s"})
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodPost, "/api/v1/evaluate", oldKey, evaluate)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", newKey, evaluate)
+
+	// A rotated key can't be rotated again
+	s.expectStatus(t, http.StatusConflict, http.MethodPost, "/api/v1/api-keys/"+old.ID+"/rotate", testMasterKey, nil)
+}
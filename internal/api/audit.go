@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type auditPage struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// ListAudit returns audit entries, newest first.
+// Filters: actor_type, actor_id, action, resource_type, resource_key, since, until (RFC 3339).
+// Pagination: limit (default 50, max 500) and cursor (next_cursor from the previous page).
+func (s *Server) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := models.AuditFilter{
+		ActorType:    q.Get("actor_type"),
+		ActorID:      q.Get("actor_id"),
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceKey:  q.Get("resource_key"),
+		Limit:        defaultAuditLimit,
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			respondError(w, http.StatusBadRequest, "until must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		if f.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil || f.Cursor <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if f.Limit > maxAuditLimit {
+			f.Limit = maxAuditLimit
+		}
+	}
+
+	entries, err := s.audit.ListAuditEntries(r.Context(), f)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := auditPage{Entries: entries}
+	if page.Entries == nil {
+		page.Entries = []models.AuditEntry{}
+	}
+	if len(entries) == f.Limit {
+		page.NextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	respondJSON(w, http.StatusOK, page)
+}
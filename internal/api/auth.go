@@ -1,40 +1,199 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/getflaggy/flaggy/internal/metrics"
 	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/oidc"
 )
 
-// RequireMasterKey returns a middleware that requires the master key for admin routes.
-// If masterKey is empty, auth is disabled (dev mode).
-func RequireMasterKey(masterKey string) func(http.Handler) http.Handler {
+// ActorHeader names the person behind a shared master key. It is recorded as
+// the actor ID in the audit log. It is self-asserted: anyone holding the
+// master key can set it, so it doesn't qualify the caller to review change
+// requests. User tokens carry their own identity and ignore it.
+const ActorHeader = "X-Flaggy-Actor"
+
+// RequireAdmin returns a middleware that authenticates admin routes. It
+// accepts the master key (a superuser), a user's personal token if users is
+// non-nil, a JWT from the identity provider if jwt is non-nil, or an API
+// key, which has no role and only reaches the routes its scopes allow. The
+// caller's actor and role are stored in the request context; use
+// RequirePermission or RequireAccess to check them per route.
+// If masterKey is empty, auth is disabled (dev mode): requests without a
+// valid user token or API key act as an anonymous admin.
+// API key and user token uses are recorded in usage, which may be nil.
+func RequireAdmin(keys apiKeyValidator, usage *KeyUsage, users userAuthenticator, jwt *oidc.Verifier, masterKey string, m *metrics.Metrics) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := extractBearer(r)
+
+			if masterKey != "" && token == masterKey {
+				next.ServeHTTP(w, withPrincipal(r, "master_key", namedActor(r, models.ActorMasterKey), models.RoleAdmin))
+				return
+			}
+
+			if users != nil && token != "" {
+				user, tokenID, err := users.AuthenticateUserToken(r.Context(), models.HashKey(token))
+				if err != nil {
+					m.CountAuthFailure("user_token", "error")
+					if !storeUnavailable(w, err) {
+						respondError(w, http.StatusInternalServerError, "auth error")
+					}
+					return
+				}
+				if user != nil {
+					usage.RecordUserToken(tokenID)
+					next.ServeHTTP(w, withPrincipal(r, "user_token", user.Actor(), user.Role))
+					return
+				}
+			}
+
+			if jwt != nil && oidc.LooksLikeJWT(token) {
+				actor, role, err := jwt.Verify(token)
+				switch {
+				case err == nil:
+					next.ServeHTTP(w, withPrincipal(r, "jwt", actor, role))
+				case errors.Is(err, oidc.ErrNoRole):
+					m.CountAuthFailure("jwt", "no_role")
+					respondError(w, http.StatusForbidden, err.Error())
+				case errors.Is(err, oidc.ErrInvalidToken):
+					m.CountAuthFailure("jwt", "invalid")
+					respondError(w, http.StatusUnauthorized, err.Error())
+				default:
+					m.CountAuthFailure("jwt", "error")
+					respondError(w, http.StatusInternalServerError, "auth error")
+				}
+				return
+			}
+
+			if token != "" {
+				apiKey, err := keys.ValidateAPIKey(r.Context(), models.HashKey(token))
+				if err != nil {
+					m.CountAuthFailure("api_key", "error")
+					if !storeUnavailable(w, err) {
+						respondError(w, http.StatusInternalServerError, "auth error")
+					}
+					return
+				}
+				if apiKey != nil {
+					usage.Record(apiKey.ID)
+					r = withPrincipal(r, "api_key", models.Actor{Type: "api_key", ID: apiKey.ID}, "")
+					next.ServeHTTP(w, withAPIKey(r, apiKey))
+					return
+				}
+			}
+
 			if masterKey == "" {
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, withPrincipal(r, "anonymous", namedActor(r, models.ActorAnonymous), models.RoleAdmin))
 				return
 			}
 
-			token := extractBearer(r)
-			if token != masterKey {
-				respondError(w, http.StatusUnauthorized, "invalid or missing master key")
+			m.CountAuthFailure("master_key", "invalid")
+			respondError(w, http.StatusUnauthorized, "invalid or missing master key or user token")
+		})
+	}
+}
+
+// RequirePermission returns a middleware that rejects callers whose role
+// doesn't grant p. API keys are always rejected. It must run after
+// RequireAdmin.
+func RequirePermission(p models.Permission, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return RequireAccess(p, "", m)
+}
+
+// RequireAccess is like RequirePermission, but also lets API keys with
+// scope through. It must run after RequireAdmin.
+func RequireAccess(p models.Permission, scope models.Scope, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := apiKeyFrom(r); apiKey != nil {
+				if scope == "" {
+					m.CountAuthFailure("api_key", "forbidden")
+					respondError(w, http.StatusForbidden, "API keys can't call this route")
+					return
+				}
+				if !apiKey.HasScope(scope) {
+					m.CountAuthFailure("api_key", "forbidden")
+					respondError(w, http.StatusForbidden, fmt.Sprintf("API key does not have the %s scope", scope))
+					return
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
 
+			role := roleFrom(r)
+			if !role.Can(p) {
+				m.CountAuthFailure(principalKindFrom(r), "forbidden")
+				respondError(w, http.StatusForbidden, fmt.Sprintf("role %q does not have the %s permission", role, p))
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// userAuthenticator is the subset of store.Users needed by RequireAdmin.
+type userAuthenticator interface {
+	AuthenticateUserToken(ctx context.Context, hashedToken string) (*models.User, string, error)
+}
+
+type principalKey struct{}
+
+// principal is how an admin request authenticated and the role it has.
+type principal struct {
+	kind string // master_key, user_token, jwt, api_key or anonymous
+	role models.Role
+}
+
+// withPrincipal returns r with the actor, the kind of credential it
+// authenticated with and its role in its context.
+func withPrincipal(r *http.Request, kind string, actor models.Actor, role models.Role) *http.Request {
+	ctx := models.WithActor(r.Context(), actor)
+	return r.WithContext(context.WithValue(ctx, principalKey{}, principal{kind: kind, role: role}))
+}
+
+// roleFrom returns the caller's role, or "" if unauthenticated.
+func roleFrom(r *http.Request) models.Role {
+	p, _ := r.Context().Value(principalKey{}).(principal)
+	return p.role
+}
+
+// principalKindFrom returns the kind of credential the caller authenticated
+// with, for labelling auth failures, or "" if unauthenticated.
+func principalKindFrom(r *http.Request) string {
+	p, _ := r.Context().Value(principalKey{}).(principal)
+	return p.kind
+}
+
+type apiKeyKey struct{}
+
+// withAPIKey returns r with the authenticated API key in its context.
+func withAPIKey(r *http.Request, k *models.APIKey) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, k))
+}
+
+// apiKeyFrom returns the API key the request authenticated with, or nil for
+// the master key, user tokens and dev mode.
+func apiKeyFrom(r *http.Request) *models.APIKey {
+	k, _ := r.Context().Value(apiKeyKey{}).(*models.APIKey)
+	return k
+}
+
 // RequireAPIKey returns a middleware that validates API keys for client routes.
 // If masterKey is set and matches, it also passes (admin can do everything).
-func RequireAPIKey(s apiKeyValidator, masterKey string) func(http.Handler) http.Handler {
+// The key is stored in the request context; use RequireScope to check it
+// per route. Key uses are recorded in usage, which may be nil.
+func RequireAPIKey(s apiKeyValidator, usage *KeyUsage, masterKey string, m *metrics.Metrics) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractBearer(r)
 			if token == "" {
+				m.CountAuthFailure("api_key", "missing")
 				respondError(w, http.StatusUnauthorized, "missing Authorization header")
 				return
 			}
@@ -46,16 +205,36 @@ func RequireAPIKey(s apiKeyValidator, masterKey string) func(http.Handler) http.
 			}
 
 			hashedKey := models.HashKey(token)
-			apiKey, err := s.ValidateAPIKey(hashedKey)
+			apiKey, err := s.ValidateAPIKey(r.Context(), hashedKey)
 			if err != nil {
-				respondError(w, http.StatusInternalServerError, "auth error")
+				m.CountAuthFailure("api_key", "error")
+				if !storeUnavailable(w, err) {
+					respondError(w, http.StatusInternalServerError, "auth error")
+				}
 				return
 			}
 			if apiKey == nil {
+				m.CountAuthFailure("api_key", "invalid")
 				respondError(w, http.StatusUnauthorized, "invalid API key")
 				return
 			}
 
+			usage.Record(apiKey.ID)
+			next.ServeHTTP(w, withAPIKey(r, apiKey))
+		})
+	}
+}
+
+// RequireScope returns a middleware that rejects API keys without scope.
+// The master key passes. It must run after RequireAPIKey.
+func RequireScope(scope models.Scope, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := apiKeyFrom(r); apiKey != nil && !apiKey.HasScope(scope) {
+				m.CountAuthFailure("api_key", "forbidden")
+				respondError(w, http.StatusForbidden, fmt.Sprintf("API key does not have the %s scope", scope))
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -63,7 +242,20 @@ func RequireAPIKey(s apiKeyValidator, masterKey string) func(http.Handler) http.
 
 // apiKeyValidator is the subset of Store needed by the auth middleware.
 type apiKeyValidator interface {
-	ValidateAPIKey(hashedKey string) (*models.APIKey, error)
+	ValidateAPIKey(ctx context.Context, hashedKey string) (*models.APIKey, error)
+}
+
+// namedActor returns base with its ID replaced by the ActorHeader value, if set.
+func namedActor(r *http.Request, base models.Actor) models.Actor {
+	if name := strings.TrimSpace(r.Header.Get(ActorHeader)); name != "" {
+		base.ID = name
+	}
+	return base
+}
+
+// actorFrom returns the authenticated actor for an admin request.
+func actorFrom(r *http.Request) models.Actor {
+	return models.ActorFromContext(r.Context())
 }
 
 func extractBearer(r *http.Request) string {
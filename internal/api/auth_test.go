@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/metrics"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// scrape returns the metrics in the Prometheus text format.
+func scrape(m *metrics.Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestMetrics_Auth(t *testing.T) {
+	s := newTestServer(t, api.Options{Metrics: metrics.New()})
+	_, key := s.createKey(t, models.EnvLive)
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodGet, "/metrics", "", nil)
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/metrics", key, nil)
+	s.expectStatus(t, http.StatusOK, http.MethodGet, "/metrics", testMasterKey, nil)
+	s.expectStatus(t, http.StatusOK, http.MethodGet, "/metrics", s.createUser(t, "alice", models.RoleViewer), nil)
+
+	public := newTestServer(t, api.Options{Metrics: metrics.New(), MetricsPublic: true})
+	public.expectStatus(t, http.StatusOK, http.MethodGet, "/metrics", "", nil)
+}
+
+func TestRequireAdmin_UserTokenLookupError(t *testing.T) {
+	m := metrics.New()
+	s := newTestServer(t, api.Options{Metrics: m})
+	s.store.Close()
+
+	s.expectStatus(t, http.StatusInternalServerError, http.MethodGet, "/api/v1/flags", "flg_pat_unknown", nil)
+	assert.Contains(t, scrape(m), `flaggy_auth_failures_total{kind="user_token",reason="error"} 1`)
+}
+
+func TestRequirePermission_CountsForbiddenByKind(t *testing.T) {
+	m := metrics.New()
+	s := newTestServer(t, api.Options{Metrics: m})
+	viewer := s.createUser(t, "alice", models.RoleViewer)
+
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/users", viewer, nil)
+	out := scrape(m)
+	assert.Contains(t, out, `flaggy_auth_failures_total{kind="user_token",reason="forbidden"} 1`)
+	assert.NotContains(t, out, `kind="master_key",reason="forbidden"`)
+}
+
+func TestRequireAdmin_UserTokenUseRecordedInBatches(t *testing.T) {
+	st := newTestStore(t, "")
+	usage := api.NewKeyUsage(st, time.Hour)
+	s := newTestServer(t, api.Options{Store: st, KeyUsage: usage})
+	token := s.createUser(t, "alice", models.RoleViewer)
+	user, err := s.store.GetUser(t.Context(), "alice")
+	require.NoError(t, err)
+
+	s.expectStatus(t, http.StatusOK, http.MethodGet, "/api/v1/flags", token, nil)
+	tokens, err := s.store.ListUserTokens(t.Context(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Nil(t, tokens[0].LastUsedAt, "not written on the request")
+
+	usage.Close()
+	tokens, err = s.store.ListUserTokens(t.Context(), user.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+}
+
+func TestRequirePermission_Roles(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	s.createFlag(t, "checkout")
+	tokens := map[models.Role]string{}
+	for _, role := range []models.Role{models.RoleViewer, models.RoleEditor, models.RoleKeyManager, models.RoleAdmin} {
+		tokens[role] = s.createUser(t, string(role), role)
+	}
+
+	routes := []struct {
+		method, path string
+		body         any
+		allowed      []models.Role
+	}{
+		{http.MethodGet, "/api/v1/flags", nil,
+			[]models.Role{models.RoleViewer, models.RoleEditor, models.RoleKeyManager, models.RoleAdmin}},
+		{http.MethodGet, "/api/v1/audit", nil,
+			[]models.Role{models.RoleViewer, models.RoleEditor, models.RoleKeyManager, models.RoleAdmin}},
+		{http.MethodPut, "/api/v1/flags/checkout", models.UpdateFlagRequest{},
+			[]models.Role{models.RoleEditor, models.RoleAdmin}},
+		{http.MethodPost, "/api/v1/segments", models.CreateSegmentRequest{},
+			[]models.Role{models.RoleEditor, models.RoleAdmin}},
+		{http.MethodGet, "/api/v1/api-keys", nil,
+			[]models.Role{models.RoleKeyManager, models.RoleAdmin}},
+		{http.MethodGet, "/api/v1/users", nil,
+			[]models.Role{models.RoleAdmin}},
+		{http.MethodGet, "/api/v1/webhooks", nil,
+			[]models.Role{models.RoleAdmin}},
+	}
+	for _, rt := range routes {
+		for role, token := range tokens {
+			resp := s.do(t, rt.method, rt.path, token, rt.body)
+			if slices.Contains(rt.allowed, role) {
+				assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, resp.StatusCode,
+					"%s %s as %s", rt.method, rt.path, role)
+			} else {
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s as %s", rt.method, rt.path, role)
+			}
+		}
+	}
+}
+
+func TestRequireAPIKey_FileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+flags:
+  - key: checkout
+    type: boolean
+    enabled: true
+    default_value: true
+`), 0o600))
+	st, err := store.NewFileStore(path)
+	require.NoError(t, err)
+	serve := func(masterKey string) *testServer {
+		srv := httptest.NewServer(api.NewRouter(api.Options{Store: st, Broadcaster: sse.NewBroadcaster(), MasterKey: masterKey}))
+		t.Cleanup(srv.Close)
+		return &testServer{Server: srv}
+	}
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+
+	// Without a master key, clients need no key
+	s := serve("")
+	resp := s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", "", evaluate)
+	assert.JSONEq(t, `true`, string(decodeBody[models.EvaluateResponse](t, resp).Value))
+
+	// With one, they need it: the file holds no API keys
+	s = serve(testMasterKey)
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodPost, "/api/v1/evaluate", "", evaluate)
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodPost, "/api/v1/evaluate", "flg_live_unknown", evaluate)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", testMasterKey, evaluate)
+}
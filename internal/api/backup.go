@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Backup responds with a consistent copy of the database, taken while the
+// server keeps serving. The copy is written to a temporary file first, so a
+// slow download doesn't hold the database.
+func (s *Server) Backup(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "flaggy-backup-")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "flaggy.db")
+	if err := s.backups.Backup(r.Context(), path); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := "flaggy-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	if _, err := io.Copy(w, f); err != nil {
+		slog.Warn("failed to send backup", "error", err)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/getflaggy/flaggy/internal/engine"
@@ -19,24 +20,37 @@ func (s *Server) EvaluateBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := engine.EvalContext(req.Context)
+	evalCtx := engine.EvalContext(req.Context)
 	results := make([]models.EvaluateResponse, 0, len(req.Flags))
 
 	for _, flagKey := range req.Flags {
-		flag, err := s.store.GetFlagForEvaluation(flagKey)
+		resp, err := s.evaluateKey(r.Context(), flagKey, evalCtx)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondStoreError(w, http.StatusInternalServerError, err)
 			return
 		}
-		if flag == nil {
-			results = append(results, models.EvaluateResponse{
-				FlagKey: flagKey,
-				Reason:  "not_found",
-			})
-			continue
+		if resp.Reason != "not_found" {
+			s.recordExposure(evalCtx, resp)
 		}
-		results = append(results, engine.Evaluate(flag, ctx))
+		results = append(results, resp)
 	}
 
 	respondJSON(w, http.StatusOK, models.BatchEvaluateResponse{Results: results})
 }
+
+// evaluateKey evaluates one flag by key and counts the evaluation. Unknown
+// flags get reason "not_found".
+func (s *Server) evaluateKey(ctx context.Context, flagKey string, evalCtx engine.EvalContext) (models.EvaluateResponse, error) {
+	flag, err := s.store.GetFlagForEvaluation(ctx, flagKey)
+	if err != nil {
+		return models.EvaluateResponse{}, err
+	}
+	if flag == nil {
+		// Unknown keys come from the client, don't use them as label values
+		s.metrics.CountEvaluation("", "not_found")
+		return models.EvaluateResponse{FlagKey: flagKey, Reason: "not_found"}, nil
+	}
+	resp := engine.Evaluate(flag, evalCtx)
+	s.metrics.CountEvaluation(resp.FlagKey, resp.Reason)
+	return resp, nil
+}
@@ -0,0 +1,515 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// RequireDirectWrites returns a middleware that rejects flag, rule and
+// segment writes when env's policy requires them to go through change requests.
+func RequireDirectWrites(cr store.ChangeRequests, env models.Environment) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy, err := cr.GetEnvironmentPolicy(r.Context(), env)
+			if err != nil {
+				respondStoreError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !policy.AllowDirectWrites {
+				respondError(w, http.StatusForbidden, fmt.Sprintf(
+					"direct writes are disabled in the %s environment; submit a change request to /api/v1/change-requests", env))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) GetEnvironmentPolicy(w http.ResponseWriter, r *http.Request) {
+	env := models.Environment(chi.URLParam(r, "env"))
+	if err := models.ValidateEnvironment(env); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	policy, err := s.changes.GetEnvironmentPolicy(r.Context(), env)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) SetEnvironmentPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.EnvironmentPolicy
+	if err := decodeJSON(r, &policy); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	policy.Environment = models.Environment(chi.URLParam(r, "env"))
+	if err := models.ValidatePolicy(&policy); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.changes.SetEnvironmentPolicy(r.Context(), actorFrom(r), &policy); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// ListChangeRequests returns change requests, newest first. Filter: status.
+func (s *Server) ListChangeRequests(w http.ResponseWriter, r *http.Request) {
+	crs, err := s.changes.ListChangeRequests(r.Context(), models.ChangeStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if crs == nil {
+		crs = []models.ChangeRequest{}
+	}
+	respondJSON(w, http.StatusOK, crs)
+}
+
+func (s *Server) GetChangeRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid change request ID")
+		return
+	}
+	cr, err := s.changes.GetChangeRequest(r.Context(), id)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if cr == nil {
+		respondError(w, http.StatusNotFound, "change request not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, cr)
+}
+
+// CreateChangeRequest validates a proposed write, computes its diff against
+// the current state, and stores it as pending.
+func (s *Server) CreateChangeRequest(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateChangeRequestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := models.ValidateChangeOperation(req.ResourceType, req.Action); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cr := &models.ChangeRequest{
+		Environment:  s.environment,
+		ResourceType: req.ResourceType,
+		Action:       req.Action,
+		ResourceKey:  req.ResourceKey,
+		RuleID:       req.RuleID,
+		Payload:      req.Payload,
+		Comment:      req.Comment,
+	}
+	if status, err := s.proposeChange(r.Context(), cr); err != nil {
+		respondStoreError(w, status, err)
+		return
+	}
+
+	policy, err := s.changes.GetEnvironmentPolicy(r.Context(), s.environment)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cr.RequiredApprovals = policy.RequiredApprovals
+
+	if err := s.changes.CreateChangeRequest(r.Context(), actorFrom(r), cr); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, cr)
+}
+
+func (s *Server) ApproveChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, models.DecisionApprove)
+}
+
+func (s *Server) RejectChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, models.DecisionReject)
+}
+
+// reviewChangeRequest records a review. The approval that reaches the
+// required count applies the change in the same request. Only callers with
+// an authenticated identity may review.
+func (s *Server) reviewChangeRequest(w http.ResponseWriter, r *http.Request, decision string) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid change request ID")
+		return
+	}
+	// Master key and anonymous callers name themselves with ActorHeader, so
+	// one of them could approve their own change under another name.
+	if actor := actorFrom(r); actor.Type == models.ActorMasterKey.Type || actor.Type == models.ActorAnonymous.Type {
+		respondError(w, http.StatusForbidden, "change requests must be reviewed with a user token or JWT, not the master key")
+		return
+	}
+	var req models.ReviewChangeRequestRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+
+	cr, err := s.changes.ReviewChangeRequest(r.Context(), actorFrom(r), id, decision, req.Comment)
+	switch {
+	case errors.Is(err, store.ErrChangeRequestNotFound):
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, store.ErrSelfReview):
+		respondStoreError(w, http.StatusForbidden, err)
+		return
+	case errors.Is(err, store.ErrChangeRequestNotPending), errors.Is(err, store.ErrAlreadyReviewed):
+		respondStoreError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if cr.Status == models.ChangeApproved {
+		if cr, err = s.completeChangeRequest(r.Context(), cr); err != nil {
+			respondStoreError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, cr)
+}
+
+// applyTimeout bounds applying an approved change request and recording
+// the outcome.
+const applyTimeout = 30 * time.Second
+
+// completeChangeRequest applies an approved change request and records the
+// outcome. It doesn't stop when ctx is canceled: a client hanging up after
+// its approval was stored must not leave the request approved but unapplied.
+func (s *Server) completeChangeRequest(ctx context.Context, cr *models.ChangeRequest) (*models.ChangeRequest, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), applyTimeout)
+	defer cancel()
+	return s.changes.CompleteChangeRequest(ctx, cr.ID, s.applyChangeRequest(ctx, cr))
+}
+
+// applyApproved applies the change requests a previous run approved but
+// stopped before applying, oldest first.
+func (s *Server) applyApproved(ctx context.Context) error {
+	crs, err := s.changes.ListChangeRequests(ctx, models.ChangeApproved)
+	if err != nil {
+		return err
+	}
+	for i := len(crs) - 1; i >= 0; i-- {
+		cr, err := s.completeChangeRequest(ctx, &crs[i])
+		if err != nil {
+			return fmt.Errorf("apply change request %d: %w", crs[i].ID, err)
+		}
+		slog.Info("applied approved change request", "id", cr.ID, "status", cr.Status, "apply_error", cr.ApplyError)
+	}
+	return nil
+}
+
+// proposeChange validates cr's payload and fills in its diff and base
+// version. Returns the HTTP status to use on error.
+func (s *Server) proposeChange(ctx context.Context, cr *models.ChangeRequest) (int, error) {
+	switch cr.ResourceType {
+	case "flag":
+		return s.proposeFlagChange(ctx, cr)
+	case "rule":
+		return s.proposeRuleChange(ctx, cr)
+	default:
+		return s.proposeSegmentChange(ctx, cr)
+	}
+}
+
+func (s *Server) proposeFlagChange(ctx context.Context, cr *models.ChangeRequest) (int, error) {
+	if cr.Action == "create" {
+		var req models.CreateFlagRequest
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		if cr.ResourceKey == "" {
+			cr.ResourceKey = req.Key
+		}
+		if cr.ResourceKey != req.Key {
+			return http.StatusBadRequest, fmt.Errorf("resource_key does not match payload key")
+		}
+		flag, status, err := s.flagFromRequest(ctx, &req)
+		if err != nil {
+			return status, err
+		}
+		cr.Diff = models.DiffFlags(nil, flag)
+		return 0, nil
+	}
+
+	before, err := s.store.GetFlag(ctx, cr.ResourceKey)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if before == nil {
+		return http.StatusNotFound, fmt.Errorf("flag not found")
+	}
+	cr.BaseVersion = before.Version
+	after := *before
+
+	switch cr.Action {
+	case "update":
+		var req models.UpdateFlagRequest
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		if req.Description != nil {
+			after.Description = *req.Description
+		}
+		if req.Enabled != nil {
+			after.Enabled = *req.Enabled
+		}
+		if req.DefaultValue != nil {
+			after.DefaultValue = req.DefaultValue
+		}
+		cr.Diff = models.DiffFlags(before, &after)
+	case "toggle":
+		after.Enabled = !after.Enabled
+		cr.Diff = models.DiffFlags(before, &after)
+	case "delete":
+		cr.Diff = models.DiffFlags(before, nil)
+	case "clone":
+		// The diff is the new flag; the base version is the source's
+		var req models.CloneFlagRequest
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		clone, status, err := s.flagClone(ctx, cr.ResourceKey, 0, &req)
+		if err != nil {
+			return status, err
+		}
+		cr.Diff = models.DiffFlags(nil, clone)
+	case "restore":
+		if s.history == nil {
+			return http.StatusBadRequest, fmt.Errorf("flag history is not supported by this store")
+		}
+		var req struct {
+			Version int `json:"version"`
+		}
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		v, err := s.history.GetFlagVersion(ctx, cr.ResourceKey, req.Version)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if v == nil {
+			return http.StatusNotFound, store.ErrVersionNotFound
+		}
+		cr.Diff = models.DiffFlags(before, v.Snapshot)
+	}
+	return 0, nil
+}
+
+func (s *Server) proposeRuleChange(ctx context.Context, cr *models.ChangeRequest) (int, error) {
+	flag, err := s.store.GetFlag(ctx, cr.ResourceKey)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if flag == nil {
+		return http.StatusNotFound, fmt.Errorf("flag not found")
+	}
+
+	if cr.Action == "create" {
+		cr.RuleID = 0
+	}
+	var proposed *models.Rule
+	if cr.Action != "delete" {
+		var req models.CreateRuleRequest
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		proposed = &models.Rule{
+			ID: cr.RuleID, FlagKey: flag.Key, Description: req.Description, Value: req.Value,
+			Priority: req.Priority, RolloutPercentage: req.RolloutPercentage,
+			Conditions: req.Conditions, SegmentKeys: req.SegmentKeys,
+		}
+		if err := models.ValidateRule(proposed); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if err := models.ValidateValueForType(flag.Type, req.Value); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("value: %w", err)
+		}
+	}
+
+	// Diff at flag level so the paths match flag history; a new rule shows as rules[0]
+	after := *flag
+	after.Rules = nil
+	found := false
+	for _, rule := range flag.Rules {
+		if cr.Action != "create" && rule.ID == cr.RuleID {
+			found = true
+			cr.BaseVersion = rule.Version
+			if proposed != nil {
+				after.Rules = append(after.Rules, *proposed)
+			}
+			continue
+		}
+		after.Rules = append(after.Rules, rule)
+	}
+	switch cr.Action {
+	case "create":
+		after.Rules = append(after.Rules, *proposed)
+	default:
+		if !found {
+			return http.StatusNotFound, fmt.Errorf("rule not found")
+		}
+	}
+	cr.Diff = models.DiffFlags(flag, &after)
+	return 0, nil
+}
+
+func (s *Server) proposeSegmentChange(ctx context.Context, cr *models.ChangeRequest) (int, error) {
+	if cr.Action == "create" {
+		var req models.CreateSegmentRequest
+		if err := json.Unmarshal(cr.Payload, &req); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+		}
+		if cr.ResourceKey == "" {
+			cr.ResourceKey = req.Key
+		}
+		seg := &models.Segment{Key: req.Key, Description: req.Description, Conditions: req.Conditions}
+		if cr.ResourceKey != seg.Key {
+			return http.StatusBadRequest, fmt.Errorf("resource_key does not match payload key")
+		}
+		if err := models.ValidateSegment(seg); err != nil {
+			return http.StatusBadRequest, err
+		}
+		cr.Diff = models.DiffSegments(nil, seg)
+		return 0, nil
+	}
+
+	before, err := s.store.GetSegment(ctx, cr.ResourceKey)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if before == nil {
+		return http.StatusNotFound, fmt.Errorf("segment not found")
+	}
+	cr.BaseVersion = before.Version
+
+	if cr.Action == "delete" {
+		cr.Diff = models.DiffSegments(before, nil)
+		return 0, nil
+	}
+
+	var req models.UpdateSegmentRequest
+	if err := json.Unmarshal(cr.Payload, &req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err)
+	}
+	after := *before
+	if req.Description != nil {
+		after.Description = *req.Description
+	}
+	if req.Conditions != nil {
+		after.Conditions = req.Conditions
+		if err := models.ValidateSegment(&after); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	cr.Diff = models.DiffSegments(before, &after)
+	return 0, nil
+}
+
+// applyChangeRequest makes an approved change through the same write
+// functions as the direct write routes, as the proposer, so it gets the same
+// validation, audit entries and events as a direct write. Writes are made at
+// the base version, so a change to the resource since the proposal makes
+// the apply fail. Returns the error message, or "" on success.
+func (s *Server) applyChangeRequest(ctx context.Context, cr *models.ChangeRequest) string {
+	if err := s.applyChange(ctx, cr); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (s *Server) applyChange(ctx context.Context, cr *models.ChangeRequest) error {
+	actor, key, version := cr.Proposer, cr.ResourceKey, cr.BaseVersion
+	var err error
+	switch cr.ResourceType + "." + cr.Action {
+	case "flag.create":
+		var req models.CreateFlagRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.createFlag(ctx, actor, &req)
+		}
+	case "flag.update":
+		var req models.UpdateFlagRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.updateFlag(ctx, actor, key, version, &req)
+		}
+	case "flag.delete":
+		_, err = s.deleteFlag(ctx, actor, key, version)
+	case "flag.toggle":
+		_, _, err = s.toggleFlag(ctx, actor, key, version)
+	case "flag.clone":
+		var req models.CloneFlagRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.cloneFlag(ctx, actor, key, version, &req)
+		}
+	case "flag.restore":
+		var req struct {
+			Version int `json:"version"`
+		}
+		if s.history == nil {
+			err = errors.New("flag history is not supported by this store")
+		} else if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.restoreFlagVersion(ctx, actor, key, req.Version)
+		}
+	case "rule.create":
+		var req models.CreateRuleRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.createRule(ctx, actor, key, &req)
+		}
+	case "rule.update":
+		var req models.CreateRuleRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.updateRule(ctx, actor, key, cr.RuleID, version, &req)
+		}
+	case "rule.delete":
+		_, err = s.deleteRule(ctx, actor, key, cr.RuleID, version)
+	case "segment.create":
+		var req models.CreateSegmentRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.createSegment(ctx, actor, &req)
+		}
+	case "segment.update":
+		var req models.UpdateSegmentRequest
+		if err = decodePayload(cr, &req); err == nil {
+			_, _, err = s.updateSegment(ctx, actor, key, version, &req)
+		}
+	case "segment.delete":
+		_, err = s.deleteSegment(ctx, actor, key, version)
+	default:
+		err = fmt.Errorf("unsupported change %s.%s", cr.ResourceType, cr.Action)
+	}
+	return err
+}
+
+func decodePayload(cr *models.ChangeRequest, dst any) error {
+	if err := json.Unmarshal(cr.Payload, dst); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// newReviewedServer returns a server whose environment only takes writes
+// through change requests, with tokens for two editors.
+func newReviewedServer(t *testing.T) (s *testServer, alice, bob string) {
+	t.Helper()
+	s = newTestServer(t, api.Options{})
+	s.expectStatus(t, http.StatusOK, http.MethodPut, "/api/v1/environments/live/policy", testMasterKey,
+		models.EnvironmentPolicy{RequiredApprovals: 1})
+	return s, s.createUser(t, "alice", models.RoleEditor), s.createUser(t, "bob", models.RoleEditor)
+}
+
+func (s *testServer) propose(t *testing.T, token string, req models.CreateChangeRequestRequest) *models.ChangeRequest {
+	t.Helper()
+	resp := s.expectStatus(t, http.StatusCreated, http.MethodPost, "/api/v1/change-requests", token, req)
+	cr := decodeBody[models.ChangeRequest](t, resp)
+	return &cr
+}
+
+func (s *testServer) approve(t *testing.T, token string, id int64) *models.ChangeRequest {
+	t.Helper()
+	resp := s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/change-requests/"+strconv.FormatInt(id, 10)+"/approve", token, nil)
+	cr := decodeBody[models.ChangeRequest](t, resp)
+	return &cr
+}
+
+func TestChangeRequest_AppliedAsProposer(t *testing.T) {
+	s, alice, bob := newReviewedServer(t)
+	s.expectStatus(t, http.StatusForbidden, http.MethodPost, "/api/v1/flags", alice,
+		models.CreateFlagRequest{Key: "checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)})
+
+	cr := s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "create",
+		Payload: json.RawMessage(`{"key":"checkout","type":"boolean","default_value":false}`),
+	})
+	cr = s.approve(t, bob, cr.ID)
+	require.Equal(t, models.ChangeApplied, cr.Status, cr.ApplyError)
+
+	flag, err := s.store.GetFlag(t.Context(), "checkout")
+	require.NoError(t, err)
+	require.NotNil(t, flag)
+	entries, err := s.store.ListAuditEntries(t.Context(), models.AuditFilter{ResourceKey: "checkout", Limit: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "alice", entries[0].Actor.ID, "the change is made as its proposer")
+
+	cr = s.propose(t, alice, models.CreateChangeRequestRequest{ResourceType: "flag", Action: "toggle", ResourceKey: "checkout"})
+	cr = s.approve(t, bob, cr.ID)
+	require.Equal(t, models.ChangeApplied, cr.Status, cr.ApplyError)
+	flag, err = s.store.GetFlag(t.Context(), "checkout")
+	require.NoError(t, err)
+	assert.True(t, flag.Enabled)
+}
+
+func TestChangeRequest_StaleBaseVersionFails(t *testing.T) {
+	s, alice, bob := newReviewedServer(t)
+	s.createFlag(t, "checkout")
+
+	cr := s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "update", ResourceKey: "checkout",
+		Payload: json.RawMessage(`{"description":"proposed"}`),
+	})
+	_, err := s.store.ToggleFlag(t.Context(), models.ActorMasterKey, "checkout", 0)
+	require.NoError(t, err)
+
+	cr = s.approve(t, bob, cr.ID)
+	assert.Equal(t, models.ChangeFailed, cr.Status)
+	assert.Equal(t, "flag was modified concurrently", cr.ApplyError)
+	flag, err := s.store.GetFlag(t.Context(), "checkout")
+	require.NoError(t, err)
+	assert.Empty(t, flag.Description)
+}
+
+func TestChangeRequest_MasterKeyCantReview(t *testing.T) {
+	s, alice, _ := newReviewedServer(t)
+	cr := s.propose(t, testMasterKey, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "create",
+		Payload: json.RawMessage(`{"key":"checkout","type":"boolean","default_value":false}`),
+	})
+
+	for _, name := range []string{"", "someone-else"} {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost,
+			s.URL+"/api/v1/change-requests/"+strconv.FormatInt(cr.ID, 10)+"/approve", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+testMasterKey)
+		req.Header.Set(api.ActorHeader, name)
+		resp, err := s.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "actor %q", name)
+	}
+
+	cr = s.approve(t, alice, cr.ID)
+	assert.Equal(t, models.ChangeApplied, cr.Status, cr.ApplyError)
+}
+
+func TestChangeRequest_Clone(t *testing.T) {
+	s, alice, bob := newReviewedServer(t)
+	s.createFlag(t, "checkout")
+	s.expectStatus(t, http.StatusForbidden, http.MethodPost, "/api/v1/flags/checkout/clone", alice,
+		models.CloneFlagRequest{Key: "checkout_v2"})
+
+	cr := s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "clone", ResourceKey: "checkout",
+		Payload: json.RawMessage(`{"key":"checkout_v2","description":"second attempt"}`),
+	})
+	assert.Equal(t, 1, cr.BaseVersion)
+	require.NotEmpty(t, cr.Diff)
+
+	cr = s.approve(t, bob, cr.ID)
+	require.Equal(t, models.ChangeApplied, cr.Status, cr.ApplyError)
+	clone, err := s.store.GetFlag(t.Context(), "checkout_v2")
+	require.NoError(t, err)
+	require.NotNil(t, clone)
+	assert.Equal(t, "second attempt", clone.Description)
+	assert.False(t, clone.Enabled)
+
+	// The source changed since the proposal: the clone isn't made
+	cr = s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "clone", ResourceKey: "checkout",
+		Payload: json.RawMessage(`{"key":"checkout_v3"}`),
+	})
+	_, err = s.store.ToggleFlag(t.Context(), models.ActorMasterKey, "checkout", 0)
+	require.NoError(t, err)
+	cr = s.approve(t, bob, cr.ID)
+	assert.Equal(t, models.ChangeFailed, cr.Status)
+	assert.Equal(t, "flag was modified concurrently", cr.ApplyError)
+}
+
+func TestChangeRequest_NamedMasterKeyProposerCantReview(t *testing.T) {
+	s, alice, bob := newReviewedServer(t)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, s.URL+"/api/v1/change-requests",
+		strings.NewReader(`{"resource_type":"flag","action":"create","payload":{"key":"checkout","type":"boolean","default_value":false}}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testMasterKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(api.ActorHeader, "alice")
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	cr := decodeBody[models.ChangeRequest](t, resp)
+	resp.Body.Close()
+
+	s.expectStatus(t, http.StatusForbidden, http.MethodPost, "/api/v1/change-requests/"+strconv.FormatInt(cr.ID, 10)+"/approve", alice, nil)
+	approved := s.approve(t, bob, cr.ID)
+	assert.Equal(t, models.ChangeApplied, approved.Status, approved.ApplyError)
+}
+
+// reviewHoldingStore holds each review's request until its client goes
+// away, after the review is stored.
+type reviewHoldingStore struct {
+	*store.SQLiteStore
+	reviewed chan struct{}
+}
+
+func (s *reviewHoldingStore) ReviewChangeRequest(ctx context.Context, actor models.Actor, id int64, decision, comment string) (*models.ChangeRequest, error) {
+	cr, err := s.SQLiteStore.ReviewChangeRequest(ctx, actor, id, decision, comment)
+	close(s.reviewed)
+	<-ctx.Done()
+	return cr, err
+}
+
+func TestChangeRequest_AppliedAfterClientCancels(t *testing.T) {
+	st := &reviewHoldingStore{SQLiteStore: newTestStore(t, ""), reviewed: make(chan struct{})}
+	srv := httptest.NewServer(api.NewRouter(api.Options{Store: st, Broadcaster: sse.NewBroadcaster(), MasterKey: testMasterKey}))
+	t.Cleanup(srv.Close)
+	s := &testServer{Server: srv, store: st.SQLiteStore}
+	s.expectStatus(t, http.StatusOK, http.MethodPut, "/api/v1/environments/live/policy", testMasterKey,
+		models.EnvironmentPolicy{RequiredApprovals: 1})
+	alice, bob := s.createUser(t, "alice", models.RoleEditor), s.createUser(t, "bob", models.RoleEditor)
+	cr := s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "create",
+		Payload: json.RawMessage(`{"key":"checkout","type":"boolean","default_value":false}`),
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v1/change-requests/"+strconv.FormatInt(cr.ID, 10)+"/approve", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+bob)
+	go func() {
+		<-st.reviewed
+		cancel()
+	}()
+	_, err = s.Client().Do(req)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Eventually(t, func() bool {
+		got, err := s.store.GetChangeRequest(t.Context(), cr.ID)
+		return err == nil && got.Status == models.ChangeApplied
+	}, 5*time.Second, 10*time.Millisecond)
+	flag, err := s.store.GetFlag(t.Context(), "checkout")
+	require.NoError(t, err)
+	assert.NotNil(t, flag)
+}
+
+func TestChangeRequest_ApprovedAppliedOnStart(t *testing.T) {
+	s, alice, _ := newReviewedServer(t)
+	cr := s.propose(t, alice, models.CreateChangeRequestRequest{
+		ResourceType: "flag", Action: "create",
+		Payload: json.RawMessage(`{"key":"checkout","type":"boolean","default_value":false}`),
+	})
+	// Approved by a server that stopped before applying it
+	cr, err := s.store.ReviewChangeRequest(t.Context(), models.Actor{Type: string(models.UserKindUser), ID: "bob"},
+		cr.ID, models.DecisionApprove, "")
+	require.NoError(t, err)
+	require.Equal(t, models.ChangeApproved, cr.Status)
+
+	newTestServer(t, api.Options{Store: s.store})
+	cr, err = s.store.GetChangeRequest(t.Context(), cr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ChangeApplied, cr.Status, cr.ApplyError)
+	flag, err := s.store.GetFlag(t.Context(), "checkout")
+	require.NoError(t, err)
+	assert.NotNil(t, flag)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// ExportConfig returns every flag and segment as a declarative config.
+func (s *Server) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.configs.ExportConfig(r.Context())
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, cfg)
+}
+
+// PlanConfig returns the changes that applying the config would make,
+// without making them.
+func (s *Server) PlanConfig(w http.ResponseWriter, r *http.Request) {
+	s.applyConfig(w, r, true)
+}
+
+// ApplyConfig makes the flags and segments match the config, all at once:
+// if any change fails, none is made. Flags and segments missing from the
+// config are deleted.
+func (s *Server) ApplyConfig(w http.ResponseWriter, r *http.Request) {
+	s.applyConfig(w, r, false)
+}
+
+func (s *Server) applyConfig(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	var cfg models.Config
+	if err := decodeJSONLimit(r, &cfg, maxConfigSize); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := models.ValidateConfig(&cfg); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := s.configs.ApplyConfig(r.Context(), actorFrom(r), &cfg, dryRun)
+	if err != nil {
+		if errors.Is(err, store.ErrFlagTypeChange) {
+			respondStoreError(w, http.StatusConflict, err)
+			return
+		}
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, plan)
+}
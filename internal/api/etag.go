@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag sets a strong ETag for a resource version.
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatch parses the If-Match header into an expected version.
+// It returns 0 when the header is absent or "*", which skips the check.
+// Weak validators (W/"3") are accepted since versions are exact.
+func ifMatch(r *http.Request) (int, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+	h = strings.TrimPrefix(h, "W/")
+	unquoted, err := strconv.Unquote(h)
+	if err != nil {
+		unquoted = h
+	}
+	v, err := strconv.Atoi(unquoted)
+	if err != nil || v <= 0 {
+		return 0, errors.New("invalid If-Match header: expected a version ETag such as \"3\"")
+	}
+	return v, nil
+}
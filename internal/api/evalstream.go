@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/engine"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+)
+
+// EvaluateStream evaluates flags for one context and keeps the client's
+// values current, for clients that can't evaluate locally. It sends a
+// "values" event with every result, then re-evaluates on each change to one
+// of the flags (or to any segment) and sends a "values" event holding only
+// the results whose value changed.
+//
+// POST takes the same body as /evaluate/batch. GET, for EventSource, takes
+// flags (comma-separated) and context (JSON) query parameters. A reconnecting
+// client gets every value again.
+func (s *Server) EvaluateStream(w http.ResponseWriter, r *http.Request) {
+	req, err := parseEvaluateStreamRequest(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := sse.NewFilter(req.Flags, nil, s.streamEnvironment(r))
+	sub, last := s.subscribe(filter)
+	defer func() { sub.Close() }()
+
+	evalCtx := engine.EvalContext(req.Context)
+	values := make(map[string]models.EvaluateResponse, len(req.Flags))
+	results, err := s.evaluateChanged(r.Context(), evalCtx, req.Flags, values)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rc := startSSE(w)
+	writeEvent(w, seqID(last), "values", models.BatchEvaluateResponse{Results: results})
+	rc.Flush()
+
+	// Keepalive ticker
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		keys := req.Flags
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+			rc.Flush()
+			continue
+		case event, ok := <-sub.C:
+			if !ok {
+				if !sub.Lost() {
+					return // Broadcaster closed
+				}
+				// Too slow: re-evaluate everything on a new subscription.
+				sub, last = s.subscribe(filter)
+				break
+			}
+			if event.Seq != 0 {
+				last = event.Seq
+			}
+			if event.FlagKey != "" {
+				keys = []string{event.FlagKey}
+			}
+		}
+
+		results, err := s.evaluateChanged(r.Context(), evalCtx, keys, values)
+		if err != nil {
+			// The client reconnects and starts over with fresh values.
+			slog.Error("failed to re-evaluate flags for stream", "error", err)
+			return
+		}
+		if len(results) > 0 {
+			writeEvent(w, seqID(last), "values", models.BatchEvaluateResponse{Results: results})
+			rc.Flush()
+		}
+	}
+}
+
+// parseEvaluateStreamRequest reads the flags and context from the body (POST)
+// or the query string (GET). Duplicate flag keys are dropped.
+func parseEvaluateStreamRequest(r *http.Request) (models.BatchEvaluateRequest, error) {
+	var req models.BatchEvaluateRequest
+	if r.Method == http.MethodPost {
+		if err := decodeJSON(r, &req); err != nil {
+			return req, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		q := r.URL.Query()
+		req.Flags = splitQueryList(q.Get("flags"))
+		if v := q.Get("context"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Context); err != nil {
+				return req, fmt.Errorf("context must be a JSON object: %w", err)
+			}
+		}
+	}
+	if len(req.Flags) == 0 {
+		return req, fmt.Errorf("flags list is required")
+	}
+	slices.Sort(req.Flags)
+	req.Flags = slices.Compact(req.Flags)
+	return req, nil
+}
+
+// evaluateChanged evaluates the flags and returns the results whose value
+// differs from the one in values, which it updates. Flags not in values yet
+// are always returned.
+func (s *Server) evaluateChanged(ctx context.Context, evalCtx engine.EvalContext, keys []string, values map[string]models.EvaluateResponse) ([]models.EvaluateResponse, error) {
+	changed := []models.EvaluateResponse{}
+	for _, key := range keys {
+		resp, err := s.evaluateKey(ctx, key, evalCtx)
+		if err != nil {
+			return nil, err
+		}
+		prev, seen := values[key]
+		if seen && bytes.Equal(prev.Value, resp.Value) && (prev.Reason == "not_found") == (resp.Reason == "not_found") {
+			continue
+		}
+		values[key] = resp
+		if resp.Reason != "not_found" {
+			s.recordExposure(evalCtx, resp)
+		}
+		changed = append(changed, resp)
+	}
+	return changed, nil
+}
+
+// seqID formats an event sequence number as an SSE ID, or "" for none.
+func seqID(seq int64) string {
+	if seq == 0 {
+		return ""
+	}
+	return strconv.FormatInt(seq, 10)
+}
@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// values decodes a "values" event.
+func values(t *testing.T, e sseEvent) map[string]models.EvaluateResponse {
+	t.Helper()
+	require.Equal(t, "values", e.Event)
+	var resp models.BatchEvaluateResponse
+	require.NoError(t, json.Unmarshal([]byte(e.Data), &resp))
+	out := make(map[string]models.EvaluateResponse, len(resp.Results))
+	for _, r := range resp.Results {
+		out[r.FlagKey] = r
+	}
+	return out
+}
+
+func TestEvaluateStream(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	s.createFlag(t, "checkout")
+	s.createFlag(t, "other")
+	_, key := s.createKey(t, models.EnvLive)
+
+	q := url.Values{"flags": {"checkout,missing"}, "context": {`{"user_id":"u1"}`}}
+	resp := s.openStream(t, "/api/v1/evaluate/stream?"+q.Encode(), key, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := newSSEReader(resp)
+
+	// Every value first, with the position in the event log
+	first := events.next(t)
+	assert.Equal(t, "2", first.ID)
+	got := values(t, first)
+	require.Len(t, got, 2)
+	assert.JSONEq(t, `false`, string(got["checkout"].Value))
+	assert.Equal(t, "not_found", got["missing"].Reason)
+
+	// Then only the values that change
+	_, err := s.store.ToggleFlag(t.Context(), models.ActorMasterKey, "checkout", 0)
+	require.NoError(t, err)
+	e := events.next(t)
+	assert.Equal(t, "3", e.ID)
+	got = values(t, e)
+	require.Len(t, got, 1)
+	assert.Equal(t, "checkout", got["checkout"].FlagKey)
+
+	description := "no new value"
+	_, err = s.store.UpdateFlag(t.Context(), models.ActorMasterKey, "checkout", 0, &models.UpdateFlagRequest{Description: &description})
+	require.NoError(t, err)
+	_, err = s.store.ToggleFlag(t.Context(), models.ActorMasterKey, "other", 0)
+	require.NoError(t, err)
+	events.none(t, 200*time.Millisecond)
+}
+
+func TestEvaluateStream_BadRequests(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive)
+
+	s.expectStatus(t, http.StatusBadRequest, http.MethodGet, "/api/v1/evaluate/stream", key, nil)
+	s.expectStatus(t, http.StatusBadRequest, http.MethodGet, "/api/v1/evaluate/stream?flags=a&context=nope", key, nil)
+	s.expectStatus(t, http.StatusBadRequest, http.MethodPost, "/api/v1/evaluate/stream", key, models.BatchEvaluateRequest{})
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/getflaggy/flaggy/internal/engine"
+	"github.com/getflaggy/flaggy/internal/exposure"
 	"github.com/getflaggy/flaggy/internal/models"
 )
 
@@ -19,18 +20,52 @@ func (s *Server) Evaluate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flag, err := s.store.GetFlagForEvaluation(req.FlagKey)
+	flag, err := s.store.GetFlagForEvaluation(r.Context(), req.FlagKey)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondStoreError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if flag == nil {
+		s.metrics.CountEvaluation("", "not_found")
 		respondError(w, http.StatusNotFound, "flag not found")
 		return
 	}
 
 	ctx := engine.EvalContext(req.Context)
 	resp := engine.Evaluate(flag, ctx)
+	s.metrics.CountEvaluation(resp.FlagKey, resp.Reason)
+	s.recordExposure(ctx, resp)
 
 	respondJSON(w, http.StatusOK, resp)
 }
+
+// recordExposure queues an exposure event for the evaluated value.
+// Contexts without an entity ID are skipped: the exposure can't be attributed.
+func (s *Server) recordExposure(ctx engine.EvalContext, resp models.EvaluateResponse) {
+	if s.exposures == nil {
+		return
+	}
+	entityID, ok := ctx.EntityID()
+	if !ok {
+		return
+	}
+
+	var attrs map[string]interface{}
+	for _, attr := range s.exposures.Attributes() {
+		if v, ok := ctx.Lookup(attr); ok {
+			if attrs == nil {
+				attrs = make(map[string]interface{})
+			}
+			attrs[attr] = v
+		}
+	}
+
+	s.exposures.Record(exposure.Event{
+		FlagKey:    resp.FlagKey,
+		Value:      resp.Value,
+		Reason:     resp.Reason,
+		RuleID:     resp.RuleID,
+		EntityID:   entityID,
+		Attributes: attrs,
+	})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+)
+
+// publishChanges sends the events of a write committed by the store to SSE
+// clients and wakes the webhook dispatcher for the deliveries the write
+// queued. Stores with an event log number events in the write's
+// transaction; those of other stores are numbered here, so they can't be
+// resumed after a restart.
+//
+// The store calls it for one write at a time, in commit order, so clients
+// always see events in sequence order.
+func (s *Server) publishChanges(events []models.ChangeEvent) {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	for _, e := range events {
+		if e.Seq == 0 {
+			e.Seq, e.CreatedAt = s.lastSeq+1, time.Now().UTC()
+		}
+		s.lastSeq = e.Seq
+		if e.Environment == "" {
+			e.Environment = s.environment
+		}
+		s.broadcaster.Publish(sseEvent(e))
+	}
+	if s.webhooks != nil {
+		s.dispatcher.Notify()
+	}
+}
+
+// sseEvent converts a logged event for the broadcaster.
+func sseEvent(e models.ChangeEvent) sse.Event {
+	return sse.Event{
+		ID:          seqID(e.Seq),
+		Seq:         e.Seq,
+		Type:        e.Type,
+		FlagKey:     e.FlagKey,
+		Environment: string(e.Environment),
+		Data:        e.Data,
+	}
+}
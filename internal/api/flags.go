@@ -1,14 +1,15 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/getflaggy/flaggy/internal/models"
-	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
 )
 
 func (s *Server) CreateFlag(w http.ResponseWriter, r *http.Request) {
@@ -18,105 +19,217 @@ func (s *Server) CreateFlag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flag := &models.Flag{
-		Key:          req.Key,
-		Type:         req.Type,
-		Description:  req.Description,
-		Enabled:      req.Enabled,
-		DefaultValue: req.DefaultValue,
+	flag, status, err := s.createFlag(r.Context(), actorFrom(r), &req)
+	if err != nil {
+		respondStoreError(w, status, err)
+		return
 	}
 
-	if err := models.ValidateFlag(flag); err != nil {
+	setETag(w, flag.Version)
+	respondJSON(w, http.StatusCreated, flag)
+}
+
+// createFlag creates a flag from req. Like the other write functions, it is
+// shared by the write handlers and approved change requests, and returns the
+// HTTP status to use on error.
+func (s *Server) createFlag(ctx context.Context, actor models.Actor, req *models.CreateFlagRequest) (*models.Flag, int, error) {
+	flag, status, err := s.flagFromRequest(ctx, req)
+	if err != nil {
+		return nil, status, err
+	}
+	if err := s.store.CreateFlag(ctx, actor, flag); err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("flag already exists or DB error: %w", err)
+	}
+	return flag, 0, nil
+}
+
+// CloneFlag copies a flag, with its rules and their segment references,
+// under a new key. The copy is created disabled. If-Match applies to the
+// flag copied.
+func (s *Server) CloneFlag(w http.ResponseWriter, r *http.Request) {
+	version, err := ifMatch(r)
+	if err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	var req models.CloneFlagRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
 
-	if err := s.store.CreateFlag(flag); err != nil {
-		respondError(w, http.StatusConflict, "flag already exists or DB error: "+err.Error())
+	flag, status, err := s.cloneFlag(r.Context(), actorFrom(r), chi.URLParam(r, "key"), version, &req)
+	if err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
 
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "flag_created", Data: flag,
-	})
+	setETag(w, flag.Version)
 	respondJSON(w, http.StatusCreated, flag)
 }
 
+func (s *Server) cloneFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.CloneFlagRequest) (*models.Flag, int, error) {
+	flag, status, err := s.flagClone(ctx, key, version, req)
+	if err != nil {
+		return nil, status, err
+	}
+	if err := s.store.CreateFlag(ctx, actor, flag); err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("flag already exists or DB error: %w", err)
+	}
+	return flag, 0, nil
+}
+
+// flagClone returns the copy of flag key that req asks for, without
+// creating it. A version other than 0 must be the flag's.
+func (s *Server) flagClone(ctx context.Context, key string, version int, req *models.CloneFlagRequest) (*models.Flag, int, error) {
+	source, err := s.store.GetFlag(ctx, key)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if source == nil {
+		return nil, http.StatusNotFound, errors.New("flag not found")
+	}
+	if version != 0 && source.Version != version {
+		return nil, http.StatusPreconditionFailed, errors.New("flag was modified concurrently")
+	}
+
+	fc := models.FlagToConfig(source)
+	fc.Key, fc.Enabled = req.Key, false
+	if req.Description != nil {
+		fc.Description = *req.Description
+	}
+	if err := models.ValidateFlagConfig(&fc); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return models.FlagFromConfig(&fc), 0, nil
+}
+
+// ListFlags returns flags, sorted by key unless sort says otherwise.
+// q searches keys and descriptions. With limit (max 500) or cursor, it
+// returns a page with the cursor of the next one.
 func (s *Server) ListFlags(w http.ResponseWriter, r *http.Request) {
-	flags, err := s.store.ListFlags()
+	opts, paged, ok := parseListOptions(w, r, models.FlagSorts)
+	if !ok {
+		return
+	}
+	flags, info, err := s.store.ListFlags(r.Context(), opts)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondListError(w, err)
 		return
 	}
 	if flags == nil {
 		flags = []models.Flag{}
 	}
+	if paged {
+		respondJSON(w, http.StatusOK, flagPage{Flags: flags, PageInfo: info})
+		return
+	}
 	respondJSON(w, http.StatusOK, flags)
 }
 
 func (s *Server) GetFlag(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
-	flag, err := s.store.GetFlag(key)
+	flag, err := s.store.GetFlag(r.Context(), key)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondStoreError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if flag == nil {
 		respondError(w, http.StatusNotFound, "flag not found")
 		return
 	}
+	setETag(w, flag.Version)
 	respondJSON(w, http.StatusOK, flag)
 }
 
 func (s *Server) UpdateFlag(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
 
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	var req models.UpdateFlagRequest
 	if err := decodeJSON(r, &req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
 
-	flag, err := s.store.UpdateFlag(key, &req)
+	flag, status, err := s.updateFlag(r.Context(), actorFrom(r), key, version, &req)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondStoreError(w, status, err)
 		return
 	}
+	setETag(w, flag.Version)
+	respondJSON(w, http.StatusOK, flag)
+}
+
+func (s *Server) updateFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateFlagRequest) (*models.Flag, int, error) {
+	flag, err := s.store.UpdateFlag(ctx, actor, key, version, req)
+	if errors.Is(err, store.ErrVersionMismatch) {
+		return nil, http.StatusPreconditionFailed, errors.New("flag was modified concurrently")
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 	if flag == nil {
-		respondError(w, http.StatusNotFound, "flag not found")
-		return
+		return nil, http.StatusNotFound, errors.New("flag not found")
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "flag_updated", Data: flag,
-	})
-	respondJSON(w, http.StatusOK, flag)
+	return flag, 0, nil
 }
 
 func (s *Server) DeleteFlag(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
-	if err := s.store.DeleteFlag(key); err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status, err := s.deleteFlag(r.Context(), actorFrom(r), key, version); err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "flag_deleted", Data: map[string]string{"key": key},
-	})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) deleteFlag(ctx context.Context, actor models.Actor, key string, version int) (int, error) {
+	if err := s.store.DeleteFlag(ctx, actor, key, version); err != nil {
+		if errors.Is(err, store.ErrVersionMismatch) {
+			return http.StatusPreconditionFailed, errors.New("flag was modified concurrently")
+		}
+		return http.StatusNotFound, err
+	}
+	return 0, nil
+}
+
 func (s *Server) ToggleFlag(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
-	flag, err := s.store.ToggleFlag(key)
+	version, err := ifMatch(r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if flag == nil {
-		respondError(w, http.StatusNotFound, "flag not found")
+	flag, status, err := s.toggleFlag(r.Context(), actorFrom(r), key, version)
+	if err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "flag_toggled", Data: flag,
-	})
+	setETag(w, flag.Version)
 	respondJSON(w, http.StatusOK, flag)
 }
+
+func (s *Server) toggleFlag(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, int, error) {
+	flag, err := s.store.ToggleFlag(ctx, actor, key, version)
+	if errors.Is(err, store.ErrVersionMismatch) {
+		return nil, http.StatusPreconditionFailed, errors.New("flag was modified concurrently")
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if flag == nil {
+		return nil, http.StatusNotFound, errors.New("flag not found")
+	}
+	return flag, 0, nil
+}
@@ -0,0 +1,89 @@
+package api_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/oidc"
+)
+
+// signES256 builds a JWT signed with key.
+func signES256(t *testing.T, key *ecdsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	h, err := json.Marshal(map[string]string{"alg": "ES256", "kid": "k1", "typ": "JWT"})
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	input := enc(h) + "." + enc(c)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + enc(sig)
+}
+
+func TestRequireAdmin_JWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	verifier, err := oidc.NewVerifier(oidc.Config{
+		Issuer:   "https://idp.example.com",
+		Audience: "flaggy",
+		RoleMap:  map[string]models.Role{"flaggy-editors": models.RoleEditor},
+	}, oidc.StaticSource{"k1": &key.PublicKey})
+	require.NoError(t, err)
+	s := newTestServer(t, api.Options{JWT: verifier})
+	s.createFlag(t, "checkout")
+
+	token := func(groups []string, exp time.Time) string {
+		return signES256(t, key, map[string]any{
+			"iss": "https://idp.example.com", "aud": "flaggy",
+			"email": "alice@example.com", "groups": groups,
+			"iat": time.Now().Unix(), "exp": exp.Unix(),
+		})
+	}
+	editor := token([]string{"flaggy-editors"}, time.Now().Add(time.Hour))
+
+	resp := s.expectStatus(t, http.StatusOK, http.MethodGet, "/api/v1/me", editor, nil)
+	me := decodeBody[struct {
+		Actor models.Actor `json:"actor"`
+		Role  models.Role  `json:"role"`
+	}](t, resp)
+	assert.Equal(t, models.Actor{Type: oidc.ActorType, ID: "alice@example.com"}, me.Actor)
+	assert.Equal(t, models.RoleEditor, me.Role)
+
+	s.expectStatus(t, http.StatusOK, http.MethodPatch, "/api/v1/flags/checkout/toggle", editor, nil)
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/users", editor, nil)
+
+	entries, err := s.store.ListAuditEntries(t.Context(), models.AuditFilter{ResourceKey: "checkout", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice@example.com", entries[0].Actor.ID)
+
+	// Valid, but mapped to no role
+	s.expectStatus(t, http.StatusForbidden, http.MethodGet, "/api/v1/flags", token([]string{"everyone"}, time.Now().Add(time.Hour)), nil)
+	// Expired
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodGet, "/api/v1/flags", token([]string{"flaggy-editors"}, time.Now().Add(-time.Hour)), nil)
+	// Signed by someone else
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	forged := signES256(t, other, map[string]any{
+		"iss": "https://idp.example.com", "aud": "flaggy", "email": "mallory@example.com",
+		"groups": []string{"flaggy-editors"}, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	s.expectStatus(t, http.StatusUnauthorized, http.MethodGet, "/api/v1/flags", forged, nil)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// KeyUsage collects API key and user token uses and writes last_used_at in
+// batches, so authenticating a request never waits on a database write.
+type KeyUsage struct {
+	store    apiKeyToucher
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]time.Time // key ID → last use since the previous flush
+	tokens  map[string]time.Time // user token ID → last use since the previous flush
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// apiKeyToucher is the subset of Store needed by KeyUsage.
+type apiKeyToucher interface {
+	TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+// userTokenToucher is implemented by stores with user tokens.
+type userTokenToucher interface {
+	TouchUserTokens(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+// NewKeyUsage starts a tracker that flushes every interval (default 30s).
+// Call Close to write the last batch.
+func NewKeyUsage(s apiKeyToucher, interval time.Duration) *KeyUsage {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	u := &KeyUsage{
+		store:    s,
+		interval: interval,
+		pending:  make(map[string]time.Time),
+		tokens:   make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go u.run()
+	return u
+}
+
+// Record notes that the key was used now. It is safe on a nil KeyUsage.
+func (u *KeyUsage) Record(keyID string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.pending[keyID] = time.Now().UTC()
+	u.mu.Unlock()
+}
+
+// RecordUserToken notes that the user token was used now. It is safe on a
+// nil KeyUsage.
+func (u *KeyUsage) RecordUserToken(tokenID string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.tokens[tokenID] = time.Now().UTC()
+	u.mu.Unlock()
+}
+
+// Close stops the tracker and writes any pending uses.
+func (u *KeyUsage) Close() {
+	close(u.stop)
+	<-u.done
+}
+
+func (u *KeyUsage) run() {
+	defer close(u.done)
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.flush()
+		case <-u.stop:
+			u.flush()
+			return
+		}
+	}
+}
+
+func (u *KeyUsage) flush() {
+	u.mu.Lock()
+	batch, tokens := u.pending, u.tokens
+	u.pending = make(map[string]time.Time, len(batch))
+	u.tokens = make(map[string]time.Time, len(tokens))
+	u.mu.Unlock()
+
+	if len(batch) > 0 {
+		if err := u.store.TouchAPIKeys(context.Background(), batch); err != nil {
+			slog.Warn("failed to record API key usage", "keys", len(batch), "error", err)
+		}
+	}
+	if t, ok := u.store.(userTokenToucher); ok && len(tokens) > 0 {
+		if err := t.TouchUserTokens(context.Background(), tokens); err != nil {
+			slog.Warn("failed to record user token usage", "tokens", len(tokens), "error", err)
+		}
+	}
+}
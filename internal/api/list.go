@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+type flagPage struct {
+	Flags []models.Flag `json:"flags"`
+	models.PageInfo
+}
+
+type segmentPage struct {
+	Segments []models.Segment `json:"segments"`
+	models.PageInfo
+}
+
+type apiKeyPage struct {
+	Keys []models.APIKey `json:"keys"`
+	models.PageInfo
+}
+
+// parseListOptions reads q, sort, limit and cursor for a list accepting the
+// sort fields in sorts. It reports whether the client asked for a page (with
+// limit or cursor); lists without one return every match as a bare array,
+// as they did before pagination.
+func parseListOptions(w http.ResponseWriter, r *http.Request, sorts []string) (opts models.ListOptions, paged, ok bool) {
+	q := r.URL.Query()
+	opts = models.ListOptions{
+		Query:  q.Get("q"),
+		Sort:   q.Get("sort"),
+		Cursor: q.Get("cursor"),
+	}
+	if _, _, err := models.ParseSort(opts.Sort, sorts); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return opts, false, false
+	}
+	if !q.Has("limit") && opts.Cursor == "" {
+		return opts, false, true
+	}
+
+	opts.Limit = defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit <= 0 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return opts, false, false
+		}
+		if opts.Limit > maxListLimit {
+			opts.Limit = maxListLimit
+		}
+	}
+	return opts, true, true
+}
+
+// respondListError responds to a failed list call.
+func respondListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrInvalidCursor) {
+		respondError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	respondStoreError(w, http.StatusInternalServerError, err)
+}
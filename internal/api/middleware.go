@@ -6,6 +6,10 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/metrics"
 )
 
 // RequestLogger logs each request using slog.
@@ -54,6 +58,38 @@ func RequestLogger(next http.Handler) http.Handler {
 	})
 }
 
+// streamRoutes are the route patterns of long-lived streaming connections.
+var streamRoutes = map[string]bool{
+	"/api/v1/stream":          true,
+	"/api/v1/evaluate/stream": true,
+	"/api/v1/ws":              true,
+}
+
+// RequestMetrics records request counts and latency by route and status.
+// The route is chi's matched pattern (e.g. /api/v1/flags/{key}) so that
+// URL parameters don't explode label cardinality.
+func RequestMetrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(ww, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			// Streams are long-lived, their duration isn't request latency
+			var d time.Duration
+			if !streamRoutes[route] {
+				d = time.Since(start)
+			}
+			m.ObserveHTTP(r.Method, route, ww.status, d)
+		})
+	}
+}
+
 type statusWriter struct {
 	http.ResponseWriter
 	status      int
@@ -83,7 +119,8 @@ func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, If-Match, X-Flaggy-Actor")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		w.Header().Set("Access-Control-Max-Age", "300")
 
 		if r.Method == "OPTIONS" {
@@ -102,3 +139,15 @@ func JSONContentType(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RejectWrites answers every request but GET and HEAD with 403, for stores
+// that can't be written.
+func RejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondError(w, http.StatusForbidden, "this server is read-only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
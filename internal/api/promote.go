@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// Peer is the server managing another environment, which flags are
+// promoted from.
+type Peer struct {
+	URL   string
+	Token string // API key or token with read access to flags
+}
+
+var errPeerFlagNotFound = errors.New("flag not found")
+
+// peerClient fetches flags from peers.
+var peerClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchFlag reads a flag from the peer's API.
+func (p Peer) fetchFlag(ctx context.Context, key string) (*models.Flag, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(p.URL, "/")+"/api/v1/flags/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errPeerFlagNotFound
+	default:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server responded %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var flag models.Flag
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&flag); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &flag, nil
+}
+
+// PromoteFlag copies a flag's description, default value and rules from the
+// server managing the from environment to this one. With dry_run=true it
+// only returns the changes it would make.
+func (s *Server) PromoteFlag(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	q := r.URL.Query()
+	from, to := models.Environment(q.Get("from")), models.Environment(q.Get("to"))
+	if to == "" {
+		to = s.environment
+	}
+	if err := models.ValidateEnvironment(from); err != nil {
+		respondError(w, http.StatusBadRequest, "from: "+err.Error())
+		return
+	}
+	if to != s.environment {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf(
+			"this server manages the %s environment; send the promotion to the %s server", s.environment, to))
+		return
+	}
+	if from == to {
+		respondError(w, http.StatusBadRequest, "from and to are the same environment")
+		return
+	}
+	peer, ok := s.peers[from]
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf(
+			"no server is configured for the %s environment; set FLAGGY_PEER_URLS", from))
+		return
+	}
+
+	source, err := peer.fetchFlag(r.Context(), key)
+	if errors.Is(err, errPeerFlagNotFound) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("flag not found in %s", from))
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("fetch flag from %s: %v", from, err))
+		return
+	}
+	fc := models.PromotedConfig(source, nil)
+	if err := models.ValidateFlagConfig(&fc); err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("invalid flag from %s: %v", from, err))
+		return
+	}
+
+	p, err := s.promotions.PromoteFlag(r.Context(), actorFrom(r), source, q.Get("dry_run") == "true")
+	if err != nil {
+		if errors.Is(err, store.ErrMissingSegments) || errors.Is(err, store.ErrFlagTypeChange) {
+			respondStoreError(w, http.StatusConflict, err)
+			return
+		}
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	p.From, p.To = from, to
+
+	if p.Applied {
+		setETag(w, p.Flag.Version)
+	}
+	respondJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/getflaggy/flaggy/internal/metrics"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/ratelimit"
+)
+
+// RateLimit returns a middleware that applies a token bucket per API key,
+// using the key's own limit or def. Requests made without an API key (master
+// key, user tokens) aren't limited. It must run after RequireAPIKey or
+// RequireAdmin.
+func RateLimit(lim *ratelimit.Limiter, def ratelimit.Limit, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := apiKeyFrom(r)
+			if apiKey == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, wait := lim.Allow(apiKey.ID, keyLimit(apiKey, def))
+			if !ok {
+				m.CountRateLimited()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				respondError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// keyLimit returns the limit for k: its own if set, otherwise def. A burst
+// of 0 defaults to the rate, rounded up.
+func keyLimit(k *models.APIKey, def ratelimit.Limit) ratelimit.Limit {
+	l := def
+	if k.RateLimit > 0 {
+		l = ratelimit.Limit{Rate: k.RateLimit, Burst: k.RateBurst}
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+	}
+	return l
+}
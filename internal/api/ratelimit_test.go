@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	s := newTestServer(t, api.Options{RateLimit: ratelimit.Limit{Rate: 0.5, Burst: 2}})
+	s.createFlag(t, "checkout")
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+	_, key := s.createKey(t, models.EnvLive)
+
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", key, evaluate)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", key, evaluate)
+	resp := s.expectStatus(t, http.StatusTooManyRequests, http.MethodPost, "/api/v1/evaluate", key, evaluate)
+	wait, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, wait, "a token comes every 2s")
+
+	// Other keys and the master key have their own buckets
+	_, other := s.createKey(t, models.EnvLive)
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", other, evaluate)
+	for range 3 {
+		s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", testMasterKey, evaluate)
+	}
+}
+
+func TestRateLimit_PerKeyLimit(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	s.createFlag(t, "checkout")
+	evaluate := models.EvaluateRequest{FlagKey: "checkout"}
+	k, key := s.createKey(t, models.EnvLive)
+	s.expectStatus(t, http.StatusOK, http.MethodPatch, "/api/v1/api-keys/"+k.ID, testMasterKey,
+		map[string]any{"rate_limit": 0.1, "rate_burst": 1})
+
+	s.expectStatus(t, http.StatusOK, http.MethodPost, "/api/v1/evaluate", key, evaluate)
+	resp := s.expectStatus(t, http.StatusTooManyRequests, http.MethodPost, "/api/v1/evaluate", key, evaluate)
+	assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+
+	"github.com/getflaggy/flaggy/internal/store"
 )
 
-const maxBodySize = 1 << 20 // 1 MB
+const (
+	maxBodySize   = 1 << 20  // 1 MB
+	maxConfigSize = 16 << 20 // 16 MB, for whole configs
+)
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -18,8 +25,39 @@ func respondError(w http.ResponseWriter, status int, msg string) {
 	respondJSON(w, status, map[string]string{"error": msg})
 }
 
+// respondStoreError responds to a failed store call with status and the
+// error, unless storeUnavailable handles it.
+func respondStoreError(w http.ResponseWriter, status int, err error) {
+	if !storeUnavailable(w, err) {
+		respondError(w, status, err.Error())
+	}
+}
+
+// storeUnavailable responds 504 if a store call failed because it timed out,
+// and 503 if the database was locked or the request was canceled. It
+// reports whether it responded.
+func storeUnavailable(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		respondError(w, http.StatusGatewayTimeout, "database query timed out")
+	case store.IsBusy(err):
+		w.Header().Set("Retry-After", "1")
+		respondError(w, http.StatusServiceUnavailable, "database is busy, retry later")
+	case errors.Is(err, context.Canceled):
+		respondError(w, http.StatusServiceUnavailable, "request canceled")
+	default:
+		return false
+	}
+	return true
+}
+
 func decodeJSON(r *http.Request, dst interface{}) error {
-	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	return decodeJSONLimit(r, dst, maxBodySize)
+}
+
+// decodeJSONLimit is decodeJSON for bodies of up to limit bytes.
+func decodeJSONLimit(r *http.Request, dst interface{}, limit int64) error {
+	r.Body = http.MaxBytesReader(nil, r.Body, limit)
 	defer io.Copy(io.Discard, r.Body)
 	return json.NewDecoder(r.Body).Decode(dst)
 }
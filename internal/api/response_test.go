@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// failingStore is a SQLite store whose flag reads and API key lookups fail
+// with err.
+type failingStore struct {
+	*store.SQLiteStore
+	err error
+}
+
+func (f *failingStore) GetFlag(context.Context, string) (*models.Flag, error) {
+	return nil, f.err
+}
+
+func (f *failingStore) ValidateAPIKey(context.Context, string) (*models.APIKey, error) {
+	return nil, f.err
+}
+
+// busyError returns the error SQLite gives a write while another connection
+// holds the write lock.
+func busyError(t *testing.T) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "busy.db")
+	holder, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer holder.Close()
+	conn, err := holder.Conn(t.Context())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(t.Context(), "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	writer, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(0)")
+	require.NoError(t, err)
+	defer writer.Close()
+	_, err = writer.ExecContext(t.Context(), "CREATE TABLE t (x)")
+	require.Error(t, err)
+	require.True(t, store.IsBusy(err), err.Error())
+	return err
+}
+
+func TestStoreUnavailable(t *testing.T) {
+	busy := busyError(t)
+	tests := []struct {
+		name       string
+		err        error
+		want       int
+		retryAfter string
+	}{
+		{"timeout", fmt.Errorf("get flag: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, ""},
+		{"busy", fmt.Errorf("get flag: %w", busy), http.StatusServiceUnavailable, "1"},
+		{"canceled", fmt.Errorf("get flag: %w", context.Canceled), http.StatusServiceUnavailable, ""},
+		{"other", errors.New("disk I/O error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &failingStore{SQLiteStore: newTestStore(t, ""), err: tt.err}
+			srv := httptest.NewServer(api.NewRouter(api.Options{Store: st, Broadcaster: sse.NewBroadcaster(), MasterKey: testMasterKey}))
+			t.Cleanup(srv.Close)
+			s := &testServer{Server: srv, store: st.SQLiteStore}
+
+			// A failed handler store call
+			resp := s.expectStatus(t, tt.want, http.MethodGet, "/api/v1/flags/checkout", testMasterKey, nil)
+			assert.Equal(t, tt.retryAfter, resp.Header.Get("Retry-After"))
+
+			// A failed API key lookup
+			resp = s.expectStatus(t, tt.want, http.MethodPost, "/api/v1/evaluate", "some-api-key",
+				models.EvaluateRequest{FlagKey: "checkout"})
+			assert.Equal(t, tt.retryAfter, resp.Header.Get("Retry-After"))
+		})
+	}
+}
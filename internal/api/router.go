@@ -1,63 +1,309 @@
 package api
 
 import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/go-chi/chi/v5"
 
+	"github.com/getflaggy/flaggy/internal/exposure"
+	"github.com/getflaggy/flaggy/internal/metrics"
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/oidc"
+	"github.com/getflaggy/flaggy/internal/ratelimit"
 	"github.com/getflaggy/flaggy/internal/sse"
 	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/internal/webhook"
 )
 
 // Server holds dependencies for all HTTP handlers.
 type Server struct {
-	store       store.Store
-	broadcaster *sse.Broadcaster
+	store         store.Store
+	broadcaster   *sse.Broadcaster
+	metrics       *metrics.Metrics
+	exposures     *exposure.Pipeline
+	audit         store.AuditLog       // nil if the store doesn't keep an audit log
+	history       store.FlagHistory    // nil if the store doesn't keep flag versions
+	changes       store.ChangeRequests // nil if the store doesn't support change requests
+	users         store.Users          // nil if the store doesn't keep admin users
+	webhooks      store.Webhooks       // nil if the store doesn't support webhooks
+	dispatcher    *webhook.Dispatcher
+	events        store.EventLog              // nil if the store doesn't keep events; SSE clients can't resume
+	configs       store.DeclarativeConfig     // nil if the store can't export or apply configs
+	backups       store.Backups               // nil if the store can't back itself up
+	promotions    store.Promotions            // nil if the store can't promote flags
+	templates     store.FlagTemplates         // nil if the store doesn't keep flag templates
+	peers         map[models.Environment]Peer // servers of the other environments, for promotion
+	publishMu     sync.Mutex                  // orders event numbering and broadcast
+	lastSeq       int64                       // number of the last event broadcast
+	environment   models.Environment
+	scoped        bool // Environment was set: streams only send API keys events of their environment
+	rotationGrace time.Duration
+}
+
+// Options holds the dependencies and settings for NewRouter.
+type Options struct {
+	Store       store.Store
+	Broadcaster *sse.Broadcaster
+	Metrics     *metrics.Metrics // Optional. If nil, /metrics is not served.
+	// MetricsPublic serves /metrics without auth, for scrapers on a private
+	// network. Otherwise it takes admin credentials with read permission.
+	MetricsPublic bool
+	Exposures     *exposure.Pipeline // Optional. If nil, no exposure events are recorded.
+	MasterKey     string             // Protects admin routes. If empty, auth is disabled (dev mode).
+	CORSEnabled   bool
+	// Environment is the environment this server manages; it selects the
+	// write policy. If set, API keys of other environments get no change
+	// events. Empty means live, with events sent to every key.
+	Environment models.Environment
+	KeyUsage    *KeyUsage // Optional. If nil, API key last_used_at isn't updated.
+	// RotationGrace is how long a rotated API key keeps working unless the
+	// rotate request says otherwise.
+	RotationGrace time.Duration
+	// RateLimit applies to API keys without a limit of their own. The zero
+	// value doesn't limit them.
+	RateLimit ratelimit.Limit
+	JWT       *oidc.Verifier // Optional. If set, admin routes accept JWTs from the identity provider.
+	// Webhooks is woken when events are queued for webhooks. Optional; if
+	// nil, queued deliveries wait for whatever dispatcher polls the store.
+	Webhooks *webhook.Dispatcher
+	// Peers are the servers managing the other environments, which flags
+	// are promoted from. Optional.
+	Peers map[models.Environment]Peer
 }
 
 // NewRouter creates a Chi router with all routes wired.
-// masterKey protects admin routes. If empty, auth is disabled (dev mode).
-func NewRouter(s store.Store, b *sse.Broadcaster, masterKey string, corsEnabled bool) *chi.Mux {
-	srv := &Server{store: s, broadcaster: b}
+func NewRouter(opts Options) *chi.Mux {
+	s, m, masterKey := opts.Store, opts.Metrics, opts.MasterKey
+	srv := &Server{
+		store:         s,
+		broadcaster:   opts.Broadcaster,
+		metrics:       m,
+		exposures:     opts.Exposures,
+		environment:   opts.Environment,
+		scoped:        opts.Environment != "",
+		rotationGrace: opts.RotationGrace,
+		dispatcher:    opts.Webhooks,
+		peers:         opts.Peers,
+	}
+	if srv.environment == "" {
+		srv.environment = models.EnvLive
+	}
+	if a, ok := s.(store.AuditLog); ok {
+		srv.audit = a
+	}
+	if h, ok := s.(store.FlagHistory); ok {
+		srv.history = h
+	}
+	if u, ok := s.(store.Users); ok {
+		srv.users = u
+	}
+	if e, ok := s.(store.EventLog); ok {
+		srv.events = e
+	}
+	if wh, ok := s.(store.Webhooks); ok {
+		srv.webhooks = wh
+	}
+	if c, ok := s.(store.DeclarativeConfig); ok {
+		srv.configs = c
+	}
+	if b, ok := s.(store.Backups); ok {
+		srv.backups = b
+	}
+	if p, ok := s.(store.Promotions); ok {
+		srv.promotions = p
+	}
+	if t, ok := s.(store.FlagTemplates); ok {
+		srv.templates = t
+	}
+	if srv.events != nil {
+		// Live events up to here are in the log, for clients to resume from
+		if _, latest, err := srv.events.EventBounds(context.Background()); err != nil {
+			slog.Error("failed to read event log", "error", err)
+		} else {
+			srv.lastSeq = latest
+		}
+	}
+	if f, ok := s.(store.ChangeFeed); ok {
+		f.OnChange(srv.publishChanges)
+	}
+	readOnly := false
+	if ro, ok := s.(store.ReadOnly); ok {
+		readOnly = ro.ReadOnly()
+	}
+	if c, ok := s.(store.ChangeRequests); ok {
+		srv.changes = c
+		if err := srv.applyApproved(context.Background()); err != nil {
+			slog.Error("failed to apply approved change requests", "error", err)
+		}
+	}
+
+	limitKeys := RateLimit(ratelimit.New(), opts.RateLimit, m)
+	requireKey := RequireAPIKey(s, opts.KeyUsage, masterKey, m)
+	if readOnly && masterKey == "" {
+		// A read-only store holds no API keys, so without a master key
+		// client routes are open, as admin routes are in dev mode
+		requireKey = func(next http.Handler) http.Handler { return next }
+	}
 
 	r := chi.NewRouter()
 	r.Use(RequestLogger)
-	if corsEnabled {
+	if m != nil {
+		r.Use(RequestMetrics(m))
+	}
+	if opts.CORSEnabled {
 		r.Use(CORS)
 	}
 
+	if m != nil {
+		if opts.MetricsPublic {
+			r.Method("GET", "/metrics", m.Handler())
+		} else {
+			r.With(RequireAdmin(s, opts.KeyUsage, srv.users, opts.JWT, masterKey, m), RequirePermission(models.PermRead, m)).
+				Method("GET", "/metrics", m.Handler())
+		}
+	}
+
 	r.Route("/api/v1", func(r chi.Router) {
-		// Admin routes — protected by master key
+		// Admin routes — master key, user token or JWT, checked per route by role
 		r.Group(func(r chi.Router) {
-			r.Use(RequireMasterKey(masterKey))
-
-			// Flags CRUD
-			r.Post("/flags", srv.CreateFlag)
-			r.Get("/flags", srv.ListFlags)
-			r.Get("/flags/{key}", srv.GetFlag)
-			r.Put("/flags/{key}", srv.UpdateFlag)
-			r.Delete("/flags/{key}", srv.DeleteFlag)
-			r.Patch("/flags/{key}/toggle", srv.ToggleFlag)
-
-			// Rules CRUD
-			r.Post("/flags/{key}/rules", srv.CreateRule)
-			r.Put("/flags/{key}/rules/{ruleID}", srv.UpdateRule)
-			r.Delete("/flags/{key}/rules/{ruleID}", srv.DeleteRule)
-
-			// Segments CRUD
-			r.Post("/segments", srv.CreateSegment)
-			r.Get("/segments", srv.ListSegments)
-			r.Get("/segments/{key}", srv.GetSegment)
-			r.Put("/segments/{key}", srv.UpdateSegment)
-			r.Delete("/segments/{key}", srv.DeleteSegment)
+			r.Use(RequireAdmin(s, opts.KeyUsage, srv.users, opts.JWT, masterKey, m))
+			r.Use(limitKeys)
+			can := func(p models.Permission) func(http.Handler) http.Handler {
+				return RequirePermission(p, m)
+			}
+
+			r.Get("/me", srv.WhoAmI)
+
+			// Flag and segment reads — also open to API keys with a read scope
+			r.Group(func(r chi.Router) {
+				r.Use(RequireAccess(models.PermRead, models.ScopeReadFlags, m))
+
+				r.Get("/flags", srv.ListFlags)
+				r.Get("/flags/{key}", srv.GetFlag)
+				if srv.history != nil {
+					r.Get("/flags/{key}/versions", srv.ListFlagVersions)
+					r.Get("/flags/{key}/versions/diff", srv.DiffFlagVersions)
+					r.Get("/flags/{key}/versions/{version}", srv.GetFlagVersion)
+				}
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(RequireAccess(models.PermRead, models.ScopeReadSegments, m))
+
+				r.Get("/segments", srv.ListSegments)
+				r.Get("/segments/{key}", srv.GetSegment)
+			})
+
+			// Other reads
+			r.Group(func(r chi.Router) {
+				r.Use(can(models.PermRead))
+
+				if srv.changes != nil {
+					r.Get("/environments/{env}/policy", srv.GetEnvironmentPolicy)
+					r.Get("/change-requests", srv.ListChangeRequests)
+					r.Get("/change-requests/{id}", srv.GetChangeRequest)
+				}
+				if srv.audit != nil {
+					r.Get("/audit", srv.ListAudit)
+				}
+				if srv.configs != nil {
+					r.Get("/config", srv.ExportConfig)
+					r.Post("/config/plan", srv.PlanConfig)
+				}
+				if srv.templates != nil {
+					r.Get("/templates", srv.ListFlagTemplates)
+					r.Get("/templates/{name}", srv.GetFlagTemplate)
+				}
+			})
+
+			// Flags, rules and segments (writes), templates and change requests
+			r.Group(func(r chi.Router) {
+				r.Use(can(models.PermWrite))
+				if readOnly {
+					r.Use(RejectWrites)
+				}
+
+				r.Group(func(r chi.Router) {
+					if srv.changes != nil {
+						r.Use(RequireDirectWrites(srv.changes, srv.environment))
+					}
+					srv.mountWrites(r)
+					if srv.configs != nil {
+						r.Post("/config/apply", srv.ApplyConfig)
+					}
+					if srv.promotions != nil {
+						r.Post("/flags/{key}/promote", srv.PromoteFlag)
+					}
+				})
+				// Templates only affect flags created later, so they aren't
+				// subject to the direct-write policy.
+				if srv.templates != nil {
+					r.Post("/templates", srv.CreateFlagTemplate)
+					r.Put("/templates/{name}", srv.UpdateFlagTemplate)
+					r.Delete("/templates/{name}", srv.DeleteFlagTemplate)
+				}
+				if srv.changes != nil {
+					r.Post("/change-requests", srv.CreateChangeRequest)
+					r.Post("/change-requests/{id}/approve", srv.ApproveChangeRequest)
+					r.Post("/change-requests/{id}/reject", srv.RejectChangeRequest)
+				}
+			})
 
 			// API Keys management
-			r.Post("/api-keys", srv.CreateAPIKey)
-			r.Get("/api-keys", srv.ListAPIKeys)
-			r.Delete("/api-keys/{id}", srv.RevokeAPIKey)
+			r.Group(func(r chi.Router) {
+				r.Use(can(models.PermManageKeys))
+				if readOnly {
+					r.Use(RejectWrites)
+				}
+
+				r.Post("/api-keys", srv.CreateAPIKey)
+				r.Get("/api-keys", srv.ListAPIKeys)
+				r.Patch("/api-keys/{id}", srv.UpdateAPIKey)
+				r.Post("/api-keys/{id}/rotate", srv.RotateAPIKey)
+				r.Delete("/api-keys/{id}", srv.RevokeAPIKey)
+			})
+
+			// Users, environment policies, webhooks and backups
+			r.Group(func(r chi.Router) {
+				r.Use(can(models.PermAdmin))
+
+				if srv.backups != nil {
+					r.Get("/backup", srv.Backup)
+				}
+
+				if srv.changes != nil {
+					r.Put("/environments/{env}/policy", srv.SetEnvironmentPolicy)
+				}
+				if srv.users != nil {
+					r.Post("/users", srv.CreateUser)
+					r.Get("/users", srv.ListUsers)
+					r.Get("/users/{id}", srv.GetUser)
+					r.Patch("/users/{id}", srv.UpdateUser)
+					r.Delete("/users/{id}", srv.DeleteUser)
+					r.Post("/users/{id}/tokens", srv.CreateUserToken)
+					r.Get("/users/{id}/tokens", srv.ListUserTokens)
+					r.Delete("/users/{id}/tokens/{tokenID}", srv.RevokeUserToken)
+				}
+				if srv.webhooks != nil {
+					r.Post("/webhooks", srv.CreateWebhook)
+					r.Get("/webhooks", srv.ListWebhooks)
+					r.Get("/webhooks/{id}", srv.GetWebhook)
+					r.Delete("/webhooks/{id}", srv.DeleteWebhook)
+					r.Get("/webhooks/{id}/deliveries", srv.ListWebhookDeliveries)
+					r.Get("/webhooks/{id}/deliveries/{deliveryID}", srv.GetWebhookDelivery)
+					r.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", srv.RedeliverWebhookDelivery)
+				}
+			})
 		})
 
-		// Client routes — protected by API key (or master key)
+		// Client routes — protected by API key (or master key), checked per route by scope
 		r.Group(func(r chi.Router) {
-			r.Use(RequireAPIKey(s, masterKey))
+			r.Use(requireKey)
+			r.Use(limitKeys)
+			r.Use(RequireScope(models.ScopeEvaluate, m))
 
 			r.Post("/evaluate", srv.Evaluate)
 			r.Post("/evaluate/batch", srv.EvaluateBatch)
@@ -65,11 +311,47 @@ func NewRouter(s store.Store, b *sse.Broadcaster, masterKey string, corsEnabled
 
 		// SSE Stream — protected by API key (or master key)
 		r.Group(func(r chi.Router) {
-			r.Use(RequireAPIKey(s, masterKey))
+			r.Use(requireKey)
+			r.Use(limitKeys)
+			r.Use(RequireScope(models.ScopeStream, m))
 
 			r.Get("/stream", srv.Stream)
+
+			// Evaluated values for one context, pushed as they change
+			r.With(RequireScope(models.ScopeEvaluate, m)).Get("/evaluate/stream", srv.EvaluateStream)
+			r.With(RequireScope(models.ScopeEvaluate, m)).Post("/evaluate/stream", srv.EvaluateStream)
+		})
+
+		// WebSocket change stream — browsers may send the key as a subprotocol
+		r.Group(func(r chi.Router) {
+			r.Use(WebSocketToken)
+			r.Use(requireKey)
+			r.Use(limitKeys)
+			r.Use(RequireScope(models.ScopeStream, m))
+
+			r.Get("/ws", srv.WebSocket)
 		})
 	})
 
 	return r
 }
+
+// mountWrites registers the flag, rule and segment write routes.
+func (s *Server) mountWrites(r chi.Router) {
+	r.Post("/flags", s.CreateFlag)
+	r.Put("/flags/{key}", s.UpdateFlag)
+	r.Delete("/flags/{key}", s.DeleteFlag)
+	r.Patch("/flags/{key}/toggle", s.ToggleFlag)
+	r.Post("/flags/{key}/clone", s.CloneFlag)
+	if s.history != nil {
+		r.Post("/flags/{key}/versions/{version}/restore", s.RestoreFlagVersion)
+	}
+
+	r.Post("/flags/{key}/rules", s.CreateRule)
+	r.Put("/flags/{key}/rules/{ruleID}", s.UpdateRule)
+	r.Delete("/flags/{key}/rules/{ruleID}", s.DeleteRule)
+
+	r.Post("/segments", s.CreateSegment)
+	r.Put("/segments/{key}", s.UpdateSegment)
+	r.Delete("/segments/{key}", s.DeleteSegment)
+}
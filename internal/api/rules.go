@@ -1,64 +1,70 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/getflaggy/flaggy/internal/models"
-	"github.com/getflaggy/flaggy/internal/sse"
+	"github.com/getflaggy/flaggy/internal/store"
 )
 
 func (s *Server) CreateRule(w http.ResponseWriter, r *http.Request) {
 	flagKey := chi.URLParam(r, "key")
 
-	// Verify flag exists
-	flag, err := s.store.GetFlag(flagKey)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if flag == nil {
-		respondError(w, http.StatusNotFound, "flag not found")
-		return
-	}
-
 	var req models.CreateRuleRequest
 	if err := decodeJSON(r, &req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
 
-	rule := &models.Rule{
-		Description:       req.Description,
-		Value:             req.Value,
-		Priority:          req.Priority,
-		RolloutPercentage: req.RolloutPercentage,
-		Conditions:        req.Conditions,
-		SegmentKeys:       req.SegmentKeys,
+	rule, status, err := s.createRule(r.Context(), actorFrom(r), flagKey, &req)
+	if err != nil {
+		respondStoreError(w, status, err)
+		return
 	}
 
+	setETag(w, rule.Version)
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) createRule(ctx context.Context, actor models.Actor, flagKey string, req *models.CreateRuleRequest) (*models.Rule, int, error) {
+	// Verify flag exists
+	flag, err := s.store.GetFlag(ctx, flagKey)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if flag == nil {
+		return nil, http.StatusNotFound, errors.New("flag not found")
+	}
+
+	rule := ruleFromRequest(req)
 	if err := models.ValidateRule(rule); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, http.StatusBadRequest, err
 	}
 	if err := models.ValidateValueForType(flag.Type, req.Value); err != nil {
-		respondError(w, http.StatusBadRequest, "value: "+err.Error())
-		return
+		return nil, http.StatusBadRequest, fmt.Errorf("value: %w", err)
 	}
 
-	if err := s.store.CreateRule(flagKey, rule); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
-		return
+	if err := s.store.CreateRule(ctx, actor, flagKey, rule); err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
+	return rule, 0, nil
+}
 
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "rule_created", Data: rule,
-	})
-	respondJSON(w, http.StatusCreated, rule)
+func ruleFromRequest(req *models.CreateRuleRequest) *models.Rule {
+	return &models.Rule{
+		Description:       req.Description,
+		Value:             req.Value,
+		Priority:          req.Priority,
+		RolloutPercentage: req.RolloutPercentage,
+		Conditions:        req.Conditions,
+		SegmentKeys:       req.SegmentKeys,
+	}
 }
 
 func (s *Server) UpdateRule(w http.ResponseWriter, r *http.Request) {
@@ -69,6 +75,11 @@ func (s *Server) UpdateRule(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "invalid rule ID")
 		return
 	}
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	var req models.CreateRuleRequest
 	if err := decodeJSON(r, &req); err != nil {
@@ -76,28 +87,28 @@ func (s *Server) UpdateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rule := &models.Rule{
-		Description:       req.Description,
-		Value:             req.Value,
-		Priority:          req.Priority,
-		RolloutPercentage: req.RolloutPercentage,
-		Conditions:        req.Conditions,
-		SegmentKeys:       req.SegmentKeys,
-	}
-	if err := models.ValidateRule(rule); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+	updated, status, err := s.updateRule(r.Context(), actorFrom(r), flagKey, ruleID, version, &req)
+	if err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
+	setETag(w, updated.Version)
+	respondJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) updateRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int, req *models.CreateRuleRequest) (*models.Rule, int, error) {
+	if err := models.ValidateRule(ruleFromRequest(req)); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
-	updated, err := s.store.UpdateRule(flagKey, ruleID, &req)
+	updated, err := s.store.UpdateRule(ctx, actor, flagKey, ruleID, version, req)
+	if errors.Is(err, store.ErrVersionMismatch) {
+		return nil, http.StatusPreconditionFailed, errors.New("rule was modified concurrently")
+	}
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
-		return
+		return nil, http.StatusNotFound, err
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "rule_updated", Data: updated,
-	})
-	respondJSON(w, http.StatusOK, updated)
+	return updated, 0, nil
 }
 
 func (s *Server) DeleteRule(w http.ResponseWriter, r *http.Request) {
@@ -108,15 +119,25 @@ func (s *Server) DeleteRule(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "invalid rule ID")
 		return
 	}
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if err := s.store.DeleteRule(flagKey, ruleID); err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+	if status, err := s.deleteRule(r.Context(), actorFrom(r), flagKey, ruleID, version); err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-		Type: "rule_deleted",
-		Data: map[string]interface{}{"flag_key": flagKey, "rule_id": ruleID},
-	})
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (s *Server) deleteRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int) (int, error) {
+	if err := s.store.DeleteRule(ctx, actor, flagKey, ruleID, version); err != nil {
+		if errors.Is(err, store.ErrVersionMismatch) {
+			return http.StatusPreconditionFailed, errors.New("rule was modified concurrently")
+		}
+		return http.StatusNotFound, err
+	}
+	return 0, nil
+}
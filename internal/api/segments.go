@@ -1,15 +1,14 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/getflaggy/flaggy/internal/models"
-	"github.com/getflaggy/flaggy/internal/sse"
 	"github.com/getflaggy/flaggy/internal/store"
 )
 
@@ -20,6 +19,17 @@ func (s *Server) CreateSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	segment, status, err := s.createSegment(r.Context(), actorFrom(r), &req)
+	if err != nil {
+		respondStoreError(w, status, err)
+		return
+	}
+
+	setETag(w, segment.Version)
+	respondJSON(w, http.StatusCreated, segment)
+}
+
+func (s *Server) createSegment(ctx context.Context, actor models.Actor, req *models.CreateSegmentRequest) (*models.Segment, int, error) {
 	segment := &models.Segment{
 		Key:         req.Key,
 		Description: req.Description,
@@ -27,49 +37,58 @@ func (s *Server) CreateSegment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := models.ValidateSegment(segment); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, http.StatusBadRequest, err
 	}
 
-	if err := s.store.CreateSegment(segment); err != nil {
-		respondError(w, http.StatusConflict, "segment already exists or DB error: "+err.Error())
-		return
+	if err := s.store.CreateSegment(ctx, actor, segment); err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("segment already exists or DB error: %w", err)
 	}
-
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "segment_created", Data: segment,
-	})
-	respondJSON(w, http.StatusCreated, segment)
+	return segment, 0, nil
 }
 
+// ListSegments returns segments like ListFlags returns flags.
 func (s *Server) ListSegments(w http.ResponseWriter, r *http.Request) {
-	segments, err := s.store.ListSegments()
+	opts, paged, ok := parseListOptions(w, r, models.SegmentSorts)
+	if !ok {
+		return
+	}
+	segments, info, err := s.store.ListSegments(r.Context(), opts)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondListError(w, err)
 		return
 	}
 	if segments == nil {
 		segments = []models.Segment{}
 	}
+	if paged {
+		respondJSON(w, http.StatusOK, segmentPage{Segments: segments, PageInfo: info})
+		return
+	}
 	respondJSON(w, http.StatusOK, segments)
 }
 
 func (s *Server) GetSegment(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
-	segment, err := s.store.GetSegment(key)
+	segment, err := s.store.GetSegment(r.Context(), key)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondStoreError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if segment == nil {
 		respondError(w, http.StatusNotFound, "segment not found")
 		return
 	}
+	setETag(w, segment.Version)
 	respondJSON(w, http.StatusOK, segment)
 }
 
 func (s *Server) UpdateSegment(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	var req models.UpdateSegmentRequest
 	if err := decodeJSON(r, &req); err != nil {
@@ -77,49 +96,64 @@ func (s *Server) UpdateSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	segment, status, err := s.updateSegment(r.Context(), actorFrom(r), key, version, &req)
+	if err != nil {
+		respondStoreError(w, status, err)
+		return
+	}
+	setETag(w, segment.Version)
+	respondJSON(w, http.StatusOK, segment)
+}
+
+func (s *Server) updateSegment(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateSegmentRequest) (*models.Segment, int, error) {
 	// Validate new conditions if provided
 	if req.Conditions != nil {
 		if len(req.Conditions) == 0 {
-			respondError(w, http.StatusBadRequest, "segment must have at least one condition")
-			return
+			return nil, http.StatusBadRequest, errors.New("segment must have at least one condition")
 		}
 		for i, c := range req.Conditions {
 			if err := models.ValidateCondition(&c); err != nil {
-				respondError(w, http.StatusBadRequest, fmt.Sprintf("condition[%d]: %s", i, err.Error()))
-				return
+				return nil, http.StatusBadRequest, fmt.Errorf("condition[%d]: %s", i, err.Error())
 			}
 		}
 	}
 
-	segment, err := s.store.UpdateSegment(key, &req)
+	segment, err := s.store.UpdateSegment(ctx, actor, key, version, req)
+	if errors.Is(err, store.ErrVersionMismatch) {
+		return nil, http.StatusPreconditionFailed, errors.New("segment was modified concurrently")
+	}
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
-		return
+		return nil, http.StatusBadRequest, err
 	}
 	if segment == nil {
-		respondError(w, http.StatusNotFound, "segment not found")
-		return
+		return nil, http.StatusNotFound, errors.New("segment not found")
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID: fmt.Sprintf("%d", time.Now().UnixMilli()), Type: "segment_updated", Data: segment,
-	})
-	respondJSON(w, http.StatusOK, segment)
+	return segment, 0, nil
 }
 
 func (s *Server) DeleteSegment(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
-	if err := s.store.DeleteSegment(key); err != nil {
-		if errors.Is(err, store.ErrSegmentInUse) {
-			respondError(w, http.StatusConflict, err.Error())
-			return
-		}
-		respondError(w, http.StatusNotFound, err.Error())
+	version, err := ifMatch(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status, err := s.deleteSegment(r.Context(), actorFrom(r), key, version); err != nil {
+		respondStoreError(w, status, err)
 		return
 	}
-	s.broadcaster.Publish(sse.Event{
-		ID:   fmt.Sprintf("%d", time.Now().UnixMilli()),
-		Type: "segment_deleted",
-		Data: map[string]string{"key": key},
-	})
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (s *Server) deleteSegment(ctx context.Context, actor models.Actor, key string, version int) (int, error) {
+	if err := s.store.DeleteSegment(ctx, actor, key, version); err != nil {
+		if errors.Is(err, store.ErrVersionMismatch) {
+			return http.StatusPreconditionFailed, errors.New("segment was modified concurrently")
+		}
+		if errors.Is(err, store.ErrSegmentInUse) {
+			return http.StatusConflict, err
+		}
+		return http.StatusNotFound, err
+	}
+	return 0, nil
+}
@@ -1,27 +1,62 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/sse"
 )
 
-func (s *Server) Stream(w http.ResponseWriter, r *http.Request) {
-	rc := http.NewResponseController(w)
+// maxReplay is the most events replayed to a resuming client. Clients
+// further behind are told to reset instead.
+const maxReplay = 1000
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
-	w.WriteHeader(http.StatusOK)
-	rc.Flush() // Force send headers immediately
+// Reasons sent with a reset event.
+const (
+	resetExpired   = "expired"          // Events after Last-Event-ID have been pruned
+	resetUnknownID = "unknown_event_id" // Last-Event-ID was never issued by this server
+	resetTooFar    = "too_far_behind"   // More than maxReplay events to catch up on
+	resetDropped   = "events_dropped"   // The client fell behind and events can't be replayed
+)
+
+// Stream sends change events as server-sent events. A client reconnecting
+// with Last-Event-ID is sent every event after that one. If they can't be
+// replayed, it gets a reset event and should refetch its flags.
+//
+// Query: flags and types (comma-separated) limit the events sent. On a
+// server scoped to an environment, API keys only receive events from their
+// own environment.
+func (s *Server) Stream(w http.ResponseWriter, r *http.Request) {
+	filter, err := s.streamFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rc := startSSE(w)
 
-	events, unsub := s.broadcaster.Subscribe()
-	defer unsub()
+	// Live events already covered by a replay are skipped below.
+	sub, last := s.subscribe(filter) // last is the sequence number of the last event sent
+	defer func() { sub.Close() }()
 
 	// Send initial connection event
 	fmt.Fprintf(w, "event: connected\ndata: {\"status\":\"ok\"}\n\n")
+
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if since, ok := parseEventID(id); !ok {
+			writeReset(w, resetUnknownID)
+			last = s.position()
+		} else {
+			last = s.replay(r.Context(), w, filter, since)
+		}
+	}
 	rc.Flush()
 
 	// Keepalive ticker
@@ -32,15 +67,24 @@ func (s *Server) Stream(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			return
-		case event, ok := <-events:
+		case event, ok := <-sub.C:
 			if !ok {
-				return // Broadcaster closed
+				if !sub.Lost() {
+					return // Broadcaster closed
+				}
+				// Too slow: catch up from the event log on a new subscription.
+				sub, _ = s.subscribe(filter)
+				last = s.replay(r.Context(), w, filter, last)
+				rc.Flush()
+				continue
+			}
+			if event.Seq != 0 && event.Seq <= last {
+				continue // Already sent by replay
 			}
-			data, _ := json.Marshal(event.Data)
-			if event.ID != "" {
-				fmt.Fprintf(w, "id: %s\n", event.ID)
+			writeEvent(w, event.ID, event.Type, event.Data)
+			if event.Seq != 0 {
+				last = event.Seq
 			}
-			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
 			rc.Flush()
 		case <-ticker.C:
 			fmt.Fprintf(w, ": keepalive\n\n")
@@ -48,3 +92,149 @@ func (s *Server) Stream(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// startSSE writes the headers of an event stream and flushes them.
+func startSSE(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	w.WriteHeader(http.StatusOK)
+	rc.Flush() // Force send headers immediately
+	return rc
+}
+
+// replay writes the logged events after since and returns the sequence number
+// to continue from. See missedEvents.
+func (s *Server) replay(ctx context.Context, w http.ResponseWriter, filter sse.Filter, since int64) int64 {
+	events, last, reset := s.missedEvents(ctx, filter, since)
+	if reset != "" {
+		writeReset(w, reset)
+	}
+	for _, e := range events {
+		writeEvent(w, e.ID, e.Type, e.Data)
+	}
+	return last
+}
+
+// missedEvents returns the logged events after since that match filter, and
+// the sequence number of the last one examined. When they can't be replayed
+// it returns the reason for a reset instead, and the latest sequence number:
+// the client's refetch covers everything up to there.
+func (s *Server) missedEvents(ctx context.Context, filter sse.Filter, since int64) (events []sse.Event, last int64, reset string) {
+	if s.events == nil {
+		return nil, s.position(), resetDropped
+	}
+	oldest, latest, err := s.events.EventBounds(ctx)
+	if err != nil {
+		slog.Error("failed to read event log", "error", err)
+		return nil, since, resetDropped
+	}
+	switch {
+	case since > latest:
+		return nil, latest, resetUnknownID
+	case since+1 < oldest:
+		return nil, latest, resetExpired
+	case latest-since > maxReplay:
+		return nil, latest, resetTooFar
+	}
+
+	logged, err := s.events.EventsSince(ctx, since, maxReplay)
+	if err != nil {
+		slog.Error("failed to read event log", "error", err)
+		return nil, latest, resetDropped
+	}
+	last = since
+	for _, e := range logged {
+		if event := sseEvent(e); filter.Match(event) {
+			events = append(events, event)
+		}
+		last = e.Seq
+	}
+	return events, last, ""
+}
+
+// parseEventID parses a Last-Event-ID value.
+func parseEventID(id string) (int64, bool) {
+	seq, err := strconv.ParseInt(id, 10, 64)
+	return seq, err == nil && seq >= 0
+}
+
+// subscribe registers an SSE client and returns the sequence number of the
+// latest event published before it. Holding publishMu means no event is
+// numbered at or below it but broadcast after.
+func (s *Server) subscribe(filter sse.Filter) (*sse.Subscription, int64) {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	return s.broadcaster.Subscribe(filter), s.latestSeq()
+}
+
+// streamFilter builds the subscription filter for a stream request.
+func (s *Server) streamFilter(r *http.Request) (sse.Filter, error) {
+	q := r.URL.Query()
+	flags := splitQueryList(q.Get("flags"))
+	types := splitQueryList(q.Get("types"))
+	if err := validateEventTypes(types); err != nil {
+		return sse.Filter{}, err
+	}
+	return sse.NewFilter(flags, types, s.streamEnvironment(r)), nil
+}
+
+// streamEnvironment returns the environment a stream's events are limited
+// to: the API key's, if the server is scoped to an environment.
+func (s *Server) streamEnvironment(r *http.Request) string {
+	if k := apiKeyFrom(r); k != nil && s.scoped {
+		return string(k.Environment)
+	}
+	return ""
+}
+
+// validateEventTypes rejects event types a filter could never match.
+func validateEventTypes(types []string) error {
+	for _, t := range types {
+		if !slices.Contains(models.EventTypes, t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// splitQueryList parses a comma-separated query value, ignoring blanks.
+func splitQueryList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// position returns the sequence number of the latest published event.
+func (s *Server) position() int64 {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	return s.latestSeq()
+}
+
+// latestSeq returns the number of the last event broadcast. A write's
+// events are in the log before they are broadcast, so replays may go
+// further; live events they cover are skipped. s.publishMu must be held.
+func (s *Server) latestSeq() int64 {
+	return s.lastSeq
+}
+
+func writeEvent(w http.ResponseWriter, id, eventType string, data any) {
+	b, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, b)
+}
+
+// writeReset tells the client it has missed events and should refetch.
+func writeReset(w http.ResponseWriter, reason string) {
+	fmt.Fprintf(w, "event: reset\ndata: {\"reason\":%q}\n\n", reason)
+}
@@ -0,0 +1,65 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+func TestStream_DefaultServerSendsEveryEnvironment(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvTest)
+
+	resp := s.openStream(t, "/api/v1/stream", key, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	events := newSSEReader(resp)
+	assert.Equal(t, "connected", events.next(t).Event)
+
+	s.createFlag(t, "checkout")
+	e := events.next(t)
+	assert.Equal(t, "flag_created", e.Event)
+	assert.Equal(t, "1", e.ID)
+}
+
+func TestStream_ScopedServerFiltersByKeyEnvironment(t *testing.T) {
+	s := newTestServer(t, api.Options{Environment: models.EnvStaging})
+	_, staging := s.createKey(t, models.EnvStaging)
+	_, live := s.createKey(t, models.EnvLive)
+
+	own := newSSEReader(s.openStream(t, "/api/v1/stream", staging, nil))
+	other := newSSEReader(s.openStream(t, "/api/v1/stream", live, nil))
+	assert.Equal(t, "connected", own.next(t).Event)
+	assert.Equal(t, "connected", other.next(t).Event)
+
+	s.createFlag(t, "checkout")
+	assert.Equal(t, "flag_created", own.next(t).Event)
+	other.none(t, 200*time.Millisecond)
+}
+
+func TestStream_ResumesFromLastEventID(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive)
+	s.createFlag(t, "checkout")
+	s.createFlag(t, "search")
+
+	events := newSSEReader(s.openStream(t, "/api/v1/stream", key, http.Header{"Last-Event-ID": {"1"}}))
+	assert.Equal(t, "connected", events.next(t).Event)
+	e := events.next(t)
+	assert.Equal(t, "2", e.ID)
+	assert.Contains(t, e.Data, `"search"`)
+
+	s.createFlag(t, "dark_mode")
+	assert.Equal(t, "3", events.next(t).ID)
+
+	unknown := newSSEReader(s.openStream(t, "/api/v1/stream", key, http.Header{"Last-Event-ID": {"nope"}}))
+	assert.Equal(t, "connected", unknown.next(t).Event)
+	reset := unknown.next(t)
+	assert.Equal(t, "reset", reset.Event)
+	assert.JSONEq(t, `{"reason":"unknown_event_id"}`, reset.Data)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+func (s *Server) CreateFlagTemplate(w http.ResponseWriter, r *http.Request) {
+	var t models.FlagTemplate
+	if err := decodeJSON(r, &t); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if t.Rules == nil {
+		t.Rules = []models.RuleConfig{}
+	}
+	if err := models.ValidateFlagTemplate(&t); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.templates.CreateFlagTemplate(r.Context(), actorFrom(r), &t); err != nil {
+		respondStoreError(w, http.StatusConflict, fmt.Errorf("template already exists or DB error: %w", err))
+		return
+	}
+	respondJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) ListFlagTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.templates.ListFlagTemplates(r.Context())
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if templates == nil {
+		templates = []models.FlagTemplate{}
+	}
+	respondJSON(w, http.StatusOK, templates)
+}
+
+func (s *Server) GetFlagTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := s.templates.GetFlagTemplate(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if t == nil {
+		respondError(w, http.StatusNotFound, "template not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, t)
+}
+
+// UpdateFlagTemplate replaces a template. Flags made from it don't change.
+func (s *Server) UpdateFlagTemplate(w http.ResponseWriter, r *http.Request) {
+	var t models.FlagTemplate
+	if err := decodeJSON(r, &t); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	t.Name = chi.URLParam(r, "name")
+	if t.Rules == nil {
+		t.Rules = []models.RuleConfig{}
+	}
+	if err := models.ValidateFlagTemplate(&t); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := s.templates.UpdateFlagTemplate(r.Context(), actorFrom(r), &t)
+	if errors.Is(err, store.ErrTemplateNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) DeleteFlagTemplate(w http.ResponseWriter, r *http.Request) {
+	err := s.templates.DeleteFlagTemplate(r.Context(), actorFrom(r), chi.URLParam(r, "name"))
+	if errors.Is(err, store.ErrTemplateNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flagFromRequest returns the flag a create request describes. If it names
+// a template, the flag's type, default value and rules come from it. The
+// status is that of the response to a failure.
+func (s *Server) flagFromRequest(ctx context.Context, req *models.CreateFlagRequest) (*models.Flag, int, error) {
+	if req.Template == "" {
+		flag := &models.Flag{
+			Key:          req.Key,
+			Type:         req.Type,
+			Description:  req.Description,
+			Enabled:      req.Enabled,
+			DefaultValue: req.DefaultValue,
+		}
+		if err := models.ValidateFlag(flag); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return flag, 0, nil
+	}
+
+	if s.templates == nil {
+		return nil, http.StatusBadRequest, errors.New("this server doesn't support templates")
+	}
+	if req.Type != "" || len(req.DefaultValue) > 0 {
+		return nil, http.StatusBadRequest, errors.New("type and default_value come from the template")
+	}
+	t, err := s.templates.GetFlagTemplate(ctx, req.Template)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if t == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("template %q not found", req.Template)
+	}
+	fc, err := t.Config(req.Key, req.Values)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	fc.Description, fc.Enabled = req.Description, req.Enabled
+	for _, rc := range fc.Rules {
+		for _, key := range rc.SegmentKeys {
+			seg, err := s.store.GetSegment(ctx, key)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			if seg == nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("segment %q not found; create it before using template %q", key, t.Name)
+			}
+		}
+	}
+	return models.FlagFromConfig(fc), 0, nil
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+type whoAmIResponse struct {
+	Actor  models.Actor   `json:"actor"`
+	Role   models.Role    `json:"role,omitempty"`
+	Scopes []models.Scope `json:"scopes,omitempty"` // API keys only
+}
+
+// WhoAmI returns the caller's identity and role, or scopes for API keys.
+func (s *Server) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	resp := whoAmIResponse{Actor: actorFrom(r), Role: roleFrom(r)}
+	if k := apiKeyFrom(r); k != nil {
+		resp.Scopes = k.Scopes
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	user := &models.User{
+		ID:   models.GenerateUserID(),
+		Name: req.Name,
+		Kind: req.Kind,
+		Role: req.Role,
+	}
+	if user.Kind == "" {
+		user.Kind = models.UserKindUser
+	}
+	if err := models.ValidateUser(user); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.users.CreateUser(r.Context(), actorFrom(r), user); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			respondError(w, http.StatusConflict, "a user with this name already exists")
+			return
+		}
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, user)
+}
+
+func (s *Server) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.users.ListUsers(r.Context())
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	respondJSON(w, http.StatusOK, users)
+}
+
+// GetUser returns a user by ID or name.
+func (s *Server) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.users.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if user == nil {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateUserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Role != nil {
+		if err := models.ValidateRole(*req.Role); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	user, err := s.users.UpdateUser(r.Context(), actorFrom(r), chi.URLParam(r, "id"), &req)
+	if errors.Is(err, store.ErrUserNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	err := s.users.DeleteUser(r.Context(), actorFrom(r), chi.URLParam(r, "id"))
+	if errors.Is(err, store.ErrUserNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) CreateUserToken(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserTokenRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+
+	user, err := s.users.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if user == nil {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	token, hashed := models.GenerateUserToken(user.ID, req.Name)
+	if err := s.users.CreateUserToken(r.Context(), actorFrom(r), &token.UserToken, hashed); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Return the raw token — shown only this once
+	respondJSON(w, http.StatusCreated, token)
+}
+
+func (s *Server) ListUserTokens(w http.ResponseWriter, r *http.Request) {
+	user, err := s.users.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if user == nil {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	tokens, err := s.users.ListUserTokens(r.Context(), user.ID)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tokens == nil {
+		tokens = []models.UserToken{}
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) RevokeUserToken(w http.ResponseWriter, r *http.Request) {
+	err := s.users.RevokeUserToken(r.Context(), actorFrom(r), chi.URLParam(r, "id"), chi.URLParam(r, "tokenID"))
+	if errors.Is(err, store.ErrUserNotFound) || errors.Is(err, store.ErrTokenNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+func (s *Server) ListFlagVersions(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	versions, err := s.history.ListFlagVersions(r.Context(), key)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(versions) == 0 {
+		respondError(w, http.StatusNotFound, "flag has no history")
+		return
+	}
+	respondJSON(w, http.StatusOK, versions)
+}
+
+func (s *Server) GetFlagVersion(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid version")
+		return
+	}
+
+	v, err := s.history.GetFlagVersion(r.Context(), key, version)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if v == nil {
+		respondError(w, http.StatusNotFound, "flag version not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, v)
+}
+
+// DiffFlagVersions compares two versions: ?from=N&to=M.
+// to defaults to the latest version, from defaults to the one before to.
+func (s *Server) DiffFlagVersions(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+
+	versions, err := s.history.ListFlagVersions(r.Context(), key)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(versions) == 0 {
+		respondError(w, http.StatusNotFound, "flag has no history")
+		return
+	}
+
+	to := versions[0].Version
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid to version")
+			return
+		}
+	}
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid from version")
+			return
+		}
+	}
+
+	// Version 0 is the empty state before the flag was created
+	var before, after *models.Flag
+	if from > 0 {
+		v, err := s.history.GetFlagVersion(r.Context(), key, from)
+		if err != nil {
+			respondStoreError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if v == nil {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("version %d not found", from))
+			return
+		}
+		before = v.Snapshot
+	}
+	v, err := s.history.GetFlagVersion(r.Context(), key, to)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if v == nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("version %d not found", to))
+		return
+	}
+	after = v.Snapshot
+
+	changes := models.DiffFlags(before, after)
+	if changes == nil {
+		changes = []models.Change{}
+	}
+	respondJSON(w, http.StatusOK, models.FlagVersionDiff{FlagKey: key, From: from, To: to, Changes: changes})
+}
+
+func (s *Server) RestoreFlagVersion(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid version")
+		return
+	}
+
+	restored, status, err := s.restoreFlagVersion(r.Context(), actorFrom(r), key, version)
+	if err != nil {
+		respondStoreError(w, status, err)
+		return
+	}
+
+	setETag(w, restored.Version)
+	respondJSON(w, http.StatusOK, restored)
+}
+
+func (s *Server) restoreFlagVersion(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, int, error) {
+	restored, _, err := s.history.RestoreFlagVersion(ctx, actor, key, version)
+	if err != nil {
+		if errors.Is(err, store.ErrVersionNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusConflict, err
+	}
+	return restored, 0, nil
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+// CreateWebhook registers an endpoint. The response is the only one that
+// includes the signing secret.
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	hook := &models.Webhook{
+		ID:     models.GenerateWebhookID(),
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if hook.Secret == "" {
+		hook.Secret = models.GenerateWebhookSecret()
+	}
+	if err := models.ValidateWebhook(hook); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.webhooks.CreateWebhook(r.Context(), actorFrom(r), hook); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, hook)
+}
+
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.webhooks.ListWebhooks(r.Context())
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	respondJSON(w, http.StatusOK, hooks)
+}
+
+func (s *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := s.webhooks.GetWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if hook == nil {
+		respondError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	hook.Secret = ""
+	respondJSON(w, http.StatusOK, hook)
+}
+
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.webhooks.DeleteWebhook(r.Context(), actorFrom(r), chi.URLParam(r, "id"))
+	if errors.Is(err, store.ErrWebhookNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first.
+// Filters: status (pending, delivered, dead) and limit (default 50, max 500).
+func (s *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if hook, err := s.webhooks.GetWebhook(r.Context(), id); err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	} else if hook == nil {
+		respondError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	q := r.URL.Query()
+	status := models.DeliveryStatus(q.Get("status"))
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		respondError(w, http.StatusBadRequest, "status must be pending, delivered or dead")
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(limit, 500)
+	}
+
+	deliveries, err := s.webhooks.ListWebhookDeliveries(r.Context(), id, status, limit)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
+// GetWebhookDelivery returns a delivery with every attempt made so far.
+func (s *Server) GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, ok := parseDeliveryID(w, r)
+	if !ok {
+		return
+	}
+	d, err := s.webhooks.GetWebhookDelivery(r.Context(), chi.URLParam(r, "id"), deliveryID)
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if d == nil {
+		respondError(w, http.StatusNotFound, "delivery not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, d)
+}
+
+// RedeliverWebhookDelivery queues a delivery to be sent again now, including
+// ones that were delivered or are dead.
+func (s *Server) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, ok := parseDeliveryID(w, r)
+	if !ok {
+		return
+	}
+	d, err := s.webhooks.RedeliverWebhookDelivery(r.Context(), actorFrom(r), chi.URLParam(r, "id"), deliveryID)
+	if errors.Is(err, store.ErrDeliveryNotFound) {
+		respondStoreError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.dispatcher.Notify()
+	respondJSON(w, http.StatusAccepted, d)
+}
+
+func parseDeliveryID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid delivery ID")
+		return 0, false
+	}
+	return id, true
+}
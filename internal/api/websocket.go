@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/getflaggy/flaggy/internal/sse"
+)
+
+// WebSocket protocol: JSON text messages, one per frame.
+//
+// Client → server:
+//
+//	{"type":"subscribe","id":"s1","flags":["a"],"types":["flag_toggled"],"last_event_id":"42"}
+//	{"type":"unsubscribe","id":"s1"}
+//
+// Server → client:
+//
+//	{"type":"connected"}
+//	{"type":"subscribed","id":"s1"}
+//	{"type":"unsubscribed","id":"s1"}
+//	{"type":"event","id":"s1","event":{"id":"43","type":"flag_toggled","data":{...}}}
+//	{"type":"reset","id":"s1","reason":"expired"}
+//	{"type":"error","id":"s1","error":"..."}
+const (
+	wsSubprotocol  = "flaggy.v1"
+	wsTokenPrefix  = "flaggy.token."  // Subprotocol carrying the API key, for browsers
+	wsPingInterval = 30 * time.Second // How often the server pings
+	wsPongTimeout  = 10 * time.Second // How long a pong may take
+	wsWriteTimeout = 10 * time.Second // How long a message write may take
+	wsMaxSubs      = 32               // Subscriptions per connection
+	wsReadLimit    = 64 << 10         // Largest client message
+)
+
+type wsClientMessage struct {
+	Type        string   `json:"type"`
+	ID          string   `json:"id"`
+	Flags       []string `json:"flags,omitempty"`
+	Types       []string `json:"types,omitempty"`
+	LastEventID string   `json:"last_event_id,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type   string     `json:"type"`
+	ID     string     `json:"id,omitempty"`
+	Event  *sse.Event `json:"event,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// WebSocketToken lets browsers, which can't set headers on a WebSocket
+// handshake, send the API key as a "flaggy.token.<key>" subprotocol. It must
+// run before RequireAPIKey.
+func WebSocketToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			for _, p := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+				if token, ok := strings.CutPrefix(strings.TrimSpace(p), wsTokenPrefix); ok {
+					r.Header.Set("Authorization", "Bearer "+token)
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WebSocket carries change events over a WebSocket, for networks that break
+// long-lived event streams. Clients open any number of filtered
+// subscriptions on one connection; each behaves like a /stream request with
+// the same flags, types and Last-Event-ID.
+func (s *Server) WebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols: []string{wsSubprotocol},
+		// Auth is by API key, never cookies, so any origin may connect.
+		OriginPatterns: []string{"*"},
+	})
+	if err != nil {
+		return // Accept has written the error response
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(wsReadLimit)
+
+	c := &wsConn{s: s, conn: conn, env: s.streamEnvironment(r), subs: make(map[string]context.CancelFunc)}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer func() {
+		cancel()
+		c.wg.Wait()
+	}()
+
+	if err := c.send(ctx, wsServerMessage{Type: "connected"}); err != nil {
+		return
+	}
+	go c.keepalive(ctx, cancel)
+
+	for {
+		var msg wsClientMessage
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				conn.Close(websocket.StatusUnsupportedData, "messages must be JSON")
+			}
+			return
+		}
+		switch msg.Type {
+		case "subscribe":
+			c.subscribe(ctx, msg)
+		case "unsubscribe":
+			c.unsubscribe(ctx, msg.ID)
+		default:
+			c.send(ctx, wsServerMessage{Type: "error", ID: msg.ID, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+		}
+	}
+}
+
+// wsConn is one WebSocket client and its subscriptions.
+type wsConn struct {
+	s    *Server
+	conn *websocket.Conn
+	env  string
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc // Subscription ID → stop
+	wg   sync.WaitGroup
+}
+
+func (c *wsConn) send(ctx context.Context, msg wsServerMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, c.conn, msg)
+}
+
+// keepalive pings the client and ends the connection when a pong is late.
+func (c *wsConn) keepalive(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, wsPongTimeout)
+			err := c.conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				c.conn.Close(websocket.StatusPolicyViolation, "pong timeout")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) subscribe(ctx context.Context, msg wsClientMessage) {
+	fail := func(reason string) {
+		c.send(ctx, wsServerMessage{Type: "error", ID: msg.ID, Error: reason})
+	}
+	if msg.ID == "" {
+		fail("subscription id is required")
+		return
+	}
+	if err := validateEventTypes(msg.Types); err != nil {
+		fail(err.Error())
+		return
+	}
+	since, resume := int64(0), msg.LastEventID != ""
+	if resume {
+		var ok bool
+		if since, ok = parseEventID(msg.LastEventID); !ok {
+			since = -1
+		}
+	}
+
+	c.mu.Lock()
+	if _, exists := c.subs[msg.ID]; exists {
+		c.mu.Unlock()
+		fail(fmt.Sprintf("subscription %q already exists", msg.ID))
+		return
+	}
+	if len(c.subs) >= wsMaxSubs {
+		c.mu.Unlock()
+		fail("too many subscriptions")
+		return
+	}
+	subCtx, stop := context.WithCancel(ctx)
+	c.subs[msg.ID] = stop
+	c.mu.Unlock()
+
+	filter := sse.NewFilter(msg.Flags, msg.Types, c.env)
+	sub, last := c.s.subscribe(filter)
+	if err := c.send(ctx, wsServerMessage{Type: "subscribed", ID: msg.ID}); err != nil {
+		sub.Close()
+		stop()
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() { sub.Close() }()
+		c.forward(subCtx, msg.ID, filter, sub, last, since, resume)
+	}()
+}
+
+// forward sends a subscription's events to the client until it is stopped.
+func (c *wsConn) forward(ctx context.Context, id string, filter sse.Filter, sub *sse.Subscription, last, since int64, resume bool) {
+	catchUp := func(since int64) error {
+		var events []sse.Event
+		var reset string
+		if since < 0 {
+			last, reset = c.s.position(), resetUnknownID
+		} else {
+			events, last, reset = c.s.missedEvents(ctx, filter, since)
+		}
+		if reset != "" {
+			if err := c.send(ctx, wsServerMessage{Type: "reset", ID: id, Reason: reset}); err != nil {
+				return err
+			}
+		}
+		for i := range events {
+			if err := c.send(ctx, wsServerMessage{Type: "event", ID: id, Event: &events[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if resume {
+		if err := catchUp(since); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				if !sub.Lost() {
+					c.conn.Close(websocket.StatusGoingAway, "server shutting down")
+					return
+				}
+				// Too slow: catch up from the event log on a new subscription.
+				sub.Close()
+				sub, _ = c.s.subscribe(filter)
+				if err := catchUp(last); err != nil {
+					return
+				}
+				continue
+			}
+			if event.Seq != 0 && event.Seq <= last {
+				continue // Already sent by a catch-up
+			}
+			if err := c.send(ctx, wsServerMessage{Type: "event", ID: id, Event: &event}); err != nil {
+				if ctx.Err() == nil {
+					slog.Debug("websocket write failed", "error", err)
+				}
+				return
+			}
+			if event.Seq != 0 {
+				last = event.Seq
+			}
+		}
+	}
+}
+
+func (c *wsConn) unsubscribe(ctx context.Context, id string) {
+	c.mu.Lock()
+	stop, ok := c.subs[id]
+	delete(c.subs, id)
+	c.mu.Unlock()
+	if !ok {
+		c.send(ctx, wsServerMessage{Type: "error", ID: id, Error: fmt.Sprintf("no subscription %q", id)})
+		return
+	}
+	stop()
+	c.send(ctx, wsServerMessage{Type: "unsubscribed", ID: id})
+}
@@ -0,0 +1,169 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/api"
+	"github.com/getflaggy/flaggy/internal/metrics"
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// wsMessage is a server message of the WebSocket protocol.
+type wsMessage struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+	Event  *struct {
+		ID   string          `json:"id"`
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	} `json:"event"`
+}
+
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dialWS opens a WebSocket, sending the key as a subprotocol like browsers.
+func (s *testServer) dialWS(t *testing.T, key string) *wsClient {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/api/v1/ws"
+	conn, resp, err := websocket.Dial(t.Context(), url, &websocket.DialOptions{
+		Subprotocols: []string{"flaggy.v1", "flaggy.token." + key},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "flaggy.v1", resp.Header.Get("Sec-WebSocket-Protocol"))
+	t.Cleanup(func() { conn.CloseNow() })
+	c := &wsClient{t: t, conn: conn}
+	assert.Equal(t, "connected", c.read().Type)
+	return c
+}
+
+func (c *wsClient) send(msg map[string]any) {
+	c.t.Helper()
+	require.NoError(c.t, wsjson.Write(c.t.Context(), c.conn, msg))
+}
+
+func (c *wsClient) read() wsMessage {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(c.t.Context(), 5*time.Second)
+	defer cancel()
+	var msg wsMessage
+	require.NoError(c.t, wsjson.Read(ctx, c.conn, &msg))
+	return msg
+}
+
+func TestWebSocket_Subscribe(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive)
+	c := s.dialWS(t, key)
+
+	c.send(map[string]any{"type": "subscribe", "id": "checkout", "flags": []string{"checkout"}})
+	assert.Equal(t, wsMessage{Type: "subscribed", ID: "checkout"}, c.read())
+	c.send(map[string]any{"type": "subscribe", "id": "toggles", "types": []string{"flag_toggled"}})
+	assert.Equal(t, wsMessage{Type: "subscribed", ID: "toggles"}, c.read())
+
+	s.createFlag(t, "search")   // neither
+	s.createFlag(t, "checkout") // checkout
+	msg := c.read()
+	assert.Equal(t, "event", msg.Type)
+	assert.Equal(t, "checkout", msg.ID)
+	require.NotNil(t, msg.Event)
+	assert.Equal(t, "2", msg.Event.ID)
+	assert.Equal(t, "flag_created", msg.Event.Type)
+
+	c.send(map[string]any{"type": "unsubscribe", "id": "checkout"})
+	assert.Equal(t, wsMessage{Type: "unsubscribed", ID: "checkout"}, c.read())
+	_, err := s.store.ToggleFlag(t.Context(), models.ActorMasterKey, "checkout", 0)
+	require.NoError(t, err)
+	msg = c.read()
+	assert.Equal(t, "toggles", msg.ID)
+	assert.Equal(t, "3", msg.Event.ID)
+
+	c.send(map[string]any{"type": "subscribe", "id": "toggles"})
+	assert.Equal(t, wsMessage{Type: "error", ID: "toggles", Error: `subscription "toggles" already exists`}, c.read())
+	c.send(map[string]any{"type": "subscribe", "id": "bad", "types": []string{"nope"}})
+	assert.Equal(t, "error", c.read().Type)
+	c.send(map[string]any{"type": "hello"})
+	assert.Equal(t, "error", c.read().Type)
+}
+
+func TestWebSocket_Resume(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive)
+	s.createFlag(t, "checkout")
+	s.createFlag(t, "search")
+	s.createFlag(t, "dark_mode")
+	c := s.dialWS(t, key)
+
+	c.send(map[string]any{"type": "subscribe", "id": "s1", "last_event_id": "1"})
+	assert.Equal(t, "subscribed", c.read().Type)
+	for _, want := range []string{"2", "3"} {
+		msg := c.read()
+		assert.Equal(t, "event", msg.Type)
+		assert.Equal(t, want, msg.Event.ID)
+	}
+	s.createFlag(t, "beta")
+	assert.Equal(t, "4", c.read().Event.ID, "no event is sent twice")
+
+	c.send(map[string]any{"type": "subscribe", "id": "s2", "last_event_id": "nope"})
+	assert.Equal(t, "subscribed", c.read().Type)
+	assert.Equal(t, wsMessage{Type: "reset", ID: "s2", Reason: "unknown_event_id"}, c.read())
+}
+
+func TestWebSocket_TooManySubscriptions(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive)
+	c := s.dialWS(t, key)
+
+	for i := range 32 {
+		id := "s" + strconv.Itoa(i)
+		c.send(map[string]any{"type": "subscribe", "id": id})
+		require.Equal(t, wsMessage{Type: "subscribed", ID: id}, c.read())
+	}
+	c.send(map[string]any{"type": "subscribe", "id": "one-more"})
+	assert.Equal(t, wsMessage{Type: "error", ID: "one-more", Error: "too many subscriptions"}, c.read())
+
+	c.send(map[string]any{"type": "unsubscribe", "id": "s0"})
+	assert.Equal(t, "unsubscribed", c.read().Type)
+	c.send(map[string]any{"type": "subscribe", "id": "one-more"})
+	assert.Equal(t, "subscribed", c.read().Type)
+}
+
+func TestWebSocket_RequiresStreamScope(t *testing.T) {
+	s := newTestServer(t, api.Options{})
+	_, key := s.createKey(t, models.EnvLive, models.ScopeEvaluate)
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/api/v1/ws"
+
+	_, resp, err := websocket.Dial(t.Context(), url, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {"Bearer " + key}},
+	})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestWebSocket_NoLatencyObserved(t *testing.T) {
+	m := metrics.New()
+	s := newTestServer(t, api.Options{Metrics: m})
+	_, key := s.createKey(t, models.EnvLive)
+	c := s.dialWS(t, key)
+	require.NoError(t, c.conn.Close(websocket.StatusNormalClosure, ""))
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(m), `flaggy_http_requests_total{method="GET",route="/api/v1/ws"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, scrape(m), `flaggy_http_request_duration_seconds_count{method="GET",route="/api/v1/ws"}`)
+}
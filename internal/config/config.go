@@ -1,20 +1,145 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	Port      string
-	DBPath    string
-	MasterKey string // Required for admin routes (key management, flag CRUD)
-	CORSEnabled bool
+	Port           string
+	DBPath         string
+	MasterKey      string // Required for admin routes (key management, flag CRUD)
+	Environment    string // Environment this server manages (live, test, staging); selects the write policy. Empty means live, unscoped.
+	CORSEnabled    bool
+	MetricsEnabled bool          // Serve Prometheus metrics on /metrics
+	MetricsPublic  bool          // Serve /metrics without auth
+	EventRetention time.Duration // How long change events are kept for SSE resume (0 = forever)
+	FlagsFile      string        // Serve flags read-only from this YAML or JSON file instead of the database
+	FlagsFilePoll  time.Duration // How often FlagsFile is checked for changes
+	DBTimeout      time.Duration // Bound on each database operation, including lock waits (0 = none)
+	Exposure       ExposureConfig
+	APIKeys        APIKeyConfig
+	OIDC           OIDCConfig
+	Webhooks       WebhookConfig
+	Backups        BackupConfig
+	Peers          PeerConfig
+}
+
+// PeerConfig locates the servers managing the other environments, which
+// flags are promoted from.
+type PeerConfig struct {
+	URLs   map[string]string // Environment → server URL
+	Tokens map[string]string // Environment → API key or token with read access to flags
+}
+
+// BackupConfig controls scheduled database backups. They are disabled
+// unless Dir is set.
+type BackupConfig struct {
+	Dir      string
+	Interval time.Duration
+	Keep     int // Newest backups kept in Dir; older ones are deleted (0 = all)
+}
+
+// WebhookConfig controls delivery of change events to registered webhooks.
+type WebhookConfig struct {
+	MaxAttempts int           // Attempts before a delivery is marked dead
+	RetryBase   time.Duration // Wait after the first failure; doubles per attempt, up to an hour
+	Timeout     time.Duration // Per-request timeout
+}
+
+// OIDCConfig controls JWT authentication for admin routes. It is disabled
+// unless JWKSURL or JWKSFile is set.
+type OIDCConfig struct {
+	JWKSURL     string
+	JWKSFile    string
+	Issuer      string
+	Audience    string
+	NameClaim   string
+	RoleClaim   string
+	RoleMap     map[string]string // Claim value → role
+	DefaultRole string
+}
+
+// Enabled reports whether a JWKS source is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.JWKSURL != "" || c.JWKSFile != ""
+}
+
+// APIKeyConfig controls API key rotation and usage tracking.
+type APIKeyConfig struct {
+	RotationGrace time.Duration // Default time a rotated key keeps working
+	UsageFlush    time.Duration // How often last_used_at is written
+	RateLimit     float64       // Default requests per second per key (0 = unlimited)
+	RateBurst     int           // Default burst per key (0 = the rate, rounded up)
+}
+
+// ExposureConfig controls the exposure event pipeline. It is disabled when Sinks is empty.
+type ExposureConfig struct {
+	Sinks          []string // Any of: stdout, file, webhook
+	FilePath       string
+	FileMaxBytes   int64
+	FileMaxBackups int
+	WebhookURL     string
+	BufferSize     int
+	DedupWindow    time.Duration
+	Attributes     []string // Context attributes copied onto each event
 }
 
 func Load() Config {
 	c := Config{
-		Port:        ":8080",
-		DBPath:      "flaggy.db",
-		MasterKey:   os.Getenv("FLAGGY_MASTER_KEY"),
-		CORSEnabled: os.Getenv("FLAGGY_CORS") != "false",
+		Port:           ":8080",
+		DBPath:         "flaggy.db",
+		MasterKey:      os.Getenv("FLAGGY_MASTER_KEY"),
+		Environment:    os.Getenv("FLAGGY_ENVIRONMENT"),
+		CORSEnabled:    os.Getenv("FLAGGY_CORS") != "false",
+		MetricsEnabled: os.Getenv("FLAGGY_METRICS") != "false",
+		MetricsPublic:  os.Getenv("FLAGGY_METRICS_PUBLIC") == "true",
+		EventRetention: envDuration("FLAGGY_EVENT_RETENTION", 24*time.Hour),
+		FlagsFile:      os.Getenv("FLAGGY_FLAGS_FILE"),
+		FlagsFilePoll:  envDuration("FLAGGY_FLAGS_FILE_POLL", 2*time.Second),
+		DBTimeout:      envDuration("FLAGGY_DB_TIMEOUT", 5*time.Second),
+		Exposure: ExposureConfig{
+			Sinks:          splitList(os.Getenv("FLAGGY_EXPOSURE_SINKS")),
+			FilePath:       "exposures.ndjson",
+			FileMaxBytes:   int64(envInt("FLAGGY_EXPOSURE_FILE_MAX_MB", 100)) << 20,
+			FileMaxBackups: envInt("FLAGGY_EXPOSURE_FILE_BACKUPS", 5),
+			WebhookURL:     os.Getenv("FLAGGY_EXPOSURE_WEBHOOK_URL"),
+			BufferSize:     envInt("FLAGGY_EXPOSURE_BUFFER", 10000),
+			DedupWindow:    envDuration("FLAGGY_EXPOSURE_DEDUP_WINDOW", time.Hour),
+			Attributes:     splitList(os.Getenv("FLAGGY_EXPOSURE_ATTRIBUTES")),
+		},
+		APIKeys: APIKeyConfig{
+			RotationGrace: envDuration("FLAGGY_API_KEY_ROTATION_GRACE", 24*time.Hour),
+			UsageFlush:    envDuration("FLAGGY_API_KEY_USAGE_FLUSH", 30*time.Second),
+			RateLimit:     envFloat("FLAGGY_RATE_LIMIT", 0),
+			RateBurst:     envInt("FLAGGY_RATE_BURST", 0),
+		},
+		OIDC: OIDCConfig{
+			JWKSURL:     os.Getenv("FLAGGY_OIDC_JWKS_URL"),
+			JWKSFile:    os.Getenv("FLAGGY_OIDC_JWKS_FILE"),
+			Issuer:      os.Getenv("FLAGGY_OIDC_ISSUER"),
+			Audience:    os.Getenv("FLAGGY_OIDC_AUDIENCE"),
+			NameClaim:   os.Getenv("FLAGGY_OIDC_NAME_CLAIM"),
+			RoleClaim:   os.Getenv("FLAGGY_OIDC_ROLE_CLAIM"),
+			RoleMap:     splitPairs(os.Getenv("FLAGGY_OIDC_ROLE_MAP")),
+			DefaultRole: os.Getenv("FLAGGY_OIDC_DEFAULT_ROLE"),
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts: envInt("FLAGGY_WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBase:   envDuration("FLAGGY_WEBHOOK_RETRY_BASE", 30*time.Second),
+			Timeout:     envDuration("FLAGGY_WEBHOOK_TIMEOUT", 10*time.Second),
+		},
+		Backups: BackupConfig{
+			Dir:      os.Getenv("FLAGGY_BACKUP_DIR"),
+			Interval: envDuration("FLAGGY_BACKUP_INTERVAL", 24*time.Hour),
+			Keep:     envInt("FLAGGY_BACKUP_KEEP", 7),
+		},
+		Peers: PeerConfig{
+			URLs:   splitPairs(os.Getenv("FLAGGY_PEER_URLS")),
+			Tokens: splitPairs(os.Getenv("FLAGGY_PEER_TOKENS")),
+		},
 	}
 	if v := os.Getenv("FLAGGY_PORT"); v != "" {
 		c.Port = v
@@ -22,5 +147,51 @@ func Load() Config {
 	if v := os.Getenv("FLAGGY_DB_PATH"); v != "" {
 		c.DBPath = v
 	}
+	if v := os.Getenv("FLAGGY_EXPOSURE_FILE"); v != "" {
+		c.Exposure.FilePath = v
+	}
 	return c
 }
+
+// splitList parses a comma-separated list, ignoring blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// splitPairs parses "a=x,b=y" into a map. Entries without "=" are ignored.
+func splitPairs(s string) map[string]string {
+	pairs := map[string]string{}
+	for _, item := range splitList(s) {
+		if k, v, ok := strings.Cut(item, "="); ok {
+			pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return pairs
+}
+
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
@@ -72,6 +72,7 @@ func Evaluate(flag *models.Flag, ctx EvalContext) models.EvaluateResponse {
 			}
 			resp.Value = rule.Value
 			resp.Match = true
+			resp.RuleID = rule.ID
 			resp.Reason = ReasonRuleMatch
 			return resp
 		}
@@ -136,6 +137,16 @@ func resolveEntityID(ctx EvalContext) (string, bool) {
 	return "", false
 }
 
+// EntityID returns the entity identifier used for rollout bucketing.
+func (ctx EvalContext) EntityID() (string, bool) {
+	return resolveEntityID(ctx)
+}
+
+// Lookup resolves a dot-notation attribute (e.g. "user.plan") in the context.
+func (ctx EvalContext) Lookup(attr string) (interface{}, bool) {
+	return resolveAttribute(ctx, attr)
+}
+
 // MustJSON marshals v to json.RawMessage, panicking on error. Test helper.
 func MustJSON(v interface{}) json.RawMessage {
 	b, err := json.Marshal(v)
@@ -0,0 +1,246 @@
+package exposure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event records that an entity was served a flag value.
+type Event struct {
+	Timestamp  time.Time              `json:"timestamp"`
+	FlagKey    string                 `json:"flag_key"`
+	Value      json.RawMessage        `json:"value"`
+	Reason     string                 `json:"reason"`
+	RuleID     int64                  `json:"rule_id,omitempty"`
+	EntityID   string                 `json:"entity_id"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Options configures a Pipeline. Zero values fall back to defaults.
+type Options struct {
+	BufferSize    int           // Max queued events before new ones are dropped (default 10000)
+	BatchSize     int           // Max events per sink write (default 500)
+	FlushInterval time.Duration // Max time an event waits in a partial batch (default 1s)
+	DedupWindow   time.Duration // Suppress repeats of entity/flag/value within this window (0 = no dedup)
+	Attributes    []string      // Context attributes copied onto each event (dot notation)
+}
+
+// sinkQueueSize is how many batches may wait for a sink. When a slow sink
+// has this many queued, its new batches are dropped rather than holding up
+// the other sinks.
+const sinkQueueSize = 16
+
+// maxDedupEntries bounds the dedup table. When exceeded, the table is reset
+// rather than growing without limit; the cost is a few duplicate events.
+const maxDedupEntries = 1_000_000
+
+// Pipeline queues exposure events in a bounded buffer and batches them in a
+// background goroutine. Each sink writes its batches from its own goroutine,
+// so one that is slow or retrying doesn't delay the others. Record never
+// blocks the evaluation path: when the buffer is full, the event is dropped.
+type Pipeline struct {
+	opts    Options
+	sinks   []Sink
+	queues  []chan []Event // Per sink, in the order of sinks
+	writers sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed and sends on events
+	closed bool
+	events chan Event
+	done   chan struct{}
+
+	dedupMu sync.Mutex
+	seen    map[string]time.Time
+
+	dropped    atomic.Uint64
+	duplicates atomic.Uint64
+	sinkErrors atomic.Uint64
+}
+
+// NewPipeline starts a pipeline writing to the given sinks.
+func NewPipeline(opts Options, sinks ...Sink) *Pipeline {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	p := &Pipeline{
+		opts:   opts,
+		sinks:  sinks,
+		events: make(chan Event, opts.BufferSize),
+		done:   make(chan struct{}),
+		seen:   make(map[string]time.Time),
+	}
+	for _, s := range sinks {
+		q := make(chan []Event, sinkQueueSize)
+		p.queues = append(p.queues, q)
+		p.writers.Add(1)
+		go p.write(s, q)
+	}
+	go p.run()
+	return p
+}
+
+// Attributes returns the context attributes to copy onto events.
+func (p *Pipeline) Attributes() []string {
+	return p.opts.Attributes
+}
+
+// Record queues an event. It is a no-op after Close.
+func (p *Pipeline) Record(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	if p.isDuplicate(e) {
+		p.duplicates.Add(1)
+		return
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.events <- e:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer or a
+// sink's queue was full.
+func (p *Pipeline) Dropped() uint64 { return p.dropped.Load() }
+
+// Duplicates returns the number of events suppressed by deduplication.
+func (p *Pipeline) Duplicates() uint64 { return p.duplicates.Load() }
+
+// SinkErrors returns the number of failed sink writes.
+func (p *Pipeline) SinkErrors() uint64 { return p.sinkErrors.Load() }
+
+// Close stops accepting events, flushes everything queued, and closes the sinks.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.events)
+	p.mu.Unlock()
+
+	<-p.done
+
+	var firstErr error
+	for _, s := range p.sinks {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *Pipeline) isDuplicate(e Event) bool {
+	if p.opts.DedupWindow <= 0 {
+		return false
+	}
+	key := e.EntityID + "\x00" + e.FlagKey + "\x00" + string(e.Value)
+
+	p.dedupMu.Lock()
+	defer p.dedupMu.Unlock()
+	if last, ok := p.seen[key]; ok && e.Timestamp.Sub(last) < p.opts.DedupWindow {
+		return true
+	}
+	if len(p.seen) >= maxDedupEntries {
+		p.seen = make(map[string]time.Time)
+	}
+	p.seen[key] = e.Timestamp
+	return false
+}
+
+// pruneDedup removes entries whose window has expired.
+func (p *Pipeline) pruneDedup(now time.Time) {
+	if p.opts.DedupWindow <= 0 {
+		return
+	}
+	p.dedupMu.Lock()
+	defer p.dedupMu.Unlock()
+	for k, t := range p.seen {
+		if now.Sub(t) >= p.opts.DedupWindow {
+			delete(p.seen, k)
+		}
+	}
+}
+
+func (p *Pipeline) run() {
+	defer close(p.done)
+	defer func() {
+		for _, q := range p.queues {
+			close(q)
+		}
+		p.writers.Wait()
+	}()
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+	batch := make([]Event, 0, p.opts.BatchSize)
+	for {
+		select {
+		case e, ok := <-p.events:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case now := <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+			if now.Sub(lastPrune) >= p.opts.DedupWindow {
+				p.pruneDedup(now)
+				lastPrune = now
+			}
+		}
+	}
+}
+
+// flush hands a copy of batch to each sink's queue.
+func (p *Pipeline) flush(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	batch = slices.Clone(batch)
+	for i, q := range p.queues {
+		select {
+		case q <- batch:
+		default:
+			p.dropped.Add(uint64(len(batch)))
+			slog.Warn("exposure sink falling behind, batch dropped", "sink", p.sinks[i].Name(), "events", len(batch))
+		}
+	}
+}
+
+// write writes the batches queued for s until the queue is closed.
+func (p *Pipeline) write(s Sink, queue <-chan []Event) {
+	defer p.writers.Done()
+	for batch := range queue {
+		if err := s.Write(batch); err != nil {
+			p.sinkErrors.Add(1)
+			slog.Error("exposure sink write failed", "sink", s.Name(), "events", len(batch), "error", err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package exposure
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *memSink) Name() string { return "mem" }
+
+func (s *memSink) Write(events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func event(entity, flag, value string) Event {
+	return Event{EntityID: entity, FlagKey: flag, Value: json.RawMessage(value)}
+}
+
+func TestPipeline_FlushesOnClose(t *testing.T) {
+	sink := &memSink{}
+	p := NewPipeline(Options{FlushInterval: time.Hour}, sink)
+	p.Record(event("u1", "flag_a", "true"))
+	p.Record(event("u2", "flag_a", "true"))
+	require.NoError(t, p.Close())
+
+	assert.Len(t, sink.events, 2)
+	assert.False(t, sink.events[0].Timestamp.IsZero())
+}
+
+func TestPipeline_Dedup(t *testing.T) {
+	sink := &memSink{}
+	p := NewPipeline(Options{DedupWindow: time.Hour}, sink)
+	p.Record(event("u1", "flag_a", "true"))
+	p.Record(event("u1", "flag_a", "true"))  // duplicate
+	p.Record(event("u1", "flag_a", "false")) // different value
+	p.Record(event("u1", "flag_b", "true"))  // different flag
+	p.Record(event("u2", "flag_a", "true"))  // different entity
+	require.NoError(t, p.Close())
+
+	assert.Len(t, sink.events, 4)
+	assert.Equal(t, uint64(1), p.Duplicates())
+}
+
+func TestPipeline_DedupWindowExpires(t *testing.T) {
+	sink := &memSink{}
+	p := NewPipeline(Options{DedupWindow: time.Minute}, sink)
+	now := time.Now()
+	e := event("u1", "flag_a", "true")
+	e.Timestamp = now
+	p.Record(e)
+	e.Timestamp = now.Add(2 * time.Minute)
+	p.Record(e)
+	require.NoError(t, p.Close())
+
+	assert.Len(t, sink.events, 2)
+}
+
+func TestPipeline_DropsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	sink := &blockingSink{block: block}
+	p := NewPipeline(Options{BufferSize: 1, BatchSize: 1}, sink)
+
+	// The first event blocks in the sink; the rest fill the sink's queue
+	// and the buffer, then are dropped.
+	p.Record(event("u0", "f", "1"))
+	require.Eventually(t, func() bool { return sink.started() }, time.Second, time.Millisecond)
+	const n = 100
+	for i := 1; i < n; i++ {
+		p.Record(event(fmt.Sprintf("u%d", i), "f", "1"))
+	}
+
+	assert.Positive(t, p.Dropped())
+	close(block)
+	require.NoError(t, p.Close())
+	assert.Equal(t, n, sink.calls+int(p.Dropped()), "every event is written or counted as dropped")
+}
+
+func TestPipeline_SlowSinkDoesNotDelayOthers(t *testing.T) {
+	block := make(chan struct{})
+	slow := &blockingSink{block: block}
+	fast := &memSink{}
+	p := NewPipeline(Options{BatchSize: 1}, slow, fast)
+
+	p.Record(event("u1", "f", "1"))
+	p.Record(event("u2", "f", "1"))
+	require.Eventually(t, func() bool {
+		fast.mu.Lock()
+		defer fast.mu.Unlock()
+		return len(fast.events) == 2
+	}, time.Second, time.Millisecond)
+	assert.True(t, slow.started())
+
+	close(block)
+	require.NoError(t, p.Close())
+	assert.Equal(t, 2, slow.calls)
+}
+
+func TestPipeline_RecordAfterClose(t *testing.T) {
+	p := NewPipeline(Options{}, &memSink{})
+	require.NoError(t, p.Close())
+	assert.NotPanics(t, func() { p.Record(event("u1", "f", "1")) })
+}
+
+type blockingSink struct {
+	mu    sync.Mutex
+	calls int
+	block chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(events []Event) error {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	<-s.block
+	return nil
+}
+
+func (s *blockingSink) started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls > 0
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exposures.ndjson")
+	sink, err := NewFileSink(path, 200, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sink.Write([]Event{event("user_1", "flag_a", "true")}))
+	}
+	require.NoError(t, sink.Close())
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		require.NoError(t, err, p)
+		assert.LessOrEqual(t, info.Size(), int64(200), p)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only maxBackups files are kept")
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		assert.Equal(t, "flag_a", e.FlagKey)
+	}
+}
+
+func TestWebhookSink_Deadline(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	sink.backoff = time.Hour
+	sink.deadline = 50 * time.Millisecond
+
+	start := time.Now()
+	err := sink.Write([]Event{event("u1", "f", "1")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "webhook returned 503")
+	assert.Less(t, time.Since(start), 5*time.Second, "backoff stops at the deadline")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWebhookSink_Retries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	sink.backoff = time.Millisecond
+	require.NoError(t, sink.Write([]Event{event("u1", "f", "1")}))
+	assert.Equal(t, int32(3), calls.Load())
+}
@@ -0,0 +1,210 @@
+package exposure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Sink receives batches of exposure events. Write is only ever called from
+// the sink's own pipeline goroutine, so implementations need no locking.
+// Batches are shared between sinks and must not be modified.
+type Sink interface {
+	Name() string
+	Write(events []Event) error
+	Close() error
+}
+
+// --- Writer (stdout) ---
+
+// WriterSink writes events as NDJSON to an io.Writer.
+type WriterSink struct {
+	w io.Writer
+}
+
+// NewStdoutSink returns a sink writing NDJSON to standard output.
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{w: os.Stdout}
+}
+
+func (s *WriterSink) Name() string { return "stdout" }
+
+func (s *WriterSink) Write(events []Event) error {
+	bw := bufio.NewWriter(s.w)
+	enc := json.NewEncoder(bw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encode event: %w", err)
+		}
+	}
+	return bw.Flush()
+}
+
+func (s *WriterSink) Close() error { return nil }
+
+// --- NDJSON file with size-based rotation ---
+
+// FileSink appends events as NDJSON to a file. When the file would exceed
+// maxBytes, it is renamed to path.1 (shifting older files up to path.N,
+// where N is maxBackups) and a new file is started.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens (or creates) path for appending.
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open exposure file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat exposure file: %w", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(events []Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encode event: %w", err)
+		}
+	}
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(buf.Len()) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(buf.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write exposure file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("close exposure file: %w", err)
+	}
+
+	if s.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return fmt.Errorf("rotate exposure file: %w", err)
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("rotate exposure file: %w", err)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// --- HTTP batch webhook ---
+
+// WebhookSink POSTs each batch as {"events": [...]} to a URL.
+// Failed requests are retried with backoff until the retries or the batch
+// deadline run out, then the batch is given up.
+type WebhookSink struct {
+	url      string
+	client   *http.Client
+	retries  int
+	backoff  time.Duration
+	deadline time.Duration // Bounds all attempts at one batch
+}
+
+// NewWebhookSink returns a sink posting batches to url.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:      url,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		retries:  3,
+		backoff:  500 * time.Millisecond,
+		deadline: 30 * time.Second,
+	}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Write(events []Event) error {
+	body, err := json.Marshal(map[string]interface{}{"events": events})
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.deadline)
+	defer cancel()
+
+	var lastErr error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(s.backoff << (attempt - 1))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("after %d attempts: %w", attempt, lastErr)
+			}
+		}
+		lastErr = s.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("after %d attempts: %w", s.retries+1, lastErr)
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error { return nil }
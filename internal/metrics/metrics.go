@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// QueryBuckets are latency buckets in seconds tuned for local SQLite queries.
+var QueryBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1}
+
+// Metrics is the set of metrics exported by the Flaggy server.
+// All recording methods are safe to call on a nil *Metrics, so callers
+// don't need to check whether metrics are enabled.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	evaluations   *prometheus.CounterVec
+	queryDuration *prometheus.HistogramVec
+	authFailures  *prometheus.CounterVec
+	rateLimited   prometheus.Counter
+}
+
+// New creates the Flaggy metric set on a fresh registry, along with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	m := &Metrics{
+		Registry: reg,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flaggy_http_requests_total",
+			Help: "Total HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "flaggy_http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		evaluations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flaggy_evaluations_total",
+			Help: "Flag evaluations by flag and reason.",
+		}, []string{"flag", "reason"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "flaggy_store_query_duration_seconds",
+			Help:    "Store operation latency by operation.",
+			Buckets: QueryBuckets,
+		}, []string{"op"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flaggy_auth_failures_total",
+			Help: "Rejected authentication attempts by kind and reason.",
+		}, []string{"kind", "reason"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "flaggy_rate_limited_total",
+			Help: "Requests rejected by an API key's rate limit.",
+		}),
+	}
+	reg.MustRegister(m.httpRequests, m.httpDuration, m.evaluations, m.queryDuration, m.authFailures, m.rateLimited)
+	return m
+}
+
+// RegisterSSE exposes the SSE broadcaster's connected client count and
+// the number of events it dropped for slow clients.
+func (m *Metrics) RegisterSSE(clients func() int, dropped func() uint64) {
+	m.Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "flaggy_sse_clients",
+			Help: "Currently connected SSE clients.",
+		}, func() float64 { return float64(clients()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "flaggy_sse_dropped_events_total",
+			Help: "Events dropped because a client's buffer was full.",
+		}, func() float64 { return float64(dropped()) }),
+	)
+}
+
+// RegisterExposures exposes the exposure pipeline's drop, dedup and sink error counts.
+func (m *Metrics) RegisterExposures(dropped, duplicates, sinkErrors func() uint64) {
+	m.Registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "flaggy_exposures_dropped_total",
+			Help: "Exposure events dropped because the buffer or a sink's queue was full.",
+		}, func() float64 { return float64(dropped()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "flaggy_exposures_deduplicated_total",
+			Help: "Exposure events suppressed as duplicates.",
+		}, func() float64 { return float64(duplicates()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "flaggy_exposure_sink_errors_total",
+			Help: "Failed exposure sink writes.",
+		}, func() float64 { return float64(sinkErrors()) }),
+	)
+}
+
+// ObserveHTTP records a completed HTTP request. Pass a zero duration to
+// count the request without recording latency (e.g. long-lived streams).
+func (m *Metrics) ObserveHTTP(method, route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	if d > 0 {
+		m.httpDuration.WithLabelValues(method, route).Observe(d.Seconds())
+	}
+}
+
+// CountEvaluation records a flag evaluation result.
+func (m *Metrics) CountEvaluation(flag, reason string) {
+	if m == nil {
+		return
+	}
+	m.evaluations.WithLabelValues(flag, reason).Inc()
+}
+
+// ObserveQuery records the latency of a store operation.
+func (m *Metrics) ObserveQuery(op string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.queryDuration.WithLabelValues(op).Observe(d.Seconds())
+}
+
+// CountAuthFailure records a rejected authentication attempt.
+// kind is "api_key", "master_key", "user_token" or "jwt"; reason is a short
+// machine-readable cause.
+func (m *Metrics) CountAuthFailure(kind, reason string) {
+	if m == nil {
+		return
+	}
+	m.authFailures.WithLabelValues(kind, reason).Inc()
+}
+
+// CountRateLimited records a request rejected by an API key's rate limit.
+// Keys aren't labelled, to keep the series count bounded.
+func (m *Metrics) CountRateLimited() {
+	if m == nil {
+		return
+	}
+	m.rateLimited.Inc()
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(m *Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.ObserveHTTP("GET", "/api/v1/flags", 200, 50*time.Millisecond)
+	m.ObserveHTTP("GET", "/api/v1/flags", 200, 0)
+	m.CountEvaluation("checkout", "default")
+	m.CountRateLimited()
+	m.RegisterSSE(func() int { return 4 }, func() uint64 { return 2 })
+
+	out := scrape(m)
+	assert.Contains(t, out, `flaggy_http_requests_total{method="GET",route="/api/v1/flags",status="200"} 2`)
+	assert.Contains(t, out, `flaggy_http_request_duration_seconds_count{method="GET",route="/api/v1/flags"} 1`)
+	assert.Contains(t, out, `flaggy_evaluations_total{flag="checkout",reason="default"} 1`)
+	assert.Contains(t, out, "flaggy_rate_limited_total 1\n")
+	assert.Contains(t, out, "flaggy_sse_clients 4\n")
+	assert.Contains(t, out, "flaggy_sse_dropped_events_total 2\n")
+	assert.Contains(t, out, "go_goroutines ")
+}
+
+func TestMetrics_NilSafe(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.CountEvaluation("flag", "default")
+		m.ObserveHTTP("GET", "/", 200, 0)
+		m.ObserveQuery("get_flag", 0)
+		m.CountAuthFailure("api_key", "invalid")
+		m.CountRateLimited()
+	})
+}
@@ -0,0 +1,34 @@
+package models
+
+import "context"
+
+// Actor identifies who performed an admin change.
+type Actor struct {
+	Type string `json:"type"` // master_key, anonymous
+	ID   string `json:"id"`
+}
+
+// Built-in actors.
+var (
+	ActorMasterKey = Actor{Type: "master_key", ID: "master"}
+	ActorAnonymous = Actor{Type: "anonymous", ID: "anonymous"} // auth disabled (dev mode)
+)
+
+func (a Actor) String() string {
+	return a.Type + ":" + a.ID
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFromContext returns the actor stored in ctx, or ActorAnonymous if none.
+func ActorFromContext(ctx context.Context) Actor {
+	if a, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return a
+	}
+	return ActorAnonymous
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -25,16 +26,98 @@ func ValidateEnvironment(env Environment) error {
 	}
 }
 
+// Scope is a class of routes an API key may call.
+type Scope string
+
+const (
+	ScopeEvaluate     Scope = "evaluate"      // POST /evaluate and /evaluate/batch
+	ScopeStream       Scope = "stream"        // GET /stream
+	ScopeReadFlags    Scope = "read_flags"    // GET /flags, a flag and its versions
+	ScopeReadSegments Scope = "read_segments" // GET /segments and a segment
+)
+
+// DefaultScopes are given to keys created without explicit scopes. They
+// match what every key could do before scopes existed.
+var DefaultScopes = []Scope{ScopeEvaluate, ScopeStream}
+
+func ValidateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, sc := range scopes {
+		switch sc {
+		case ScopeEvaluate, ScopeStream, ScopeReadFlags, ScopeReadSegments:
+		default:
+			return fmt.Errorf("invalid scope: %q (must be evaluate, stream, read_flags, or read_segments)", sc)
+		}
+	}
+	return nil
+}
+
+// JoinScopes encodes scopes for storage as a comma-separated list.
+func JoinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, sc := range scopes {
+		parts[i] = string(sc)
+	}
+	return strings.Join(parts, ",")
+}
+
+// SplitScopes decodes a list encoded by JoinScopes.
+func SplitScopes(s string) []Scope {
+	scopes := []Scope{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			scopes = append(scopes, Scope(part))
+		}
+	}
+	return scopes
+}
+
 type APIKey struct {
 	ID          string      `json:"id"`
 	Name        string      `json:"name"`
 	Environment Environment `json:"environment"`
+	Scopes      []Scope     `json:"scopes"`
 	Prefix      string      `json:"prefix"`
 	Revoked     bool        `json:"revoked"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	ReplacedBy  string      `json:"replaced_by,omitempty"` // Successor issued by rotation
+	RateLimit   float64     `json:"rate_limit,omitempty"`  // Requests per second; 0 uses the server default
+	RateBurst   int         `json:"rate_burst,omitempty"`  // Bucket size; 0 uses the rate, rounded up
 	CreatedAt   time.Time   `json:"created_at"`
 	LastUsedAt  *time.Time  `json:"last_used_at,omitempty"`
 }
 
+// Expired reports whether the key's expiry has passed at now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// ValidateRateLimit checks a per-key rate limit and burst.
+func ValidateRateLimit(rate float64, burst int) error {
+	if rate < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	if burst < 0 {
+		return fmt.Errorf("rate_burst must not be negative")
+	}
+	if burst > 0 && rate == 0 {
+		return fmt.Errorf("rate_burst requires rate_limit")
+	}
+	return nil
+}
+
+// HasScope reports whether the key was granted sc.
+func (k *APIKey) HasScope(sc Scope) bool {
+	for _, have := range k.Scopes {
+		if have == sc {
+			return true
+		}
+	}
+	return false
+}
+
 // APIKeyWithRaw is returned only at creation time. RawKey is shown once.
 type APIKeyWithRaw struct {
 	APIKey
@@ -44,7 +127,7 @@ type APIKeyWithRaw struct {
 // GenerateAPIKey creates a new API key with a random suffix.
 // The raw key is returned for the one-time display.
 // Only the SHA-256 hash is stored.
-func GenerateAPIKey(name string, env Environment) (*APIKeyWithRaw, string) {
+func GenerateAPIKey(name string, env Environment, scopes []Scope) (*APIKeyWithRaw, string) {
 	suffix := make([]byte, 32)
 	if _, err := rand.Read(suffix); err != nil {
 		panic(fmt.Sprintf("crypto/rand failed: %v", err))
@@ -64,6 +147,7 @@ func GenerateAPIKey(name string, env Environment) (*APIKeyWithRaw, string) {
 			ID:          id,
 			Name:        name,
 			Environment: env,
+			Scopes:      scopes,
 			Prefix:      prefix,
 			CreatedAt:   time.Now().UTC(),
 		},
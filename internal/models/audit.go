@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one recorded admin change. Before is empty for creations,
+// After is empty for deletions.
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	Actor        Actor           `json:"actor"`
+	Action       string          `json:"action"`        // e.g. flag.create, rule.update, segment.delete
+	ResourceType string          `json:"resource_type"` // flag, rule, segment, api_key
+	ResourceKey  string          `json:"resource_key"`  // flag key (also for rules), segment key, or API key ID
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit entries. Zero fields don't filter.
+// Results are ordered newest first; Cursor is the ID of the last entry of the
+// previous page.
+type AuditFilter struct {
+	ActorType    string
+	ActorID      string
+	Action       string
+	ResourceType string
+	ResourceKey  string
+	Since        time.Time
+	Until        time.Time
+	Cursor       int64
+	Limit        int
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChangeStatus is the lifecycle state of a change request.
+type ChangeStatus string
+
+const (
+	ChangePending  ChangeStatus = "pending"  // Waiting for reviews
+	ChangeApproved ChangeStatus = "approved" // Enough approvals; being applied
+	ChangeApplied  ChangeStatus = "applied"  // Written to the store
+	ChangeRejected ChangeStatus = "rejected" // A reviewer rejected it
+	ChangeFailed   ChangeStatus = "failed"   // Approved, but applying it failed (see ApplyError)
+)
+
+// Review decisions.
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// ChangeRequest is a proposed flag, rule or segment write that is held until
+// enough reviewers other than the proposer approve it.
+type ChangeRequest struct {
+	ID                int64           `json:"id"`
+	Environment       Environment     `json:"environment"`
+	ResourceType      string          `json:"resource_type"` // flag, rule, segment
+	Action            string          `json:"action"`        // create, update, delete, toggle, restore
+	ResourceKey       string          `json:"resource_key"`  // flag key (also for rules) or segment key
+	RuleID            int64           `json:"rule_id,omitempty"`
+	Payload           json.RawMessage `json:"payload,omitempty"`      // Request body of the equivalent direct write
+	BaseVersion       int             `json:"base_version,omitempty"` // Resource version the diff was computed against
+	Diff              []Change        `json:"diff"`
+	Comment           string          `json:"comment,omitempty"`
+	Status            ChangeStatus    `json:"status"`
+	RequiredApprovals int             `json:"required_approvals"`
+	Proposer          Actor           `json:"proposer"`
+	Reviews           []ChangeReview  `json:"reviews"`
+	ApplyError        string          `json:"apply_error,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// Approvals returns the number of approving reviews.
+func (cr *ChangeRequest) Approvals() int {
+	n := 0
+	for _, r := range cr.Reviews {
+		if r.Decision == DecisionApprove {
+			n++
+		}
+	}
+	return n
+}
+
+// ChangeReview is one reviewer's decision on a change request.
+type ChangeReview struct {
+	Actor     Actor     `json:"actor"`
+	Decision  string    `json:"decision"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EnvironmentPolicy controls how admin writes reach the store in an environment.
+type EnvironmentPolicy struct {
+	Environment       Environment `json:"environment"`
+	RequiredApprovals int         `json:"required_approvals"`  // Approvals a change request needs (min 1)
+	AllowDirectWrites bool        `json:"allow_direct_writes"` // If false, writes must go through change requests
+	UpdatedAt         time.Time   `json:"updated_at,omitempty"`
+}
+
+// DefaultEnvironmentPolicy is used for environments without a stored policy.
+func DefaultEnvironmentPolicy(env Environment) *EnvironmentPolicy {
+	return &EnvironmentPolicy{Environment: env, RequiredApprovals: 1, AllowDirectWrites: true}
+}
+
+type CreateChangeRequestRequest struct {
+	ResourceType string          `json:"resource_type"`
+	Action       string          `json:"action"`
+	ResourceKey  string          `json:"resource_key"`
+	RuleID       int64           `json:"rule_id,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Comment      string          `json:"comment"`
+}
+
+type ReviewChangeRequestRequest struct {
+	Comment string `json:"comment"`
+}
+
+// ValidateChangeOperation checks that action is supported for resourceType.
+func ValidateChangeOperation(resourceType, action string) error {
+	allowed := map[string][]string{
+		"flag":    {"create", "update", "delete", "toggle", "restore", "clone"},
+		"rule":    {"create", "update", "delete"},
+		"segment": {"create", "update", "delete"},
+	}
+	actions, ok := allowed[resourceType]
+	if !ok {
+		return fmt.Errorf("invalid resource_type: %q (must be flag, rule, or segment)", resourceType)
+	}
+	for _, a := range actions {
+		if a == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid action %q for %s", action, resourceType)
+}
+
+// ValidatePolicy checks an environment policy.
+func ValidatePolicy(p *EnvironmentPolicy) error {
+	if err := ValidateEnvironment(p.Environment); err != nil {
+		return err
+	}
+	if p.RequiredApprovals < 1 || p.RequiredApprovals > 10 {
+		return fmt.Errorf("required_approvals must be between 1 and 10")
+	}
+	return nil
+}
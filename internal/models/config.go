@@ -0,0 +1,258 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Config is the declarative state of a server's flags and segments, as
+// written by `flaggy export` and read by `flaggy apply`. It holds no IDs,
+// versions or timestamps. Applying a config makes the server match it
+// exactly: flags and segments missing from it are deleted.
+type Config struct {
+	Segments []SegmentConfig `json:"segments"`
+	Flags    []FlagConfig    `json:"flags"`
+}
+
+// FlagConfig is the user-defined part of a flag. Rules are in evaluation
+// order.
+type FlagConfig struct {
+	Key          string          `json:"key"`
+	Type         FlagType        `json:"type"`
+	Description  string          `json:"description"`
+	Enabled      bool            `json:"enabled"`
+	DefaultValue json.RawMessage `json:"default_value"`
+	Rules        []RuleConfig    `json:"rules"`
+}
+
+// SegmentConfig is the user-defined part of a segment.
+type SegmentConfig struct {
+	Key         string            `json:"key"`
+	Description string            `json:"description"`
+	Conditions  []ConditionConfig `json:"conditions"`
+}
+
+// Actions of a ConfigChange.
+const (
+	ConfigCreate = "create"
+	ConfigUpdate = "update"
+	ConfigDelete = "delete"
+)
+
+// ConfigChange is one step of applying a config.
+type ConfigChange struct {
+	Action       string   `json:"action"`        // create, update or delete
+	ResourceType string   `json:"resource_type"` // segment or flag
+	Key          string   `json:"key"`
+	Changes      []Change `json:"changes,omitempty"` // Field changes of an update
+
+	// Set once the change is applied, for publishing events.
+	Flag     *Flag    `json:"-"`
+	Previous *Flag    `json:"-"`
+	Segment  *Segment `json:"-"`
+}
+
+// ConfigPlan lists the changes that make a server match a config, in the
+// order they are applied: segments are created and updated before the flags
+// whose rules reference them, and deleted after.
+type ConfigPlan struct {
+	Changes []ConfigChange `json:"changes"`
+	Applied bool           `json:"applied"`
+}
+
+// FlagToConfig returns the user-defined part of a flag.
+func FlagToConfig(f *Flag) FlagConfig {
+	rules := make([]RuleConfig, len(f.Rules))
+	for i := range f.Rules {
+		rules[i] = ruleConfig(&f.Rules[i])
+	}
+	return FlagConfig{
+		Key:          f.Key,
+		Type:         f.Type,
+		Description:  f.Description,
+		Enabled:      f.Enabled,
+		DefaultValue: f.DefaultValue,
+		Rules:        rules,
+	}
+}
+
+// FlagFromConfig returns a new flag, with rules, defined by a config.
+func FlagFromConfig(fc *FlagConfig) *Flag {
+	rules := make([]Rule, len(fc.Rules))
+	for i, rc := range fc.Rules {
+		rules[i] = Rule{
+			Description:       rc.Description,
+			Value:             rc.Value,
+			Priority:          rc.Priority,
+			RolloutPercentage: rc.RolloutPercentage,
+			Conditions:        Conditions(rc.Conditions),
+			SegmentKeys:       rc.SegmentKeys,
+		}
+	}
+	return &Flag{
+		Key:          fc.Key,
+		Type:         fc.Type,
+		Description:  fc.Description,
+		Enabled:      fc.Enabled,
+		DefaultValue: fc.DefaultValue,
+		Rules:        rules,
+	}
+}
+
+// SegmentToConfig returns the user-defined part of a segment.
+func SegmentToConfig(s *Segment) SegmentConfig {
+	return SegmentConfig{
+		Key:         s.Key,
+		Description: s.Description,
+		Conditions:  conditionConfigs(s.Conditions),
+	}
+}
+
+// Conditions converts condition configs for storage.
+func Conditions(configs []ConditionConfig) []Condition {
+	out := make([]Condition, len(configs))
+	for i, c := range configs {
+		out[i] = Condition{Attribute: c.Attribute, Operator: c.Operator, Value: c.Value}
+	}
+	return out
+}
+
+// NormalizeConfig puts a config in the form exported by the server: flags
+// and segments sorted by key, rules sorted by priority (keeping their order
+// within one priority), segment keys sorted and no nil lists.
+func NormalizeConfig(c *Config) {
+	if c.Segments == nil {
+		c.Segments = []SegmentConfig{}
+	}
+	if c.Flags == nil {
+		c.Flags = []FlagConfig{}
+	}
+	sort.SliceStable(c.Segments, func(i, j int) bool { return c.Segments[i].Key < c.Segments[j].Key })
+	sort.SliceStable(c.Flags, func(i, j int) bool { return c.Flags[i].Key < c.Flags[j].Key })
+
+	for i := range c.Segments {
+		s := &c.Segments[i]
+		if s.Conditions == nil {
+			s.Conditions = []ConditionConfig{}
+		}
+	}
+	for i := range c.Flags {
+		f := &c.Flags[i]
+		if f.Rules == nil {
+			f.Rules = []RuleConfig{}
+		}
+		sort.SliceStable(f.Rules, func(a, b int) bool { return f.Rules[a].Priority < f.Rules[b].Priority })
+		for j := range f.Rules {
+			r := &f.Rules[j]
+			if r.Conditions == nil {
+				r.Conditions = []ConditionConfig{}
+			}
+			if r.SegmentKeys == nil {
+				r.SegmentKeys = []string{}
+			}
+			sort.Strings(r.SegmentKeys)
+		}
+	}
+}
+
+// ValidateConfig checks every flag and segment in a config, that keys are
+// unique, and that rules only reference segments defined in the config.
+func ValidateConfig(c *Config) error {
+	segments := make(map[string]bool, len(c.Segments))
+	for _, sc := range c.Segments {
+		if segments[sc.Key] {
+			return fmt.Errorf("segment %q is defined more than once", sc.Key)
+		}
+		segments[sc.Key] = true
+		seg := &Segment{Key: sc.Key, Description: sc.Description, Conditions: Conditions(sc.Conditions)}
+		if err := ValidateSegment(seg); err != nil {
+			return fmt.Errorf("segment %q: %w", sc.Key, err)
+		}
+	}
+
+	flags := make(map[string]bool, len(c.Flags))
+	for _, fc := range c.Flags {
+		if flags[fc.Key] {
+			return fmt.Errorf("flag %q is defined more than once", fc.Key)
+		}
+		flags[fc.Key] = true
+		if err := ValidateFlagConfig(&fc); err != nil {
+			return err
+		}
+		for i, rc := range fc.Rules {
+			for _, sk := range rc.SegmentKeys {
+				if !segments[sk] {
+					return fmt.Errorf("flag %q: rules[%d]: segment %q is not defined in the config", fc.Key, i, sk)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateFlagConfig checks a flag config and its rules, but not that the
+// segments they reference exist.
+func ValidateFlagConfig(fc *FlagConfig) error {
+	flag := &Flag{Key: fc.Key, Type: fc.Type, Description: fc.Description, DefaultValue: fc.DefaultValue}
+	if err := ValidateFlag(flag); err != nil {
+		return fmt.Errorf("flag %q: %w", fc.Key, err)
+	}
+	for i, rc := range fc.Rules {
+		rule := &Rule{
+			Conditions:        Conditions(rc.Conditions),
+			SegmentKeys:       rc.SegmentKeys,
+			RolloutPercentage: rc.RolloutPercentage,
+		}
+		if err := ValidateRule(rule); err != nil {
+			return fmt.Errorf("flag %q: rules[%d]: %w", fc.Key, i, err)
+		}
+		if err := ValidateValueForType(fc.Type, rc.Value); err != nil {
+			return fmt.Errorf("flag %q: rules[%d]: value: %w", fc.Key, i, err)
+		}
+	}
+	return nil
+}
+
+// DiffFlagConfigs returns the changes from before to after. Unlike
+// DiffFlags, rules are matched by position, since configs have no rule IDs.
+func DiffFlagConfigs(before, after *FlagConfig) []Change {
+	var changes []Change
+	add := func(path string, b, a interface{}) {
+		bj, aj := mustMarshal(b), mustMarshal(a)
+		if !jsonEqual(bj, aj) {
+			changes = append(changes, Change{Path: path, Before: bj, After: aj})
+		}
+	}
+	add("type", before.Type, after.Type)
+	add("description", before.Description, after.Description)
+	add("enabled", before.Enabled, after.Enabled)
+	add("default_value", before.DefaultValue, after.DefaultValue)
+
+	for i := range max(len(before.Rules), len(after.Rules)) {
+		path := fmt.Sprintf("rules[%d]", i)
+		switch {
+		case i >= len(after.Rules):
+			changes = append(changes, Change{Path: path, Before: mustMarshal(before.Rules[i])})
+		case i >= len(before.Rules):
+			changes = append(changes, Change{Path: path, After: mustMarshal(after.Rules[i])})
+		default:
+			changes = append(changes, diffRuleConfigs(path, before.Rules[i], after.Rules[i])...)
+		}
+	}
+	return changes
+}
+
+// DiffSegmentConfigs returns the changes from before to after.
+func DiffSegmentConfigs(before, after *SegmentConfig) []Change {
+	var changes []Change
+	add := func(path string, b, a interface{}) {
+		bj, aj := mustMarshal(b), mustMarshal(a)
+		if !jsonEqual(bj, aj) {
+			changes = append(changes, Change{Path: path, Before: bj, After: aj})
+		}
+	}
+	add("description", before.Description, after.Description)
+	add("conditions", before.Conditions, after.Conditions)
+	return changes
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Segments: []SegmentConfig{{
+			Key:        "pro_users",
+			Conditions: []ConditionConfig{{Attribute: "plan", Operator: OpEquals, Value: json.RawMessage(`"pro"`)}},
+		}},
+		Flags: []FlagConfig{{
+			Key:          "new_checkout",
+			Type:         FlagTypeBoolean,
+			DefaultValue: json.RawMessage(`false`),
+			Rules: []RuleConfig{{
+				Value:             json.RawMessage(`true`),
+				RolloutPercentage: 100,
+				SegmentKeys:       []string{"pro_users"},
+			}},
+		}},
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	require.NoError(t, ValidateConfig(testConfig()))
+
+	cfg := testConfig()
+	cfg.Flags[0].Rules[0].SegmentKeys = []string{"missing"}
+	assert.ErrorContains(t, ValidateConfig(cfg), `segment "missing" is not defined`)
+
+	cfg = testConfig()
+	cfg.Flags = append(cfg.Flags, cfg.Flags[0])
+	assert.ErrorContains(t, ValidateConfig(cfg), "defined more than once")
+
+	cfg = testConfig()
+	cfg.Flags[0].Rules[0].Value = json.RawMessage(`"yes"`)
+	assert.ErrorContains(t, ValidateConfig(cfg), "rules[0]: value: expected boolean value")
+}
+
+func TestFlagToConfig_RoundTrip(t *testing.T) {
+	// An exported flag, normalized, has no changes against itself
+	cfg := &Config{Flags: []FlagConfig{FlagToConfig(testFlag())}}
+	NormalizeConfig(cfg)
+	before := FlagToConfig(testFlag())
+
+	assert.Empty(t, DiffFlagConfigs(&before, &cfg.Flags[0]))
+}
+
+func TestNormalizeConfig(t *testing.T) {
+	cfg := &Config{Flags: []FlagConfig{
+		{Key: "zeta", Rules: []RuleConfig{
+			{Description: "second", Priority: 2},
+			{Description: "first", Priority: 1, SegmentKeys: []string{"b", "a"}},
+		}},
+		{Key: "alpha"},
+	}}
+	NormalizeConfig(cfg)
+
+	assert.Equal(t, "alpha", cfg.Flags[0].Key)
+	assert.Equal(t, []RuleConfig{}, cfg.Flags[0].Rules)
+	assert.Equal(t, "first", cfg.Flags[1].Rules[0].Description)
+	assert.Equal(t, []string{"a", "b"}, cfg.Flags[1].Rules[0].SegmentKeys)
+	assert.Equal(t, []ConditionConfig{}, cfg.Flags[1].Rules[1].Conditions)
+	assert.Equal(t, []SegmentConfig{}, cfg.Segments)
+}
+
+func TestDiffFlagConfigs_RulesByPosition(t *testing.T) {
+	before := testConfig().Flags[0]
+	after := testConfig().Flags[0]
+	after.Rules[0].RolloutPercentage = 50
+	after.Rules = append(after.Rules, RuleConfig{Value: json.RawMessage(`false`)})
+
+	changes := DiffFlagConfigs(&before, &after)
+	require.Len(t, changes, 2)
+	assert.Equal(t, Change{Path: "rules[0].rollout_percentage", Before: json.RawMessage(`100`), After: json.RawMessage(`50`)}, changes[0])
+	assert.Equal(t, "rules[1]", changes[1].Path)
+	assert.Empty(t, changes[1].Before)
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change is a single difference between two versions of a resource.
+// Before is empty for additions, After is empty for removals.
+type Change struct {
+	Path   string          `json:"path"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// DiffFlags returns the configuration changes from before to after.
+// Rules are matched by ID; timestamps and database IDs of conditions are ignored.
+// Either side may be nil (flag created or deleted).
+func DiffFlags(before, after *Flag) []Change {
+	var changes []Change
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return []Change{{Path: "", After: mustMarshal(after)}}
+	case after == nil:
+		return []Change{{Path: "", Before: mustMarshal(before)}}
+	}
+
+	add := func(path string, b, a interface{}) {
+		bj, aj := mustMarshal(b), mustMarshal(a)
+		if !jsonEqual(bj, aj) {
+			changes = append(changes, Change{Path: path, Before: bj, After: aj})
+		}
+	}
+	add("type", before.Type, after.Type)
+	add("description", before.Description, after.Description)
+	add("enabled", before.Enabled, after.Enabled)
+	add("default_value", before.DefaultValue, after.DefaultValue)
+
+	beforeRules := make(map[int64]*Rule, len(before.Rules))
+	for i := range before.Rules {
+		beforeRules[before.Rules[i].ID] = &before.Rules[i]
+	}
+	afterRules := make(map[int64]*Rule, len(after.Rules))
+	for i := range after.Rules {
+		afterRules[after.Rules[i].ID] = &after.Rules[i]
+	}
+
+	ids := make([]int64, 0, len(beforeRules)+len(afterRules))
+	for id := range beforeRules {
+		ids = append(ids, id)
+	}
+	for id := range afterRules {
+		if _, ok := beforeRules[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		b, a := beforeRules[id], afterRules[id]
+		path := fmt.Sprintf("rules[%d]", id)
+		switch {
+		case a == nil:
+			changes = append(changes, Change{Path: path, Before: mustMarshal(ruleConfig(b))})
+		case b == nil:
+			changes = append(changes, Change{Path: path, After: mustMarshal(ruleConfig(a))})
+		default:
+			changes = append(changes, DiffRules(path, b, a)...)
+		}
+	}
+	return changes
+}
+
+// DiffRules returns field-level changes between two rules, prefixing each path.
+func DiffRules(prefix string, before, after *Rule) []Change {
+	return diffRuleConfigs(prefix, ruleConfig(before), ruleConfig(after))
+}
+
+func diffRuleConfigs(prefix string, bc, ac RuleConfig) []Change {
+	var changes []Change
+	add := func(field string, b, a interface{}) {
+		bj, aj := mustMarshal(b), mustMarshal(a)
+		if !jsonEqual(bj, aj) {
+			changes = append(changes, Change{Path: prefix + "." + field, Before: bj, After: aj})
+		}
+	}
+	add("description", bc.Description, ac.Description)
+	add("value", bc.Value, ac.Value)
+	add("priority", bc.Priority, ac.Priority)
+	add("rollout_percentage", bc.RolloutPercentage, ac.RolloutPercentage)
+	add("conditions", bc.Conditions, ac.Conditions)
+	add("segment_keys", bc.SegmentKeys, ac.SegmentKeys)
+	return changes
+}
+
+// DiffSegments returns the configuration changes between two segments.
+// Either side may be nil (segment created or deleted).
+func DiffSegments(before, after *Segment) []Change {
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return []Change{{Path: "", After: mustMarshal(after)}}
+	case after == nil:
+		return []Change{{Path: "", Before: mustMarshal(before)}}
+	}
+
+	var changes []Change
+	add := func(path string, b, a interface{}) {
+		bj, aj := mustMarshal(b), mustMarshal(a)
+		if !jsonEqual(bj, aj) {
+			changes = append(changes, Change{Path: path, Before: bj, After: aj})
+		}
+	}
+	add("description", before.Description, after.Description)
+	add("conditions", conditionConfigs(before.Conditions), conditionConfigs(after.Conditions))
+	return changes
+}
+
+// ConditionConfig is the user-defined part of a condition, without IDs or timestamps.
+type ConditionConfig struct {
+	Attribute string          `json:"attribute"`
+	Operator  Operator        `json:"operator"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// RuleConfig is the user-defined part of a rule, without IDs or timestamps.
+type RuleConfig struct {
+	Description       string            `json:"description"`
+	Value             json.RawMessage   `json:"value"`
+	Priority          int               `json:"priority"`
+	RolloutPercentage int               `json:"rollout_percentage"`
+	Conditions        []ConditionConfig `json:"conditions"`
+	SegmentKeys       []string          `json:"segment_keys"`
+}
+
+func ruleConfig(r *Rule) RuleConfig {
+	keys := append([]string{}, r.SegmentKeys...)
+	sort.Strings(keys)
+	return RuleConfig{
+		Description:       r.Description,
+		Value:             r.Value,
+		Priority:          r.Priority,
+		RolloutPercentage: r.RolloutPercentage,
+		Conditions:        conditionConfigs(r.Conditions),
+		SegmentKeys:       keys,
+	}
+}
+
+func conditionConfigs(conds []Condition) []ConditionConfig {
+	out := make([]ConditionConfig, len(conds))
+	for i, c := range conds {
+		out[i] = ConditionConfig{Attribute: c.Attribute, Operator: c.Operator, Value: c.Value}
+	}
+	return out
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("marshal %T: %v", v, err))
+	}
+	return b
+}
+
+// jsonEqual compares two JSON documents semantically: key order and
+// whitespace don't matter.
+func jsonEqual(a, b json.RawMessage) bool {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return string(a) == string(b)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
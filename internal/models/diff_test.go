@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testFlag() *Flag {
+	return &Flag{
+		Key:          "new_checkout",
+		Type:         FlagTypeBoolean,
+		Enabled:      true,
+		DefaultValue: json.RawMessage(`false`),
+		Rules: []Rule{{
+			ID:          1,
+			Value:       json.RawMessage(`true`),
+			Priority:    1,
+			SegmentKeys: []string{"pro_users"},
+			Conditions: []Condition{
+				{ID: 10, Attribute: "country", Operator: OpEquals, Value: json.RawMessage(`"FR"`)},
+			},
+		}},
+	}
+}
+
+func TestDiffFlags_NoChanges(t *testing.T) {
+	a, b := testFlag(), testFlag()
+	// Timestamps and condition IDs are not configuration
+	b.UpdatedAt = time.Now()
+	b.Rules[0].Conditions[0].ID = 99
+	b.DefaultValue = json.RawMessage(` false `)
+
+	assert.Empty(t, DiffFlags(a, b))
+}
+
+func TestDiffFlags_FieldChanges(t *testing.T) {
+	a, b := testFlag(), testFlag()
+	b.Enabled = false
+	b.Rules[0].RolloutPercentage = 20
+
+	changes := DiffFlags(a, b)
+	assert.Equal(t, []Change{
+		{Path: "enabled", Before: json.RawMessage(`true`), After: json.RawMessage(`false`)},
+		{Path: "rules[1].rollout_percentage", Before: json.RawMessage(`0`), After: json.RawMessage(`20`)},
+	}, changes)
+}
+
+func TestDiffFlags_RulesAddedAndRemoved(t *testing.T) {
+	a, b := testFlag(), testFlag()
+	b.Rules[0].ID = 2
+
+	changes := DiffFlags(a, b)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "rules[1]", changes[0].Path)
+	assert.NotEmpty(t, changes[0].Before)
+	assert.Empty(t, changes[0].After)
+	assert.Equal(t, "rules[2]", changes[1].Path)
+	assert.Empty(t, changes[1].Before)
+	assert.NotEmpty(t, changes[1].After)
+}
+
+func TestDiffFlags_CreatedAndDeleted(t *testing.T) {
+	f := testFlag()
+
+	created := DiffFlags(nil, f)
+	assert.Len(t, created, 1)
+	assert.Empty(t, created[0].Before)
+
+	deleted := DiffFlags(f, nil)
+	assert.Len(t, deleted, 1)
+	assert.Empty(t, deleted[0].After)
+
+	assert.Nil(t, DiffFlags(nil, nil))
+}
+
+func TestDiffFlags_SegmentKeyOrderIgnored(t *testing.T) {
+	a, b := testFlag(), testFlag()
+	a.Rules[0].SegmentKeys = []string{"a", "b"}
+	b.Rules[0].SegmentKeys = []string{"b", "a"}
+
+	assert.Empty(t, DiffFlags(a, b))
+}
+
+func TestDiffSegments(t *testing.T) {
+	a := &Segment{Key: "pro", Conditions: []Condition{{Attribute: "plan", Operator: OpEquals, Value: json.RawMessage(`"pro"`)}}}
+	b := &Segment{Key: "pro", Description: "Pro users", Conditions: a.Conditions}
+
+	changes := DiffSegments(a, b)
+	assert.Equal(t, []Change{
+		{Path: "description", Before: json.RawMessage(`""`), After: json.RawMessage(`"Pro users"`)},
+	}, changes)
+}
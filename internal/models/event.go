@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ChangeEvent is a published change, numbered in publication order. Seq is
+// the SSE event ID clients resume from.
+type ChangeEvent struct {
+	Seq         int64           `json:"seq"`
+	Type        string          `json:"type"`
+	FlagKey     string          `json:"flag_key,omitempty"` // Flag the event concerns; empty for segment events
+	Environment Environment     `json:"environment"`        // Environment of the server that published it
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// NewChangeEvent returns an event about the flag flagKey, or about a
+// segment if flagKey is empty, with data as its payload.
+func NewChangeEvent(eventType, flagKey string, data any) ChangeEvent {
+	return ChangeEvent{Type: eventType, FlagKey: flagKey, Data: mustMarshal(data)}
+}
+
+// FlagDeletedEvent returns the event of deleting the flag key.
+func FlagDeletedEvent(key string) ChangeEvent {
+	return NewChangeEvent("flag_deleted", key, map[string]string{"key": key})
+}
+
+// RuleDeletedEvent returns the event of deleting a rule of the flag flagKey.
+func RuleDeletedEvent(flagKey string, ruleID int64) ChangeEvent {
+	return NewChangeEvent("rule_deleted", flagKey, map[string]interface{}{"flag_key": flagKey, "rule_id": ruleID})
+}
+
+// SegmentDeletedEvent returns the event of deleting the segment key.
+func SegmentDeletedEvent(key string) ChangeEvent {
+	return NewChangeEvent("segment_deleted", "", map[string]string{"key": key})
+}
+
+// FlagReplacedEvents returns the events a client would have seen had the
+// change from previous, nil for a new flag, to current been made through
+// the regular flag and rule endpoints.
+func FlagReplacedEvents(previous, current *Flag) []ChangeEvent {
+	var events []ChangeEvent
+	if previous == nil {
+		events = append(events, NewChangeEvent("flag_created", current.Key, current))
+	} else {
+		events = append(events, NewChangeEvent("flag_updated", current.Key, current))
+	}
+
+	prevRules := make(map[int64]*Rule)
+	if previous != nil {
+		for i := range previous.Rules {
+			prevRules[previous.Rules[i].ID] = &previous.Rules[i]
+		}
+	}
+	for i := range current.Rules {
+		rule := &current.Rules[i]
+		old, existed := prevRules[rule.ID]
+		delete(prevRules, rule.ID)
+		switch {
+		case !existed:
+			events = append(events, NewChangeEvent("rule_created", current.Key, rule))
+		case len(DiffRules("", old, rule)) > 0:
+			events = append(events, NewChangeEvent("rule_updated", current.Key, rule))
+		}
+	}
+	if previous != nil {
+		// In the previous flag's order, so the events are deterministic
+		for i := range previous.Rules {
+			if id := previous.Rules[i].ID; prevRules[id] != nil {
+				events = append(events, RuleDeletedEvent(current.Key, id))
+			}
+		}
+	}
+	return events
+}
+
+// ConfigPlanEvents returns the events of each change of an applied plan,
+// in order.
+func ConfigPlanEvents(plan *ConfigPlan) []ChangeEvent {
+	var events []ChangeEvent
+	for _, c := range plan.Changes {
+		switch {
+		case c.ResourceType == "segment" && c.Action == ConfigCreate:
+			events = append(events, NewChangeEvent("segment_created", "", c.Segment))
+		case c.ResourceType == "segment" && c.Action == ConfigUpdate:
+			events = append(events, NewChangeEvent("segment_updated", "", c.Segment))
+		case c.ResourceType == "segment":
+			events = append(events, SegmentDeletedEvent(c.Key))
+		case c.Action == ConfigDelete:
+			events = append(events, FlagDeletedEvent(c.Key))
+		default:
+			events = append(events, FlagReplacedEvents(c.Previous, c.Flag)...)
+		}
+	}
+	return events
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagReplacedEvents(t *testing.T) {
+	rule := func(id int64, value string) Rule {
+		return Rule{ID: id, Value: json.RawMessage(value), RolloutPercentage: 100}
+	}
+	previous := &Flag{Key: "checkout", Rules: []Rule{rule(1, `true`), rule(2, `true`), rule(3, `true`), rule(4, `true`)}}
+	current := &Flag{Key: "checkout", Rules: []Rule{rule(2, `false`), rule(3, `true`), rule(5, `true`)}}
+
+	// ID is the rule's, or 0 for flag events
+	type event struct {
+		Type string
+		ID   int64
+	}
+	summarize := func(events []ChangeEvent) []event {
+		var out []event
+		for _, e := range events {
+			assert.Equal(t, "checkout", e.FlagKey)
+			var data struct {
+				ID     int64 `json:"id"`
+				RuleID int64 `json:"rule_id"`
+			}
+			assert.NoError(t, json.Unmarshal(e.Data, &data))
+			out = append(out, event{e.Type, data.ID + data.RuleID})
+		}
+		return out
+	}
+
+	assert.Equal(t, []event{
+		{"flag_updated", 0},
+		{"rule_updated", 2},
+		{"rule_created", 5},
+		{"rule_deleted", 1},
+		{"rule_deleted", 4},
+	}, summarize(FlagReplacedEvents(previous, current)))
+
+	assert.Equal(t, []event{
+		{"flag_created", 0},
+		{"rule_created", 2},
+		{"rule_created", 3},
+		{"rule_created", 5},
+	}, summarize(FlagReplacedEvents(nil, current)))
+}
@@ -48,6 +48,7 @@ type Flag struct {
 	Enabled      bool            `json:"enabled"`
 	DefaultValue json.RawMessage `json:"default_value"`
 	Rules        []Rule          `json:"rules,omitempty"`
+	Version      int             `json:"version"`
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
 
@@ -64,6 +65,7 @@ type Rule struct {
 	RolloutPercentage int             `json:"rollout_percentage"`
 	Conditions        []Condition     `json:"conditions"`
 	SegmentKeys       []string        `json:"segment_keys,omitempty"`
+	Version           int             `json:"version"`
 	CreatedAt         time.Time       `json:"created_at"`
 	UpdatedAt         time.Time       `json:"updated_at"`
 }
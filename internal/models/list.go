@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ListOptions selects and orders a page of flags, segments or API keys.
+// Zero fields don't filter or limit.
+type ListOptions struct {
+	Query  string // Case-insensitive substring of the key or description (name or ID for API keys)
+	Sort   string // A sort field, prefixed with "-" for descending order
+	Cursor string // NextCursor of the previous page
+	Limit  int
+}
+
+// PageInfo describes a page returned for ListOptions.
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
+	Total      int    `json:"total"`                 // Items matching the query, across all pages
+}
+
+// Sort fields each list accepts. The first is the default.
+var (
+	FlagSorts    = []string{"key", "-key", "created_at", "-created_at", "updated_at", "-updated_at"}
+	SegmentSorts = []string{"key", "-key", "created_at", "-created_at", "updated_at", "-updated_at"}
+	APIKeySorts  = []string{"-created_at", "created_at", "name", "-name"}
+)
+
+// ParseSort checks sort against the accepted fields and splits it into the
+// field and direction. An empty sort is the first accepted one.
+func ParseSort(sort string, accepted []string) (field string, desc bool, err error) {
+	if sort == "" {
+		sort = accepted[0]
+	}
+	for _, a := range accepted {
+		if a == sort {
+			field, desc = strings.CutPrefix(sort, "-")
+			return field, desc, nil
+		}
+	}
+	return "", false, fmt.Errorf("sort must be one of %s", strings.Join(accepted, ", "))
+}
@@ -0,0 +1,26 @@
+package models
+
+// Promotion is the result of copying a flag's description, default value
+// and rules from one environment to another. The target keeps its enabled
+// state; a flag new to the target is created disabled.
+type Promotion struct {
+	Key             string      `json:"key"`
+	From            Environment `json:"from"`
+	To              Environment `json:"to"`
+	Action          string      `json:"action"`                     // create or update; empty if the target already matches
+	Changes         []Change    `json:"changes"`                    // Changes to the target's flag
+	MissingSegments []string    `json:"missing_segments,omitempty"` // Segments the rules reference that the target doesn't have
+	Applied         bool        `json:"applied"`
+
+	Flag *Flag `json:"-"` // Set once the promotion is applied
+}
+
+// PromotedConfig returns the config of source as promoted onto target,
+// which is nil if the target has no such flag.
+func PromotedConfig(source, target *Flag) FlagConfig {
+	fc := FlagToConfig(source)
+	fc.Enabled = target != nil && target.Enabled
+	cfg := Config{Flags: []FlagConfig{fc}}
+	NormalizeConfig(&cfg)
+	return cfg.Flags[0]
+}
@@ -8,6 +8,18 @@ type CreateFlagRequest struct {
 	Description  string          `json:"description"`
 	Enabled      bool            `json:"enabled"`
 	DefaultValue json.RawMessage `json:"default_value"`
+
+	// Template creates the flag from a template, which gives its type,
+	// default value and rules; Values fills in the template's placeholders.
+	Template string                     `json:"template,omitempty"`
+	Values   map[string]json.RawMessage `json:"values,omitempty"`
+}
+
+// CloneFlagRequest copies a flag with its rules under a new key. The copy
+// is disabled.
+type CloneFlagRequest struct {
+	Key         string  `json:"key"`
+	Description *string `json:"description,omitempty"` // Defaults to the original's
 }
 
 type UpdateFlagRequest struct {
@@ -44,4 +56,5 @@ type EvaluateResponse struct {
 	Value   json.RawMessage `json:"value"`
 	Match   bool            `json:"match"`
 	Reason  string          `json:"reason"`
+	RuleID  int64           `json:"rule_id,omitempty"` // Set when a rule matched
 }
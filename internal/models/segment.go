@@ -9,6 +9,7 @@ type Segment struct {
 	Key         string      `json:"key"`
 	Description string      `json:"description"`
 	Conditions  []Condition `json:"conditions"`
+	Version     int         `json:"version"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
 }
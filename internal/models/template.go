@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// FlagTemplate is a reusable flag definition: a type, a default value and
+// rules, stamped out as new flags. The default value and rule values may be
+// placeholders, JSON strings of the form "{{name}}", filled in with a value
+// of the flag's type when a flag is created from the template.
+type FlagTemplate struct {
+	Name         string                     `json:"name"`
+	Description  string                     `json:"description"`
+	Type         FlagType                   `json:"type"`
+	DefaultValue json.RawMessage            `json:"default_value"`
+	Rules        []RuleConfig               `json:"rules"`
+	Defaults     map[string]json.RawMessage `json:"defaults,omitempty"` // Placeholder values used when a flag doesn't give one
+	CreatedAt    time.Time                  `json:"created_at"`
+	UpdatedAt    time.Time                  `json:"updated_at"`
+}
+
+var placeholderRegex = regexp.MustCompile(`^\{\{\s*([a-z][a-z0-9_]*)\s*\}\}$`)
+
+// placeholder returns the name of the placeholder v is, if it is one.
+func placeholder(v json.RawMessage) (string, bool) {
+	var s string
+	if json.Unmarshal(v, &s) != nil {
+		return "", false
+	}
+	m := placeholderRegex.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Placeholders returns the names of the template's placeholders, in the
+// order they first appear.
+func (t *FlagTemplate) Placeholders() []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(v json.RawMessage) {
+		if name, ok := placeholder(v); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	add(t.DefaultValue)
+	for _, rc := range t.Rules {
+		add(rc.Value)
+	}
+	return names
+}
+
+// ValidateFlagTemplate checks a template. Values that are placeholders are
+// checked once they are filled in.
+func ValidateFlagTemplate(t *FlagTemplate) error {
+	if !keyRegex.MatchString(t.Name) {
+		return fmt.Errorf("name must match %s", keyRegex.String())
+	}
+	switch t.Type {
+	case FlagTypeBoolean, FlagTypeString, FlagTypeNumber, FlagTypeJSON:
+	default:
+		return fmt.Errorf("invalid flag type: %q", t.Type)
+	}
+	checkValue := func(v json.RawMessage) error {
+		if _, ok := placeholder(v); ok {
+			return nil
+		}
+		return ValidateValueForType(t.Type, v)
+	}
+	if err := checkValue(t.DefaultValue); err != nil {
+		return fmt.Errorf("default_value: %w", err)
+	}
+	for i, rc := range t.Rules {
+		rule := &Rule{
+			Conditions:        Conditions(rc.Conditions),
+			SegmentKeys:       rc.SegmentKeys,
+			RolloutPercentage: rc.RolloutPercentage,
+		}
+		if err := ValidateRule(rule); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if err := checkValue(rc.Value); err != nil {
+			return fmt.Errorf("rules[%d]: value: %w", i, err)
+		}
+	}
+
+	placeholders := map[string]bool{}
+	for _, name := range t.Placeholders() {
+		placeholders[name] = true
+	}
+	for name, v := range t.Defaults {
+		if !placeholders[name] {
+			return fmt.Errorf("defaults: %q is not a placeholder of the template", name)
+		}
+		if err := ValidateValueForType(t.Type, v); err != nil {
+			return fmt.Errorf("defaults: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Config returns the config of a flag with key made from the template.
+// Placeholders are filled in from values, falling back to the template's
+// defaults; each must have one or the other.
+func (t *FlagTemplate) Config(key string, values map[string]json.RawMessage) (*FlagConfig, error) {
+	placeholders := map[string]bool{}
+	for _, name := range t.Placeholders() {
+		placeholders[name] = true
+	}
+	for name := range values {
+		if !placeholders[name] {
+			return nil, fmt.Errorf("template %q has no placeholder %q", t.Name, name)
+		}
+	}
+	fill := func(v json.RawMessage) (json.RawMessage, error) {
+		name, ok := placeholder(v)
+		if !ok {
+			return v, nil
+		}
+		if value, ok := values[name]; ok {
+			return value, nil
+		}
+		if value, ok := t.Defaults[name]; ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("no value for placeholder %q of template %q", name, t.Name)
+	}
+
+	fc := &FlagConfig{Key: key, Type: t.Type, Rules: make([]RuleConfig, len(t.Rules))}
+	var err error
+	if fc.DefaultValue, err = fill(t.DefaultValue); err != nil {
+		return nil, err
+	}
+	for i, rc := range t.Rules {
+		if rc.Value, err = fill(rc.Value); err != nil {
+			return nil, err
+		}
+		fc.Rules[i] = rc
+	}
+	if err := ValidateFlagConfig(fc); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
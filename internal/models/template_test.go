@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTemplate() *FlagTemplate {
+	return &FlagTemplate{
+		Name:         "staged_variant",
+		Type:         FlagTypeString,
+		DefaultValue: json.RawMessage(`"control"`),
+		Rules: []RuleConfig{
+			{Value: json.RawMessage(`"{{variant}}"`), SegmentKeys: []string{"internal"}},
+			{
+				Value:             json.RawMessage(`"{{ variant }}"`),
+				RolloutPercentage: 10,
+				Conditions:        []ConditionConfig{{Attribute: "plan", Operator: OpEquals, Value: json.RawMessage(`"pro"`)}},
+			},
+		},
+		Defaults: map[string]json.RawMessage{"variant": json.RawMessage(`"treatment"`)},
+	}
+}
+
+func TestValidateFlagTemplate(t *testing.T) {
+	tmpl := testTemplate()
+	require.NoError(t, ValidateFlagTemplate(tmpl))
+	assert.Equal(t, []string{"variant"}, tmpl.Placeholders())
+
+	tmpl = testTemplate()
+	tmpl.Type = FlagTypeNumber
+	tmpl.DefaultValue = json.RawMessage(`"{{default}}"`)
+	tmpl.Defaults = nil
+	require.NoError(t, ValidateFlagTemplate(tmpl), "placeholders are checked when filled in")
+
+	tmpl = testTemplate()
+	tmpl.DefaultValue = json.RawMessage(`1`)
+	assert.ErrorContains(t, ValidateFlagTemplate(tmpl), "default_value")
+
+	tmpl = testTemplate()
+	tmpl.Defaults["other"] = json.RawMessage(`"x"`)
+	assert.ErrorContains(t, ValidateFlagTemplate(tmpl), `"other" is not a placeholder`)
+
+	tmpl = testTemplate()
+	tmpl.Defaults["variant"] = json.RawMessage(`1`)
+	assert.ErrorContains(t, ValidateFlagTemplate(tmpl), "defaults: variant")
+
+	tmpl = testTemplate()
+	tmpl.Rules[1].RolloutPercentage = 101
+	assert.ErrorContains(t, ValidateFlagTemplate(tmpl), "rules[1]")
+}
+
+func TestFlagTemplate_Config(t *testing.T) {
+	tmpl := testTemplate()
+
+	fc, err := tmpl.Config("checkout_copy", map[string]json.RawMessage{"variant": json.RawMessage(`"short"`)})
+	require.NoError(t, err)
+	assert.Equal(t, "checkout_copy", fc.Key)
+	assert.Equal(t, FlagTypeString, fc.Type)
+	assert.JSONEq(t, `"control"`, string(fc.DefaultValue))
+	require.Len(t, fc.Rules, 2)
+	assert.JSONEq(t, `"short"`, string(fc.Rules[0].Value))
+	assert.JSONEq(t, `"short"`, string(fc.Rules[1].Value))
+	assert.Equal(t, 10, fc.Rules[1].RolloutPercentage)
+	assert.JSONEq(t, `"{{variant}}"`, string(tmpl.Rules[0].Value), "the template is unchanged")
+
+	fc, err = tmpl.Config("checkout_copy", nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"treatment"`, string(fc.Rules[0].Value), "falls back to the default")
+
+	tmpl.Defaults = nil
+	_, err = tmpl.Config("checkout_copy", nil)
+	assert.ErrorContains(t, err, `no value for placeholder "variant"`)
+
+	_, err = tmpl.Config("checkout_copy", map[string]json.RawMessage{"variant": json.RawMessage(`"a"`), "pct": json.RawMessage(`5`)})
+	assert.ErrorContains(t, err, `no placeholder "pct"`)
+
+	_, err = tmpl.Config("checkout_copy", map[string]json.RawMessage{"variant": json.RawMessage(`true`)})
+	assert.Error(t, err, "values must match the flag type")
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Role determines what an admin identity may do.
+type Role string
+
+const (
+	RoleViewer     Role = "viewer"      // Read flags, segments, history, audit and change requests
+	RoleEditor     Role = "editor"      // Viewer + write flags, rules and segments, propose and review changes
+	RoleKeyManager Role = "key-manager" // Viewer + manage API keys
+	RoleAdmin      Role = "admin"       // Everything, including users and environment policies
+)
+
+func ValidateRole(r Role) error {
+	switch r {
+	case RoleViewer, RoleEditor, RoleKeyManager, RoleAdmin:
+		return nil
+	default:
+		return fmt.Errorf("invalid role: %q (must be viewer, editor, key-manager, or admin)", r)
+	}
+}
+
+// Permission is a class of admin routes.
+type Permission string
+
+const (
+	PermRead       Permission = "read"        // GET flags, segments, history, audit, change requests
+	PermWrite      Permission = "write"       // Flag, rule, segment and template writes; change requests
+	PermManageKeys Permission = "manage_keys" // API keys
+	PermAdmin      Permission = "admin"       // Users, tokens, environment policies
+)
+
+// Can reports whether the role grants p.
+func (r Role) Can(p Permission) bool {
+	switch r {
+	case RoleAdmin:
+		return true
+	case RoleEditor:
+		return p == PermRead || p == PermWrite
+	case RoleKeyManager:
+		return p == PermRead || p == PermManageKeys
+	case RoleViewer:
+		return p == PermRead
+	}
+	return false
+}
+
+// UserKind distinguishes people from automation.
+type UserKind string
+
+const (
+	UserKindUser    UserKind = "user"
+	UserKindService UserKind = "service"
+)
+
+// User is a named admin identity: a person or a service account.
+// Users authenticate with personal tokens.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Kind      UserKind  `json:"kind"`
+	Role      Role      `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Actor returns the identity recorded for the user's changes.
+func (u *User) Actor() Actor {
+	return Actor{Type: string(u.Kind), ID: u.Name}
+}
+
+// UserToken is a personal access token. Only its hash is stored.
+type UserToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Revoked    bool       `json:"revoked"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// UserTokenWithRaw is returned only at creation time. RawToken is shown once.
+type UserTokenWithRaw struct {
+	UserToken
+	RawToken string `json:"token"`
+}
+
+type CreateUserRequest struct {
+	Name string   `json:"name"`
+	Kind UserKind `json:"kind"`
+	Role Role     `json:"role"`
+}
+
+type UpdateUserRequest struct {
+	Role     *Role `json:"role,omitempty"`
+	Disabled *bool `json:"disabled,omitempty"`
+}
+
+type CreateUserTokenRequest struct {
+	Name string `json:"name"`
+}
+
+var userNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@-]{0,127}$`)
+
+func ValidateUser(u *User) error {
+	if !userNamePattern.MatchString(u.Name) {
+		return fmt.Errorf("name must match %s", userNamePattern.String())
+	}
+	switch u.Kind {
+	case UserKindUser, UserKindService:
+	default:
+		return fmt.Errorf("invalid kind: %q (must be user or service)", u.Kind)
+	}
+	return ValidateRole(u.Role)
+}
+
+// GenerateUserID returns a new random user ID.
+func GenerateUserID() string {
+	return "usr_" + randomHex(8)
+}
+
+// GenerateUserToken creates a personal token for userID.
+// The raw token is returned for the one-time display; store only the hash.
+func GenerateUserToken(userID, name string) (*UserTokenWithRaw, string) {
+	suffix := randomHex(32)
+	rawToken := "flg_pat_" + suffix
+
+	token := &UserTokenWithRaw{
+		UserToken: UserToken{
+			ID:        "tok_" + suffix[:16],
+			UserID:    userID,
+			Name:      name,
+			Prefix:    "flg_pat_" + suffix[:4],
+			CreatedAt: time.Now().UTC(),
+		},
+		RawToken: rawToken,
+	}
+	return token, HashKey(rawToken)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role Role
+		can  []Permission
+	}{
+		{RoleViewer, []Permission{PermRead}},
+		{RoleEditor, []Permission{PermRead, PermWrite}},
+		{RoleKeyManager, []Permission{PermRead, PermManageKeys}},
+		{RoleAdmin, []Permission{PermRead, PermWrite, PermManageKeys, PermAdmin}},
+		{Role("owner"), nil},
+	}
+	all := []Permission{PermRead, PermWrite, PermManageKeys, PermAdmin}
+	for _, tt := range tests {
+		for _, p := range all {
+			assert.Equal(t, contains(tt.can, p), tt.role.Can(p), "%s can %s", tt.role, p)
+		}
+	}
+}
+
+func contains(ps []Permission, p Permission) bool {
+	for _, q := range ps {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateUser(t *testing.T) {
+	valid := User{Name: "alice@example.com", Kind: UserKindUser, Role: RoleEditor}
+	assert.NoError(t, ValidateUser(&valid))
+
+	bad := valid
+	bad.Name = "-alice"
+	assert.Error(t, ValidateUser(&bad))
+
+	bad = valid
+	bad.Kind = "robot"
+	assert.Error(t, ValidateUser(&bad))
+
+	bad = valid
+	bad.Role = "owner"
+	assert.Error(t, ValidateUser(&bad))
+}
+
+func TestGenerateUserToken(t *testing.T) {
+	token, hash := GenerateUserToken("usr_1", "laptop")
+
+	assert.True(t, strings.HasPrefix(token.RawToken, "flg_pat_"))
+	assert.True(t, strings.HasPrefix(token.RawToken, token.Prefix))
+	assert.Equal(t, HashKey(token.RawToken), hash)
+	assert.NotContains(t, hash, token.RawToken)
+	assert.Equal(t, "usr_1", token.UserID)
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// FlagVersion is an immutable snapshot of a flag's full configuration
+// (rules, conditions and segment references) taken after a write.
+// Versions are numbered per flag starting at 1 and survive flag deletion.
+type FlagVersion struct {
+	FlagKey   string    `json:"flag_key"`
+	Version   int       `json:"version"`
+	Action    string    `json:"action"` // audit action that produced it, e.g. flag.update, rule.create
+	Actor     Actor     `json:"actor"`
+	Snapshot  *Flag     `json:"snapshot,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FlagVersionDiff is the result of comparing two versions of a flag.
+type FlagVersionDiff struct {
+	FlagKey string   `json:"flag_key"`
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Changes []Change `json:"changes"`
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// EventTypes lists the change events published to SSE clients and webhooks.
+var EventTypes = []string{
+	"flag_created", "flag_updated", "flag_deleted", "flag_toggled",
+	"rule_created", "rule_updated", "rule_deleted",
+	"segment_created", "segment_updated", "segment_deleted",
+}
+
+// Webhook is an endpoint that receives change events. Payloads are signed
+// with Secret, which is only returned when the webhook is created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // Event types to send; empty means all
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to eventType.
+func (w *Webhook) Wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus is the state of one event's delivery to one webhook.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // Waiting for its first or next attempt
+	DeliveryDelivered DeliveryStatus = "delivered" // The endpoint answered 2xx
+	DeliveryDead      DeliveryStatus = "dead"      // Out of attempts; redeliver to try again
+)
+
+// WebhookDelivery is an outbox entry: one event queued for one webhook.
+type WebhookDelivery struct {
+	ID            int64            `json:"id"`
+	WebhookID     string           `json:"webhook_id"`
+	EventID       string           `json:"event_id"`
+	EventType     string           `json:"event_type"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        DeliveryStatus   `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+	AttemptLog    []WebhookAttempt `json:"attempt_log,omitempty"` // Only on single-delivery reads
+}
+
+// WebhookAttempt records one POST to a webhook endpoint.
+type WebhookAttempt struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 if no response was received
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"` // Optional; generated if empty
+}
+
+func ValidateWebhook(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, e := range w.Events {
+		known := false
+		for _, t := range EventTypes {
+			known = known || e == t
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	if len(w.Secret) < 16 {
+		return fmt.Errorf("secret must be at least 16 characters")
+	}
+	return nil
+}
+
+// GenerateWebhookID returns a new random webhook ID.
+func GenerateWebhookID() string {
+	return "whk_" + randomHex(8)
+}
+
+// GenerateWebhookSecret returns a new random signing secret.
+func GenerateWebhookSecret() string {
+	return "whsec_" + randomHex(32)
+}
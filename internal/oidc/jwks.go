@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk is a single JSON Web Key. Only the fields needed for RSA and EC
+// signature keys are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes a JWKS document into public keys by key ID. Keys that
+// aren't RSA or EC signature keys are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			pub, err = k.rsaKey()
+		case "EC":
+			pub, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks has no usable signature keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySource returns the current signing keys by key ID.
+type KeySource interface {
+	// Keys returns the cached keys. If refresh is true, the source may
+	// reload them first, e.g. because a token names an unknown key ID.
+	Keys(refresh bool) (map[string]crypto.PublicKey, error)
+}
+
+// minRefreshInterval limits how often an unknown key ID can trigger a reload.
+const minRefreshInterval = time.Minute
+
+// cachedSource loads keys with load and reloads them on request, at most
+// once per minRefreshInterval.
+type cachedSource struct {
+	load func() ([]byte, error)
+	name string
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+}
+
+func newCachedSource(name string, load func() ([]byte, error)) (*cachedSource, error) {
+	s := &cachedSource{load: load, name: name}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *cachedSource) reload() error {
+	data, err := s.load()
+	if err != nil {
+		return fmt.Errorf("load jwks from %s: %w", s.name, err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("load jwks from %s: %w", s.name, err)
+	}
+	s.keys = keys
+	s.loadedAt = time.Now()
+	return nil
+}
+
+func (s *cachedSource) Keys(refresh bool) (map[string]crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if refresh && time.Since(s.loadedAt) >= minRefreshInterval {
+		if err := s.reload(); err != nil {
+			// Keep serving the keys we have; the IdP may be briefly down.
+			slog.Warn("jwks refresh failed", "source", s.name, "error", err)
+			s.loadedAt = time.Now()
+		}
+	}
+	return s.keys, nil
+}
+
+// NewFileSource loads a JWKS document from a local file. The file is read
+// again when a token names an unknown key ID.
+func NewFileSource(path string) (KeySource, error) {
+	return newCachedSource(path, func() ([]byte, error) { return os.ReadFile(path) })
+}
+
+// NewURLSource fetches a JWKS document over HTTP. It is fetched again when a
+// token names an unknown key ID, which picks up key rotation at the IdP.
+func NewURLSource(url string, client *http.Client) (KeySource, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return newCachedSource(url, func() ([]byte, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	})
+}
+
+// StaticSource serves a fixed key set.
+type StaticSource map[string]crypto.PublicKey
+
+func (s StaticSource) Keys(bool) (map[string]crypto.PublicKey, error) {
+	return s, nil
+}
@@ -0,0 +1,308 @@
+// Package oidc authenticates admin requests with JWT bearer tokens issued by
+// an OpenID Connect identity provider, verified against its JWKS.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, badly
+	// signed, expired, or issued by or for someone else.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrNoRole is returned for valid tokens whose claims map to no role.
+	ErrNoRole = errors.New("token grants no flaggy role")
+)
+
+// ActorType is recorded as the actor type for changes made with a JWT.
+const ActorType = "oidc"
+
+// Config controls token validation and how claims map to flaggy identities.
+type Config struct {
+	Issuer   string // Required "iss"
+	Audience string // Must appear in "aud"
+
+	// NameClaim holds the actor name (default "email", falling back to "sub").
+	NameClaim string
+	// RoleClaim holds a string or list of strings mapped to a role
+	// (default "groups").
+	RoleClaim string
+	// RoleMap maps RoleClaim values to roles. If empty, values are taken as
+	// role names.
+	RoleMap map[string]models.Role
+	// DefaultRole applies when no RoleClaim value maps to a role. Empty
+	// rejects such tokens.
+	DefaultRole models.Role
+
+	// Leeway tolerates clock skew on exp, nbf and iat (default 1 minute).
+	Leeway time.Duration
+}
+
+// Verifier validates JWTs and maps their claims to an actor and role.
+type Verifier struct {
+	cfg  Config
+	keys KeySource
+	now  func() time.Time
+}
+
+func NewVerifier(cfg Config, keys KeySource) (*Verifier, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("oidc: issuer is required")
+	}
+	if cfg.Audience == "" {
+		return nil, fmt.Errorf("oidc: audience is required")
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "email"
+	}
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = "groups"
+	}
+	if cfg.Leeway == 0 {
+		cfg.Leeway = time.Minute
+	}
+	for value, role := range cfg.RoleMap {
+		if err := models.ValidateRole(role); err != nil {
+			return nil, fmt.Errorf("oidc: role map %q: %w", value, err)
+		}
+	}
+	if cfg.DefaultRole != "" {
+		if err := models.ValidateRole(cfg.DefaultRole); err != nil {
+			return nil, fmt.Errorf("oidc: default role: %w", err)
+		}
+	}
+	return &Verifier{cfg: cfg, keys: keys, now: time.Now}, nil
+}
+
+// LooksLikeJWT reports whether token has the three-part JWS compact form.
+// Flaggy's own keys and tokens never contain dots.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Verify checks the token's signature and registered claims and returns
+// the actor and role it maps to.
+func (v *Verifier) Verify(token string) (models.Actor, models.Role, error) {
+	claims, err := v.verifyClaims(token)
+	if err != nil {
+		return models.Actor{}, "", err
+	}
+
+	name, _ := claims[v.cfg.NameClaim].(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+	if name == "" {
+		return models.Actor{}, "", fmt.Errorf("%w: no %s or sub claim", ErrInvalidToken, v.cfg.NameClaim)
+	}
+	actor := models.Actor{Type: ActorType, ID: name}
+
+	role := v.mapRole(claims[v.cfg.RoleClaim])
+	if role == "" {
+		return actor, "", ErrNoRole
+	}
+	return actor, role, nil
+}
+
+func (v *Verifier) verifyClaims(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+
+	keys, err := v.keys.Keys(false)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[h.Kid]
+	if !ok {
+		if keys, err = v.keys.Keys(true); err != nil {
+			return nil, err
+		}
+		if key, ok = keys[h.Kid]; !ok {
+			return nil, fmt.Errorf("%w: unknown key ID %q", ErrInvalidToken, h.Kid)
+		}
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkRegistered(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkRegistered(claims map[string]any) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("issuer %q is not trusted", iss)
+	}
+	if !hasAudience(claims["aud"], v.cfg.Audience) {
+		return fmt.Errorf("audience does not include %q", v.cfg.Audience)
+	}
+
+	now := v.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("missing exp")
+	}
+	if !now.Before(exp.Add(v.cfg.Leeway)) {
+		return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(v.cfg.Leeway).Before(iat) {
+		return fmt.Errorf("token issued in the future")
+	}
+	return nil
+}
+
+func hasAudience(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		for _, v := range a {
+			if s, _ := v.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(v any) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// rolePriority orders roles for tokens whose claims map to several.
+var rolePriority = []models.Role{models.RoleAdmin, models.RoleEditor, models.RoleKeyManager, models.RoleViewer}
+
+// mapRole returns the highest-priority role the claim value maps to, or
+// the default role.
+func (v *Verifier) mapRole(claim any) models.Role {
+	var values []string
+	switch c := claim.(type) {
+	case string:
+		values = []string{c}
+	case []any:
+		for _, item := range c {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	granted := map[models.Role]bool{}
+	for _, value := range values {
+		if len(v.cfg.RoleMap) > 0 {
+			if role, ok := v.cfg.RoleMap[value]; ok {
+				granted[role] = true
+			}
+		} else if models.ValidateRole(models.Role(value)) == nil {
+			granted[models.Role(value)] = true
+		}
+	}
+	for _, role := range rolePriority {
+		if granted[role] {
+			return role
+		}
+	}
+	return v.cfg.DefaultRole
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifySignature checks sig over signingInput. Only asymmetric algorithms
+// are accepted, and the key type must match the algorithm.
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, sig []byte) error {
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg {
+	case "RS256", "ES256", "PS256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "RS384", "ES384", "PS384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512", "PS512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s needs an RSA key", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(pub, ch, digest, sig, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, ch, digest, sig)
+	default:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s needs an EC key", alg)
+		}
+		if want := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]; pub.Curve.Params().BitSize != want {
+			return fmt.Errorf("algorithm %s doesn't match the key's curve", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("bad signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+}
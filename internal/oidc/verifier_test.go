@@ -0,0 +1,232 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "flaggy"
+)
+
+var (
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testNow   = time.Unix(1_800_000_000, 0)
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func testJWKS() []byte {
+	size := 32
+	x, y := make([]byte, size), make([]byte, size)
+	ecKey.X.FillBytes(x)
+	ecKey.Y.FillBytes(y)
+	doc := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+			"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(x), "y": b64(y)},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}}
+	b, _ := json.Marshal(doc)
+	return b
+}
+
+// sign builds a compact JWS with the given algorithm and key ID.
+func sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case "none":
+	}
+	require.NoError(t, err)
+	return input + "." + b64(sig)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":    testIssuer,
+		"aud":    []string{"other", testAudience},
+		"sub":    "00u1abcd",
+		"email":  "alice@example.com",
+		"groups": []string{"everyone", "flaggy-editors"},
+		"iat":    testNow.Add(-time.Minute).Unix(),
+		"exp":    testNow.Add(time.Hour).Unix(),
+	}
+}
+
+func newTestVerifier(t *testing.T, cfg Config) *Verifier {
+	t.Helper()
+	keys, err := ParseJWKS(testJWKS())
+	require.NoError(t, err)
+	cfg.Issuer, cfg.Audience = testIssuer, testAudience
+	if cfg.RoleMap == nil {
+		cfg.RoleMap = map[string]models.Role{"flaggy-editors": models.RoleEditor, "flaggy-admins": models.RoleAdmin}
+	}
+	v, err := NewVerifier(cfg, StaticSource(keys))
+	require.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func TestParseJWKS_SkipsUnsupportedKeys(t *testing.T) {
+	keys, err := ParseJWKS(testJWKS())
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.IsType(t, &rsa.PublicKey{}, keys["rsa-1"])
+	assert.IsType(t, &ecdsa.PublicKey{}, keys["ec-1"])
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`))
+	assert.Error(t, err)
+}
+
+func TestVerify_ValidTokens(t *testing.T) {
+	v := newTestVerifier(t, Config{})
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+		actor, role, err := v.Verify(sign(t, alg, kid, validClaims()))
+		require.NoError(t, err, alg)
+		assert.Equal(t, models.Actor{Type: ActorType, ID: "alice@example.com"}, actor)
+		assert.Equal(t, models.RoleEditor, role)
+	}
+}
+
+func TestVerify_RejectsBadTokens(t *testing.T) {
+	v := newTestVerifier(t, Config{})
+	with := func(key string, value any) map[string]any {
+		c := validClaims()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := map[string]string{
+		"wrong issuer":     sign(t, "RS256", "rsa-1", with("iss", "https://evil.example.com")),
+		"wrong audience":   sign(t, "RS256", "rsa-1", with("aud", "someone-else")),
+		"expired":          sign(t, "RS256", "rsa-1", with("exp", testNow.Add(-2*time.Minute).Unix())),
+		"no expiry":        sign(t, "RS256", "rsa-1", with("exp", nil)),
+		"not yet valid":    sign(t, "RS256", "rsa-1", with("nbf", testNow.Add(10*time.Minute).Unix())),
+		"unknown key":      sign(t, "RS256", "rsa-2", validClaims()),
+		"alg none":         sign(t, "none", "rsa-1", validClaims()),
+		"alg/key mismatch": sign(t, "ES256", "rsa-1", validClaims()),
+		"malformed":        "not.a.jwt",
+	}
+	for name, token := range tests {
+		_, _, err := v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	// Tampered claims invalidate the signature.
+	token := sign(t, "RS256", "rsa-1", validClaims())
+	parts := strings.Split(token, ".")
+	c, _ := json.Marshal(with("groups", []string{"flaggy-admins"}))
+	_, _, err := v.Verify(parts[0] + "." + b64(c) + "." + parts[2])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerify_LeewayAllowsSmallSkew(t *testing.T) {
+	v := newTestVerifier(t, Config{})
+	c := validClaims()
+	c["exp"] = testNow.Add(-30 * time.Second).Unix()
+	_, _, err := v.Verify(sign(t, "RS256", "rsa-1", c))
+	assert.NoError(t, err)
+}
+
+func TestVerify_RoleMapping(t *testing.T) {
+	c := validClaims()
+	c["groups"] = []string{"flaggy-editors", "flaggy-admins"}
+	_, role, err := newTestVerifier(t, Config{}).Verify(sign(t, "RS256", "rsa-1", c))
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, role, "highest role wins")
+
+	c["groups"] = []string{"everyone"}
+	_, _, err = newTestVerifier(t, Config{}).Verify(sign(t, "RS256", "rsa-1", c))
+	assert.ErrorIs(t, err, ErrNoRole)
+
+	_, role, err = newTestVerifier(t, Config{DefaultRole: models.RoleViewer}).Verify(sign(t, "RS256", "rsa-1", c))
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleViewer, role)
+
+	// Without a role map, claim values are role names.
+	c["flaggy_role"] = "key-manager"
+	v := newTestVerifier(t, Config{RoleClaim: "flaggy_role", RoleMap: map[string]models.Role{}})
+	_, role, err = v.Verify(sign(t, "RS256", "rsa-1", c))
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleKeyManager, role)
+}
+
+func TestVerify_NameFallsBackToSub(t *testing.T) {
+	c := validClaims()
+	delete(c, "email")
+	actor, _, err := newTestVerifier(t, Config{}).Verify(sign(t, "RS256", "rsa-1", c))
+	require.NoError(t, err)
+	assert.Equal(t, "00u1abcd", actor.ID)
+}
+
+func TestFileAndURLSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, testJWKS(), 0o600))
+	fileSource, err := NewFileSource(path)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testJWKS())
+	}))
+	defer srv.Close()
+	urlSource, err := NewURLSource(srv.URL, srv.Client())
+	require.NoError(t, err)
+
+	for _, src := range []KeySource{fileSource, urlSource} {
+		v, err := NewVerifier(Config{Issuer: testIssuer, Audience: testAudience, DefaultRole: models.RoleViewer}, src)
+		require.NoError(t, err)
+		v.now = func() time.Time { return testNow }
+		_, _, err = v.Verify(sign(t, "ES256", "ec-1", validClaims()))
+		assert.NoError(t, err)
+	}
+
+	_, err = NewFileSource(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	assert.True(t, LooksLikeJWT("a.b.c"))
+	assert.False(t, LooksLikeJWT("flg_live_0123abcd"))
+	assert.False(t, LooksLikeJWT("flg_pat_0123abcd"))
+}
@@ -0,0 +1,67 @@
+// Package ratelimit implements in-memory token buckets keyed by string.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a sustained rate with a burst allowance. A Limit with a
+// non-positive Rate is unlimited.
+type Limit struct {
+	Rate  float64 // Tokens added per second
+	Burst int     // Bucket size; at least 1
+}
+
+// Unlimited reports whether l imposes no limit.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter holds one token bucket per key. Buckets start full. The number of
+// buckets is bounded by the number of distinct keys, which for API keys is
+// small, so they are never evicted.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from key's bucket under limit l. If none is left, it
+// returns false and how long until one will be. A changed limit applies
+// from the next call on.
+func (lim *Limiter) Allow(key string, l Limit) (bool, time.Duration) {
+	if l.Unlimited() {
+		return true, 0
+	}
+	burst := float64(max(l.Burst, 1))
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	now := lim.now()
+	b, ok := lim.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		lim.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	return false, wait
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	lim := New()
+	lim.now = func() time.Time { return now }
+	return lim, &now
+}
+
+func TestAllow_BurstThenRefill(t *testing.T) {
+	lim, now := newTestLimiter()
+	l := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		ok, _ := lim.Allow("k", l)
+		assert.True(t, ok, "request %d", i)
+	}
+	ok, wait := lim.Allow("k", l)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	*now = now.Add(500 * time.Millisecond)
+	ok, _ = lim.Allow("k", l)
+	assert.True(t, ok)
+	ok, _ = lim.Allow("k", l)
+	assert.False(t, ok)
+}
+
+func TestAllow_RefillCappedAtBurst(t *testing.T) {
+	lim, now := newTestLimiter()
+	l := Limit{Rate: 10, Burst: 2}
+
+	lim.Allow("k", l)
+	*now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		ok, _ := lim.Allow("k", l)
+		assert.True(t, ok)
+	}
+	ok, _ := lim.Allow("k", l)
+	assert.False(t, ok)
+}
+
+func TestAllow_KeysAreIndependent(t *testing.T) {
+	lim, _ := newTestLimiter()
+	l := Limit{Rate: 1, Burst: 1}
+
+	ok, _ := lim.Allow("a", l)
+	assert.True(t, ok)
+	ok, _ = lim.Allow("a", l)
+	assert.False(t, ok)
+	ok, _ = lim.Allow("b", l)
+	assert.True(t, ok)
+}
+
+func TestAllow_Unlimited(t *testing.T) {
+	lim, _ := newTestLimiter()
+	for i := 0; i < 1000; i++ {
+		ok, _ := lim.Allow("k", Limit{})
+		assert.True(t, ok)
+	}
+}
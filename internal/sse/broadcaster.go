@@ -8,58 +8,132 @@ import (
 
 // Event represents an SSE event sent to connected clients.
 type Event struct {
-	ID   string `json:"id"`
-	Type string `json:"type"` // flag_created, flag_updated, flag_deleted, flag_toggled, rule_created, rule_updated, rule_deleted
-	Data any    `json:"data"`
+	ID          string `json:"id"`
+	Seq         int64  `json:"-"`    // Position in the event log; ID is its decimal form
+	Type        string `json:"type"` // flag_created, flag_updated, flag_deleted, flag_toggled, rule_created, rule_updated, rule_deleted
+	FlagKey     string `json:"-"`    // Flag the event concerns; empty for segment events
+	Environment string `json:"-"`    // Environment of the server that published it
+	Data        any    `json:"data"`
+}
+
+// Filter selects the events a subscription receives. Empty fields match
+// everything.
+type Filter struct {
+	Flags       map[string]bool // Flag keys. Segment events always match, since they can change any flag.
+	Types       map[string]bool // Event types
+	Environment string
+}
+
+// NewFilter builds a filter from lists of flag keys and event types.
+func NewFilter(flags, types []string, environment string) Filter {
+	f := Filter{Environment: environment}
+	if len(flags) > 0 {
+		f.Flags = make(map[string]bool, len(flags))
+		for _, k := range flags {
+			f.Flags[k] = true
+		}
+	}
+	if len(types) > 0 {
+		f.Types = make(map[string]bool, len(types))
+		for _, t := range types {
+			f.Types[t] = true
+		}
+	}
+	return f
+}
+
+// Match reports whether the filter selects the event.
+func (f Filter) Match(e Event) bool {
+	if f.Types != nil && !f.Types[e.Type] {
+		return false
+	}
+	if f.Flags != nil && e.FlagKey != "" && !f.Flags[e.FlagKey] {
+		return false
+	}
+	if f.Environment != "" && e.Environment != "" && e.Environment != f.Environment {
+		return false
+	}
+	return true
 }
 
 // Broadcaster fans out events to all connected SSE clients.
 type Broadcaster struct {
 	mu      sync.RWMutex
-	clients map[uint64]chan Event
+	clients map[uint64]*Subscription
 	nextID  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// Subscription is one client's feed of events.
+type Subscription struct {
+	// C receives events. It is closed when the subscription ends: on Close,
+	// when the broadcaster closes, or when the client fell behind (see Lost).
+	C <-chan Event
+
+	b      *Broadcaster
+	id     uint64
+	ch     chan Event
+	filter Filter
+	lost   atomic.Bool
+}
+
+// Lost reports whether the subscription was ended because the client fell
+// behind and an event could not be queued for it. The client has missed
+// events since the last one it received.
+func (s *Subscription) Lost() bool {
+	return s.lost.Load()
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.remove(s)
 }
 
 // NewBroadcaster creates a new SSE broadcaster.
 func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
-		clients: make(map[uint64]chan Event),
+		clients: make(map[uint64]*Subscription),
 	}
 }
 
-// Subscribe registers a new client and returns a channel to receive events
-// and a function to unsubscribe.
-func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+// Subscribe registers a new client that receives the events matching filter.
+func (b *Broadcaster) Subscribe(filter Filter) *Subscription {
 	ch := make(chan Event, 64)
-	id := b.nextID.Add(1)
+	sub := &Subscription{C: ch, b: b, id: b.nextID.Add(1), ch: ch, filter: filter}
 
 	b.mu.Lock()
-	b.clients[id] = ch
+	b.clients[sub.id] = sub
 	b.mu.Unlock()
+	return sub
+}
 
-	unsub := func() {
-		b.mu.Lock()
-		delete(b.clients, id)
-		b.mu.Unlock()
-		// Drain remaining events
-		for range ch {
-		}
+// remove ends a subscription. b.mu must be held for writing.
+func (b *Broadcaster) remove(sub *Subscription) {
+	if _, ok := b.clients[sub.id]; ok {
+		delete(b.clients, sub.id)
+		close(sub.ch)
 	}
-
-	return ch, unsub
 }
 
-// Publish sends an event to all connected clients.
-// Non-blocking: if a client's buffer is full, the event is dropped for that client.
+// Publish sends an event to the clients whose filter matches it. It never
+// blocks: a client whose buffer is full is unsubscribed and marked lost
+// rather than silently missing the event.
 func (b *Broadcaster) Publish(event Event) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	for _, ch := range b.clients {
+	for _, sub := range b.clients {
+		if !sub.filter.Match(event) {
+			continue
+		}
 		select {
-		case ch <- event:
+		case sub.ch <- event:
 		default:
-			// Client too slow, drop event
+			b.dropped.Add(1)
+			sub.lost.Store(true)
+			b.remove(sub)
 		}
 	}
 }
@@ -71,13 +145,17 @@ func (b *Broadcaster) ClientCount() int {
 	return len(b.clients)
 }
 
+// Dropped returns the total number of events dropped for slow clients.
+func (b *Broadcaster) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
 // Close closes all client channels.
 func (b *Broadcaster) Close() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	for id, ch := range b.clients {
-		close(ch)
-		delete(b.clients, id)
+	for _, sub := range b.clients {
+		b.remove(sub)
 	}
 }
 
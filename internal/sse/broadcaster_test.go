@@ -0,0 +1,65 @@
+package sse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish_SlowClientIsLost(t *testing.T) {
+	b := NewBroadcaster()
+	slow, fast := b.Subscribe(Filter{}), b.Subscribe(Filter{})
+	defer fast.Close()
+
+	for i := 1; i <= cap(slow.ch)+1; i++ {
+		b.Publish(Event{Seq: int64(i)})
+		<-fast.C
+	}
+
+	assert.True(t, slow.Lost())
+	assert.False(t, fast.Lost())
+	assert.Equal(t, 1, b.ClientCount())
+	assert.Equal(t, uint64(1), b.Dropped())
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	assert.Equal(t, cap(slow.ch), n, "events queued before the drop are still delivered")
+	slow.Close() // no-op after being dropped
+}
+
+func TestSubscription_CloseTwice(t *testing.T) {
+	b := NewBroadcaster()
+	sub := b.Subscribe(Filter{})
+	sub.Close()
+	sub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	assert.False(t, sub.Lost())
+	assert.Zero(t, b.ClientCount())
+}
+
+func TestPublish_Filter(t *testing.T) {
+	b := NewBroadcaster()
+	sub := b.Subscribe(NewFilter([]string{"checkout"}, []string{"flag_toggled", "segment_updated"}, "live"))
+	defer sub.Close()
+
+	b.Publish(Event{Seq: 1, Type: "flag_toggled", FlagKey: "checkout", Environment: "live"})
+	b.Publish(Event{Seq: 2, Type: "flag_toggled", FlagKey: "search", Environment: "live"})
+	b.Publish(Event{Seq: 3, Type: "flag_updated", FlagKey: "checkout", Environment: "live"})
+	b.Publish(Event{Seq: 4, Type: "flag_toggled", FlagKey: "checkout", Environment: "test"})
+	b.Publish(Event{Seq: 5, Type: "segment_updated", Environment: "live"})
+	b.Publish(Event{Seq: 6, Type: "segment_deleted", Environment: "live"})
+
+	var got []int64
+	for len(sub.C) > 0 {
+		got = append(got, (<-sub.C).Seq)
+	}
+	assert.Equal(t, []int64{1, 5}, got)
+}
+
+func TestFilter_ZeroMatchesAll(t *testing.T) {
+	assert.True(t, Filter{}.Match(Event{Type: "rule_deleted", FlagKey: "x", Environment: "test"}))
+	assert.True(t, NewFilter(nil, nil, "").Match(Event{Type: "segment_created"}))
+}
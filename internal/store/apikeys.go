@@ -1,18 +1,46 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/getflaggy/flaggy/internal/models"
 )
 
-func (s *SQLiteStore) CreateAPIKey(key *models.APIKey, hashedKey string) error {
-	_, err := s.db.Exec(
-		`INSERT INTO api_keys (id, name, environment, prefix, hashed_key, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		key.ID, key.Name, key.Environment, key.Prefix, hashedKey, key.CreatedAt,
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyInactive = errors.New("api key is revoked, expired or already rotated")
+)
+
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, actor models.Actor, key *models.APIKey, hashedKey string) error {
+	ctx, done := s.track(ctx, "create_api_key")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertAPIKey(ctx, tx, key, hashedKey); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, actor, "api_key.create", "api_key", key.ID, nil, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertAPIKey(ctx context.Context, q querier, key *models.APIKey, hashedKey string) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO api_keys (id, name, environment, scopes, prefix, hashed_key, expires_at,
+		                       rate_limit, rate_burst, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.Environment, models.JoinScopes(key.Scopes), key.Prefix, hashedKey,
+		key.ExpiresAt, key.RateLimit, key.RateBurst, key.CreatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("create api key: %w", err)
@@ -20,63 +48,253 @@ func (s *SQLiteStore) CreateAPIKey(key *models.APIKey, hashedKey string) error {
 	return nil
 }
 
-func (s *SQLiteStore) ListAPIKeys() ([]models.APIKey, error) {
-	rows, err := s.db.Query(
-		`SELECT id, name, environment, prefix, revoked, created_at, last_used_at
-		 FROM api_keys ORDER BY created_at DESC`)
+const apiKeyColumns = `id, name, environment, scopes, prefix, revoked, expires_at, replaced_by,
+	rate_limit, rate_burst, created_at, last_used_at`
+
+func scanAPIKey(scan func(dest ...any) error) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var expires, lastUsed sql.NullTime
+	var replacedBy sql.NullString
+	if err := scan(&k.ID, &k.Name, &k.Environment, &scopes, &k.Prefix, &k.Revoked,
+		&expires, &replacedBy, &k.RateLimit, &k.RateBurst, &k.CreatedAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	k.Scopes = models.SplitScopes(scopes)
+	if expires.Valid {
+		k.ExpiresAt = &expires.Time
+	}
+	k.ReplacedBy = replacedBy.String
+	if lastUsed.Valid {
+		k.LastUsedAt = &lastUsed.Time
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns API keys, newest first by default. The query matches
+// names and IDs.
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context, opts models.ListOptions) ([]models.APIKey, models.PageInfo, error) {
+	ctx, done := s.track(ctx, "list_api_keys")
+	defer done()
+
+	p, err := newListPage(opts, models.APIKeySorts)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	var search string
+	var args []any
+	if opts.Query != "" {
+		pattern := likePattern(opts.Query)
+		search, args = `(name LIKE ? ESCAPE '\' OR id LIKE ? ESCAPE '\')`, []any{pattern, pattern}
+	}
+	after, afterArgs, err := p.afterCondition("id")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	var info models.PageInfo
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_keys`+whereClause(search), args...).Scan(&info.Total); err != nil {
+		return nil, info, fmt.Errorf("count api keys: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys`+whereClause(search, after)+p.orderBy("id"),
+		append(args, afterArgs...)...)
 	if err != nil {
-		return nil, fmt.Errorf("list api keys: %w", err)
+		return nil, info, fmt.Errorf("list api keys: %w", err)
 	}
 	defer rows.Close()
 
 	var keys []models.APIKey
 	for rows.Next() {
-		var k models.APIKey
-		var lastUsed sql.NullTime
-		if err := rows.Scan(&k.ID, &k.Name, &k.Environment, &k.Prefix,
-			&k.Revoked, &k.CreatedAt, &lastUsed); err != nil {
-			return nil, fmt.Errorf("scan api key: %w", err)
+		k, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, info, fmt.Errorf("scan api key: %w", err)
 		}
-		if lastUsed.Valid {
-			k.LastUsedAt = &lastUsed.Time
-		}
-		keys = append(keys, k)
+		keys = append(keys, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, info, err
 	}
-	return keys, rows.Err()
+	keys, info.NextCursor = trim(p, keys, sortValue(apiKeyRow))
+	return keys, info, nil
 }
 
-func (s *SQLiteStore) ValidateAPIKey(hashedKey string) (*models.APIKey, error) {
-	var k models.APIKey
-	var lastUsed sql.NullTime
-	err := s.db.QueryRow(
-		`SELECT id, name, environment, prefix, revoked, created_at, last_used_at
-		 FROM api_keys WHERE hashed_key = ? AND revoked = 0`, hashedKey,
-	).Scan(&k.ID, &k.Name, &k.Environment, &k.Prefix, &k.Revoked, &k.CreatedAt, &lastUsed)
+// GetAPIKey returns the key with this ID, or nil if it doesn't exist.
+func (s *SQLiteStore) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	ctx, done := s.track(ctx, "get_api_key")
+	defer done()
+	return getAPIKey(ctx, s.db, id)
+}
+
+func getAPIKey(ctx context.Context, q querier, id string) (*models.APIKey, error) {
+	k, err := scanAPIKey(q.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return k, nil
+}
+
+// ValidateAPIKey returns the unrevoked, unexpired key with this hash, or nil.
+// It doesn't record the use; see TouchAPIKeys.
+func (s *SQLiteStore) ValidateAPIKey(ctx context.Context, hashedKey string) (*models.APIKey, error) {
+	ctx, done := s.track(ctx, "validate_api_key")
+	defer done()
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		 WHERE hashed_key = ? AND revoked = 0 AND (expires_at IS NULL OR expires_at > ?)`,
+		hashedKey, time.Now().UTC(),
+	).Scan)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("validate api key: %w", err)
 	}
-	if lastUsed.Valid {
-		k.LastUsedAt = &lastUsed.Time
+	return k, nil
+}
+
+// TouchAPIKeys sets last_used_at for a batch of keys, by key ID.
+func (s *SQLiteStore) TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error {
+	ctx, done := s.track(ctx, "touch_api_keys")
+	defer done()
+	return s.touch(ctx, "api_keys", lastUsed)
+}
+
+// touch sets last_used_at for a batch of rows of table, by ID, unless they
+// were used later.
+func (s *SQLiteStore) touch(ctx context.Context, table string, lastUsed map[string]time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE `+table+` SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare touch: %w", err)
+	}
+	defer stmt.Close()
+	for id, at := range lastUsed {
+		at = at.UTC()
+		if _, err := stmt.ExecContext(ctx, at, id, at); err != nil {
+			return fmt.Errorf("touch %s: %w", table, err)
+		}
 	}
+	return tx.Commit()
+}
 
-	// Update last_used_at
-	now := time.Now().UTC()
-	s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, k.ID)
+// RotateAPIKey stores successor as the replacement for key id, which keeps
+// working until graceUntil (or its own expiry, if sooner). It returns the
+// rotated key. Only active keys can be rotated.
+func (s *SQLiteStore) RotateAPIKey(ctx context.Context, actor models.Actor, id string, successor *models.APIKey, hashedKey string, graceUntil time.Time) (*models.APIKey, error) {
+	ctx, done := s.track(ctx, "rotate_api_key")
+	defer done()
 
-	return &k, nil
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getAPIKey(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if before.Revoked || before.ReplacedBy != "" || before.Expired(time.Now().UTC()) {
+		return nil, ErrAPIKeyInactive
+	}
+
+	if err := insertAPIKey(ctx, tx, successor, hashedKey); err != nil {
+		return nil, err
+	}
+	after := *before
+	after.ReplacedBy = successor.ID
+	graceUntil = graceUntil.UTC()
+	if after.ExpiresAt == nil || graceUntil.Before(*after.ExpiresAt) {
+		after.ExpiresAt = &graceUntil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET expires_at = ?, replaced_by = ? WHERE id = ?`,
+		after.ExpiresAt, after.ReplacedBy, id); err != nil {
+		return nil, fmt.Errorf("rotate api key: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, actor, "api_key.rotate", "api_key", id, before, &after); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "api_key.create", "api_key", successor.ID, nil, successor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &after, nil
 }
 
-func (s *SQLiteStore) RevokeAPIKey(id string) error {
-	res, err := s.db.Exec(`UPDATE api_keys SET revoked = 1 WHERE id = ?`, id)
+// SetAPIKeyRateLimit changes a key's rate limit and burst.
+func (s *SQLiteStore) SetAPIKeyRateLimit(ctx context.Context, actor models.Actor, id string, rate float64, burst int) (*models.APIKey, error) {
+	ctx, done := s.track(ctx, "set_api_key_rate_limit")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getAPIKey(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	after := *before
+	after.RateLimit, after.RateBurst = rate, burst
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET rate_limit = ?, rate_burst = ? WHERE id = ?`,
+		rate, burst, id); err != nil {
+		return nil, fmt.Errorf("set api key rate limit: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "api_key.update", "api_key", id, before, &after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &after, nil
+}
+
+func (s *SQLiteStore) RevokeAPIKey(ctx context.Context, actor models.Actor, id string) error {
+	ctx, done := s.track(ctx, "revoke_api_key")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var wasRevoked bool
+	err = tx.QueryRowContext(ctx, `SELECT revoked FROM api_keys WHERE id = ?`, id).Scan(&wasRevoked)
+	if err == sql.ErrNoRows {
+		return ErrAPIKeyNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("revoke api key: %w", err)
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("api key not found")
+
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked = 1 WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
 	}
-	return nil
+	if err := writeAudit(ctx, tx, actor, "api_key.revoke", "api_key", id,
+		map[string]bool{"revoked": wasRevoked}, map[string]bool{"revoked": true}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
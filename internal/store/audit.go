@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// writeAudit records an admin change inside the caller's transaction, so the
+// entry exists if and only if the change is committed. Pass nil for before on
+// creations and for after on deletions.
+func writeAudit(ctx context.Context, tx *sql.Tx, actor models.Actor, action, resourceType, resourceKey string, before, after any) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_log (actor_type, actor_id, action, resource_type, resource_key, before_json, after_json, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		actor.Type, actor.ID, action, resourceType, resourceKey, beforeJSON, afterJSON, time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("write audit: %w", err)
+	}
+	return nil
+}
+
+func auditJSON(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("marshal audit state: %w", err)
+	}
+	if string(b) == "null" {
+		return sql.NullString{}, nil
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// ListAuditEntries returns audit entries matching the filter, newest first.
+func (s *SQLiteStore) ListAuditEntries(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, done := s.track(ctx, "list_audit_entries")
+	defer done()
+
+	query := `SELECT id, actor_type, actor_id, action, resource_type, resource_key,
+	                 before_json, after_json, created_at
+	          FROM audit_log WHERE 1=1`
+	var args []interface{}
+	add := func(clause string, v interface{}) {
+		query += " AND " + clause
+		args = append(args, v)
+	}
+	if f.ActorType != "" {
+		add("actor_type = ?", f.ActorType)
+	}
+	if f.ActorID != "" {
+		add("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceKey != "" {
+		add("resource_key = ?", f.ResourceKey)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= ?", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		add("created_at < ?", f.Until.UTC())
+	}
+	if f.Cursor > 0 {
+		add("id < ?", f.Cursor)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.Actor.Type, &e.Actor.ID, &e.Action, &e.ResourceType,
+			&e.ResourceKey, &before, &after, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
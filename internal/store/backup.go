@@ -0,0 +1,224 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrDatabaseInUse is returned by Restore and migration commands when
+// another connection, usually a running server, has the database open.
+var ErrDatabaseInUse = errors.New("database is in use; stop flaggy serve first")
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist yet. The copy is one read transaction, so reads and writes carry on
+// meanwhile. It isn't bounded by the query timeout: copying a large
+// database takes longer than any query.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup: %s already exists", path)
+	}
+	// Written under a temporary name, so path never holds a partial copy
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	start := time.Now()
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	if s.observer != nil {
+		s.observer("backup", time.Since(start))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// BackupInfo describes a database file checked by CheckBackup.
+type BackupInfo struct {
+	Migrations int      // Migrations applied to the file
+	Pending    []string // Migrations the server will apply when it opens the file
+	Flags      int
+	Segments   int
+}
+
+// CheckBackup checks that path is an intact Flaggy database whose
+// migrations are all in migrationsFS, so that a server of this version can
+// open it.
+func CheckBackup(path string, migrationsFS fs.FS) (*BackupInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 16)
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || !bytes.Equal(header, []byte("SQLite format 3\x00")) {
+		return nil, fmt.Errorf("%s is not a SQLite database", path)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=query_only(1)")
+	if err != nil {
+		return nil, fmt.Errorf("open backup: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check(1)").Scan(&result); err != nil {
+		return nil, fmt.Errorf("check integrity: %w", err)
+	}
+	if result != "ok" {
+		return nil, fmt.Errorf("backup is corrupt: %s", result)
+	}
+
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables); err != nil {
+		return nil, fmt.Errorf("inspect backup: %w", err)
+	}
+	if tables == 0 {
+		return nil, fmt.Errorf("not a Flaggy database: it has no schema_migrations table")
+	}
+	applied, checksums, err := readApplied(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+	files, err := readMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BackupInfo{Migrations: len(applied)}
+	for _, f := range files {
+		if _, ok := applied[f.name]; !ok {
+			info.Pending = append(info.Pending, f.name)
+			continue
+		}
+		if sum := checksums[f.name]; sum != "" && sum != f.checksum {
+			return nil, fmt.Errorf("backup's migration %s differs from this version's (checksum mismatch)", f.name)
+		}
+		delete(applied, f.name)
+	}
+	for name := range applied {
+		return nil, fmt.Errorf("backup has migration %s, which this version of Flaggy doesn't know; restore it with the version that made it", name)
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM flags").Scan(&info.Flags); err != nil {
+		return nil, fmt.Errorf("count flags: %w", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM segments").Scan(&info.Segments); err != nil {
+		return nil, fmt.Errorf("count segments: %w", err)
+	}
+	return info, nil
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath
+// after checking it with CheckBackup. The backup is copied next to dbPath
+// and renamed over it, so dbPath always holds one database or the other.
+// The replaced database is kept at dbPath + ".before-restore".
+//
+// The server must be stopped: Restore returns ErrDatabaseInUse if another
+// connection has the database open.
+func Restore(dbPath, backupPath string, migrationsFS fs.FS) (*BackupInfo, error) {
+	tmp := dbPath + ".restore"
+	if err := copyFile(backupPath, tmp); err != nil {
+		return nil, fmt.Errorf("copy backup: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	info, err := CheckBackup(tmp, migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := keepDatabase(dbPath, dbPath+".before-restore"); err != nil {
+			return nil, err
+		}
+	}
+	// The WAL of the replaced database was checkpointed into it; a stale
+	// one would be replayed into the restored file.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return nil, fmt.Errorf("replace database: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(dbPath)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return info, nil
+}
+
+// keepDatabase locks the database at path, checkpoints its WAL into it and
+// copies it to dst.
+func keepDatabase(path, dst string) error {
+	db, err := openExclusive(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := copyFile(path, dst); err != nil {
+		return fmt.Errorf("keep replaced database: %w", err)
+	}
+	return nil
+}
+
+// openExclusive opens the database at path on one connection holding an
+// exclusive lock until it is closed. It returns ErrDatabaseInUse if any
+// other connection has the database open.
+func openExclusive(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=locking_mode(EXCLUSIVE)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	db.SetMaxOpenConns(1) // The lock belongs to one connection
+
+	// The lock is taken on first access
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&n); err != nil {
+		db.Close()
+		if IsBusy(err) {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, fmt.Errorf("lock database: %w", err)
+	}
+	return db, nil
+}
+
+// copyFile copies src to dst, replacing it, and syncs dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var (
+	ErrChangeRequestNotFound   = errors.New("change request not found")
+	ErrChangeRequestNotPending = errors.New("change request is not pending")
+	ErrSelfReview              = errors.New("the proposer cannot review their own change request")
+	ErrAlreadyReviewed         = errors.New("you have already reviewed this change request")
+)
+
+// GetEnvironmentPolicy returns the stored policy for env, or the default
+// policy if none has been set.
+func (s *SQLiteStore) GetEnvironmentPolicy(ctx context.Context, env models.Environment) (*models.EnvironmentPolicy, error) {
+	ctx, done := s.track(ctx, "get_environment_policy")
+	defer done()
+	return getEnvironmentPolicy(ctx, s.db, env)
+}
+
+func getEnvironmentPolicy(ctx context.Context, q querier, env models.Environment) (*models.EnvironmentPolicy, error) {
+	p := &models.EnvironmentPolicy{Environment: env}
+	err := q.QueryRowContext(ctx,
+		`SELECT required_approvals, allow_direct_writes, updated_at
+		 FROM environment_policies WHERE environment = ?`, env,
+	).Scan(&p.RequiredApprovals, &p.AllowDirectWrites, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return models.DefaultEnvironmentPolicy(env), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get environment policy: %w", err)
+	}
+	return p, nil
+}
+
+// SetEnvironmentPolicy creates or replaces the policy for p.Environment.
+func (s *SQLiteStore) SetEnvironmentPolicy(ctx context.Context, actor models.Actor, p *models.EnvironmentPolicy) error {
+	ctx, done := s.track(ctx, "set_environment_policy")
+	defer done()
+	p.UpdatedAt = time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getEnvironmentPolicy(ctx, tx, p.Environment)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO environment_policies (environment, required_approvals, allow_direct_writes, updated_at)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(environment) DO UPDATE SET
+		     required_approvals = excluded.required_approvals,
+		     allow_direct_writes = excluded.allow_direct_writes,
+		     updated_at = excluded.updated_at`,
+		p.Environment, p.RequiredApprovals, p.AllowDirectWrites, p.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("set environment policy: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "policy.update", "environment", string(p.Environment), before, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateChangeRequest stores a pending change request. The proposer,
+// status and timestamps are set by the store.
+func (s *SQLiteStore) CreateChangeRequest(ctx context.Context, actor models.Actor, cr *models.ChangeRequest) error {
+	ctx, done := s.track(ctx, "create_change_request")
+	defer done()
+	now := time.Now().UTC()
+	cr.Proposer = actor
+	cr.Status = models.ChangePending
+	cr.Reviews = []models.ChangeReview{}
+	cr.CreatedAt = now
+	cr.UpdatedAt = now
+
+	diff, err := json.Marshal(cr.Diff)
+	if err != nil {
+		return fmt.Errorf("marshal diff: %w", err)
+	}
+	var payload sql.NullString
+	if len(cr.Payload) > 0 {
+		payload = sql.NullString{String: string(cr.Payload), Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO change_requests (environment, resource_type, action, resource_key, rule_id, payload,
+		                              base_version, diff, comment, status, required_approvals,
+		                              proposer_type, proposer_id, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cr.Environment, cr.ResourceType, cr.Action, cr.ResourceKey, cr.RuleID, payload,
+		cr.BaseVersion, string(diff), cr.Comment, cr.Status, cr.RequiredApprovals,
+		actor.Type, actor.ID, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("insert change request: %w", err)
+	}
+	cr.ID, _ = res.LastInsertId()
+
+	if err := writeAudit(ctx, tx, actor, "change_request.create", "change_request", fmt.Sprint(cr.ID), nil, cr); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChangeRequest returns a change request with its reviews, or nil if it doesn't exist.
+func (s *SQLiteStore) GetChangeRequest(ctx context.Context, id int64) (*models.ChangeRequest, error) {
+	ctx, done := s.track(ctx, "get_change_request")
+	defer done()
+	return getChangeRequest(ctx, s.db, id)
+}
+
+const changeRequestColumns = `id, environment, resource_type, action, resource_key, rule_id, payload,
+	base_version, diff, comment, status, required_approvals, proposer_type, proposer_id,
+	apply_error, created_at, updated_at`
+
+func scanChangeRequest(scan func(dest ...any) error) (*models.ChangeRequest, error) {
+	var cr models.ChangeRequest
+	var payload sql.NullString
+	var diff string
+	if err := scan(&cr.ID, &cr.Environment, &cr.ResourceType, &cr.Action, &cr.ResourceKey, &cr.RuleID,
+		&payload, &cr.BaseVersion, &diff, &cr.Comment, &cr.Status, &cr.RequiredApprovals,
+		&cr.Proposer.Type, &cr.Proposer.ID, &cr.ApplyError, &cr.CreatedAt, &cr.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if payload.Valid {
+		cr.Payload = json.RawMessage(payload.String)
+	}
+	if err := json.Unmarshal([]byte(diff), &cr.Diff); err != nil {
+		return nil, fmt.Errorf("decode diff: %w", err)
+	}
+	return &cr, nil
+}
+
+func getChangeRequest(ctx context.Context, q querier, id int64) (*models.ChangeRequest, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+changeRequestColumns+` FROM change_requests WHERE id = ?`, id)
+	cr, err := scanChangeRequest(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get change request: %w", err)
+	}
+	if cr.Reviews, err = getChangeReviews(ctx, q, id); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func getChangeReviews(ctx context.Context, q querier, id int64) ([]models.ChangeReview, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT actor_type, actor_id, decision, comment, created_at
+		 FROM change_request_reviews WHERE change_request_id = ? ORDER BY created_at`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []models.ChangeReview{}
+	for rows.Next() {
+		var r models.ChangeReview
+		if err := rows.Scan(&r.Actor.Type, &r.Actor.ID, &r.Decision, &r.Comment, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan review: %w", err)
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// ListChangeRequests returns change requests, newest first, optionally
+// filtered by status. Reviews are included.
+func (s *SQLiteStore) ListChangeRequests(ctx context.Context, status models.ChangeStatus) ([]models.ChangeRequest, error) {
+	ctx, done := s.track(ctx, "list_change_requests")
+	defer done()
+
+	query := `SELECT ` + changeRequestColumns + ` FROM change_requests`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list change requests: %w", err)
+	}
+	var crs []models.ChangeRequest
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan change request: %w", err)
+		}
+		crs = append(crs, *cr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range crs {
+		if crs[i].Reviews, err = getChangeReviews(ctx, s.db, crs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return crs, nil
+}
+
+// ReviewChangeRequest records actor's decision on a pending change request.
+// A rejection closes it; an approval that reaches the required count moves
+// it to approved, after which the caller applies it and calls
+// CompleteChangeRequest. Only one review can move a request out of pending.
+func (s *SQLiteStore) ReviewChangeRequest(ctx context.Context, actor models.Actor, id int64, decision, comment string) (*models.ChangeRequest, error) {
+	ctx, done := s.track(ctx, "review_change_request")
+	defer done()
+	now := time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	cr, err := getChangeRequest(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cr == nil {
+		return nil, ErrChangeRequestNotFound
+	}
+	if cr.Status != models.ChangePending {
+		return nil, ErrChangeRequestNotPending
+	}
+	// Identities are compared by ID alone: the same person may propose
+	// under the master key with ActorHeader and review with their own token.
+	if cr.Proposer.ID == actor.ID {
+		return nil, ErrSelfReview
+	}
+	for _, r := range cr.Reviews {
+		if r.Actor.ID == actor.ID {
+			return nil, ErrAlreadyReviewed
+		}
+	}
+	before := *cr
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO change_request_reviews (change_request_id, actor_type, actor_id, decision, comment, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		id, actor.Type, actor.ID, decision, comment, now,
+	); err != nil {
+		return nil, fmt.Errorf("insert review: %w", err)
+	}
+	cr.Reviews = append(cr.Reviews, models.ChangeReview{Actor: actor, Decision: decision, Comment: comment, CreatedAt: now})
+
+	switch {
+	case decision == models.DecisionReject:
+		cr.Status = models.ChangeRejected
+	case cr.Approvals() >= cr.RequiredApprovals:
+		cr.Status = models.ChangeApproved
+	}
+	cr.UpdatedAt = now
+	res, err := tx.ExecContext(ctx,
+		`UPDATE change_requests SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		cr.Status, now, id, models.ChangePending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update change request: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrChangeRequestNotPending
+	}
+
+	if err := writeAudit(ctx, tx, actor, "change_request."+decision, "change_request", fmt.Sprint(id), &before, cr); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return cr, nil
+}
+
+// CompleteChangeRequest marks an approved change request as applied, or as
+// failed with applyErr if applying it didn't succeed.
+func (s *SQLiteStore) CompleteChangeRequest(ctx context.Context, id int64, applyErr string) (*models.ChangeRequest, error) {
+	ctx, done := s.track(ctx, "complete_change_request")
+	defer done()
+
+	status := models.ChangeApplied
+	if applyErr != "" {
+		status = models.ChangeFailed
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE change_requests SET status = ?, apply_error = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		status, applyErr, time.Now().UTC(), id, models.ChangeApproved,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("complete change request: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("change request %d is not approved", id)
+	}
+	return getChangeRequest(ctx, s.db, id)
+}
@@ -0,0 +1,366 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// ErrFlagTypeChange is returned when a config changes an existing flag's type.
+var ErrFlagTypeChange = errors.New("a flag's type can't be changed; delete the flag first")
+
+// ExportConfig returns every flag and segment as a config.
+func (s *SQLiteStore) ExportConfig(ctx context.Context) (*models.Config, error) {
+	ctx, done := s.track(ctx, "export_config")
+	defer done()
+
+	// Read in one transaction, so the export is a consistent snapshot
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	segments, flags, err := loadAll(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &models.Config{}
+	for _, seg := range segments {
+		cfg.Segments = append(cfg.Segments, models.SegmentToConfig(seg))
+	}
+	for _, flag := range flags {
+		cfg.Flags = append(cfg.Flags, models.FlagToConfig(flag))
+	}
+	models.NormalizeConfig(cfg)
+	return cfg, nil
+}
+
+// ApplyConfig makes the flags and segments match cfg, which must be valid,
+// and returns the changes made. Everything is applied in one transaction:
+// if any change fails, none is kept. With dryRun, the changes are only
+// planned.
+//
+// Rules are matched to the flag's current rules by position and keep their
+// IDs. Each change is audited and versioned like the equivalent single write.
+func (s *SQLiteStore) ApplyConfig(ctx context.Context, actor models.Actor, cfg *models.Config, dryRun bool) (*models.ConfigPlan, error) {
+	ctx, done := s.track(ctx, "apply_config")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	segments, flags, err := loadAll(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	models.NormalizeConfig(cfg)
+	for _, fc := range cfg.Flags {
+		if cur, ok := flags[fc.Key]; ok && cur.Type != fc.Type {
+			return nil, fmt.Errorf("flag %q: %w (%s → %s)", fc.Key, ErrFlagTypeChange, cur.Type, fc.Type)
+		}
+	}
+	plan := planConfig(cfg, segments, flags)
+	if dryRun || len(plan.Changes) == 0 {
+		return plan, nil
+	}
+
+	wantSegments := make(map[string]*models.SegmentConfig, len(cfg.Segments))
+	for i := range cfg.Segments {
+		wantSegments[cfg.Segments[i].Key] = &cfg.Segments[i]
+	}
+	wantFlags := make(map[string]*models.FlagConfig, len(cfg.Flags))
+	for i := range cfg.Flags {
+		wantFlags[cfg.Flags[i].Key] = &cfg.Flags[i]
+	}
+
+	now := time.Now().UTC()
+	for i := range plan.Changes {
+		c := &plan.Changes[i]
+		switch {
+		case c.ResourceType == "segment" && c.Action == models.ConfigDelete:
+			err = applySegmentDelete(ctx, tx, actor, c, segments[c.Key])
+		case c.ResourceType == "segment":
+			err = applySegment(ctx, tx, actor, c, segments[c.Key], wantSegments[c.Key], now)
+		case c.Action == models.ConfigDelete:
+			err = applyFlagDelete(ctx, tx, actor, c, flags[c.Key])
+		default:
+			err = applyFlag(ctx, tx, actor, c, flags[c.Key], wantFlags[c.Key], now)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s %q: %w", c.Action, c.ResourceType, c.Key, err)
+		}
+	}
+	plan.Applied = true
+	if err := out.add(ctx, tx, models.ConfigPlanEvents(plan)...); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// loadAll reads every segment and flag, with conditions and rules, by key.
+func loadAll(ctx context.Context, q querier) (map[string]*models.Segment, map[string]*models.Flag, error) {
+	segKeys, err := listKeys(ctx, q, `SELECT key FROM segments ORDER BY key`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list segments: %w", err)
+	}
+	segments := make(map[string]*models.Segment, len(segKeys))
+	for _, key := range segKeys {
+		if segments[key], err = getSegment(ctx, q, key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	flagKeys, err := listKeys(ctx, q, `SELECT key FROM flags ORDER BY key`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list flags: %w", err)
+	}
+	flags := make(map[string]*models.Flag, len(flagKeys))
+	for _, key := range flagKeys {
+		if flags[key], err = getFlag(ctx, q, key); err != nil {
+			return nil, nil, err
+		}
+	}
+	return segments, flags, nil
+}
+
+func listKeys(ctx context.Context, q querier, query string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// planConfig compares a normalized config with the current state. Segments
+// are created and updated first so rules can reference them, then flags are
+// written, and segments are deleted last, once no rule references them.
+func planConfig(cfg *models.Config, segments map[string]*models.Segment, flags map[string]*models.Flag) *models.ConfigPlan {
+	plan := &models.ConfigPlan{Changes: []models.ConfigChange{}}
+	add := func(action, resourceType, key string, changes []models.Change) {
+		plan.Changes = append(plan.Changes, models.ConfigChange{
+			Action: action, ResourceType: resourceType, Key: key, Changes: changes,
+		})
+	}
+
+	want := make(map[string]bool)
+	for i := range cfg.Segments {
+		sc := &cfg.Segments[i]
+		want["segment/"+sc.Key] = true
+		cur, ok := segments[sc.Key]
+		if !ok {
+			add(models.ConfigCreate, "segment", sc.Key, nil)
+			continue
+		}
+		before := models.SegmentToConfig(cur)
+		if changes := models.DiffSegmentConfigs(&before, sc); len(changes) > 0 {
+			add(models.ConfigUpdate, "segment", sc.Key, changes)
+		}
+	}
+	for i := range cfg.Flags {
+		fc := &cfg.Flags[i]
+		want["flag/"+fc.Key] = true
+		cur, ok := flags[fc.Key]
+		if !ok {
+			add(models.ConfigCreate, "flag", fc.Key, nil)
+			continue
+		}
+		before := models.FlagToConfig(cur)
+		if changes := models.DiffFlagConfigs(&before, fc); len(changes) > 0 {
+			add(models.ConfigUpdate, "flag", fc.Key, changes)
+		}
+	}
+
+	for _, key := range sortedKeys(flags) {
+		if !want["flag/"+key] {
+			add(models.ConfigDelete, "flag", key, nil)
+		}
+	}
+	for _, key := range sortedKeys(segments) {
+		if !want["segment/"+key] {
+			add(models.ConfigDelete, "segment", key, nil)
+		}
+	}
+	return plan
+}
+
+func applySegment(ctx context.Context, tx *sql.Tx, actor models.Actor, c *models.ConfigChange, before *models.Segment, sc *models.SegmentConfig, now time.Time) error {
+	action := "segment.update"
+	var err error
+	if c.Action == models.ConfigCreate {
+		action = "segment.create"
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO segments (key, description, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+			sc.Key, sc.Description, now, now,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE segments SET description = ?, updated_at = ?, version = version + 1 WHERE key = ?`,
+			sc.Description, now, sc.Key,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("write segment: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM segment_conditions WHERE segment_key = ?`, sc.Key); err != nil {
+		return fmt.Errorf("delete segment conditions: %w", err)
+	}
+	for _, cc := range sc.Conditions {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO segment_conditions (segment_key, attribute, operator, value, created_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			sc.Key, cc.Attribute, cc.Operator, string(cc.Value), now,
+		); err != nil {
+			return fmt.Errorf("insert segment condition: %w", err)
+		}
+	}
+
+	after, err := getSegment(ctx, tx, sc.Key)
+	if err != nil {
+		return err
+	}
+	c.Segment = after
+	return writeAudit(ctx, tx, actor, action, "segment", sc.Key, before, after)
+}
+
+func applySegmentDelete(ctx context.Context, tx *sql.Tx, actor models.Actor, c *models.ConfigChange, before *models.Segment) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM segments WHERE key = ?`, c.Key); err != nil {
+		return fmt.Errorf("delete segment: %w", err)
+	}
+	return writeAudit(ctx, tx, actor, "segment.delete", "segment", c.Key, before, nil)
+}
+
+func applyFlag(ctx context.Context, tx *sql.Tx, actor models.Actor, c *models.ConfigChange, previous *models.Flag, fc *models.FlagConfig, now time.Time) error {
+	action := "flag.update"
+	if c.Action == models.ConfigCreate {
+		action = "flag.create"
+	}
+	flag, err := writeFlagConfig(ctx, tx, c.Action, c.Changes, fc, previous, now)
+	if err != nil {
+		return err
+	}
+	if err := recordVersion(ctx, tx, actor, action, flag); err != nil {
+		return err
+	}
+	c.Flag, c.Previous = flag, previous
+	return writeAudit(ctx, tx, actor, action, "flag", fc.Key, previous, flag)
+}
+
+// writeFlagConfig creates or updates a flag to match fc, given the changes
+// from previous, and returns it. It doesn't record a version or audit it.
+func writeFlagConfig(ctx context.Context, tx *sql.Tx, action string, changes []models.Change, fc *models.FlagConfig, previous *models.Flag, now time.Time) (*models.Flag, error) {
+	var err error
+	if action == models.ConfigCreate {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO flags (key, type, description, enabled, default_value, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			fc.Key, fc.Type, fc.Description, fc.Enabled, string(fc.DefaultValue), now, now,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE flags SET description = ?, enabled = ?, default_value = ?, updated_at = ? WHERE key = ?`,
+			fc.Description, fc.Enabled, string(fc.DefaultValue), now, fc.Key,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write flag: %w", err)
+	}
+
+	if action == models.ConfigCreate || rulesChanged(changes) {
+		if err := replaceRules(ctx, tx, fc, previous, now); err != nil {
+			return nil, err
+		}
+	}
+	return getFlag(ctx, tx, fc.Key)
+}
+
+// replaceRules replaces a flag's rules with the config's. The rule at each
+// position keeps the ID of the current rule there, and its version is bumped
+// if it changed.
+func replaceRules(ctx context.Context, tx *sql.Tx, fc *models.FlagConfig, previous *models.Flag, now time.Time) error {
+	var current []models.Rule
+	if previous != nil {
+		current = previous.Rules
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rules WHERE flag_key = ?`, fc.Key); err != nil {
+		return fmt.Errorf("delete rules: %w", err)
+	}
+	for i, rc := range fc.Rules {
+		rule := models.Rule{
+			Description:       rc.Description,
+			Value:             rc.Value,
+			Priority:          rc.Priority,
+			RolloutPercentage: rc.RolloutPercentage,
+			Conditions:        models.Conditions(rc.Conditions),
+			SegmentKeys:       rc.SegmentKeys,
+			Version:           1,
+			CreatedAt:         now,
+		}
+		if i < len(current) {
+			old := &current[i]
+			rule.ID, rule.Version, rule.CreatedAt = old.ID, old.Version, old.CreatedAt
+			if len(models.DiffRules("", old, &rule)) > 0 {
+				rule.Version++
+			}
+		}
+		if err := insertRuleWithID(ctx, tx, fc.Key, &rule, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyFlagDelete(ctx context.Context, tx *sql.Tx, actor models.Actor, c *models.ConfigChange, before *models.Flag) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM flags WHERE key = ?`, c.Key); err != nil {
+		return fmt.Errorf("delete flag: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.delete", "flag", c.Key, before, nil); err != nil {
+		return err
+	}
+	c.Previous = before
+	return recordVersion(ctx, tx, actor, "flag.delete", before)
+}
+
+// rulesChanged reports whether a flag update touches its rules.
+func rulesChanged(changes []models.Change) bool {
+	for _, ch := range changes {
+		if strings.HasPrefix(ch.Path, "rules[") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// OnChange sets fn to be called with the events of each committed write,
+// numbered, in commit order. fn must not block or call back into the store.
+// Must be called before the store is shared between goroutines.
+func (s *SQLiteStore) OnChange(fn func([]models.ChangeEvent)) {
+	s.onChange = fn
+}
+
+// An outbox collects the change events of a write transaction. They are
+// added to the event log, with a delivery for every webhook subscribed to
+// them, in the transaction: a committed change always has its events and
+// deliveries, and a rolled-back one never does. The events are handed to
+// the OnChange listener once it commits.
+type outbox struct {
+	s      *SQLiteStore
+	events []models.ChangeEvent
+	locked bool
+}
+
+// outbox starts collecting the events of a transaction. Defer release.
+func (s *SQLiteStore) outbox() *outbox {
+	return &outbox{s: s}
+}
+
+// add records events in tx. Call it after the transaction's first write:
+// tx then holds the database's write lock, and the lock taken here keeps
+// events numbered and handed to the listener in commit order.
+func (o *outbox) add(ctx context.Context, tx *sql.Tx, events ...models.ChangeEvent) error {
+	if !o.locked {
+		o.s.eventMu.Lock()
+		o.locked = true
+	}
+	for _, e := range events {
+		e.Environment = o.s.environment
+		e.CreatedAt = time.Now().UTC()
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO events (type, flag_key, environment, data, created_at) VALUES (?, ?, ?, ?, ?)`,
+			e.Type, e.FlagKey, e.Environment, string(e.Data), e.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("append event: %w", err)
+		}
+		if e.Seq, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("append event: %w", err)
+		}
+		if err := enqueueWebhookDeliveries(ctx, tx, &e); err != nil {
+			return err
+		}
+		o.events = append(o.events, e)
+	}
+	return nil
+}
+
+// commit commits tx and hands its events to the listener.
+func (o *outbox) commit(tx *sql.Tx) error {
+	defer o.release()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	if o.s.onChange != nil && len(o.events) > 0 {
+		o.s.onChange(o.events)
+	}
+	return nil
+}
+
+// release gives up the event lock if commit wasn't reached.
+func (o *outbox) release() {
+	if o.locked {
+		o.locked = false
+		o.s.eventMu.Unlock()
+	}
+}
+
+// EventsSince returns up to limit events with a sequence number above seq,
+// in order.
+func (s *SQLiteStore) EventsSince(ctx context.Context, seq int64, limit int) ([]models.ChangeEvent, error) {
+	ctx, done := s.track(ctx, "events_since")
+	defer done()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT seq, type, flag_key, environment, data, created_at FROM events
+		 WHERE seq > ? ORDER BY seq LIMIT ?`, seq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.ChangeEvent
+	for rows.Next() {
+		var e models.ChangeEvent
+		var data string
+		if err := rows.Scan(&e.Seq, &e.Type, &e.FlagKey, &e.Environment, &data, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		e.Data = []byte(data)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// EventBounds returns the oldest retained sequence number and the latest one
+// ever issued. When every event has been pruned, oldest is latest+1.
+func (s *SQLiteStore) EventBounds(ctx context.Context) (oldest, latest int64, err error) {
+	ctx, done := s.track(ctx, "event_bounds")
+	defer done()
+	var min sql.NullInt64
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'events'), 0),
+		        (SELECT MIN(seq) FROM events)`,
+	).Scan(&latest, &min); err != nil {
+		return 0, 0, fmt.Errorf("event bounds: %w", err)
+	}
+	oldest = latest + 1
+	if min.Valid {
+		oldest = min.Int64
+	}
+	return oldest, latest, nil
+}
+
+// PruneEvents deletes events created before the cutoff and returns how many
+// were removed.
+func (s *SQLiteStore) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, done := s.track(ctx, "prune_events")
+	defer done()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune events: %w", err)
+	}
+	return res.RowsAffected()
+}
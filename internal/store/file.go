@@ -0,0 +1,420 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// ErrReadOnly is returned by writes to a read-only store.
+var ErrReadOnly = errors.New("store is read-only")
+
+// FileStore implements Store over a YAML or JSON config file, in the format
+// written by `flaggy export`, for servers without a database. It rejects
+// every write and holds no API keys, so clients authenticate with the master
+// key, or with nothing if the server has none. Watch reloads the file when
+// it changes.
+type FileStore struct {
+	path string
+
+	mu       sync.RWMutex
+	segments map[string]*models.Segment
+	flags    map[string]*models.Flag
+	modTime  time.Time
+	size     int64
+	sum      [sha256.Size]byte // Of the file as last loaded
+	onChange func([]models.ChangeEvent)
+}
+
+// NewFileStore loads the config file at path.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:     path,
+		segments: map[string]*models.Segment{},
+		flags:    map[string]*models.Flag{},
+	}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseConfig reads a config in YAML or JSON (which is valid YAML) and
+// validates it.
+func ParseConfig(data []byte) (*models.Config, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &models.Config{}
+	if v != nil {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := models.ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+	models.NormalizeConfig(cfg)
+	return cfg, nil
+}
+
+// OnChange sets fn to be called with the events of each reload that
+// changed any flag or segment. The events aren't numbered.
+func (s *FileStore) OnChange(fn func([]models.ChangeEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// Reload reads the file and returns the changes since it was last loaded.
+// If the file is invalid, the flags stay as they were.
+func (s *FileStore) Reload() (*models.ConfigPlan, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	s.mu.Lock()
+	s.modTime, s.size = info.ModTime(), info.Size()
+	unchanged := sum == s.sum
+	s.mu.Unlock()
+	if unchanged {
+		return &models.ConfigPlan{Changes: []models.ConfigChange{}}, nil
+	}
+
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.mu.Lock()
+	s.sum = sum
+	plan := s.replace(cfg, time.Now().UTC())
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	if onChange != nil && len(plan.Changes) > 0 {
+		onChange(models.ConfigPlanEvents(plan))
+	}
+	return plan, nil
+}
+
+// replace swaps in the config's flags and segments. Unchanged ones are kept
+// as they were; changed ones get the next version. s.mu must be held.
+func (s *FileStore) replace(cfg *models.Config, now time.Time) *models.ConfigPlan {
+	plan := planConfig(cfg, s.segments, s.flags)
+	plan.Applied = true
+
+	wantSegments := make(map[string]*models.SegmentConfig, len(cfg.Segments))
+	for i := range cfg.Segments {
+		wantSegments[cfg.Segments[i].Key] = &cfg.Segments[i]
+	}
+	wantFlags := make(map[string]*models.FlagConfig, len(cfg.Flags))
+	for i := range cfg.Flags {
+		wantFlags[cfg.Flags[i].Key] = &cfg.Flags[i]
+	}
+
+	for i := range plan.Changes {
+		c := &plan.Changes[i]
+		if c.ResourceType == "segment" {
+			if c.Action == models.ConfigDelete {
+				delete(s.segments, c.Key)
+				continue
+			}
+			seg := fileSegment(wantSegments[c.Key], s.segments[c.Key], now)
+			s.segments[c.Key], c.Segment = seg, seg
+			continue
+		}
+		c.Previous = s.flags[c.Key]
+		if c.Action == models.ConfigDelete {
+			delete(s.flags, c.Key)
+			continue
+		}
+		flag := fileFlag(wantFlags[c.Key], c.Previous, now)
+		s.flags[c.Key], c.Flag = flag, flag
+	}
+	return plan
+}
+
+// fileSegment builds a segment from its config, succeeding previous if set.
+func fileSegment(sc *models.SegmentConfig, previous *models.Segment, now time.Time) *models.Segment {
+	seg := &models.Segment{
+		Key:         sc.Key,
+		Description: sc.Description,
+		Conditions:  models.Conditions(sc.Conditions),
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for i := range seg.Conditions {
+		seg.Conditions[i].ID = int64(i + 1)
+		seg.Conditions[i].CreatedAt = now
+	}
+	if previous != nil {
+		seg.Version, seg.CreatedAt = previous.Version+1, previous.CreatedAt
+	}
+	return seg
+}
+
+// fileFlag builds a flag from its config, succeeding previous if set. Rules
+// are numbered from 1 in evaluation order; a rule keeps its version while it
+// is unchanged.
+func fileFlag(fc *models.FlagConfig, previous *models.Flag, now time.Time) *models.Flag {
+	flag := &models.Flag{
+		Key:          fc.Key,
+		Type:         fc.Type,
+		Description:  fc.Description,
+		Enabled:      fc.Enabled,
+		DefaultValue: fc.DefaultValue,
+		Rules:        make([]models.Rule, len(fc.Rules)),
+		Version:      1,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if previous != nil {
+		flag.Version, flag.CreatedAt = previous.Version+1, previous.CreatedAt
+	}
+	for i, rc := range fc.Rules {
+		rule := models.Rule{
+			ID:                int64(i + 1),
+			FlagKey:           fc.Key,
+			Description:       rc.Description,
+			Value:             rc.Value,
+			Priority:          rc.Priority,
+			RolloutPercentage: rc.RolloutPercentage,
+			Conditions:        models.Conditions(rc.Conditions),
+			SegmentKeys:       rc.SegmentKeys,
+			Version:           1,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		for j := range rule.Conditions {
+			rule.Conditions[j].ID = int64(j + 1)
+			rule.Conditions[j].RuleID = rule.ID
+			rule.Conditions[j].CreatedAt = now
+		}
+		if previous != nil && i < len(previous.Rules) {
+			old := &previous.Rules[i]
+			rule.Version, rule.CreatedAt, rule.UpdatedAt = old.Version, old.CreatedAt, old.UpdatedAt
+			if len(models.DiffRules("", old, &rule)) > 0 {
+				rule.Version++
+				rule.UpdatedAt = now
+			}
+		}
+		flag.Rules[i] = rule
+	}
+	return flag
+}
+
+// Watch reloads the file whenever its size or modification time changes,
+// checking every interval, until ctx is done. Reload errors are logged and
+// the previous flags kept.
+func (s *FileStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			slog.Error("failed to check flags file", "path", s.path, "error", err)
+			continue
+		}
+		s.mu.RLock()
+		unchanged := info.ModTime().Equal(s.modTime) && info.Size() == s.size
+		s.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+
+		plan, err := s.Reload()
+		if err != nil {
+			slog.Error("failed to reload flags file; keeping the previous flags", "error", err)
+			continue
+		}
+		if len(plan.Changes) > 0 {
+			slog.Info("reloaded flags file", "path", s.path, "changes", len(plan.Changes))
+		}
+	}
+}
+
+// ReadOnly reports that the store rejects writes.
+func (s *FileStore) ReadOnly() bool { return true }
+
+// --- Flags ---
+
+func (s *FileStore) CreateFlag(ctx context.Context, actor models.Actor, flag *models.Flag) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) GetFlag(ctx context.Context, key string) (*models.Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	flag := *f
+	flag.Rules = append([]models.Rule(nil), f.Rules...)
+	return &flag, nil
+}
+
+func (s *FileStore) ListFlags(ctx context.Context, opts models.ListOptions) ([]models.Flag, models.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flags := make([]models.Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		flag := *f
+		flag.Rules = nil // Like the SQLite store, lists don't include rules
+		flags = append(flags, flag)
+	}
+	return pageItems(flags, opts, models.FlagSorts, flagRow)
+}
+
+func (s *FileStore) UpdateFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateFlagRequest) (*models.Flag, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *FileStore) DeleteFlag(ctx context.Context, actor models.Actor, key string, version int) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) ToggleFlag(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, error) {
+	return nil, ErrReadOnly
+}
+
+// --- Rules ---
+
+func (s *FileStore) CreateRule(ctx context.Context, actor models.Actor, flagKey string, rule *models.Rule) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) UpdateRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int, req *models.CreateRuleRequest) (*models.Rule, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *FileStore) DeleteRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int) error {
+	return ErrReadOnly
+}
+
+// --- Segments ---
+
+func (s *FileStore) CreateSegment(ctx context.Context, actor models.Actor, segment *models.Segment) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) GetSegment(ctx context.Context, key string) (*models.Segment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seg, ok := s.segments[key]
+	if !ok {
+		return nil, nil
+	}
+	out := *seg
+	return &out, nil
+}
+
+func (s *FileStore) ListSegments(ctx context.Context, opts models.ListOptions) ([]models.Segment, models.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	segments := make([]models.Segment, 0, len(s.segments))
+	for _, seg := range s.segments {
+		segments = append(segments, *seg)
+	}
+	return pageItems(segments, opts, models.SegmentSorts, segmentRow)
+}
+
+func (s *FileStore) UpdateSegment(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateSegmentRequest) (*models.Segment, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *FileStore) DeleteSegment(ctx context.Context, actor models.Actor, key string, version int) error {
+	return ErrReadOnly
+}
+
+// --- Evaluation ---
+
+// GetFlagForEvaluation returns the flag with its rules and the segments they
+// reference, all from the same load of the file.
+func (s *FileStore) GetFlagForEvaluation(ctx context.Context, key string) (*models.Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	flag := *f
+	for _, r := range f.Rules {
+		for _, sk := range r.SegmentKeys {
+			if flag.Segments == nil {
+				flag.Segments = make(map[string]*models.Segment)
+			}
+			flag.Segments[sk] = s.segments[sk]
+		}
+	}
+	return &flag, nil
+}
+
+// --- API Keys ---
+
+func (s *FileStore) CreateAPIKey(ctx context.Context, actor models.Actor, key *models.APIKey, hashedKey string) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	return nil, nil
+}
+
+func (s *FileStore) ListAPIKeys(ctx context.Context, opts models.ListOptions) ([]models.APIKey, models.PageInfo, error) {
+	return nil, models.PageInfo{}, nil
+}
+
+func (s *FileStore) ValidateAPIKey(ctx context.Context, hashedKey string) (*models.APIKey, error) {
+	return nil, nil
+}
+
+func (s *FileStore) TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error {
+	return nil
+}
+
+func (s *FileStore) RotateAPIKey(ctx context.Context, actor models.Actor, id string, successor *models.APIKey, hashedKey string, graceUntil time.Time) (*models.APIKey, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *FileStore) SetAPIKeyRateLimit(ctx context.Context, actor models.Actor, id string, rate float64, burst int) (*models.APIKey, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *FileStore) RevokeAPIKey(ctx context.Context, actor models.Actor, id string) error {
+	return ErrReadOnly
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,12 +10,23 @@ import (
 	"github.com/getflaggy/flaggy/internal/models"
 )
 
-func (s *SQLiteStore) CreateFlag(flag *models.Flag) error {
+// CreateFlag creates a flag with its rules, if it has any.
+func (s *SQLiteStore) CreateFlag(ctx context.Context, actor models.Actor, flag *models.Flag) error {
+	ctx, done := s.track(ctx, "create_flag")
+	defer done()
 	now := time.Now().UTC()
 	flag.CreatedAt = now
 	flag.UpdatedAt = now
 
-	_, err := s.db.Exec(
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	_, err = tx.ExecContext(ctx,
 		`INSERT INTO flags (key, type, description, enabled, default_value, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		flag.Key, flag.Type, flag.Description, flag.Enabled,
@@ -23,17 +35,51 @@ func (s *SQLiteStore) CreateFlag(flag *models.Flag) error {
 	if err != nil {
 		return fmt.Errorf("create flag: %w", err)
 	}
-	return nil
+	if len(flag.Rules) > 0 {
+		for i := range flag.Rules {
+			r := &flag.Rules[i]
+			if err := validateSegmentKeys(ctx, tx, r.SegmentKeys); err != nil {
+				return err
+			}
+			r.ID, r.FlagKey, r.Version, r.CreatedAt = 0, flag.Key, 1, now
+			if err := insertRuleWithID(ctx, tx, flag.Key, r, now); err != nil {
+				return err
+			}
+		}
+		// Read back for the IDs of the rules and conditions
+		created, err := getFlag(ctx, tx, flag.Key)
+		if err != nil {
+			return err
+		}
+		created.Version = flag.Version // Set by recordVersion
+		*flag = *created
+	}
+	if err := recordVersion(ctx, tx, actor, "flag.create", flag); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.create", "flag", flag.Key, nil, flag); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.FlagReplacedEvents(nil, flag)...); err != nil {
+		return err
+	}
+	return out.commit(tx)
+}
+
+func (s *SQLiteStore) GetFlag(ctx context.Context, key string) (*models.Flag, error) {
+	ctx, done := s.track(ctx, "get_flag")
+	defer done()
+	return getFlag(ctx, s.db, key)
 }
 
-func (s *SQLiteStore) GetFlag(key string) (*models.Flag, error) {
+func getFlag(ctx context.Context, q querier, key string) (*models.Flag, error) {
 	flag := &models.Flag{}
 	var defaultVal string
-	err := s.db.QueryRow(
-		`SELECT key, type, description, enabled, default_value, created_at, updated_at
+	err := q.QueryRowContext(ctx,
+		`SELECT key, type, description, enabled, default_value, version, created_at, updated_at
 		 FROM flags WHERE key = ?`, key,
 	).Scan(&flag.Key, &flag.Type, &flag.Description, &flag.Enabled,
-		&defaultVal, &flag.CreatedAt, &flag.UpdatedAt)
+		&defaultVal, &flag.Version, &flag.CreatedAt, &flag.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -42,7 +88,7 @@ func (s *SQLiteStore) GetFlag(key string) (*models.Flag, error) {
 	}
 	flag.DefaultValue = json.RawMessage(defaultVal)
 
-	rules, err := s.getRulesForFlag(key)
+	rules, err := getRulesForFlag(ctx, q, key)
 	if err != nil {
 		return nil, err
 	}
@@ -50,12 +96,31 @@ func (s *SQLiteStore) GetFlag(key string) (*models.Flag, error) {
 	return flag, nil
 }
 
-func (s *SQLiteStore) ListFlags() ([]models.Flag, error) {
-	rows, err := s.db.Query(
-		`SELECT key, type, description, enabled, default_value, created_at, updated_at
-		 FROM flags ORDER BY key`)
+func (s *SQLiteStore) ListFlags(ctx context.Context, opts models.ListOptions) ([]models.Flag, models.PageInfo, error) {
+	ctx, done := s.track(ctx, "list_flags")
+	defer done()
+
+	p, err := newListPage(opts, models.FlagSorts)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	search, args := searchCondition("flags", opts.Query)
+	after, afterArgs, err := p.afterCondition("key")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	var info models.PageInfo
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM flags`+whereClause(search), args...).Scan(&info.Total); err != nil {
+		return nil, info, fmt.Errorf("count flags: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT key, type, description, enabled, default_value, version, created_at, updated_at
+		 FROM flags`+whereClause(search, after)+p.orderBy("key"),
+		append(args, afterArgs...)...)
 	if err != nil {
-		return nil, fmt.Errorf("list flags: %w", err)
+		return nil, info, fmt.Errorf("list flags: %w", err)
 	}
 	defer rows.Close()
 
@@ -64,23 +129,43 @@ func (s *SQLiteStore) ListFlags() ([]models.Flag, error) {
 		var f models.Flag
 		var defaultVal string
 		if err := rows.Scan(&f.Key, &f.Type, &f.Description, &f.Enabled,
-			&defaultVal, &f.CreatedAt, &f.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("scan flag: %w", err)
+			&defaultVal, &f.Version, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return nil, info, fmt.Errorf("scan flag: %w", err)
 		}
 		f.DefaultValue = json.RawMessage(defaultVal)
 		flags = append(flags, f)
 	}
-	return flags, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, info, err
+	}
+	flags, info.NextCursor = trim(p, flags, sortValue(flagRow))
+	return flags, info, nil
 }
 
-func (s *SQLiteStore) UpdateFlag(key string, req *models.UpdateFlagRequest) (*models.Flag, error) {
-	flag, err := s.GetFlag(key)
+func (s *SQLiteStore) UpdateFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateFlagRequest) (*models.Flag, error) {
+	ctx, done := s.track(ctx, "update_flag")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getFlag(ctx, tx, key)
 	if err != nil {
 		return nil, err
 	}
-	if flag == nil {
+	if before == nil {
 		return nil, nil
 	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	after := *before
+	flag := &after
 
 	if req.Description != nil {
 		flag.Description = *req.Description
@@ -96,60 +181,145 @@ func (s *SQLiteStore) UpdateFlag(key string, req *models.UpdateFlagRequest) (*mo
 	}
 	flag.UpdatedAt = time.Now().UTC()
 
-	_, err = s.db.Exec(
+	res, err := tx.ExecContext(ctx,
 		`UPDATE flags SET description = ?, enabled = ?, default_value = ?, updated_at = ?
-		 WHERE key = ?`,
-		flag.Description, flag.Enabled, string(flag.DefaultValue), flag.UpdatedAt, key,
+		 WHERE key = ? AND version = ?`,
+		flag.Description, flag.Enabled, string(flag.DefaultValue), flag.UpdatedAt, key, before.Version,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("update flag: %w", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrVersionMismatch
+	}
+	if err := recordVersion(ctx, tx, actor, "flag.update", flag); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.update", "flag", key, before, flag); err != nil {
+		return nil, err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("flag_updated", key, flag)); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
+	}
 	return flag, nil
 }
 
-func (s *SQLiteStore) DeleteFlag(key string) error {
-	res, err := s.db.Exec(`DELETE FROM flags WHERE key = ?`, key)
+func (s *SQLiteStore) DeleteFlag(ctx context.Context, actor models.Actor, key string, version int) error {
+	ctx, done := s.track(ctx, "delete_flag")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("delete flag: %w", err)
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getFlag(ctx, tx, key)
+	if err != nil {
+		return err
+	}
+	if before == nil {
 		return fmt.Errorf("flag not found")
 	}
-	return nil
+	if err := checkVersion(version, before.Version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM flags WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("delete flag: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.delete", "flag", key, before, nil); err != nil {
+		return err
+	}
+	if err := recordVersion(ctx, tx, actor, "flag.delete", before); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.FlagDeletedEvent(key)); err != nil {
+		return err
+	}
+	return out.commit(tx)
 }
 
-func (s *SQLiteStore) ToggleFlag(key string) (*models.Flag, error) {
+func (s *SQLiteStore) ToggleFlag(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, error) {
+	ctx, done := s.track(ctx, "toggle_flag")
+	defer done()
 	now := time.Now().UTC()
-	_, err := s.db.Exec(
-		`UPDATE flags SET enabled = NOT enabled, updated_at = ? WHERE key = ?`, now, key,
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getFlag(ctx, tx, key)
+	if err != nil || before == nil {
+		return nil, err
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE flags SET enabled = NOT enabled, updated_at = ? WHERE key = ? AND version = ?`,
+		now, key, before.Version,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("toggle flag: %w", err)
 	}
-	return s.GetFlag(key)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrVersionMismatch
+	}
+	flag, err := getFlag(ctx, tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, actor, "flag.toggle", flag); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.toggle", "flag", key, before, flag); err != nil {
+		return nil, err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("flag_toggled", key, flag)); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
+	}
+	return flag, nil
 }
 
 // --- Rules ---
 
-func (s *SQLiteStore) CreateRule(flagKey string, rule *models.Rule) error {
+func (s *SQLiteStore) CreateRule(ctx context.Context, actor models.Actor, flagKey string, rule *models.Rule) error {
+	ctx, done := s.track(ctx, "create_rule")
+	defer done()
 	now := time.Now().UTC()
 	rule.FlagKey = flagKey
+	rule.Version = 1
 	rule.CreatedAt = now
 	rule.UpdatedAt = now
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
 
 	// Validate that all referenced segments exist
-	if err := validateSegmentKeys(tx, rule.SegmentKeys); err != nil {
+	if err := validateSegmentKeys(ctx, tx, rule.SegmentKeys); err != nil {
 		return err
 	}
 
-	res, err := tx.Exec(
+	res, err := tx.ExecContext(ctx,
 		`INSERT INTO rules (flag_key, description, value, priority, rollout_percentage, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		rule.FlagKey, rule.Description, string(rule.Value), rule.Priority,
@@ -165,7 +335,7 @@ func (s *SQLiteStore) CreateRule(flagKey string, rule *models.Rule) error {
 		c := &rule.Conditions[i]
 		c.RuleID = ruleID
 		c.CreatedAt = now
-		res, err := tx.Exec(
+		res, err := tx.ExecContext(ctx,
 			`INSERT INTO conditions (rule_id, attribute, operator, value, created_at)
 			 VALUES (?, ?, ?, ?, ?)`,
 			c.RuleID, c.Attribute, c.Operator, string(c.Value), c.CreatedAt,
@@ -179,7 +349,7 @@ func (s *SQLiteStore) CreateRule(flagKey string, rule *models.Rule) error {
 
 	// Insert rule_segments
 	for _, sk := range rule.SegmentKeys {
-		if _, err := tx.Exec(
+		if _, err := tx.ExecContext(ctx,
 			`INSERT INTO rule_segments (rule_id, segment_key) VALUES (?, ?)`,
 			ruleID, sk,
 		); err != nil {
@@ -187,46 +357,71 @@ func (s *SQLiteStore) CreateRule(flagKey string, rule *models.Rule) error {
 		}
 	}
 
-	return tx.Commit()
+	if err := writeAudit(ctx, tx, actor, "rule.create", "rule", flagKey, nil, rule); err != nil {
+		return err
+	}
+	if err := recordCurrentVersion(ctx, tx, actor, "rule.create", flagKey); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("rule_created", flagKey, rule)); err != nil {
+		return err
+	}
+	return out.commit(tx)
 }
 
-func (s *SQLiteStore) UpdateRule(flagKey string, ruleID int64, req *models.CreateRuleRequest) (*models.Rule, error) {
+func (s *SQLiteStore) UpdateRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int, req *models.CreateRuleRequest) (*models.Rule, error) {
+	ctx, done := s.track(ctx, "update_rule")
+	defer done()
 	now := time.Now().UTC()
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getRule(ctx, tx, flagKey, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, fmt.Errorf("rule not found")
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
 
 	// Validate that all referenced segments exist
-	if err := validateSegmentKeys(tx, req.SegmentKeys); err != nil {
+	if err := validateSegmentKeys(ctx, tx, req.SegmentKeys); err != nil {
 		return nil, err
 	}
 
-	res, err := tx.Exec(
-		`UPDATE rules SET description = ?, value = ?, priority = ?, rollout_percentage = ?, updated_at = ?
-		 WHERE id = ? AND flag_key = ?`,
-		req.Description, string(req.Value), req.Priority, req.RolloutPercentage, now, ruleID, flagKey,
+	res, err := tx.ExecContext(ctx,
+		`UPDATE rules SET description = ?, value = ?, priority = ?, rollout_percentage = ?, updated_at = ?,
+		                  version = version + 1
+		 WHERE id = ? AND flag_key = ? AND version = ?`,
+		req.Description, string(req.Value), req.Priority, req.RolloutPercentage, now, ruleID, flagKey, before.Version,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("update rule: %w", err)
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return nil, fmt.Errorf("rule not found")
+		return nil, ErrVersionMismatch
 	}
 
-	if _, err := tx.Exec(`DELETE FROM conditions WHERE rule_id = ?`, ruleID); err != nil {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM conditions WHERE rule_id = ?`, ruleID); err != nil {
 		return nil, fmt.Errorf("delete conditions: %w", err)
 	}
 
 	// Replace rule_segments
-	if _, err := tx.Exec(`DELETE FROM rule_segments WHERE rule_id = ?`, ruleID); err != nil {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rule_segments WHERE rule_id = ?`, ruleID); err != nil {
 		return nil, fmt.Errorf("delete rule_segments: %w", err)
 	}
 	for _, sk := range req.SegmentKeys {
-		if _, err := tx.Exec(
+		if _, err := tx.ExecContext(ctx,
 			`INSERT INTO rule_segments (rule_id, segment_key) VALUES (?, ?)`,
 			ruleID, sk,
 		); err != nil {
@@ -242,11 +437,13 @@ func (s *SQLiteStore) UpdateRule(flagKey string, ruleID int64, req *models.Creat
 		Priority:          req.Priority,
 		RolloutPercentage: req.RolloutPercentage,
 		SegmentKeys:       req.SegmentKeys,
+		Version:           before.Version + 1,
+		CreatedAt:         before.CreatedAt,
 		UpdatedAt:         now,
 	}
 
 	for _, c := range req.Conditions {
-		cRes, err := tx.Exec(
+		cRes, err := tx.ExecContext(ctx,
 			`INSERT INTO conditions (rule_id, attribute, operator, value, created_at)
 			 VALUES (?, ?, ?, ?, ?)`,
 			ruleID, c.Attribute, c.Operator, string(c.Value), now,
@@ -265,30 +462,65 @@ func (s *SQLiteStore) UpdateRule(flagKey string, ruleID int64, req *models.Creat
 		})
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
+	if err := writeAudit(ctx, tx, actor, "rule.update", "rule", flagKey, before, rule); err != nil {
+		return nil, err
+	}
+	if err := recordCurrentVersion(ctx, tx, actor, "rule.update", flagKey); err != nil {
+		return nil, err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("rule_updated", flagKey, rule)); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
 	}
 	return rule, nil
 }
 
-func (s *SQLiteStore) DeleteRule(flagKey string, ruleID int64) error {
-	res, err := s.db.Exec(
-		`DELETE FROM rules WHERE id = ? AND flag_key = ?`, ruleID, flagKey,
-	)
+func (s *SQLiteStore) DeleteRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int) error {
+	ctx, done := s.track(ctx, "delete_rule")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("delete rule: %w", err)
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getRule(ctx, tx, flagKey, ruleID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
 		return fmt.Errorf("rule not found")
 	}
-	return nil
+	if err := checkVersion(version, before.Version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM rules WHERE id = ? AND flag_key = ?`, ruleID, flagKey,
+	); err != nil {
+		return fmt.Errorf("delete rule: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "rule.delete", "rule", flagKey, before, nil); err != nil {
+		return err
+	}
+	if err := recordCurrentVersion(ctx, tx, actor, "rule.delete", flagKey); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.RuleDeletedEvent(flagKey, ruleID)); err != nil {
+		return err
+	}
+	return out.commit(tx)
 }
 
 // --- Helpers ---
 
 // validateSegmentKeys checks that all segment keys exist in the DB.
-func validateSegmentKeys(tx *sql.Tx, keys []string) error {
+func validateSegmentKeys(ctx context.Context, tx *sql.Tx, keys []string) error {
 	if len(keys) == 0 {
 		return nil
 	}
@@ -304,7 +536,7 @@ func validateSegmentKeys(tx *sql.Tx, keys []string) error {
 	}
 	query += ")"
 
-	rows, err := tx.Query(query, args...)
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("validate segment keys: %w", err)
 	}
@@ -332,9 +564,18 @@ func validateSegmentKeys(tx *sql.Tx, keys []string) error {
 
 // --- Evaluation ---
 
-// GetFlagForEvaluation returns the flag with rules, conditions, and referenced segments.
-func (s *SQLiteStore) GetFlagForEvaluation(key string) (*models.Flag, error) {
-	flag, err := s.GetFlag(key)
+// GetFlagForEvaluation returns the flag with rules, conditions, and referenced
+// segments, read in one transaction so they are consistent with each other.
+func (s *SQLiteStore) GetFlagForEvaluation(ctx context.Context, key string) (*models.Flag, error) {
+	ctx, done := s.track(ctx, "get_flag_for_evaluation")
+	defer done()
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	flag, err := getFlag(ctx, tx, key)
 	if err != nil || flag == nil {
 		return flag, err
 	}
@@ -353,7 +594,7 @@ func (s *SQLiteStore) GetFlagForEvaluation(key string) (*models.Flag, error) {
 	// Load referenced segments
 	segments := make(map[string]*models.Segment)
 	for sk := range segKeySet {
-		seg, err := s.GetSegment(sk)
+		seg, err := getSegment(ctx, tx, sk)
 		if err != nil {
 			return nil, fmt.Errorf("load segment %q: %w", sk, err)
 		}
@@ -366,10 +607,24 @@ func (s *SQLiteStore) GetFlagForEvaluation(key string) (*models.Flag, error) {
 	return flag, nil
 }
 
-func (s *SQLiteStore) getRulesForFlag(flagKey string) ([]models.Rule, error) {
-	rows, err := s.db.Query(
+// getRule returns a single rule of a flag, or nil if it doesn't exist.
+func getRule(ctx context.Context, q querier, flagKey string, ruleID int64) (*models.Rule, error) {
+	rules, err := getRulesForFlag(ctx, q, flagKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID == ruleID {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func getRulesForFlag(ctx context.Context, q querier, flagKey string) ([]models.Rule, error) {
+	rows, err := q.QueryContext(ctx,
 		`SELECT r.id, r.flag_key, r.description, r.value, r.priority, r.rollout_percentage,
-		        r.created_at, r.updated_at,
+		        r.version, r.created_at, r.updated_at,
 		        c.id, c.rule_id, c.attribute, c.operator, c.value, c.created_at
 		 FROM rules r
 		 LEFT JOIN conditions c ON c.rule_id = r.id
@@ -394,7 +649,7 @@ func (s *SQLiteStore) getRulesForFlag(flagKey string) ([]models.Rule, error) {
 
 		if err := rows.Scan(
 			&r.ID, &r.FlagKey, &r.Description, &ruleVal, &r.Priority,
-			&r.RolloutPercentage, &r.CreatedAt, &r.UpdatedAt,
+			&r.RolloutPercentage, &r.Version, &r.CreatedAt, &r.UpdatedAt,
 			&cID, &cRuleID, &cAttr, &cOp, &cVal, &cCreated,
 		); err != nil {
 			return nil, fmt.Errorf("scan rule: %w", err)
@@ -440,7 +695,7 @@ func (s *SQLiteStore) getRulesForFlag(flagKey string) ([]models.Rule, error) {
 		}
 		query += `) ORDER BY rule_id, segment_key`
 
-		segRows, err := s.db.Query(query, args...)
+		segRows, err := q.QueryContext(ctx, query, args...)
 		if err != nil {
 			return nil, fmt.Errorf("get rule segments: %w", err)
 		}
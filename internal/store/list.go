@@ -0,0 +1,233 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued for the
+// list's sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the position after the last item of a page: its sort value and
+// the ID breaking ties between equal values. Clients see it base64-encoded.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sortTime formats a time as a cursor value. The fixed width keeps values in
+// time order when compared as strings.
+func sortTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// listPage is a parsed ListOptions.
+type listPage struct {
+	sort  string
+	field string
+	desc  bool
+	after *cursor
+	limit int
+}
+
+func newListPage(opts models.ListOptions, accepted []string) (*listPage, error) {
+	p := &listPage{limit: opts.Limit}
+	var err error
+	if p.field, p.desc, err = models.ParseSort(opts.Sort, accepted); err != nil {
+		return nil, err
+	}
+	p.sort = opts.Sort
+	if p.sort == "" {
+		p.sort = accepted[0]
+	}
+	if opts.Cursor == "" {
+		return p, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	p.after = &cursor{}
+	if err := json.Unmarshal(data, p.after); err != nil || p.after.Sort != p.sort {
+		return nil, ErrInvalidCursor
+	}
+	return p, nil
+}
+
+// afterCondition returns the SQL condition selecting rows past the cursor,
+// ordered by the sort column then idCol, or "" on the first page.
+func (p *listPage) afterCondition(idCol string) (string, []any, error) {
+	if p.after == nil {
+		return "", nil, nil
+	}
+	var value any = p.after.Value
+	if strings.HasSuffix(p.field, "_at") {
+		t, err := time.Parse(time.RFC3339Nano, p.after.Value)
+		if err != nil {
+			return "", nil, ErrInvalidCursor
+		}
+		value = t
+	}
+	op := ">"
+	if p.desc {
+		op = "<"
+	}
+	return fmt.Sprintf("(%s, %s) %s (?, ?)", p.field, idCol, op), []any{value, p.after.ID}, nil
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses. One row past the limit is
+// fetched to tell whether there is a next page.
+func (p *listPage) orderBy(idCol string) string {
+	dir := "ASC"
+	if p.desc {
+		dir = "DESC"
+	}
+	clause := fmt.Sprintf(" ORDER BY %s %s, %s %s", p.field, dir, idCol, dir)
+	if p.limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d", p.limit+1)
+	}
+	return clause
+}
+
+// trim cuts rows fetched by orderBy to the page and returns the cursor of
+// the next page, if there is one. value returns an item's sort value and ID.
+func trim[T any](p *listPage, items []T, value func(T, string) (string, string)) ([]T, string) {
+	if p.limit <= 0 || len(items) <= p.limit {
+		return items, ""
+	}
+	items = items[:p.limit]
+	v, id := value(items[len(items)-1], p.field)
+	return items, cursor{Sort: p.sort, Value: v, ID: id}.encode()
+}
+
+// searchCondition returns the SQL condition matching rows of table (flags or
+// segments) whose key or description contains query. Queries of three or
+// more characters use the table's trigram index, maintained by triggers;
+// shorter ones, which a trigram can't match, fall back to LIKE.
+func searchCondition(table, query string) (string, []any) {
+	if query == "" {
+		return "", nil
+	}
+	if utf8.RuneCountInString(query) >= 3 {
+		phrase := `"` + strings.ReplaceAll(query, `"`, `""`) + `"`
+		return fmt.Sprintf("key IN (SELECT key FROM %s_search WHERE %s_search MATCH ?)", table, table), []any{phrase}
+	}
+	pattern := likePattern(query)
+	return `(key LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, []any{pattern, pattern}
+}
+
+// likePattern matches values containing s, with LIKE wildcards in s escaped.
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+// whereClause joins conditions, skipping empty ones.
+func whereClause(conds ...string) string {
+	conds = slices.DeleteFunc(conds, func(c string) bool { return c == "" })
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// listRow is what paging needs to know about an item.
+type listRow struct {
+	id     string            // Unique; breaks ties between equal sort values
+	text   []string          // Searched by the query
+	values map[string]string // Sort value for each field
+}
+
+// pageItems applies opts to items in memory, the way the SQLite store does
+// in SQL, for stores without a database.
+func pageItems[T any](items []T, opts models.ListOptions, accepted []string, row func(T) listRow) ([]T, models.PageInfo, error) {
+	p, err := newListPage(opts, accepted)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	query := strings.ToLower(opts.Query)
+	rows := make(map[int]listRow, len(items))
+	var matched []int
+	for i, item := range items {
+		r := row(item)
+		if query != "" && !slices.ContainsFunc(r.text, func(t string) bool {
+			return strings.Contains(strings.ToLower(t), query)
+		}) {
+			continue
+		}
+		rows[i] = r
+		matched = append(matched, i)
+	}
+	compare := func(a, b listRow) int {
+		c := strings.Compare(a.values[p.field], b.values[p.field])
+		if c == 0 {
+			c = strings.Compare(a.id, b.id)
+		}
+		if p.desc {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matched, func(a, b int) int { return compare(rows[a], rows[b]) })
+
+	info := models.PageInfo{Total: len(matched)}
+	if p.after != nil {
+		after := listRow{id: p.after.ID, values: map[string]string{p.field: p.after.Value}}
+		start, _ := slices.BinarySearchFunc(matched, after, func(i int, target listRow) int {
+			if compare(rows[i], target) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		matched = matched[start:]
+	}
+
+	var page []T
+	for _, i := range matched {
+		page = append(page, items[i])
+	}
+	page, info.NextCursor = trim(p, page, sortValue(row))
+	return page, info, nil
+}
+
+// sortValue adapts row for trim.
+func sortValue[T any](row func(T) listRow) func(T, string) (string, string) {
+	return func(item T, field string) (string, string) {
+		r := row(item)
+		return r.values[field], r.id
+	}
+}
+
+func flagRow(f models.Flag) listRow {
+	return listRow{id: f.Key, text: []string{f.Key, f.Description}, values: map[string]string{
+		"key": f.Key, "created_at": sortTime(f.CreatedAt), "updated_at": sortTime(f.UpdatedAt),
+	}}
+}
+
+func segmentRow(seg models.Segment) listRow {
+	return listRow{id: seg.Key, text: []string{seg.Key, seg.Description}, values: map[string]string{
+		"key": seg.Key, "created_at": sortTime(seg.CreatedAt), "updated_at": sortTime(seg.UpdatedAt),
+	}}
+}
+
+func apiKeyRow(k models.APIKey) listRow {
+	return listRow{id: k.ID, text: []string{k.Name, k.ID}, values: map[string]string{
+		"name": k.Name, "created_at": sortTime(k.CreatedAt),
+	}}
+}
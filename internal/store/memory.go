@@ -0,0 +1,682 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// MemoryStore implements Store in memory, for tests and for embedding the
+// API without a database file. It behaves like SQLiteStore, which the
+// storetest suite checks, but keeps no audit log or flag history and loses
+// everything when the process exits.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	flags    map[string]*models.Flag // Rules sorted by priority, then ID
+	segments map[string]*models.Segment
+	apiKeys  map[string]*models.APIKey
+	hashes   map[string]string // Hashed key to key ID
+
+	// Flag versions continue after a flag is deleted and recreated, like the
+	// SQLite store's flag history.
+	flagVersions  map[string]int
+	nextRuleID    int64
+	nextCondID    int64
+	nextSegCondID int64
+
+	onChange func([]models.ChangeEvent)
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		flags:        map[string]*models.Flag{},
+		segments:     map[string]*models.Segment{},
+		apiKeys:      map[string]*models.APIKey{},
+		hashes:       map[string]string{},
+		flagVersions: map[string]int{},
+	}
+}
+
+// OnChange sets fn to be called with the events of each write, in order.
+// The events aren't numbered. fn must not block or call back into the
+// store. Must be called before the store is shared between goroutines.
+func (s *MemoryStore) OnChange(fn func([]models.ChangeEvent)) {
+	s.onChange = fn
+}
+
+// emit hands the events of a write to the listener. s.mu must be held, so
+// events are seen in the order the writes were made.
+func (s *MemoryStore) emit(events ...models.ChangeEvent) {
+	if s.onChange != nil {
+		s.onChange(events)
+	}
+}
+
+// --- Flags ---
+
+func (s *MemoryStore) CreateFlag(ctx context.Context, actor models.Actor, flag *models.Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.flags[flag.Key]; ok {
+		return fmt.Errorf("create flag: flag %q already exists", flag.Key)
+	}
+	for _, r := range flag.Rules {
+		if err := s.validateSegmentKeys(r.SegmentKeys); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	flag.CreatedAt = now
+	flag.UpdatedAt = now
+	flag.Version = s.bumpFlagVersion(flag.Key, flag.Version)
+	for i := range flag.Rules {
+		r := &flag.Rules[i]
+		s.nextRuleID++
+		r.ID, r.FlagKey, r.Version, r.CreatedAt, r.UpdatedAt = s.nextRuleID, flag.Key, 1, now, now
+		for j := range r.Conditions {
+			c := &r.Conditions[j]
+			s.nextCondID++
+			c.ID, c.RuleID, c.CreatedAt = s.nextCondID, r.ID, now
+		}
+	}
+
+	sortRules(flag)
+
+	stored := cloneFlag(flag)
+	if stored.Rules == nil {
+		stored.Rules = []models.Rule{}
+	}
+	s.flags[flag.Key] = stored
+	s.emit(models.FlagReplacedEvents(nil, flag)...)
+	return nil
+}
+
+// bumpFlagVersion returns the next version of a flag, as recordVersion does.
+func (s *MemoryStore) bumpFlagVersion(key string, current int) int {
+	next := s.flagVersions[key] + 1
+	if next <= current {
+		next = current + 1
+	}
+	s.flagVersions[key] = next
+	return next
+}
+
+func (s *MemoryStore) GetFlag(ctx context.Context, key string) (*models.Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	return cloneFlag(f), nil
+}
+
+func (s *MemoryStore) ListFlags(ctx context.Context, opts models.ListOptions) ([]models.Flag, models.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var flags []models.Flag
+	for _, f := range s.flags {
+		flag := *f
+		flag.Rules = nil // Like the SQLite store, lists don't include rules
+		flags = append(flags, flag)
+	}
+	return pageItems(flags, opts, models.FlagSorts, flagRow)
+}
+
+func (s *MemoryStore) UpdateFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateFlagRequest) (*models.Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	flag := cloneFlag(before)
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	if req.DefaultValue != nil {
+		if err := models.ValidateValueForType(flag.Type, req.DefaultValue); err != nil {
+			return nil, fmt.Errorf("default_value: %w", err)
+		}
+		flag.DefaultValue = req.DefaultValue
+	}
+	flag.UpdatedAt = time.Now().UTC()
+	flag.Version = s.bumpFlagVersion(key, before.Version)
+
+	s.flags[key] = flag
+	s.emit(models.NewChangeEvent("flag_updated", key, flag))
+	return cloneFlag(flag), nil
+}
+
+func (s *MemoryStore) DeleteFlag(ctx context.Context, actor models.Actor, key string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.flags[key]
+	if !ok {
+		return fmt.Errorf("flag not found")
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return err
+	}
+	// Rules go with the flag; the deletion takes a version of its own
+	delete(s.flags, key)
+	s.bumpFlagVersion(key, before.Version)
+	s.emit(models.FlagDeletedEvent(key))
+	return nil
+}
+
+func (s *MemoryStore) ToggleFlag(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	flag := cloneFlag(before)
+	flag.Enabled = !flag.Enabled
+	flag.UpdatedAt = time.Now().UTC()
+	flag.Version = s.bumpFlagVersion(key, before.Version)
+
+	s.flags[key] = flag
+	s.emit(models.NewChangeEvent("flag_toggled", key, flag))
+	return cloneFlag(flag), nil
+}
+
+// --- Rules ---
+
+func (s *MemoryStore) CreateRule(ctx context.Context, actor models.Actor, flagKey string, rule *models.Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.validateSegmentKeys(rule.SegmentKeys); err != nil {
+		return err
+	}
+	before, ok := s.flags[flagKey]
+	if !ok {
+		return fmt.Errorf("flag not found")
+	}
+
+	now := time.Now().UTC()
+	s.nextRuleID++
+	rule.ID = s.nextRuleID
+	rule.FlagKey = flagKey
+	rule.Version = 1
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	for i := range rule.Conditions {
+		c := &rule.Conditions[i]
+		s.nextCondID++
+		c.ID = s.nextCondID
+		c.RuleID = rule.ID
+		c.CreatedAt = now
+	}
+
+	flag := cloneFlag(before)
+	flag.Rules = append(flag.Rules, *cloneRule(rule))
+	s.putRules(flag)
+	s.emit(models.NewChangeEvent("rule_created", flagKey, rule))
+	return nil
+}
+
+func (s *MemoryStore) UpdateRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int, req *models.CreateRuleRequest) (*models.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, i := s.findRule(flagKey, ruleID)
+	if i < 0 {
+		return nil, fmt.Errorf("rule not found")
+	}
+	before := &f.Rules[i]
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	if err := s.validateSegmentKeys(req.SegmentKeys); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	rule := &models.Rule{
+		ID:                ruleID,
+		FlagKey:           flagKey,
+		Description:       req.Description,
+		Value:             req.Value,
+		Priority:          req.Priority,
+		RolloutPercentage: req.RolloutPercentage,
+		SegmentKeys:       req.SegmentKeys,
+		Version:           before.Version + 1,
+		CreatedAt:         before.CreatedAt,
+		UpdatedAt:         now,
+	}
+	for _, c := range req.Conditions {
+		s.nextCondID++
+		rule.Conditions = append(rule.Conditions, models.Condition{
+			ID:        s.nextCondID,
+			RuleID:    ruleID,
+			Attribute: c.Attribute,
+			Operator:  c.Operator,
+			Value:     c.Value,
+			CreatedAt: now,
+		})
+	}
+
+	flag := cloneFlag(f)
+	flag.Rules[i] = *cloneRule(rule)
+	s.putRules(flag)
+	s.emit(models.NewChangeEvent("rule_updated", flagKey, rule))
+	return rule, nil
+}
+
+func (s *MemoryStore) DeleteRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, i := s.findRule(flagKey, ruleID)
+	if i < 0 {
+		return fmt.Errorf("rule not found")
+	}
+	if err := checkVersion(version, f.Rules[i].Version); err != nil {
+		return err
+	}
+	flag := cloneFlag(f)
+	flag.Rules = append(flag.Rules[:i], flag.Rules[i+1:]...)
+	s.putRules(flag)
+	s.emit(models.RuleDeletedEvent(flagKey, ruleID))
+	return nil
+}
+
+// findRule returns the flag and the index of its rule, or -1.
+func (s *MemoryStore) findRule(flagKey string, ruleID int64) (*models.Flag, int) {
+	f, ok := s.flags[flagKey]
+	if !ok {
+		return nil, -1
+	}
+	for i := range f.Rules {
+		if f.Rules[i].ID == ruleID {
+			return f, i
+		}
+	}
+	return f, -1
+}
+
+// putRules stores a flag whose rules changed, in evaluation order and with a
+// new version.
+func (s *MemoryStore) putRules(flag *models.Flag) {
+	sortRules(flag)
+	flag.Version = s.bumpFlagVersion(flag.Key, flag.Version)
+	s.flags[flag.Key] = flag
+}
+
+// sortRules puts a flag's rules in evaluation order, with segment keys
+// sorted and empty lists nil, as the SQLite store reads them back.
+func sortRules(flag *models.Flag) {
+	for i := range flag.Rules {
+		r := &flag.Rules[i]
+		if len(r.Conditions) == 0 {
+			r.Conditions = nil
+		}
+		if len(r.SegmentKeys) == 0 {
+			r.SegmentKeys = nil
+		}
+		sort.Strings(r.SegmentKeys)
+	}
+	sort.SliceStable(flag.Rules, func(i, j int) bool {
+		if flag.Rules[i].Priority != flag.Rules[j].Priority {
+			return flag.Rules[i].Priority < flag.Rules[j].Priority
+		}
+		return flag.Rules[i].ID < flag.Rules[j].ID
+	})
+}
+
+// validateSegmentKeys checks that all segment keys exist.
+func (s *MemoryStore) validateSegmentKeys(keys []string) error {
+	for _, k := range keys {
+		if _, ok := s.segments[k]; !ok {
+			return fmt.Errorf("segment %q not found", k)
+		}
+	}
+	return nil
+}
+
+// --- Segments ---
+
+func (s *MemoryStore) CreateSegment(ctx context.Context, actor models.Actor, segment *models.Segment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.segments[segment.Key]; ok {
+		return fmt.Errorf("insert segment: segment %q already exists", segment.Key)
+	}
+	now := time.Now().UTC()
+	segment.Version = 1
+	segment.CreatedAt = now
+	segment.UpdatedAt = now
+	for i := range segment.Conditions {
+		c := &segment.Conditions[i]
+		s.nextSegCondID++
+		c.ID = s.nextSegCondID
+		c.CreatedAt = now
+	}
+	s.putSegment(cloneSegment(segment))
+	s.emit(models.NewChangeEvent("segment_created", "", segment))
+	return nil
+}
+
+func (s *MemoryStore) GetSegment(ctx context.Context, key string) (*models.Segment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seg, ok := s.segments[key]
+	if !ok {
+		return nil, nil
+	}
+	return cloneSegment(seg), nil
+}
+
+func (s *MemoryStore) ListSegments(ctx context.Context, opts models.ListOptions) ([]models.Segment, models.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var segments []models.Segment
+	for _, seg := range s.segments {
+		out := *seg
+		out.Conditions = nil // Like the SQLite store, lists don't include conditions
+		segments = append(segments, out)
+	}
+	return pageItems(segments, opts, models.SegmentSorts, segmentRow)
+}
+
+func (s *MemoryStore) UpdateSegment(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateSegmentRequest) (*models.Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.segments[key]
+	if !ok {
+		return nil, nil
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	seg := cloneSegment(before)
+	seg.Version++
+	if req.Description != nil {
+		seg.Description = *req.Description
+	}
+	seg.UpdatedAt = time.Now().UTC()
+	if req.Conditions != nil {
+		seg.Conditions = make([]models.Condition, len(req.Conditions))
+		for i, c := range req.Conditions {
+			s.nextSegCondID++
+			seg.Conditions[i] = models.Condition{
+				ID:        s.nextSegCondID,
+				Attribute: c.Attribute,
+				Operator:  c.Operator,
+				Value:     c.Value,
+				CreatedAt: seg.UpdatedAt,
+			}
+		}
+	}
+
+	out := cloneSegment(seg)
+	s.putSegment(seg)
+	s.emit(models.NewChangeEvent("segment_updated", "", out))
+	return out, nil
+}
+
+// putSegment stores a segment, with no conditions as nil.
+func (s *MemoryStore) putSegment(seg *models.Segment) {
+	if len(seg.Conditions) == 0 {
+		seg.Conditions = nil
+	}
+	s.segments[seg.Key] = seg
+}
+
+func (s *MemoryStore) DeleteSegment(ctx context.Context, actor models.Actor, key string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.flags {
+		for _, r := range f.Rules {
+			for _, sk := range r.SegmentKeys {
+				if sk == key {
+					return ErrSegmentInUse
+				}
+			}
+		}
+	}
+	before, ok := s.segments[key]
+	if !ok {
+		return fmt.Errorf("segment not found")
+	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return err
+	}
+	delete(s.segments, key)
+	s.emit(models.SegmentDeletedEvent(key))
+	return nil
+}
+
+// --- Evaluation ---
+
+// GetFlagForEvaluation returns the flag with rules, conditions, and referenced segments.
+func (s *MemoryStore) GetFlagForEvaluation(ctx context.Context, key string) (*models.Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return nil, nil
+	}
+	flag := cloneFlag(f)
+	for _, r := range flag.Rules {
+		for _, sk := range r.SegmentKeys {
+			seg, ok := s.segments[sk]
+			if !ok {
+				continue
+			}
+			if flag.Segments == nil {
+				flag.Segments = make(map[string]*models.Segment)
+			}
+			flag.Segments[sk] = cloneSegment(seg)
+		}
+	}
+	return flag, nil
+}
+
+// --- API Keys ---
+
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, actor models.Actor, key *models.APIKey, hashedKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertAPIKey(key, hashedKey)
+}
+
+func (s *MemoryStore) insertAPIKey(key *models.APIKey, hashedKey string) error {
+	if _, ok := s.apiKeys[key.ID]; ok {
+		return fmt.Errorf("create api key: key %q already exists", key.ID)
+	}
+	if _, ok := s.hashes[hashedKey]; ok {
+		return fmt.Errorf("create api key: hashed key already exists")
+	}
+	s.apiKeys[key.ID] = cloneAPIKey(key)
+	s.hashes[hashedKey] = key.ID
+	return nil
+}
+
+// GetAPIKey returns the key with this ID, or nil if it doesn't exist.
+func (s *MemoryStore) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return nil, nil
+	}
+	return cloneAPIKey(k), nil
+}
+
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, opts models.ListOptions) ([]models.APIKey, models.PageInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []models.APIKey
+	for _, k := range s.apiKeys {
+		keys = append(keys, *cloneAPIKey(k))
+	}
+	return pageItems(keys, opts, models.APIKeySorts, apiKeyRow)
+}
+
+// ValidateAPIKey returns the unrevoked, unexpired key with this hash, or nil.
+// It doesn't record the use; see TouchAPIKeys.
+func (s *MemoryStore) ValidateAPIKey(ctx context.Context, hashedKey string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.hashes[hashedKey]
+	if !ok {
+		return nil, nil
+	}
+	k := s.apiKeys[id]
+	if k.Revoked || k.Expired(time.Now().UTC()) {
+		return nil, nil
+	}
+	return cloneAPIKey(k), nil
+}
+
+// TouchAPIKeys sets last_used_at for a batch of keys, by key ID.
+func (s *MemoryStore) TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, at := range lastUsed {
+		k, ok := s.apiKeys[id]
+		if !ok {
+			continue
+		}
+		at = at.UTC()
+		if k.LastUsedAt == nil || k.LastUsedAt.Before(at) {
+			k = cloneAPIKey(k)
+			k.LastUsedAt = &at
+			s.apiKeys[id] = k
+		}
+	}
+	return nil
+}
+
+// RotateAPIKey stores successor as the replacement for key id, which keeps
+// working until graceUntil (or its own expiry, if sooner). It returns the
+// rotated key. Only active keys can be rotated.
+func (s *MemoryStore) RotateAPIKey(ctx context.Context, actor models.Actor, id string, successor *models.APIKey, hashedKey string, graceUntil time.Time) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.apiKeys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	if before.Revoked || before.ReplacedBy != "" || before.Expired(time.Now().UTC()) {
+		return nil, ErrAPIKeyInactive
+	}
+	if err := s.insertAPIKey(successor, hashedKey); err != nil {
+		return nil, err
+	}
+
+	after := cloneAPIKey(before)
+	after.ReplacedBy = successor.ID
+	graceUntil = graceUntil.UTC()
+	if after.ExpiresAt == nil || graceUntil.Before(*after.ExpiresAt) {
+		after.ExpiresAt = &graceUntil
+	}
+	s.apiKeys[id] = after
+	return cloneAPIKey(after), nil
+}
+
+// SetAPIKeyRateLimit changes a key's rate limit and burst.
+func (s *MemoryStore) SetAPIKeyRateLimit(ctx context.Context, actor models.Actor, id string, rate float64, burst int) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.apiKeys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	after := cloneAPIKey(before)
+	after.RateLimit, after.RateBurst = rate, burst
+	s.apiKeys[id] = after
+	return cloneAPIKey(after), nil
+}
+
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, actor models.Actor, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.apiKeys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	after := cloneAPIKey(before)
+	after.Revoked = true
+	s.apiKeys[id] = after
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// --- Copies ---
+
+// The store keeps its own copies of everything it is given and returns, so
+// callers can't change stored state by holding on to a pointer.
+
+func cloneFlag(f *models.Flag) *models.Flag {
+	out := *f
+	out.DefaultValue = append([]byte(nil), f.DefaultValue...)
+	if f.Rules != nil {
+		out.Rules = make([]models.Rule, len(f.Rules))
+		for i := range f.Rules {
+			out.Rules[i] = *cloneRule(&f.Rules[i])
+		}
+	}
+	out.Segments = nil
+	return &out
+}
+
+func cloneRule(r *models.Rule) *models.Rule {
+	out := *r
+	out.Value = append([]byte(nil), r.Value...)
+	out.Conditions = cloneConditions(r.Conditions)
+	if r.SegmentKeys != nil {
+		out.SegmentKeys = append([]string(nil), r.SegmentKeys...)
+	}
+	return &out
+}
+
+func cloneSegment(seg *models.Segment) *models.Segment {
+	out := *seg
+	out.Conditions = cloneConditions(seg.Conditions)
+	return &out
+}
+
+func cloneConditions(conds []models.Condition) []models.Condition {
+	if conds == nil {
+		return nil
+	}
+	out := make([]models.Condition, len(conds))
+	for i, c := range conds {
+		c.Value = append([]byte(nil), c.Value...)
+		out[i] = c
+	}
+	return out
+}
+
+func cloneAPIKey(k *models.APIKey) *models.APIKey {
+	out := *k
+	out.Scopes = append([]models.Scope(nil), k.Scopes...)
+	if k.ExpiresAt != nil {
+		t := *k.ExpiresAt
+		out.ExpiresAt = &t
+	}
+	if k.LastUsedAt != nil {
+		t := *k.LastUsedAt
+		out.LastUsedAt = &t
+	}
+	return &out
+}
@@ -0,0 +1,327 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Migration is a schema migration and its state in a database. Migration
+// files are named NNN_name.sql; the down migration reverting one is
+// NNN_name.down.sql. One that rebuilds a table has a line reading
+// "-- flaggy:foreign_keys=off".
+type Migration struct {
+	Name       string // File name of the up migration
+	Applied    bool
+	AppliedAt  time.Time
+	Reversible bool // Has a down migration
+	Modified   bool // Applied, but the file has changed since
+	Unknown    bool // Applied, but not a migration of this version of Flaggy
+}
+
+type migrationFile struct {
+	name     string
+	up, down string
+	checksum string // Of the up migration
+}
+
+// readMigrations returns the migrations in fsys, in the order they apply.
+func readMigrations(fsys fs.FS) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	files := map[string]*migrationFile{}
+	downs := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", e.Name(), err)
+		}
+		if up, ok := strings.CutSuffix(e.Name(), ".down.sql"); ok {
+			downs[up+".sql"] = string(data)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		files[e.Name()] = &migrationFile{name: e.Name(), up: string(data), checksum: hex.EncodeToString(sum[:])}
+	}
+	for name, down := range downs {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("down migration for %s has no up migration", name)
+		}
+		f.down = down
+	}
+
+	out := make([]migrationFile, 0, len(files))
+	for _, f := range files {
+		out = append(out, *f)
+	}
+	slices.SortFunc(out, func(a, b migrationFile) int { return strings.Compare(a.name, b.name) })
+	return out, nil
+}
+
+// Migrator applies and reverts the schema migrations in a filesystem.
+// Each migration runs in its own transaction, so a failing one leaves the
+// schema as it was before it.
+type Migrator struct {
+	db   *sql.DB
+	fsys fs.FS
+}
+
+// OpenMigrator opens the database at dbPath for managing its migrations.
+// With exclusive, it locks the database, failing with ErrDatabaseInUse if a
+// server has it open; take the lock to apply or revert migrations.
+func OpenMigrator(dbPath string, fsys fs.FS, exclusive bool) (*Migrator, error) {
+	var db *sql.DB
+	var err error
+	if exclusive {
+		db, err = openExclusive(dbPath)
+	} else {
+		db, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, fsys: fsys}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// applied returns the applied migrations by name, with their checksums.
+// Migrations applied before checksums were recorded have an empty one.
+func (m *Migrator) applied(ctx context.Context) (map[string]Migration, map[string]string, error) {
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		filename TEXT PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT (datetime('now')),
+		checksum TEXT NOT NULL DEFAULT ''
+	)`); err != nil {
+		return nil, nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var hasChecksum bool
+	if err := m.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) > 0 FROM pragma_table_info('schema_migrations') WHERE name = 'checksum'`).Scan(&hasChecksum); err != nil {
+		return nil, nil, fmt.Errorf("inspect schema_migrations: %w", err)
+	}
+	if !hasChecksum {
+		if _, err := m.db.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`); err != nil {
+			return nil, nil, fmt.Errorf("add checksum column: %w", err)
+		}
+	}
+	return readApplied(ctx, m.db)
+}
+
+// readApplied reads the applied migrations by name, with their checksums,
+// without writing to the database. A database without a schema_migrations
+// table has none applied.
+func readApplied(ctx context.Context, q querier) (map[string]Migration, map[string]string, error) {
+	applied := map[string]Migration{}
+	checksums := map[string]string{}
+	var hasTable bool
+	if err := q.QueryRowContext(ctx,
+		`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&hasTable); err != nil {
+		return nil, nil, fmt.Errorf("inspect schema_migrations: %w", err)
+	}
+	if !hasTable {
+		return applied, checksums, nil
+	}
+	var hasChecksum bool
+	if err := q.QueryRowContext(ctx,
+		`SELECT COUNT(*) > 0 FROM pragma_table_info('schema_migrations') WHERE name = 'checksum'`).Scan(&hasChecksum); err != nil {
+		return nil, nil, fmt.Errorf("inspect schema_migrations: %w", err)
+	}
+	checksum := "''"
+	if hasChecksum {
+		checksum = "checksum"
+	}
+	rows, err := q.QueryContext(ctx, `SELECT filename, applied_at, `+checksum+` FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mig Migration
+		var sum string
+		if err := rows.Scan(&mig.Name, &mig.AppliedAt, &sum); err != nil {
+			return nil, nil, fmt.Errorf("scan migration: %w", err)
+		}
+		mig.Applied = true
+		applied[mig.Name] = mig
+		checksums[mig.Name] = sum
+	}
+	return applied, checksums, rows.Err()
+}
+
+// Status returns every migration in the filesystem, in order, followed by
+// any applied migrations the filesystem doesn't have. It doesn't write to
+// the database.
+func (m *Migrator) Status(ctx context.Context) ([]Migration, error) {
+	files, err := readMigrations(m.fsys)
+	if err != nil {
+		return nil, err
+	}
+	applied, checksums, err := readApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Migration
+	for _, f := range files {
+		mig, ok := applied[f.name]
+		if !ok {
+			mig = Migration{Name: f.name}
+		}
+		mig.Reversible = f.down != ""
+		mig.Modified = ok && checksums[f.name] != "" && checksums[f.name] != f.checksum
+		out = append(out, mig)
+		delete(applied, f.name)
+	}
+	var unknown []Migration
+	for _, mig := range applied {
+		mig.Unknown = true
+		unknown = append(unknown, mig)
+	}
+	slices.SortFunc(unknown, func(a, b Migration) int { return strings.Compare(a.Name, b.Name) })
+	return append(out, unknown...), nil
+}
+
+// verify checks that every applied migration is in the filesystem,
+// unchanged. Checksums missing from migrations applied before they were
+// recorded are filled in.
+func (m *Migrator) verify(ctx context.Context) ([]migrationFile, map[string]Migration, error) {
+	files, err := readMigrations(m.fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, checksums, err := m.applied(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	known := map[string]bool{}
+	for _, f := range files {
+		known[f.name] = true
+		sum, ok := checksums[f.name]
+		switch {
+		case !ok:
+		case sum == "":
+			if _, err := m.db.ExecContext(ctx, `UPDATE schema_migrations SET checksum = ? WHERE filename = ?`, f.checksum, f.name); err != nil {
+				return nil, nil, fmt.Errorf("record checksum of %s: %w", f.name, err)
+			}
+		case sum != f.checksum:
+			return nil, nil, fmt.Errorf("migration %s was modified after it was applied (checksum mismatch)", f.name)
+		}
+	}
+	for name := range applied {
+		if !known[name] {
+			return nil, nil, fmt.Errorf("database has migration %s, which this version of Flaggy doesn't know; "+
+				"revert it with the version that applied it (flaggy migrate down)", name)
+		}
+	}
+	return files, applied, nil
+}
+
+// Up verifies the applied migrations and applies the pending ones, in
+// order. It returns the names of those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	files, applied, err := m.verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	for _, f := range files {
+		if _, ok := applied[f.name]; ok {
+			continue
+		}
+		if err := m.run(ctx, f.name, f.up, `INSERT INTO schema_migrations (filename, applied_at, checksum) VALUES (?, ?, ?)`,
+			f.name, time.Now().UTC(), f.checksum); err != nil {
+			return done, err
+		}
+		done = append(done, f.name)
+	}
+	return done, nil
+}
+
+// Down reverts the last n applied migrations, newest first. It returns the
+// names of those it reverted. Migrations without a down migration can't
+// be reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]string, error) {
+	files, applied, err := m.verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	for i := len(files) - 1; i >= 0 && len(done) < n; i-- {
+		f := files[i]
+		if _, ok := applied[f.name]; !ok {
+			continue
+		}
+		if f.down == "" {
+			return done, fmt.Errorf("migration %s has no down migration", f.name)
+		}
+		if err := m.run(ctx, f.name, f.down, `DELETE FROM schema_migrations WHERE filename = ?`, f.name); err != nil {
+			return done, err
+		}
+		done = append(done, f.name)
+	}
+	return done, nil
+}
+
+// noForeignKeys marks a migration that rebuilds a table. SQLite ignores
+// PRAGMA foreign_keys inside a transaction, so run turns enforcement off
+// around it; otherwise dropping the old table would cascade to, or fail on,
+// the rows referencing it.
+const noForeignKeys = "-- flaggy:foreign_keys=off"
+
+// run executes a migration and records it in one transaction. Migrations
+// marked noForeignKeys run with foreign keys off, and must leave none
+// violated.
+func (m *Migrator) run(ctx context.Context, name, script, record string, args ...any) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+	rebuild := strings.Contains(script, noForeignKeys)
+	if rebuild {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+			return fmt.Errorf("disable foreign keys: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys=ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("exec %s: %w", name, err)
+	}
+	if rebuild {
+		var table string
+		err := tx.QueryRowContext(ctx, "SELECT \"table\" FROM pragma_foreign_key_check").Scan(&table)
+		if err == nil {
+			return fmt.Errorf("exec %s: leaves rows of %s with dangling foreign keys", name, table)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("check foreign keys after %s: %w", name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("record migration %s: %w", name, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// ErrMissingSegments is returned when a promoted flag's rules reference
+// segments the target environment doesn't have.
+var ErrMissingSegments = errors.New("segments are missing in the target environment")
+
+// PromoteFlag replaces the flag with source's key with source, read from
+// another environment, as models.PromotedConfig describes, and returns the
+// changes made. With dryRun, or if the rules reference segments this store
+// doesn't have, nothing is written; the latter also returns
+// ErrMissingSegments.
+//
+// The write is audited and versioned as flag.promote.
+func (s *SQLiteStore) PromoteFlag(ctx context.Context, actor models.Actor, source *models.Flag, dryRun bool) (*models.Promotion, error) {
+	ctx, done := s.track(ctx, "promote_flag")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	previous, err := getFlag(ctx, tx, source.Key)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.Type != source.Type {
+		return nil, fmt.Errorf("flag %q: %w (%s → %s)", source.Key, ErrFlagTypeChange, previous.Type, source.Type)
+	}
+	fc := models.PromotedConfig(source, previous)
+
+	p := &models.Promotion{Key: source.Key, Changes: []models.Change{}}
+	if previous == nil {
+		p.Action = models.ConfigCreate
+		empty := models.FlagConfig{Key: fc.Key, Type: fc.Type}
+		p.Changes = append(p.Changes, models.DiffFlagConfigs(&empty, &fc)...)
+	} else {
+		before := models.FlagToConfig(previous)
+		if changes := models.DiffFlagConfigs(&before, &fc); len(changes) > 0 {
+			p.Action = models.ConfigUpdate
+			p.Changes = changes
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, rc := range fc.Rules {
+		for _, key := range rc.SegmentKeys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			seg, err := getSegment(ctx, tx, key)
+			if err != nil {
+				return nil, err
+			}
+			if seg == nil {
+				p.MissingSegments = append(p.MissingSegments, key)
+			}
+		}
+	}
+	if dryRun || p.Action == "" {
+		return p, nil
+	}
+	if len(p.MissingSegments) > 0 {
+		return p, fmt.Errorf("%w: %s", ErrMissingSegments, strings.Join(p.MissingSegments, ", "))
+	}
+
+	flag, err := writeFlagConfig(ctx, tx, p.Action, p.Changes, &fc, previous, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, actor, "flag.promote", flag); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "flag.promote", "flag", flag.Key, previous, flag); err != nil {
+		return nil, err
+	}
+	if err := out.add(ctx, tx, models.FlagReplacedEvents(previous, flag)...); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
+	}
+	p.Applied = true
+	p.Flag = flag
+	return p, nil
+}
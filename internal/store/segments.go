@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -12,18 +13,23 @@ import (
 
 var ErrSegmentInUse = errors.New("segment is referenced by one or more rules")
 
-func (s *SQLiteStore) CreateSegment(segment *models.Segment) error {
+func (s *SQLiteStore) CreateSegment(ctx context.Context, actor models.Actor, segment *models.Segment) error {
+	ctx, done := s.track(ctx, "create_segment")
+	defer done()
 	now := time.Now().UTC()
+	segment.Version = 1
 	segment.CreatedAt = now
 	segment.UpdatedAt = now
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
 
-	_, err = tx.Exec(
+	_, err = tx.ExecContext(ctx,
 		`INSERT INTO segments (key, description, created_at, updated_at)
 		 VALUES (?, ?, ?, ?)`,
 		segment.Key, segment.Description, segment.CreatedAt, segment.UpdatedAt,
@@ -35,7 +41,7 @@ func (s *SQLiteStore) CreateSegment(segment *models.Segment) error {
 	for i := range segment.Conditions {
 		c := &segment.Conditions[i]
 		c.CreatedAt = now
-		res, err := tx.Exec(
+		res, err := tx.ExecContext(ctx,
 			`INSERT INTO segment_conditions (segment_key, attribute, operator, value, created_at)
 			 VALUES (?, ?, ?, ?, ?)`,
 			segment.Key, c.Attribute, c.Operator, string(c.Value), c.CreatedAt,
@@ -47,14 +53,26 @@ func (s *SQLiteStore) CreateSegment(segment *models.Segment) error {
 		c.ID = cID
 	}
 
-	return tx.Commit()
+	if err := writeAudit(ctx, tx, actor, "segment.create", "segment", segment.Key, nil, segment); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("segment_created", "", segment)); err != nil {
+		return err
+	}
+	return out.commit(tx)
+}
+
+func (s *SQLiteStore) GetSegment(ctx context.Context, key string) (*models.Segment, error) {
+	ctx, done := s.track(ctx, "get_segment")
+	defer done()
+	return getSegment(ctx, s.db, key)
 }
 
-func (s *SQLiteStore) GetSegment(key string) (*models.Segment, error) {
+func getSegment(ctx context.Context, q querier, key string) (*models.Segment, error) {
 	seg := &models.Segment{}
-	err := s.db.QueryRow(
-		`SELECT key, description, created_at, updated_at FROM segments WHERE key = ?`, key,
-	).Scan(&seg.Key, &seg.Description, &seg.CreatedAt, &seg.UpdatedAt)
+	err := q.QueryRowContext(ctx,
+		`SELECT key, description, version, created_at, updated_at FROM segments WHERE key = ?`, key,
+	).Scan(&seg.Key, &seg.Description, &seg.Version, &seg.CreatedAt, &seg.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -62,7 +80,7 @@ func (s *SQLiteStore) GetSegment(key string) (*models.Segment, error) {
 		return nil, fmt.Errorf("get segment: %w", err)
 	}
 
-	conditions, err := s.getSegmentConditions(key)
+	conditions, err := getSegmentConditions(ctx, q, key)
 	if err != nil {
 		return nil, err
 	}
@@ -70,61 +88,100 @@ func (s *SQLiteStore) GetSegment(key string) (*models.Segment, error) {
 	return seg, nil
 }
 
-func (s *SQLiteStore) ListSegments() ([]models.Segment, error) {
-	rows, err := s.db.Query(
-		`SELECT key, description, created_at, updated_at FROM segments ORDER BY key`)
+func (s *SQLiteStore) ListSegments(ctx context.Context, opts models.ListOptions) ([]models.Segment, models.PageInfo, error) {
+	ctx, done := s.track(ctx, "list_segments")
+	defer done()
+
+	p, err := newListPage(opts, models.SegmentSorts)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	search, args := searchCondition("segments", opts.Query)
+	after, afterArgs, err := p.afterCondition("key")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	var info models.PageInfo
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM segments`+whereClause(search), args...).Scan(&info.Total); err != nil {
+		return nil, info, fmt.Errorf("count segments: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT key, description, version, created_at, updated_at
+		 FROM segments`+whereClause(search, after)+p.orderBy("key"),
+		append(args, afterArgs...)...)
 	if err != nil {
-		return nil, fmt.Errorf("list segments: %w", err)
+		return nil, info, fmt.Errorf("list segments: %w", err)
 	}
 	defer rows.Close()
 
 	var segments []models.Segment
 	for rows.Next() {
 		var seg models.Segment
-		if err := rows.Scan(&seg.Key, &seg.Description, &seg.CreatedAt, &seg.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("scan segment: %w", err)
+		if err := rows.Scan(&seg.Key, &seg.Description, &seg.Version, &seg.CreatedAt, &seg.UpdatedAt); err != nil {
+			return nil, info, fmt.Errorf("scan segment: %w", err)
 		}
 		segments = append(segments, seg)
 	}
-	return segments, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, info, err
+	}
+	segments, info.NextCursor = trim(p, segments, sortValue(segmentRow))
+	return segments, info, nil
 }
 
-func (s *SQLiteStore) UpdateSegment(key string, req *models.UpdateSegmentRequest) (*models.Segment, error) {
-	seg, err := s.GetSegment(key)
+func (s *SQLiteStore) UpdateSegment(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateSegmentRequest) (*models.Segment, error) {
+	ctx, done := s.track(ctx, "update_segment")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	before, err := getSegment(ctx, tx, key)
 	if err != nil {
 		return nil, err
 	}
-	if seg == nil {
+	if before == nil {
 		return nil, nil
 	}
+	if err := checkVersion(version, before.Version); err != nil {
+		return nil, err
+	}
+	after := *before
+	seg := &after
+	seg.Version++
 
 	if req.Description != nil {
 		seg.Description = *req.Description
 	}
 	seg.UpdatedAt = time.Now().UTC()
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("begin tx: %w", err)
-	}
-	defer tx.Rollback()
-
-	_, err = tx.Exec(
-		`UPDATE segments SET description = ?, updated_at = ? WHERE key = ?`,
-		seg.Description, seg.UpdatedAt, key,
+	res, err := tx.ExecContext(ctx,
+		`UPDATE segments SET description = ?, updated_at = ?, version = version + 1
+		 WHERE key = ? AND version = ?`,
+		seg.Description, seg.UpdatedAt, key, before.Version,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("update segment: %w", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrVersionMismatch
+	}
 
 	if req.Conditions != nil {
-		if _, err := tx.Exec(`DELETE FROM segment_conditions WHERE segment_key = ?`, key); err != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM segment_conditions WHERE segment_key = ?`, key); err != nil {
 			return nil, fmt.Errorf("delete segment conditions: %w", err)
 		}
 
 		seg.Conditions = make([]models.Condition, len(req.Conditions))
 		for i, c := range req.Conditions {
-			res, err := tx.Exec(
+			res, err := tx.ExecContext(ctx,
 				`INSERT INTO segment_conditions (segment_key, attribute, operator, value, created_at)
 				 VALUES (?, ?, ?, ?, ?)`,
 				key, c.Attribute, c.Operator, string(c.Value), seg.UpdatedAt,
@@ -143,16 +200,33 @@ func (s *SQLiteStore) UpdateSegment(key string, req *models.UpdateSegmentRequest
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
+	if err := writeAudit(ctx, tx, actor, "segment.update", "segment", key, before, seg); err != nil {
+		return nil, err
+	}
+	if err := out.add(ctx, tx, models.NewChangeEvent("segment_updated", "", seg)); err != nil {
+		return nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, err
 	}
 	return seg, nil
 }
 
-func (s *SQLiteStore) DeleteSegment(key string) error {
+func (s *SQLiteStore) DeleteSegment(ctx context.Context, actor models.Actor, key string, version int) error {
+	ctx, done := s.track(ctx, "delete_segment")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
 	// Check if segment is referenced by any rule
 	var count int
-	err := s.db.QueryRow(
+	err = tx.QueryRowContext(ctx,
 		`SELECT COUNT(*) FROM rule_segments WHERE segment_key = ?`, key,
 	).Scan(&count)
 	if err != nil {
@@ -162,19 +236,31 @@ func (s *SQLiteStore) DeleteSegment(key string) error {
 		return ErrSegmentInUse
 	}
 
-	res, err := s.db.Exec(`DELETE FROM segments WHERE key = ?`, key)
+	before, err := getSegment(ctx, tx, key)
 	if err != nil {
-		return fmt.Errorf("delete segment: %w", err)
+		return err
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	if before == nil {
 		return fmt.Errorf("segment not found")
 	}
-	return nil
+	if err := checkVersion(version, before.Version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM segments WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("delete segment: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "segment.delete", "segment", key, before, nil); err != nil {
+		return err
+	}
+	if err := out.add(ctx, tx, models.SegmentDeletedEvent(key)); err != nil {
+		return err
+	}
+	return out.commit(tx)
 }
 
-func (s *SQLiteStore) getSegmentConditions(segmentKey string) ([]models.Condition, error) {
-	rows, err := s.db.Query(
+func getSegmentConditions(ctx context.Context, q querier, segmentKey string) ([]models.Condition, error) {
+	rows, err := q.QueryContext(ctx,
 		`SELECT id, attribute, operator, value, created_at
 		 FROM segment_conditions WHERE segment_key = ? ORDER BY id`, segmentKey,
 	)
@@ -1,83 +1,117 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
+	"strings"
+	"sync"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/getflaggy/flaggy/internal/models"
 )
 
 // SQLiteStore implements Store using modernc.org/sqlite.
 type SQLiteStore struct {
-	db *sql.DB
+	db          *sql.DB
+	timeout     time.Duration
+	observer    QueryObserver
+	environment models.Environment
+
+	eventMu  sync.Mutex // held from a write's first event until its listener returns
+	onChange func([]models.ChangeEvent)
 }
 
-// NewSQLiteStore opens a SQLite database and runs all embedded migrations.
-func NewSQLiteStore(dbPath string, migrationsFS fs.FS) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("open db: %w", err)
-	}
+// SQLiteOptions configures a SQLiteStore.
+type SQLiteOptions struct {
+	// QueryTimeout bounds each store operation, including the time spent
+	// waiting for another connection's write lock. Zero means no timeout,
+	// with locks waited for up to 5s.
+	QueryTimeout time.Duration
+	// Environment is recorded on the change events of writes.
+	Environment models.Environment
+}
 
-	// Enable WAL mode and foreign keys
-	pragmas := []string{
-		"PRAGMA journal_mode=WAL",
-		"PRAGMA foreign_keys=ON",
-		"PRAGMA busy_timeout=5000",
+// querier is satisfied by both *sql.DB and *sql.Tx, so read helpers can run
+// inside a write transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// QueryObserver receives the latency of each store operation.
+type QueryObserver func(op string, d time.Duration)
+
+// SetQueryObserver installs fn to be called after every store operation.
+// Must be called before the store is shared between goroutines.
+func (s *SQLiteStore) SetQueryObserver(fn QueryObserver) {
+	s.observer = fn
+}
+
+// track starts op: it bounds ctx by the query timeout and starts timing.
+// Call the returned func when the operation finishes.
+func (s *SQLiteStore) track(ctx context.Context, op string) (context.Context, func()) {
+	cancel := context.CancelFunc(func() {})
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
 	}
-	for _, p := range pragmas {
-		if _, err := db.Exec(p); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("exec %s: %w", p, err)
-		}
+	if s.observer == nil {
+		return ctx, cancel
 	}
-
-	s := &SQLiteStore{db: db}
-	if err := s.migrate(migrationsFS); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("migrate: %w", err)
+	start := time.Now()
+	return ctx, func() {
+		cancel()
+		s.observer(op, time.Since(start))
 	}
-	return s, nil
 }
 
-func (s *SQLiteStore) migrate(fsys fs.FS) error {
-	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
-		filename TEXT PRIMARY KEY,
-		applied_at DATETIME NOT NULL DEFAULT (datetime('now'))
-	)`); err != nil {
-		return fmt.Errorf("create schema_migrations: %w", err)
+// IsBusy reports whether err is SQLite giving up on a lock held by another
+// connection.
+func IsBusy(err error) bool {
+	var se *sqlite.Error
+	return errors.As(err, &se) && se.Code()&0xff == sqlite3.SQLITE_BUSY
+}
+
+// NewSQLiteStore opens a SQLite database, verifies the applied migrations
+// and applies the pending ones.
+func NewSQLiteStore(dbPath string, migrationsFS fs.FS, opts SQLiteOptions) (*SQLiteStore, error) {
+	// SQLite's wait for a lock doesn't watch the context, so it is capped at
+	// the query timeout. Per-connection pragmas go in the DSN to apply to
+	// every connection in the pool.
+	busy := 5 * time.Second
+	if opts.QueryTimeout > 0 {
+		busy = opts.QueryTimeout
 	}
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	dsn := fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_pragma=foreign_keys(1)", dbPath, sep, busy.Milliseconds())
 
-	entries, err := fs.ReadDir(fsys, ".")
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
-		return fmt.Errorf("read migrations: %w", err)
+		return nil, fmt.Errorf("open db: %w", err)
 	}
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-
-		var count int
-		if err := s.db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE filename = ?", e.Name()).Scan(&count); err != nil {
-			return fmt.Errorf("check migration %s: %w", e.Name(), err)
-		}
-		if count > 0 {
-			continue
-		}
-
-		data, err := fs.ReadFile(fsys, e.Name())
-		if err != nil {
-			return fmt.Errorf("read %s: %w", e.Name(), err)
-		}
-		if _, err := s.db.Exec(string(data)); err != nil {
-			return fmt.Errorf("exec %s: %w", e.Name(), err)
-		}
-		if _, err := s.db.Exec("INSERT INTO schema_migrations (filename) VALUES (?)", e.Name()); err != nil {
-			return fmt.Errorf("record migration %s: %w", e.Name(), err)
-		}
+
+	// Enable WAL mode, which is kept in the database file
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("exec PRAGMA journal_mode=WAL: %w", err)
+	}
+
+	s := &SQLiteStore{db: db, timeout: opts.QueryTimeout, environment: opts.Environment}
+	m := &Migrator{db: db, fsys: migrationsFS}
+	if _, err := m.Up(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
 	}
-	return nil
+	return s, nil
 }
 
 func (s *SQLiteStore) Close() error {
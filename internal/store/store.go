@@ -1,37 +1,168 @@
 package store
 
-import "github.com/getflaggy/flaggy/internal/models"
+import (
+	"context"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
 
 // Store defines the persistence interface for flags and rules.
+// Write methods take the actor performing the change so implementations
+// can record it in the audit log. Updates and deletes take the version the
+// caller expects the resource to be at and return ErrVersionMismatch if it
+// has changed; a version of 0 skips the check. List methods return the page
+// selected by opts, with a cursor to the next one.
 type Store interface {
 	// Flags
-	CreateFlag(flag *models.Flag) error
-	GetFlag(key string) (*models.Flag, error)
-	ListFlags() ([]models.Flag, error)
-	UpdateFlag(key string, req *models.UpdateFlagRequest) (*models.Flag, error)
-	DeleteFlag(key string) error
-	ToggleFlag(key string) (*models.Flag, error)
+	CreateFlag(ctx context.Context, actor models.Actor, flag *models.Flag) error
+	GetFlag(ctx context.Context, key string) (*models.Flag, error)
+	ListFlags(ctx context.Context, opts models.ListOptions) ([]models.Flag, models.PageInfo, error)
+	UpdateFlag(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateFlagRequest) (*models.Flag, error)
+	DeleteFlag(ctx context.Context, actor models.Actor, key string, version int) error
+	ToggleFlag(ctx context.Context, actor models.Actor, key string, version int) (*models.Flag, error)
 
 	// Rules
-	CreateRule(flagKey string, rule *models.Rule) error
-	UpdateRule(flagKey string, ruleID int64, req *models.CreateRuleRequest) (*models.Rule, error)
-	DeleteRule(flagKey string, ruleID int64) error
+	CreateRule(ctx context.Context, actor models.Actor, flagKey string, rule *models.Rule) error
+	UpdateRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int, req *models.CreateRuleRequest) (*models.Rule, error)
+	DeleteRule(ctx context.Context, actor models.Actor, flagKey string, ruleID int64, version int) error
 
 	// Segments
-	CreateSegment(segment *models.Segment) error
-	GetSegment(key string) (*models.Segment, error)
-	ListSegments() ([]models.Segment, error)
-	UpdateSegment(key string, req *models.UpdateSegmentRequest) (*models.Segment, error)
-	DeleteSegment(key string) error
+	CreateSegment(ctx context.Context, actor models.Actor, segment *models.Segment) error
+	GetSegment(ctx context.Context, key string) (*models.Segment, error)
+	ListSegments(ctx context.Context, opts models.ListOptions) ([]models.Segment, models.PageInfo, error)
+	UpdateSegment(ctx context.Context, actor models.Actor, key string, version int, req *models.UpdateSegmentRequest) (*models.Segment, error)
+	DeleteSegment(ctx context.Context, actor models.Actor, key string, version int) error
 
 	// Evaluation
-	GetFlagForEvaluation(key string) (*models.Flag, error)
+	GetFlagForEvaluation(ctx context.Context, key string) (*models.Flag, error)
 
 	// API Keys
-	CreateAPIKey(key *models.APIKey, hashedKey string) error
-	ListAPIKeys() ([]models.APIKey, error)
-	ValidateAPIKey(hashedKey string) (*models.APIKey, error)
-	RevokeAPIKey(id string) error
+	CreateAPIKey(ctx context.Context, actor models.Actor, key *models.APIKey, hashedKey string) error
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, opts models.ListOptions) ([]models.APIKey, models.PageInfo, error)
+	ValidateAPIKey(ctx context.Context, hashedKey string) (*models.APIKey, error)
+	TouchAPIKeys(ctx context.Context, lastUsed map[string]time.Time) error
+	RotateAPIKey(ctx context.Context, actor models.Actor, id string, successor *models.APIKey, hashedKey string, graceUntil time.Time) (*models.APIKey, error)
+	SetAPIKeyRateLimit(ctx context.Context, actor models.Actor, id string, rate float64, burst int) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, actor models.Actor, id string) error
 
 	Close() error
 }
+
+// AuditLog is implemented by stores that record admin changes.
+// The API serves /audit only when the store implements it.
+type AuditLog interface {
+	ListAuditEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// FlagHistory is implemented by stores that keep versioned flag snapshots.
+// The API serves /flags/{key}/versions only when the store implements it.
+type FlagHistory interface {
+	ListFlagVersions(ctx context.Context, key string) ([]models.FlagVersion, error)
+	GetFlagVersion(ctx context.Context, key string, version int) (*models.FlagVersion, error)
+	RestoreFlagVersion(ctx context.Context, actor models.Actor, key string, version int) (restored, previous *models.Flag, err error)
+}
+
+// ChangeRequests is implemented by stores that support the change request
+// workflow. The API serves /change-requests and /environments/{env}/policy
+// only when the store implements it.
+type ChangeRequests interface {
+	GetEnvironmentPolicy(ctx context.Context, env models.Environment) (*models.EnvironmentPolicy, error)
+	SetEnvironmentPolicy(ctx context.Context, actor models.Actor, policy *models.EnvironmentPolicy) error
+
+	CreateChangeRequest(ctx context.Context, actor models.Actor, cr *models.ChangeRequest) error
+	GetChangeRequest(ctx context.Context, id int64) (*models.ChangeRequest, error)
+	ListChangeRequests(ctx context.Context, status models.ChangeStatus) ([]models.ChangeRequest, error)
+	ReviewChangeRequest(ctx context.Context, actor models.Actor, id int64, decision, comment string) (*models.ChangeRequest, error)
+	CompleteChangeRequest(ctx context.Context, id int64, applyErr string) (*models.ChangeRequest, error)
+}
+
+// Users is implemented by stores that keep named admin identities. Without
+// it, the master key is the only admin credential.
+type Users interface {
+	CreateUser(ctx context.Context, actor models.Actor, user *models.User) error
+	GetUser(ctx context.Context, idOrName string) (*models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	UpdateUser(ctx context.Context, actor models.Actor, idOrName string, req *models.UpdateUserRequest) (*models.User, error)
+	DeleteUser(ctx context.Context, actor models.Actor, idOrName string) error
+
+	CreateUserToken(ctx context.Context, actor models.Actor, token *models.UserToken, hashedToken string) error
+	ListUserTokens(ctx context.Context, userID string) ([]models.UserToken, error)
+	RevokeUserToken(ctx context.Context, actor models.Actor, userID, tokenID string) error
+	AuthenticateUserToken(ctx context.Context, hashedToken string) (user *models.User, tokenID string, err error)
+	TouchUserTokens(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+// Webhooks is implemented by stores that keep webhook endpoints and an
+// outbox of deliveries to them, queued by the writes that make the changes.
+// The API serves /webhooks only when the store implements it.
+type Webhooks interface {
+	CreateWebhook(ctx context.Context, actor models.Actor, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, actor models.Actor, id string) error
+
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, attempt models.WebhookAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) error
+
+	ListWebhookDeliveries(ctx context.Context, webhookID string, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, webhookID string, id int64) (*models.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, actor models.Actor, webhookID string, id int64) (*models.WebhookDelivery, error)
+}
+
+// EventLog is implemented by stores that keep published change events, so
+// that SSE clients can resume from the last event they saw. Events are
+// added to the log by the writes that make the changes.
+type EventLog interface {
+	EventsSince(ctx context.Context, seq int64, limit int) ([]models.ChangeEvent, error)
+	EventBounds(ctx context.Context) (oldest, latest int64, err error)
+	PruneEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// DeclarativeConfig is implemented by stores that can export every flag and
+// segment and apply a whole config in one transaction. The API serves
+// /config only when the store implements it.
+type DeclarativeConfig interface {
+	ExportConfig(ctx context.Context) (*models.Config, error)
+	ApplyConfig(ctx context.Context, actor models.Actor, cfg *models.Config, dryRun bool) (*models.ConfigPlan, error)
+}
+
+// Promotions is implemented by stores that can replace a flag with one read
+// from another environment. The API serves /flags/{key}/promote only when
+// the store implements it.
+type Promotions interface {
+	PromoteFlag(ctx context.Context, actor models.Actor, source *models.Flag, dryRun bool) (*models.Promotion, error)
+}
+
+// FlagTemplates is implemented by stores that keep flag templates. The API
+// serves /templates, and creates flags from templates, only when the store
+// implements it.
+type FlagTemplates interface {
+	CreateFlagTemplate(ctx context.Context, actor models.Actor, template *models.FlagTemplate) error
+	GetFlagTemplate(ctx context.Context, name string) (*models.FlagTemplate, error)
+	ListFlagTemplates(ctx context.Context) ([]models.FlagTemplate, error)
+	UpdateFlagTemplate(ctx context.Context, actor models.Actor, template *models.FlagTemplate) error
+	DeleteFlagTemplate(ctx context.Context, actor models.Actor, name string) error
+}
+
+// Backups is implemented by stores that can copy themselves to a file while
+// in use. The API serves /backup only when the store implements it.
+type Backups interface {
+	Backup(ctx context.Context, path string) error
+}
+
+// ReadOnly is implemented by stores that reject every write with
+// ErrReadOnly. The API then refuses writes without calling the store.
+type ReadOnly interface {
+	ReadOnly() bool
+}
+
+// ChangeFeed is implemented by stores that report each change to flags,
+// rules and segments as events, whether made through the API or, like
+// FileStore's reloads, outside it. The API publishes them to SSE and
+// WebSocket clients. Stores with an EventLog number the events; others
+// leave that to the listener.
+type ChangeFeed interface {
+	OnChange(fn func([]models.ChangeEvent))
+}
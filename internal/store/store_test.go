@@ -0,0 +1,452 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+	"github.com/getflaggy/flaggy/internal/store/storetest"
+	"github.com/getflaggy/flaggy/migrations"
+)
+
+// newTestStore opens a SQLite store on a new database in a temporary
+// directory and returns it with the database's path. The store is closed
+// when the test ends.
+func newTestStore(t *testing.T, opts store.SQLiteOptions) (*store.SQLiteStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flaggy.db")
+	return openTestStore(t, path, opts), path
+}
+
+// openTestStore opens a SQLite store on the database at path. The store is
+// closed when the test ends.
+func openTestStore(t *testing.T, path string, opts store.SQLiteOptions) *store.SQLiteStore {
+	t.Helper()
+	s, err := store.NewSQLiteStore(path, migrations.FS, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, _ := newTestStore(t, store.SQLiteOptions{})
+		return s
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+func TestSQLiteStore_QueryTimeout(t *testing.T) {
+	s, path := newTestStore(t, store.SQLiteOptions{QueryTimeout: 200 * time.Millisecond})
+
+	// Another connection holds the write lock
+	other, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer other.Close()
+	conn, err := other.Conn(t.Context())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(t.Context(), "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	flag := &models.Flag{Key: "new_checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	start := time.Now()
+	err = s.CreateFlag(t.Context(), models.ActorMasterKey, flag)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.True(t, store.IsBusy(err) || errors.Is(err, context.DeadlineExceeded), err.Error())
+
+	// Reads don't wait for the writer
+	_, _, err = s.ListFlags(t.Context(), models.ListOptions{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = s.GetFlag(ctx, "new_checkout")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSQLiteStore_FlagForEvaluationIsOneOperation(t *testing.T) {
+	s, _ := newTestStore(t, store.SQLiteOptions{})
+	ctx, actor := t.Context(), models.ActorMasterKey
+	require.NoError(t, s.CreateSegment(ctx, actor, &models.Segment{
+		Key:        "dutch",
+		Conditions: []models.Condition{{Attribute: "country", Operator: models.OpEquals, Value: json.RawMessage(`"NL"`)}},
+	}))
+	require.NoError(t, s.CreateFlag(ctx, actor, &models.Flag{Key: "checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}))
+	require.NoError(t, s.CreateRule(ctx, actor, "checkout", &models.Rule{
+		Value: json.RawMessage(`true`), RolloutPercentage: 100, SegmentKeys: []string{"dutch"},
+	}))
+
+	var ops []string
+	s.SetQueryObserver(func(op string, _ time.Duration) { ops = append(ops, op) })
+	flag, err := s.GetFlagForEvaluation(ctx, "checkout")
+	require.NoError(t, err)
+	require.Contains(t, flag.Segments, "dutch")
+	assert.Equal(t, []string{"get_flag_for_evaluation"}, ops)
+}
+
+func TestSQLiteStore_EventsInWriteTransaction(t *testing.T) {
+	s, path := newTestStore(t, store.SQLiteOptions{Environment: models.EnvStaging})
+	var published []models.ChangeEvent
+	s.OnChange(func(events []models.ChangeEvent) { published = append(published, events...) })
+	ctx, actor := t.Context(), models.ActorMasterKey
+	newFlag := func(key string) *models.Flag {
+		return &models.Flag{Key: key, Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	}
+
+	require.NoError(t, s.CreateFlag(ctx, actor, newFlag("logged")))
+	require.Len(t, published, 1)
+	assert.Equal(t, models.EnvStaging, published[0].Environment)
+
+	// The event log refuses the next event: the change is rolled back
+	other, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.ExecContext(ctx, `CREATE TRIGGER refuse_events BEFORE INSERT ON events BEGIN SELECT RAISE(ABORT, 'event log full'); END`)
+	require.NoError(t, err)
+
+	err = s.CreateFlag(ctx, actor, newFlag("lost"))
+	require.ErrorContains(t, err, "event log full")
+	flag, err := s.GetFlag(ctx, "lost")
+	require.NoError(t, err)
+	assert.Nil(t, flag)
+	entries, err := s.ListAuditEntries(ctx, models.AuditFilter{ResourceKey: "lost", Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Len(t, published, 1, "nothing is published for a rolled-back change")
+
+	// The next write works once the log does
+	_, err = other.ExecContext(ctx, `DROP TRIGGER refuse_events`)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateFlag(ctx, actor, newFlag("after")))
+	require.Len(t, published, 2)
+	assert.Equal(t, published[0].Seq+1, published[1].Seq)
+}
+
+func TestSQLiteStore_WebhookDeliveriesInWriteTransaction(t *testing.T) {
+	s, path := newTestStore(t, store.SQLiteOptions{})
+	var published []models.ChangeEvent
+	s.OnChange(func(events []models.ChangeEvent) { published = append(published, events...) })
+	ctx, actor := t.Context(), models.ActorMasterKey
+	newFlag := func(key string) *models.Flag {
+		return &models.Flag{Key: key, Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	}
+	require.NoError(t, s.CreateWebhook(ctx, actor, &models.Webhook{ID: "all", URL: "http://example.com/all"}))
+	require.NoError(t, s.CreateFlag(ctx, actor, newFlag("queued")))
+
+	// Queueing the delivery fails: the change and its event are rolled back
+	other, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.ExecContext(ctx, `CREATE TRIGGER refuse_deliveries BEFORE INSERT ON webhook_deliveries BEGIN SELECT RAISE(ABORT, 'outbox full'); END`)
+	require.NoError(t, err)
+
+	err = s.CreateFlag(ctx, actor, newFlag("lost"))
+	require.ErrorContains(t, err, "outbox full")
+	flag, err := s.GetFlag(ctx, "lost")
+	require.NoError(t, err)
+	assert.Nil(t, flag)
+	logged, err := s.EventsSince(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, logged, 1)
+	assert.Len(t, published, 1, "nothing is published for a rolled-back change")
+	due, err := s.DueWebhookDeliveries(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+}
+
+func TestSQLiteStore_BackupRestore(t *testing.T) {
+	s, dbPath := newTestStore(t, store.SQLiteOptions{})
+	flag := &models.Flag{Key: "new_checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	require.NoError(t, s.CreateFlag(t.Context(), models.ActorMasterKey, flag))
+
+	backup := filepath.Join(filepath.Dir(dbPath), "backup.db")
+	require.NoError(t, s.Backup(t.Context(), backup))
+	assert.Error(t, s.Backup(t.Context(), backup), "an existing file is not overwritten")
+
+	flag = &models.Flag{Key: "dark_mode", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	require.NoError(t, s.CreateFlag(t.Context(), models.ActorMasterKey, flag))
+
+	info, err := store.CheckBackup(backup, migrations.FS)
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Flags)
+	assert.Empty(t, info.Pending)
+
+	// Not while the store has the database open
+	_, err = store.Restore(dbPath, backup, migrations.FS)
+	require.ErrorIs(t, err, store.ErrDatabaseInUse)
+	require.NoError(t, s.Close())
+
+	_, err = store.Restore(dbPath, backup, migrations.FS)
+	require.NoError(t, err)
+
+	s = openTestStore(t, dbPath, store.SQLiteOptions{})
+	flags, _, err := s.ListFlags(t.Context(), models.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, flags, 1)
+	assert.Equal(t, "new_checkout", flags[0].Key)
+
+	// The replaced database is kept
+	info, err = store.CheckBackup(dbPath+".before-restore", migrations.FS)
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Flags)
+}
+
+func TestCheckBackup(t *testing.T) {
+	s, dbPath := newTestStore(t, store.SQLiteOptions{})
+	dir := filepath.Dir(dbPath)
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, s.Backup(t.Context(), backup))
+	require.NoError(t, s.Close())
+
+	// Older binaries don't know the latest migration
+	latest := "016_search.sql"
+	older := copyMigrations(t)
+	delete(older, latest)
+	delete(older, "016_search.down.sql")
+	_, err := store.CheckBackup(backup, older)
+	assert.ErrorContains(t, err, latest)
+
+	// Newer ones apply theirs when the server starts
+	newer := copyMigrations(t)
+	newer["999_future.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	info, err := store.CheckBackup(backup, newer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"999_future.sql"}, info.Pending)
+
+	// A migration changed since the backup was made is caught
+	changed := copyMigrations(t)
+	changed[latest].Data = append(changed[latest].Data, "\n-- edited"...)
+	_, err = store.CheckBackup(backup, changed)
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	notDB := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(notDB, []byte("not a database, just some text"), 0o644))
+	_, err = store.CheckBackup(notDB, migrations.FS)
+	assert.ErrorContains(t, err, "not a SQLite database")
+
+	// Other SQLite databases aren't Flaggy's
+	other := filepath.Join(dir, "other.db")
+	db, err := sql.Open("sqlite", other)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE notes (body TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	_, err = store.CheckBackup(other, migrations.FS)
+	assert.ErrorContains(t, err, "not a Flaggy database")
+}
+
+// copyMigrations returns a copy of the embedded migrations that a test can
+// change.
+func copyMigrations(t *testing.T) fstest.MapFS {
+	t.Helper()
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	require.NoError(t, err)
+	out := fstest.MapFS{}
+	for _, e := range entries {
+		data, err := fs.ReadFile(migrations.FS, e.Name())
+		require.NoError(t, err)
+		out[e.Name()] = &fstest.MapFile{Data: data}
+	}
+	return out
+}
+
+func TestMigrator(t *testing.T) {
+	s, dbPath := newTestStore(t, store.SQLiteOptions{})
+	flag := &models.Flag{Key: "new_checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`)}
+	require.NoError(t, s.CreateFlag(t.Context(), models.ActorMasterKey, flag))
+
+	// Not while the store has the database open
+	_, err := store.OpenMigrator(dbPath, migrations.FS, true)
+	require.ErrorIs(t, err, store.ErrDatabaseInUse)
+	require.NoError(t, s.Close())
+
+	m, err := store.OpenMigrator(dbPath, migrations.FS, true)
+	require.NoError(t, err)
+	status, err := m.Status(t.Context())
+	require.NoError(t, err)
+	require.NotEmpty(t, status)
+	for _, mig := range status {
+		assert.True(t, mig.Applied, mig.Name)
+		assert.True(t, mig.Reversible, mig.Name)
+		assert.False(t, mig.Modified, mig.Name)
+	}
+
+	// Every down migration reverts its up migration, all the way down
+	reverted, err := m.Down(t.Context(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{status[len(status)-1].Name, status[len(status)-2].Name, status[len(status)-3].Name}, reverted)
+	reverted, err = m.Down(t.Context(), len(status))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(status)-3)
+	applied, err := m.Up(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, applied, len(status))
+	require.NoError(t, m.Close())
+
+	// Reverting and reapplying a migration keeps the data it doesn't own
+	m, err = store.OpenMigrator(dbPath, migrations.FS, true)
+	require.NoError(t, err)
+	_, err = m.Down(t.Context(), 5)
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+	s = openTestStore(t, dbPath, store.SQLiteOptions{})
+	require.NoError(t, s.CreateFlag(t.Context(), models.ActorMasterKey, &models.Flag{
+		Key: "dark_mode", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`false`),
+	}))
+	flags, _, err := s.ListFlags(t.Context(), models.ListOptions{Query: "mode"})
+	require.NoError(t, err)
+	assert.Len(t, flags, 1)
+	require.NoError(t, s.Close())
+
+	// A migration edited after it was applied stops the store from opening
+	changed := copyMigrations(t)
+	changed["002_rollout.sql"].Data = append(changed["002_rollout.sql"].Data, "\n-- edited"...)
+	_, err = store.NewSQLiteStore(dbPath, changed, store.SQLiteOptions{})
+	assert.ErrorContains(t, err, "002_rollout.sql was modified")
+
+	// So does one this version doesn't know
+	older := copyMigrations(t)
+	delete(older, "016_search.sql")
+	delete(older, "016_search.down.sql")
+	_, err = store.NewSQLiteStore(dbPath, older, store.SQLiteOptions{})
+	assert.ErrorContains(t, err, "doesn't know")
+}
+
+func TestMigrator_FailedMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "flaggy.db")
+	broken := fstest.MapFS{
+		"001_notes.sql": &fstest.MapFile{Data: []byte("CREATE TABLE notes (body TEXT);")},
+		"002_tags.sql":  &fstest.MapFile{Data: []byte("CREATE TABLE tags (name TEXT); INSERT INTO missing VALUES (1);")},
+	}
+	m, err := store.OpenMigrator(dbPath, broken, true)
+	require.NoError(t, err)
+	defer m.Close()
+
+	applied, err := m.Up(t.Context())
+	assert.ErrorContains(t, err, "002_tags.sql")
+	assert.Equal(t, []string{"001_notes.sql"}, applied)
+
+	// The failed migration left nothing behind
+	status, err := m.Status(t.Context())
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+	assert.False(t, status[1].Reversible)
+	broken["002_tags.sql"].Data = []byte("CREATE TABLE tags (name TEXT);")
+	applied, err = m.Up(t.Context())
+	require.NoError(t, err, "tags was rolled back, so it can be created again")
+	assert.Equal(t, []string{"002_tags.sql"}, applied)
+
+	_, err = m.Down(t.Context(), 1)
+	assert.ErrorContains(t, err, "no down migration")
+}
+
+func TestMigrator_StatusIsReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "flaggy.db")
+	fsys := fstest.MapFS{
+		"001_notes.sql": &fstest.MapFile{Data: []byte("CREATE TABLE notes (body TEXT);")},
+		"002_tags.sql":  &fstest.MapFile{Data: []byte("CREATE TABLE tags (name TEXT);")},
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	columns := func() int {
+		t.Helper()
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('schema_migrations')`).Scan(&n))
+		return n
+	}
+
+	// Without a schema_migrations table nothing is applied
+	m, err := store.OpenMigrator(dbPath, fsys, false)
+	require.NoError(t, err)
+	defer m.Close()
+	status, err := m.Status(t.Context())
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.False(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+	assert.Zero(t, columns(), "the table isn't created")
+
+	// A table from before checksums is read without one
+	_, err = db.Exec(`CREATE TABLE schema_migrations (filename TEXT PRIMARY KEY, applied_at DATETIME NOT NULL DEFAULT (datetime('now')));
+		INSERT INTO schema_migrations (filename) VALUES ('001_notes.sql');`)
+	require.NoError(t, err)
+	status, err = m.Status(t.Context())
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[0].Modified)
+	assert.False(t, status[1].Applied)
+	assert.Equal(t, 2, columns(), "the checksum column isn't added")
+}
+
+func TestMigrator_TableRebuild(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "flaggy.db")
+	fsys := fstest.MapFS{
+		"001_teams.sql": &fstest.MapFile{Data: []byte(`
+			CREATE TABLE teams (id INTEGER PRIMARY KEY, name TEXT);
+			CREATE TABLE members (team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE);
+			INSERT INTO teams (id, name) VALUES (1, 'core');
+			INSERT INTO members (team_id) VALUES (1);`)},
+		"002_team_slugs.sql": &fstest.MapFile{Data: []byte(`ALTER TABLE teams ADD COLUMN slug TEXT REFERENCES teams(id);`)},
+		"002_team_slugs.down.sql": &fstest.MapFile{Data: []byte(`
+			-- flaggy:foreign_keys=off
+			CREATE TABLE teams_new (id INTEGER PRIMARY KEY, name TEXT);
+			INSERT INTO teams_new (id, name) SELECT id, name FROM teams;
+			DROP TABLE teams;
+			ALTER TABLE teams_new RENAME TO teams;`)},
+	}
+	m, err := store.OpenMigrator(dbPath, fsys, true)
+	require.NoError(t, err)
+	_, err = m.Up(t.Context())
+	require.NoError(t, err)
+
+	// Dropping teams doesn't cascade to members
+	_, err = m.Down(t.Context(), 1)
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+	defer db.Close()
+	var members int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM members`).Scan(&members))
+	assert.Equal(t, 1, members)
+
+	// A rebuild that leaves dangling references is rolled back
+	fsys["002_team_slugs.down.sql"].Data = []byte(`
+		-- flaggy:foreign_keys=off
+		CREATE TABLE teams_new (id INTEGER PRIMARY KEY, name TEXT, slug TEXT);
+		DROP TABLE teams;
+		ALTER TABLE teams_new RENAME TO teams;`)
+	m, err = store.OpenMigrator(dbPath, fsys, true)
+	require.NoError(t, err)
+	defer m.Close()
+	_, err = m.Up(t.Context())
+	require.NoError(t, err)
+	_, err = m.Down(t.Context(), 1)
+	assert.ErrorContains(t, err, "dangling foreign keys")
+	status, err := m.Status(t.Context())
+	require.NoError(t, err)
+	assert.True(t, status[1].Applied)
+}
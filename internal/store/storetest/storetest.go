@@ -0,0 +1,901 @@
+// Package storetest is a conformance suite for store.Store implementations.
+// Every implementation must pass it, so that the API behaves the same
+// whatever the backend:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store { return newMyStore(t) })
+//	}
+package storetest
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/models"
+	"github.com/getflaggy/flaggy/internal/store"
+)
+
+var actor = models.ActorMasterKey
+
+// Run runs the suite. newStore must return an empty store; it is called
+// once per test, and the store is closed when the test ends.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"Flags", testFlags},
+		{"FlagVersions", testFlagVersions},
+		{"RuleOrdering", testRuleOrdering},
+		{"RuleVersions", testRuleVersions},
+		{"RuleSegmentKeys", testRuleSegmentKeys},
+		{"CreateFlagWithRules", testCreateFlagWithRules},
+		{"SegmentInUse", testSegmentInUse},
+		{"CascadeDelete", testCascadeDelete},
+		{"Segments", testSegments},
+		{"FlagForEvaluation", testFlagForEvaluation},
+		{"APIKeyRevocation", testAPIKeyRevocation},
+		{"APIKeyRotation", testAPIKeyRotation},
+		{"Copies", testCopies},
+		{"ListPages", testListPages},
+		{"ListSearch", testListSearch},
+		{"ChangeEvents", testChangeEvents},
+		{"PromoteFlag", testPromoteFlag},
+		{"FlagTemplates", testFlagTemplates},
+		{"EventLog", testEventLog},
+		{"WebhookDeliveries", testWebhookDeliveries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() { s.Close() })
+			tt.fn(t, s)
+		})
+	}
+}
+
+func createFlag(t *testing.T, s store.Store, key string) *models.Flag {
+	t.Helper()
+	flag := &models.Flag{
+		Key:          key,
+		Type:         models.FlagTypeBoolean,
+		DefaultValue: json.RawMessage(`false`),
+	}
+	require.NoError(t, s.CreateFlag(t.Context(), actor, flag))
+	return flag
+}
+
+func createRule(t *testing.T, s store.Store, flagKey string, priority int, segmentKeys ...string) *models.Rule {
+	t.Helper()
+	rule := &models.Rule{
+		Value:             json.RawMessage(`true`),
+		Priority:          priority,
+		RolloutPercentage: 100,
+		Conditions:        []models.Condition{{Attribute: "plan", Operator: models.OpEquals, Value: json.RawMessage(`"pro"`)}},
+		SegmentKeys:       segmentKeys,
+	}
+	require.NoError(t, s.CreateRule(t.Context(), actor, flagKey, rule))
+	return rule
+}
+
+func createSegment(t *testing.T, s store.Store, key string) *models.Segment {
+	t.Helper()
+	seg := &models.Segment{
+		Key:        key,
+		Conditions: []models.Condition{{Attribute: "country", Operator: models.OpEquals, Value: json.RawMessage(`"NL"`)}},
+	}
+	require.NoError(t, s.CreateSegment(t.Context(), actor, seg))
+	return seg
+}
+
+func ruleIDs(rules []models.Rule) []int64 {
+	ids := make([]int64, len(rules))
+	for i, r := range rules {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func testFlags(t *testing.T, s store.Store) {
+	flag := createFlag(t, s, "new_checkout")
+	assert.Equal(t, 1, flag.Version)
+	assert.False(t, flag.CreatedAt.IsZero())
+	assert.Error(t, s.CreateFlag(t.Context(), actor, &models.Flag{Key: "new_checkout", Type: models.FlagTypeBoolean, DefaultValue: json.RawMessage(`true`)}))
+
+	got, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, models.FlagTypeBoolean, got.Type)
+	assert.JSONEq(t, `false`, string(got.DefaultValue))
+	assert.Empty(t, got.Rules)
+
+	missing, err := s.GetFlag(t.Context(), "missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	createFlag(t, s, "dark_mode")
+	flags, _, err := s.ListFlags(t.Context(), models.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, flags, 2)
+	assert.Equal(t, "dark_mode", flags[0].Key)
+	assert.Equal(t, "new_checkout", flags[1].Key)
+
+	desc := "Checkout redesign"
+	updated, err := s.UpdateFlag(t.Context(), actor, "new_checkout", 0, &models.UpdateFlagRequest{Description: &desc})
+	require.NoError(t, err)
+	assert.Equal(t, desc, updated.Description)
+	_, err = s.UpdateFlag(t.Context(), actor, "new_checkout", 0, &models.UpdateFlagRequest{DefaultValue: json.RawMessage(`"yes"`)})
+	assert.Error(t, err)
+	missing, err = s.UpdateFlag(t.Context(), actor, "missing", 0, &models.UpdateFlagRequest{Description: &desc})
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	toggled, err := s.ToggleFlag(t.Context(), actor, "new_checkout", 0)
+	require.NoError(t, err)
+	assert.True(t, toggled.Enabled)
+	missing, err = s.ToggleFlag(t.Context(), actor, "missing", 0)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, s.DeleteFlag(t.Context(), actor, "dark_mode", 0))
+	assert.Error(t, s.DeleteFlag(t.Context(), actor, "dark_mode", 0))
+	got, err = s.GetFlag(t.Context(), "dark_mode")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func testFlagVersions(t *testing.T, s store.Store) {
+	flag := createFlag(t, s, "new_checkout")
+	require.Equal(t, 1, flag.Version)
+
+	_, err := s.ToggleFlag(t.Context(), actor, "new_checkout", 2)
+	assert.ErrorIs(t, err, store.ErrVersionMismatch)
+	toggled, err := s.ToggleFlag(t.Context(), actor, "new_checkout", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, toggled.Version)
+
+	// Rule changes bump the flag's version
+	createRule(t, s, "new_checkout", 0)
+	got, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.Version)
+
+	assert.ErrorIs(t, s.DeleteFlag(t.Context(), actor, "new_checkout", 1), store.ErrVersionMismatch)
+	require.NoError(t, s.DeleteFlag(t.Context(), actor, "new_checkout", 3))
+
+	// A recreated flag continues the old one's versions
+	flag = createFlag(t, s, "new_checkout")
+	assert.Greater(t, flag.Version, 3)
+}
+
+func testRuleOrdering(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	r1 := createRule(t, s, "new_checkout", 10)
+	r2 := createRule(t, s, "new_checkout", 0)
+	r3 := createRule(t, s, "new_checkout", 10)
+	r4 := createRule(t, s, "new_checkout", 5)
+
+	// By priority, then in creation order
+	flag, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{r2.ID, r4.ID, r1.ID, r3.ID}, ruleIDs(flag.Rules))
+
+	_, err = s.UpdateRule(t.Context(), actor, "new_checkout", r3.ID, 0, &models.CreateRuleRequest{
+		Value:             json.RawMessage(`true`),
+		Priority:          1,
+		RolloutPercentage: 100,
+	})
+	require.NoError(t, err)
+	flag, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{r2.ID, r3.ID, r4.ID, r1.ID}, ruleIDs(flag.Rules))
+
+	require.NoError(t, s.DeleteRule(t.Context(), actor, "new_checkout", r4.ID, 0))
+	flag, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{r2.ID, r3.ID, r1.ID}, ruleIDs(flag.Rules))
+}
+
+func testRuleVersions(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	rule := createRule(t, s, "new_checkout", 0)
+	assert.Equal(t, 1, rule.Version)
+	assert.NotZero(t, rule.ID)
+	assert.Equal(t, "new_checkout", rule.FlagKey)
+	require.Len(t, rule.Conditions, 1)
+	assert.Equal(t, rule.ID, rule.Conditions[0].RuleID)
+
+	req := &models.CreateRuleRequest{
+		Value:             json.RawMessage(`false`),
+		RolloutPercentage: 50,
+		Conditions:        []models.Condition{{Attribute: "plan", Operator: models.OpEquals, Value: json.RawMessage(`"team"`)}},
+	}
+	_, err := s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID, 2, req)
+	assert.ErrorIs(t, err, store.ErrVersionMismatch)
+	updated, err := s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID, 1, req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, rule.CreatedAt, updated.CreatedAt)
+
+	flag, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	require.Len(t, flag.Rules, 1)
+	assert.Equal(t, 50, flag.Rules[0].RolloutPercentage)
+	require.Len(t, flag.Rules[0].Conditions, 1)
+	assert.JSONEq(t, `"team"`, string(flag.Rules[0].Conditions[0].Value))
+
+	_, err = s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID+100, 0, req)
+	assert.Error(t, err)
+	assert.ErrorIs(t, s.DeleteRule(t.Context(), actor, "new_checkout", rule.ID, 1), store.ErrVersionMismatch)
+	require.NoError(t, s.DeleteRule(t.Context(), actor, "new_checkout", rule.ID, 2))
+	assert.Error(t, s.DeleteRule(t.Context(), actor, "new_checkout", rule.ID, 0))
+}
+
+func testCreateFlagWithRules(t *testing.T, s store.Store) {
+	createSegment(t, s, "pro_users")
+	newFlag := func(segmentKey string) *models.Flag {
+		return &models.Flag{
+			Key:          "new_checkout",
+			Type:         models.FlagTypeBoolean,
+			DefaultValue: json.RawMessage(`false`),
+			Rules: []models.Rule{
+				{Value: json.RawMessage(`true`), Priority: 1, RolloutPercentage: 10, SegmentKeys: []string{segmentKey}},
+				{Value: json.RawMessage(`true`), RolloutPercentage: 100, Conditions: []models.Condition{
+					{Attribute: "email", Operator: models.OpContains, Value: json.RawMessage(`"@example.com"`)},
+				}},
+			},
+		}
+	}
+
+	// A missing segment fails the whole create
+	err := s.CreateFlag(t.Context(), actor, newFlag("missing"))
+	assert.ErrorContains(t, err, `segment "missing" not found`)
+	got, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	flag := newFlag("pro_users")
+	require.NoError(t, s.CreateFlag(t.Context(), actor, flag))
+	assert.Equal(t, 1, flag.Version)
+	require.Len(t, flag.Rules, 2)
+	assert.NotZero(t, flag.Rules[0].ID)
+
+	got, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Version)
+	require.Len(t, got.Rules, 2)
+	assert.Equal(t, 0, got.Rules[0].Priority, "rules are in evaluation order")
+	assert.Equal(t, "email", got.Rules[0].Conditions[0].Attribute)
+	assert.Equal(t, 1, got.Rules[0].Version)
+	assert.Equal(t, []string{"pro_users"}, got.Rules[1].SegmentKeys)
+	assert.Equal(t, 10, got.Rules[1].RolloutPercentage)
+}
+
+func testRuleSegmentKeys(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	createSegment(t, s, "pro_users")
+	createSegment(t, s, "beta_users")
+
+	// Every referenced segment must exist, and nothing is written otherwise
+	err := s.CreateRule(t.Context(), actor, "new_checkout", &models.Rule{
+		Value:             json.RawMessage(`true`),
+		RolloutPercentage: 100,
+		SegmentKeys:       []string{"pro_users", "missing"},
+	})
+	assert.ErrorContains(t, err, `segment "missing" not found`)
+	flag, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Empty(t, flag.Rules)
+
+	rule := createRule(t, s, "new_checkout", 0, "pro_users", "beta_users")
+	flag, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	require.Len(t, flag.Rules, 1)
+	assert.ElementsMatch(t, []string{"pro_users", "beta_users"}, flag.Rules[0].SegmentKeys)
+
+	_, err = s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID, 0, &models.CreateRuleRequest{
+		Value:             json.RawMessage(`true`),
+		RolloutPercentage: 100,
+		SegmentKeys:       []string{"missing"},
+	})
+	assert.ErrorContains(t, err, `segment "missing" not found`)
+	flag, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, 1, flag.Rules[0].Version)
+	assert.ElementsMatch(t, []string{"pro_users", "beta_users"}, flag.Rules[0].SegmentKeys)
+
+	_, err = s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID, 0, &models.CreateRuleRequest{
+		Value:             json.RawMessage(`true`),
+		RolloutPercentage: 100,
+		SegmentKeys:       []string{"beta_users"},
+	})
+	require.NoError(t, err)
+	flag, err = s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"beta_users"}, flag.Rules[0].SegmentKeys)
+}
+
+func testSegmentInUse(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	createSegment(t, s, "pro_users")
+	rule := createRule(t, s, "new_checkout", 0, "pro_users")
+
+	assert.ErrorIs(t, s.DeleteSegment(t.Context(), actor, "pro_users", 0), store.ErrSegmentInUse)
+	seg, err := s.GetSegment(t.Context(), "pro_users")
+	require.NoError(t, err)
+	assert.NotNil(t, seg)
+
+	// Once no rule references it, it can go
+	_, err = s.UpdateRule(t.Context(), actor, "new_checkout", rule.ID, 0, &models.CreateRuleRequest{
+		Value:             json.RawMessage(`true`),
+		RolloutPercentage: 100,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteSegment(t.Context(), actor, "pro_users", 0))
+	assert.Error(t, s.DeleteSegment(t.Context(), actor, "pro_users", 0))
+}
+
+func testCascadeDelete(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	createSegment(t, s, "pro_users")
+	rule := createRule(t, s, "new_checkout", 0, "pro_users")
+
+	// Deleting a flag deletes its rules and their segment references
+	require.NoError(t, s.DeleteFlag(t.Context(), actor, "new_checkout", 0))
+	require.NoError(t, s.DeleteSegment(t.Context(), actor, "pro_users", 0))
+
+	createFlag(t, s, "new_checkout")
+	flag, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Empty(t, flag.Rules)
+	assert.Error(t, s.DeleteRule(t.Context(), actor, "new_checkout", rule.ID, 0))
+}
+
+func testSegments(t *testing.T, s store.Store) {
+	seg := createSegment(t, s, "pro_users")
+	assert.Equal(t, 1, seg.Version)
+	require.Len(t, seg.Conditions, 1)
+	assert.NotZero(t, seg.Conditions[0].ID)
+	assert.Error(t, s.CreateSegment(t.Context(), actor, &models.Segment{Key: "pro_users"}))
+
+	createSegment(t, s, "beta_users")
+	segments, _, err := s.ListSegments(t.Context(), models.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, "beta_users", segments[0].Key)
+
+	// Conditions are kept unless the update replaces them
+	desc := "Paying customers"
+	updated, err := s.UpdateSegment(t.Context(), actor, "pro_users", 1, &models.UpdateSegmentRequest{Description: &desc})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	got, err := s.GetSegment(t.Context(), "pro_users")
+	require.NoError(t, err)
+	assert.Equal(t, desc, got.Description)
+	assert.Len(t, got.Conditions, 1)
+
+	_, err = s.UpdateSegment(t.Context(), actor, "pro_users", 1, &models.UpdateSegmentRequest{Description: &desc})
+	assert.ErrorIs(t, err, store.ErrVersionMismatch)
+	_, err = s.UpdateSegment(t.Context(), actor, "pro_users", 2, &models.UpdateSegmentRequest{Conditions: []models.Condition{
+		{Attribute: "plan", Operator: models.OpIn, Value: json.RawMessage(`["pro","team"]`)},
+		{Attribute: "country", Operator: models.OpNotEquals, Value: json.RawMessage(`"US"`)},
+	}})
+	require.NoError(t, err)
+	got, err = s.GetSegment(t.Context(), "pro_users")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.Version)
+	require.Len(t, got.Conditions, 2)
+	assert.Equal(t, "plan", got.Conditions[0].Attribute)
+
+	missing, err := s.UpdateSegment(t.Context(), actor, "missing", 0, &models.UpdateSegmentRequest{Description: &desc})
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	assert.ErrorIs(t, s.DeleteSegment(t.Context(), actor, "pro_users", 1), store.ErrVersionMismatch)
+	require.NoError(t, s.DeleteSegment(t.Context(), actor, "pro_users", 3))
+	got, err = s.GetSegment(t.Context(), "pro_users")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func testFlagForEvaluation(t *testing.T, s store.Store) {
+	createFlag(t, s, "new_checkout")
+	createSegment(t, s, "pro_users")
+	createSegment(t, s, "beta_users")
+	createRule(t, s, "new_checkout", 0, "pro_users")
+	createRule(t, s, "new_checkout", 1)
+
+	flag, err := s.GetFlagForEvaluation(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	require.Len(t, flag.Rules, 2)
+	require.Len(t, flag.Segments, 1)
+	assert.Equal(t, "pro_users", flag.Segments["pro_users"].Key)
+	assert.Len(t, flag.Segments["pro_users"].Conditions, 1)
+
+	createFlag(t, s, "dark_mode")
+	flag, err = s.GetFlagForEvaluation(t.Context(), "dark_mode")
+	require.NoError(t, err)
+	assert.Empty(t, flag.Segments)
+
+	flag, err = s.GetFlagForEvaluation(t.Context(), "missing")
+	require.NoError(t, err)
+	assert.Nil(t, flag)
+}
+
+func newAPIKey(id string) *models.APIKey {
+	return &models.APIKey{
+		ID:          id,
+		Name:        id,
+		Environment: models.EnvLive,
+		Scopes:      models.DefaultScopes,
+		Prefix:      "fgy_live_" + id[:4],
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func testAPIKeyRevocation(t *testing.T, s store.Store) {
+	require.NoError(t, s.CreateAPIKey(t.Context(), actor, newAPIKey("key_1"), "hash_1"))
+
+	got, err := s.ValidateAPIKey(t.Context(), "hash_1")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "key_1", got.ID)
+	assert.Equal(t, models.DefaultScopes, got.Scopes)
+
+	got, err = s.ValidateAPIKey(t.Context(), "hash_unknown")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	require.NoError(t, s.RevokeAPIKey(t.Context(), actor, "key_1"))
+	got, err = s.ValidateAPIKey(t.Context(), "hash_1")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// A revoked key is still listed, and revoking it again is harmless
+	got, err = s.GetAPIKey(t.Context(), "key_1")
+	require.NoError(t, err)
+	assert.True(t, got.Revoked)
+	require.NoError(t, s.RevokeAPIKey(t.Context(), actor, "key_1"))
+	assert.ErrorIs(t, s.RevokeAPIKey(t.Context(), actor, "key_unknown"), store.ErrAPIKeyNotFound)
+
+	// Expired keys don't validate either
+	expired := newAPIKey("key_2")
+	past := time.Now().UTC().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	require.NoError(t, s.CreateAPIKey(t.Context(), actor, expired, "hash_2"))
+	got, err = s.ValidateAPIKey(t.Context(), "hash_2")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	keys, _, err := s.ListAPIKeys(t.Context(), models.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+}
+
+func testAPIKeyRotation(t *testing.T, s store.Store) {
+	require.NoError(t, s.CreateAPIKey(t.Context(), actor, newAPIKey("key_1"), "hash_1"))
+
+	grace := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	rotated, err := s.RotateAPIKey(t.Context(), actor, "key_1", newAPIKey("key_2"), "hash_2", grace)
+	require.NoError(t, err)
+	assert.Equal(t, "key_2", rotated.ReplacedBy)
+	require.NotNil(t, rotated.ExpiresAt)
+	assert.True(t, grace.Equal(*rotated.ExpiresAt))
+
+	// Both keys work during the grace period, but the old one can't be
+	// rotated again
+	for _, hash := range []string{"hash_1", "hash_2"} {
+		got, err := s.ValidateAPIKey(t.Context(), hash)
+		require.NoError(t, err)
+		assert.NotNil(t, got, hash)
+	}
+	_, err = s.RotateAPIKey(t.Context(), actor, "key_1", newAPIKey("key_3"), "hash_3", grace)
+	assert.ErrorIs(t, err, store.ErrAPIKeyInactive)
+	_, err = s.RotateAPIKey(t.Context(), actor, "key_unknown", newAPIKey("key_3"), "hash_3", grace)
+	assert.ErrorIs(t, err, store.ErrAPIKeyNotFound)
+
+	limited, err := s.SetAPIKeyRateLimit(t.Context(), actor, "key_2", 5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, limited.RateLimit)
+	assert.Equal(t, 10, limited.RateBurst)
+
+	used := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, s.TouchAPIKeys(t.Context(), map[string]time.Time{"key_2": used}))
+	require.NoError(t, s.TouchAPIKeys(t.Context(), map[string]time.Time{"key_2": used.Add(-time.Hour)}))
+	got, err := s.GetAPIKey(t.Context(), "key_2")
+	require.NoError(t, err)
+	require.NotNil(t, got.LastUsedAt)
+	assert.True(t, used.Equal(*got.LastUsedAt))
+}
+
+func testCopies(t *testing.T, s store.Store) {
+	flag := createFlag(t, s, "new_checkout")
+	createRule(t, s, "new_checkout", 0)
+
+	// Changing what the store was given or returned doesn't change the store
+	flag.Description = "changed"
+	got, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	got.Rules[0].Conditions[0].Attribute = "changed"
+	got.Rules[0].Priority = 99
+
+	again, err := s.GetFlag(t.Context(), "new_checkout")
+	require.NoError(t, err)
+	assert.Empty(t, again.Description)
+	assert.Equal(t, "plan", again.Rules[0].Conditions[0].Attribute)
+	assert.Equal(t, 0, again.Rules[0].Priority)
+}
+
+func flagKeys(flags []models.Flag) []string {
+	keys := make([]string, len(flags))
+	for i, f := range flags {
+		keys[i] = f.Key
+	}
+	return keys
+}
+
+// listAllFlags follows cursors from the first page to the last.
+func listAllFlags(t *testing.T, s store.Store, opts models.ListOptions) []string {
+	t.Helper()
+	var keys []string
+	for range 10 {
+		flags, info, err := s.ListFlags(t.Context(), opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(flags), opts.Limit)
+		keys = append(keys, flagKeys(flags)...)
+		if info.NextCursor == "" {
+			return keys
+		}
+		opts.Cursor = info.NextCursor
+	}
+	t.Fatal("cursors never reached the last page")
+	return nil
+}
+
+func testListPages(t *testing.T, s store.Store) {
+	for _, key := range []string{"flag_c", "flag_a", "flag_e", "flag_b", "flag_d"} {
+		createFlag(t, s, key)
+	}
+
+	flags, info, err := s.ListFlags(t.Context(), models.ListOptions{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"flag_a", "flag_b"}, flagKeys(flags))
+	assert.Equal(t, 5, info.Total)
+	assert.NotEmpty(t, info.NextCursor)
+
+	assert.Equal(t, []string{"flag_a", "flag_b", "flag_c", "flag_d", "flag_e"},
+		listAllFlags(t, s, models.ListOptions{Limit: 2}))
+	assert.Equal(t, []string{"flag_e", "flag_d", "flag_c", "flag_b", "flag_a"},
+		listAllFlags(t, s, models.ListOptions{Sort: "-key", Limit: 2}))
+
+	// The last page exactly filling the limit has no next cursor
+	flags, info, err = s.ListFlags(t.Context(), models.ListOptions{Limit: 5})
+	require.NoError(t, err)
+	assert.Len(t, flags, 5)
+	assert.Empty(t, info.NextCursor)
+
+	// The most recently updated flag sorts last
+	desc := "Touched"
+	_, err = s.UpdateFlag(t.Context(), actor, "flag_b", 0, &models.UpdateFlagRequest{Description: &desc})
+	require.NoError(t, err)
+	byUpdate := listAllFlags(t, s, models.ListOptions{Sort: "updated_at", Limit: 2})
+	require.Len(t, byUpdate, 5)
+	assert.Equal(t, "flag_b", byUpdate[4])
+	assert.ElementsMatch(t, []string{"flag_a", "flag_b", "flag_c", "flag_d", "flag_e"}, byUpdate)
+
+	// Cursors are only valid for the sort they were issued for
+	_, info, err = s.ListFlags(t.Context(), models.ListOptions{Limit: 2})
+	require.NoError(t, err)
+	_, _, err = s.ListFlags(t.Context(), models.ListOptions{Sort: "-key", Cursor: info.NextCursor, Limit: 2})
+	assert.ErrorIs(t, err, store.ErrInvalidCursor)
+	_, _, err = s.ListFlags(t.Context(), models.ListOptions{Cursor: "not a cursor", Limit: 2})
+	assert.ErrorIs(t, err, store.ErrInvalidCursor)
+	_, _, err = s.ListFlags(t.Context(), models.ListOptions{Sort: "type"})
+	assert.Error(t, err)
+
+	// API keys list newest first, with ties broken by ID
+	for _, id := range []string{"key_1", "key_2", "key_3"} {
+		require.NoError(t, s.CreateAPIKey(t.Context(), actor, newAPIKey(id), "hash_"+id))
+	}
+	keys, info, err := s.ListAPIKeys(t.Context(), models.ListOptions{Sort: "name", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "key_1", keys[0].ID)
+	assert.Equal(t, 3, info.Total)
+	keys, info, err = s.ListAPIKeys(t.Context(), models.ListOptions{Sort: "name", Cursor: info.NextCursor, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "key_3", keys[0].ID)
+	assert.Empty(t, info.NextCursor)
+}
+
+func testListSearch(t *testing.T, s store.Store) {
+	for key, desc := range map[string]string{
+		"new_checkout":  "Checkout redesign",
+		"dark_mode":     "Dark UI theme",
+		"search_v2":     "New search backend, replaces the checkout search",
+		"pricing_table": "",
+	} {
+		flag := createFlag(t, s, key)
+		_, err := s.UpdateFlag(t.Context(), actor, flag.Key, 0, &models.UpdateFlagRequest{Description: &desc})
+		require.NoError(t, err)
+	}
+
+	// Matches keys and descriptions, ignoring case
+	flags, info, err := s.ListFlags(t.Context(), models.ListOptions{Query: "CHECKOUT"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new_checkout", "search_v2"}, flagKeys(flags))
+	assert.Equal(t, 2, info.Total)
+
+	flags, _, err = s.ListFlags(t.Context(), models.ListOptions{Query: "mode"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dark_mode"}, flagKeys(flags))
+
+	// Queries too short for a trigram still match
+	flags, _, err = s.ListFlags(t.Context(), models.ListOptions{Query: "ui"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dark_mode"}, flagKeys(flags))
+
+	// LIKE wildcards are literal
+	flags, _, err = s.ListFlags(t.Context(), models.ListOptions{Query: "_v"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"search_v2"}, flagKeys(flags))
+	flags, _, err = s.ListFlags(t.Context(), models.ListOptions{Query: "%"})
+	require.NoError(t, err)
+	assert.Empty(t, flags)
+
+	// The search follows updates and deletes
+	desc := "Checkout pricing"
+	_, err = s.UpdateFlag(t.Context(), actor, "pricing_table", 0, &models.UpdateFlagRequest{Description: &desc})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteFlag(t.Context(), actor, "new_checkout", 0))
+	assert.Equal(t, []string{"pricing_table", "search_v2"},
+		listAllFlags(t, s, models.ListOptions{Query: "checkout", Limit: 1}))
+
+	createSegment(t, s, "beta_users")
+	createSegment(t, s, "pro_users")
+	segments, info, err := s.ListSegments(t.Context(), models.ListOptions{Query: "pro_"})
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, "pro_users", segments[0].Key)
+	assert.Equal(t, 1, info.Total)
+
+	require.NoError(t, s.CreateAPIKey(t.Context(), actor, newAPIKey("key_ci"), "hash_ci"))
+	require.NoError(t, s.CreateAPIKey(t.Context(), actor, newAPIKey("key_web"), "hash_web"))
+	keys, _, err := s.ListAPIKeys(t.Context(), models.ListOptions{Query: "WEB"})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "key_web", keys[0].ID)
+}
+
+func testChangeEvents(t *testing.T, s store.Store) {
+	feed, ok := s.(store.ChangeFeed)
+	if !ok {
+		t.Skip("store doesn't report changes")
+	}
+	var events []models.ChangeEvent
+	feed.OnChange(func(e []models.ChangeEvent) { events = append(events, e...) })
+	ctx := t.Context()
+
+	seg := createSegment(t, s, "beta")
+	flag := &models.Flag{
+		Key:          "checkout",
+		Type:         models.FlagTypeBoolean,
+		DefaultValue: json.RawMessage(`false`),
+		Rules:        []models.Rule{{Value: json.RawMessage(`true`), SegmentKeys: []string{"beta"}}},
+	}
+	require.NoError(t, s.CreateFlag(ctx, actor, flag))
+	rule := createRule(t, s, "checkout", 1)
+	_, err := s.ToggleFlag(ctx, actor, "checkout", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteRule(ctx, actor, "checkout", rule.ID, 0))
+
+	// Failed writes report nothing
+	_, err = s.ToggleFlag(ctx, actor, "checkout", 1)
+	require.ErrorIs(t, err, store.ErrVersionMismatch)
+
+	require.NoError(t, s.DeleteFlag(ctx, actor, "checkout", 0))
+	require.NoError(t, s.DeleteSegment(ctx, actor, "beta", 0))
+
+	type event struct{ Type, FlagKey string }
+	var got []event
+	for _, e := range events {
+		got = append(got, event{e.Type, e.FlagKey})
+	}
+	assert.Equal(t, []event{
+		{"segment_created", ""},
+		{"flag_created", "checkout"},
+		{"rule_created", "checkout"},
+		{"rule_created", "checkout"},
+		{"flag_toggled", "checkout"},
+		{"rule_deleted", "checkout"},
+		{"flag_deleted", "checkout"},
+		{"segment_deleted", ""},
+	}, got)
+
+	var created models.Segment
+	require.NoError(t, json.Unmarshal(events[0].Data, &created))
+	assert.Equal(t, seg.Key, created.Key)
+	var deleted map[string]any
+	require.NoError(t, json.Unmarshal(events[5].Data, &deleted))
+	assert.EqualValues(t, rule.ID, deleted["rule_id"])
+
+	if _, ok := s.(store.EventLog); ok {
+		for i := 1; i < len(events); i++ {
+			assert.Equal(t, events[i-1].Seq+1, events[i].Seq, "events are numbered in order")
+		}
+	}
+}
+
+func testPromoteFlag(t *testing.T, s store.Store) {
+	promo, ok := s.(store.Promotions)
+	if !ok {
+		t.Skip("store doesn't promote flags")
+	}
+	ctx := t.Context()
+	// As read from another environment
+	source := &models.Flag{
+		Key:          "new_checkout",
+		Type:         models.FlagTypeBoolean,
+		Enabled:      true,
+		DefaultValue: json.RawMessage(`false`),
+		Rules:        []models.Rule{{ID: 7, Value: json.RawMessage(`true`), RolloutPercentage: 100, SegmentKeys: []string{"beta"}}},
+	}
+
+	// The target lacks the segment the rule references
+	p, err := promo.PromoteFlag(ctx, actor, source, true)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConfigCreate, p.Action)
+	assert.Equal(t, []string{"beta"}, p.MissingSegments)
+	assert.False(t, p.Applied)
+	_, err = promo.PromoteFlag(ctx, actor, source, false)
+	require.ErrorIs(t, err, store.ErrMissingSegments)
+	flag, err := s.GetFlag(ctx, "new_checkout")
+	require.NoError(t, err)
+	assert.Nil(t, flag)
+
+	createSegment(t, s, "beta")
+	p, err = promo.PromoteFlag(ctx, actor, source, false)
+	require.NoError(t, err)
+	assert.True(t, p.Applied)
+	require.NotNil(t, p.Flag)
+	assert.False(t, p.Flag.Enabled, "a new flag is created disabled")
+	require.Len(t, p.Flag.Rules, 1)
+	assert.Equal(t, []string{"beta"}, p.Flag.Rules[0].SegmentKeys)
+
+	p, err = promo.PromoteFlag(ctx, actor, source, false)
+	require.NoError(t, err)
+	assert.Empty(t, p.Action, "the target already matches")
+	assert.False(t, p.Applied)
+
+	// The target keeps its enabled state
+	_, err = s.ToggleFlag(ctx, actor, "new_checkout", 0)
+	require.NoError(t, err)
+	source.DefaultValue = json.RawMessage(`true`)
+	p, err = promo.PromoteFlag(ctx, actor, source, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.ConfigUpdate, p.Action)
+	require.Len(t, p.Changes, 1)
+	assert.Equal(t, "default_value", p.Changes[0].Path)
+	assert.True(t, p.Flag.Enabled)
+
+	if audit, ok := s.(store.AuditLog); ok {
+		entries, err := audit.ListAuditEntries(ctx, models.AuditFilter{Action: "flag.promote", Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	}
+
+	// A flag's type can't change
+	other := &models.Flag{Key: "new_checkout", Type: models.FlagTypeString, DefaultValue: json.RawMessage(`"a"`)}
+	_, err = promo.PromoteFlag(ctx, actor, other, true)
+	require.ErrorIs(t, err, store.ErrFlagTypeChange)
+}
+
+func testFlagTemplates(t *testing.T, s store.Store) {
+	templates, ok := s.(store.FlagTemplates)
+	if !ok {
+		t.Skip("store doesn't keep flag templates")
+	}
+	ctx := t.Context()
+
+	tmpl := &models.FlagTemplate{
+		Name:         "internal_first",
+		Type:         models.FlagTypeBoolean,
+		DefaultValue: json.RawMessage(`false`),
+		Rules: []models.RuleConfig{{
+			Value:      json.RawMessage(`"{{internal}}"`),
+			Conditions: []models.ConditionConfig{{Attribute: "email", Operator: models.OpEquals, Value: json.RawMessage(`"a@example.com"`)}},
+		}},
+		Defaults: map[string]json.RawMessage{"internal": json.RawMessage(`true`)},
+	}
+	require.NoError(t, templates.CreateFlagTemplate(ctx, actor, tmpl))
+	assert.Error(t, templates.CreateFlagTemplate(ctx, actor, tmpl), "names are unique")
+
+	got, err := templates.GetFlagTemplate(ctx, "internal_first")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, tmpl.Rules, got.Rules)
+	assert.JSONEq(t, `true`, string(got.Defaults["internal"]))
+
+	tmpl.Description = "Internal users first"
+	require.NoError(t, templates.UpdateFlagTemplate(ctx, actor, tmpl))
+	list, err := templates.ListFlagTemplates(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "Internal users first", list[0].Description)
+
+	require.NoError(t, templates.DeleteFlagTemplate(ctx, actor, "internal_first"))
+	got, err = templates.GetFlagTemplate(ctx, "internal_first")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.ErrorIs(t, templates.DeleteFlagTemplate(ctx, actor, "internal_first"), store.ErrTemplateNotFound)
+	assert.ErrorIs(t, templates.UpdateFlagTemplate(ctx, actor, tmpl), store.ErrTemplateNotFound)
+
+	if audit, ok := s.(store.AuditLog); ok {
+		entries, err := audit.ListAuditEntries(ctx, models.AuditFilter{ResourceType: "template", Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	}
+}
+
+func testEventLog(t *testing.T, s store.Store) {
+	log, ok := s.(store.EventLog)
+	feed, feeds := s.(store.ChangeFeed)
+	if !ok || !feeds {
+		t.Skip("store doesn't keep an event log")
+	}
+	var published []models.ChangeEvent
+	feed.OnChange(func(e []models.ChangeEvent) { published = append(published, e...) })
+	ctx := t.Context()
+
+	createFlag(t, s, "checkout")
+	createRule(t, s, "checkout", 1)
+	logged, err := log.EventsSince(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logged, 2)
+	assert.Equal(t, published, logged, "the log holds the events as published")
+
+	logged, err = log.EventsSince(ctx, logged[0].Seq, 10)
+	require.NoError(t, err)
+	assert.Equal(t, published[1:], logged)
+	oldest, latest, err := log.EventBounds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, published[0].Seq, oldest)
+	assert.Equal(t, published[1].Seq, latest)
+}
+
+func testWebhookDeliveries(t *testing.T, s store.Store) {
+	hooks, ok := s.(store.Webhooks)
+	feed, feeds := s.(store.ChangeFeed)
+	if !ok || !feeds {
+		t.Skip("store doesn't keep webhooks")
+	}
+	var published []models.ChangeEvent
+	feed.OnChange(func(e []models.ChangeEvent) { published = append(published, e...) })
+	ctx := t.Context()
+	require.NoError(t, hooks.CreateWebhook(ctx, actor, &models.Webhook{ID: "all", URL: "http://example.com/all"}))
+	require.NoError(t, hooks.CreateWebhook(ctx, actor, &models.Webhook{ID: "toggles", URL: "http://example.com/toggles", Events: []string{"flag_toggled"}}))
+
+	createFlag(t, s, "checkout")
+	require.Len(t, published, 1)
+	due, err := hooks.DueWebhookDeliveries(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1, "only subscribed webhooks get a delivery")
+	assert.Equal(t, "all", due[0].WebhookID)
+	assert.Equal(t, strconv.FormatInt(published[0].Seq, 10), due[0].EventID)
+	var payload struct {
+		Data struct{ Key string } `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(due[0].Payload, &payload))
+	assert.Equal(t, "checkout", payload.Data.Key)
+
+	_, err = s.ToggleFlag(ctx, actor, "checkout", 0)
+	require.NoError(t, err)
+	toggles, err := hooks.ListWebhookDeliveries(ctx, "toggles", "", 10)
+	require.NoError(t, err)
+	assert.Len(t, toggles, 1)
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// templateDefinition is the part of a template stored as JSON.
+type templateDefinition struct {
+	DefaultValue json.RawMessage            `json:"default_value"`
+	Rules        []models.RuleConfig        `json:"rules"`
+	Defaults     map[string]json.RawMessage `json:"defaults,omitempty"`
+}
+
+func (s *SQLiteStore) CreateFlagTemplate(ctx context.Context, actor models.Actor, t *models.FlagTemplate) error {
+	ctx, done := s.track(ctx, "create_flag_template")
+	defer done()
+	now := time.Now().UTC()
+	t.CreatedAt, t.UpdatedAt = now, now
+
+	def, err := json.Marshal(templateDefinition{DefaultValue: t.DefaultValue, Rules: t.Rules, Defaults: t.Defaults})
+	if err != nil {
+		return fmt.Errorf("encode template: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO flag_templates (name, description, type, definition, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Description, t.Type, string(def), t.CreatedAt, t.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("create template: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "template.create", "template", t.Name, nil, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const templateColumns = `name, description, type, definition, created_at, updated_at`
+
+func scanTemplate(scan func(dest ...any) error) (*models.FlagTemplate, error) {
+	var t models.FlagTemplate
+	var def string
+	if err := scan(&t.Name, &t.Description, &t.Type, &def, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	var d templateDefinition
+	if err := json.Unmarshal([]byte(def), &d); err != nil {
+		return nil, fmt.Errorf("decode template %q: %w", t.Name, err)
+	}
+	t.DefaultValue, t.Rules, t.Defaults = d.DefaultValue, d.Rules, d.Defaults
+	if t.Rules == nil {
+		t.Rules = []models.RuleConfig{}
+	}
+	return &t, nil
+}
+
+func getTemplate(ctx context.Context, q querier, name string) (*models.FlagTemplate, error) {
+	t, err := scanTemplate(q.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM flag_templates WHERE name = ?`, name).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get template: %w", err)
+	}
+	return t, nil
+}
+
+// GetFlagTemplate returns a template, or nil if not found.
+func (s *SQLiteStore) GetFlagTemplate(ctx context.Context, name string) (*models.FlagTemplate, error) {
+	ctx, done := s.track(ctx, "get_flag_template")
+	defer done()
+	return getTemplate(ctx, s.db, name)
+}
+
+// ListFlagTemplates returns all templates, sorted by name.
+func (s *SQLiteStore) ListFlagTemplates(ctx context.Context) ([]models.FlagTemplate, error) {
+	ctx, done := s.track(ctx, "list_flag_templates")
+	defer done()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+templateColumns+` FROM flag_templates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.FlagTemplate
+	for rows.Next() {
+		t, err := scanTemplate(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("scan template: %w", err)
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+// UpdateFlagTemplate replaces a template's definition. Flags already made
+// from it don't change.
+func (s *SQLiteStore) UpdateFlagTemplate(ctx context.Context, actor models.Actor, t *models.FlagTemplate) error {
+	ctx, done := s.track(ctx, "update_flag_template")
+	defer done()
+
+	def, err := json.Marshal(templateDefinition{DefaultValue: t.DefaultValue, Rules: t.Rules, Defaults: t.Defaults})
+	if err != nil {
+		return fmt.Errorf("encode template: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getTemplate(ctx, tx, t.Name)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrTemplateNotFound
+	}
+	t.CreatedAt, t.UpdatedAt = before.CreatedAt, time.Now().UTC()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE flag_templates SET description = ?, type = ?, definition = ?, updated_at = ? WHERE name = ?`,
+		t.Description, t.Type, string(def), t.UpdatedAt, t.Name,
+	); err != nil {
+		return fmt.Errorf("update template: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "template.update", "template", t.Name, before, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteFlagTemplate(ctx context.Context, actor models.Actor, name string) error {
+	ctx, done := s.track(ctx, "delete_flag_template")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getTemplate(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrTemplateNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM flag_templates WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete template: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "template.delete", "template", name, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
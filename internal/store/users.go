@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, actor models.Actor, u *models.User) error {
+	ctx, done := s.track(ctx, "create_user")
+	defer done()
+	now := time.Now().UTC()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO users (id, name, kind, role, disabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Name, u.Kind, u.Role, u.Disabled, u.CreatedAt, u.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "user.create", "user", u.Name, nil, u); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetUser looks a user up by ID or name. Returns nil if not found.
+func (s *SQLiteStore) GetUser(ctx context.Context, idOrName string) (*models.User, error) {
+	ctx, done := s.track(ctx, "get_user")
+	defer done()
+	return getUser(ctx, s.db, idOrName)
+}
+
+func getUser(ctx context.Context, q querier, idOrName string) (*models.User, error) {
+	var u models.User
+	err := q.QueryRowContext(ctx,
+		`SELECT id, name, kind, role, disabled, created_at, updated_at
+		 FROM users WHERE id = ? OR name = ?`, idOrName, idOrName,
+	).Scan(&u.ID, &u.Name, &u.Kind, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return &u, nil
+}
+
+func (s *SQLiteStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	ctx, done := s.track(ctx, "list_users")
+	defer done()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, kind, role, disabled, created_at, updated_at FROM users ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Kind, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteStore) UpdateUser(ctx context.Context, actor models.Actor, idOrName string, req *models.UpdateUserRequest) (*models.User, error) {
+	ctx, done := s.track(ctx, "update_user")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getUser(ctx, tx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrUserNotFound
+	}
+	after := *before
+	if req.Role != nil {
+		after.Role = *req.Role
+	}
+	if req.Disabled != nil {
+		after.Disabled = *req.Disabled
+	}
+	after.UpdatedAt = time.Now().UTC()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET role = ?, disabled = ?, updated_at = ? WHERE id = ?`,
+		after.Role, after.Disabled, after.UpdatedAt, after.ID,
+	); err != nil {
+		return nil, fmt.Errorf("update user: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "user.update", "user", after.Name, before, &after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &after, nil
+}
+
+// DeleteUser removes a user and all of their tokens.
+func (s *SQLiteStore) DeleteUser(ctx context.Context, actor models.Actor, idOrName string) error {
+	ctx, done := s.track(ctx, "delete_user")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getUser(ctx, tx, idOrName)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, before.ID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "user.delete", "user", before.Name, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) CreateUserToken(ctx context.Context, actor models.Actor, token *models.UserToken, hashedToken string) error {
+	ctx, done := s.track(ctx, "create_user_token")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := getUser(ctx, tx, token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_tokens (id, user_id, name, prefix, hashed_token, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Name, token.Prefix, hashedToken, token.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("create user token: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "user_token.create", "user", user.Name, nil, token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListUserTokens(ctx context.Context, userID string) ([]models.UserToken, error) {
+	ctx, done := s.track(ctx, "list_user_tokens")
+	defer done()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, name, prefix, revoked, created_at, last_used_at
+		 FROM user_tokens WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list user tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.UserToken
+	for rows.Next() {
+		var t models.UserToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Revoked, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("scan user token: %w", err)
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLiteStore) RevokeUserToken(ctx context.Context, actor models.Actor, userID, tokenID string) error {
+	ctx, done := s.track(ctx, "revoke_user_token")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := getUser(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE user_tokens SET revoked = 1 WHERE id = ? AND user_id = ?`, tokenID, user.ID)
+	if err != nil {
+		return fmt.Errorf("revoke user token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	if err := writeAudit(ctx, tx, actor, "user_token.revoke", "user", user.Name,
+		map[string]string{"token_id": tokenID}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AuthenticateUserToken returns the enabled user owning the unrevoked token
+// with this hash, and the token's ID, or nil. It doesn't record the use; see
+// TouchUserTokens.
+func (s *SQLiteStore) AuthenticateUserToken(ctx context.Context, hashedToken string) (*models.User, string, error) {
+	ctx, done := s.track(ctx, "authenticate_user_token")
+	defer done()
+	var u models.User
+	var tokenID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT u.id, u.name, u.kind, u.role, u.disabled, u.created_at, u.updated_at, t.id
+		 FROM user_tokens t JOIN users u ON u.id = t.user_id
+		 WHERE t.hashed_token = ? AND t.revoked = 0 AND u.disabled = 0`, hashedToken,
+	).Scan(&u.ID, &u.Name, &u.Kind, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt, &tokenID)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("authenticate user token: %w", err)
+	}
+	return &u, tokenID, nil
+}
+
+// TouchUserTokens sets last_used_at for a batch of user tokens, by token ID.
+func (s *SQLiteStore) TouchUserTokens(ctx context.Context, lastUsed map[string]time.Time) error {
+	ctx, done := s.track(ctx, "touch_user_tokens")
+	defer done()
+	return s.touch(ctx, "user_tokens", lastUsed)
+}
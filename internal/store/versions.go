@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// ErrVersionNotFound is returned when a flag version doesn't exist.
+var ErrVersionNotFound = errors.New("flag version not found")
+
+// ErrVersionMismatch is returned when a write's expected version doesn't
+// match the resource's current version (it was modified concurrently).
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// checkVersion compares an expected version against the current one.
+// An expected version of 0 skips the check.
+func checkVersion(expected, current int) error {
+	if expected != 0 && expected != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// recordVersion snapshots the flag as it is inside tx and appends it to the
+// flag's history. The flag's version column is bumped to the new history
+// version, and flag.Version is updated to match. For deletions, pass the flag
+// as it was before the delete.
+func recordVersion(ctx context.Context, tx *sql.Tx, actor models.Actor, action string, flag *models.Flag) error {
+	var next int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM flag_versions WHERE flag_key = ?`, flag.Key,
+	).Scan(&next); err != nil {
+		return fmt.Errorf("next version: %w", err)
+	}
+	if next <= flag.Version {
+		next = flag.Version + 1
+	}
+	if action != "flag.delete" {
+		flag.Version = next
+		if _, err := tx.ExecContext(ctx, `UPDATE flags SET version = ? WHERE key = ?`, next, flag.Key); err != nil {
+			return fmt.Errorf("bump flag version: %w", err)
+		}
+	}
+
+	snapshot, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO flag_versions (flag_key, version, action, actor_type, actor_id, snapshot, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		flag.Key, next, action, actor.Type, actor.ID, string(snapshot), time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+	return nil
+}
+
+// recordCurrentVersion reads the flag inside tx and snapshots it.
+func recordCurrentVersion(ctx context.Context, tx *sql.Tx, actor models.Actor, action, flagKey string) error {
+	flag, err := getFlag(ctx, tx, flagKey)
+	if err != nil {
+		return err
+	}
+	if flag == nil {
+		return fmt.Errorf("flag not found")
+	}
+	return recordVersion(ctx, tx, actor, action, flag)
+}
+
+// ListFlagVersions returns the flag's history, newest first, without snapshots.
+func (s *SQLiteStore) ListFlagVersions(ctx context.Context, key string) ([]models.FlagVersion, error) {
+	ctx, done := s.track(ctx, "list_flag_versions")
+	defer done()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT flag_key, version, action, actor_type, actor_id, created_at
+		 FROM flag_versions WHERE flag_key = ? ORDER BY version DESC`, key)
+	if err != nil {
+		return nil, fmt.Errorf("list flag versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.FlagVersion
+	for rows.Next() {
+		var v models.FlagVersion
+		if err := rows.Scan(&v.FlagKey, &v.Version, &v.Action, &v.Actor.Type, &v.Actor.ID, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan flag version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetFlagVersion returns one version with its snapshot, or nil if it doesn't exist.
+func (s *SQLiteStore) GetFlagVersion(ctx context.Context, key string, version int) (*models.FlagVersion, error) {
+	ctx, done := s.track(ctx, "get_flag_version")
+	defer done()
+	return getFlagVersion(ctx, s.db, key, version)
+}
+
+func getFlagVersion(ctx context.Context, q querier, key string, version int) (*models.FlagVersion, error) {
+	var v models.FlagVersion
+	var snapshot string
+	err := q.QueryRowContext(ctx,
+		`SELECT flag_key, version, action, actor_type, actor_id, snapshot, created_at
+		 FROM flag_versions WHERE flag_key = ? AND version = ?`, key, version,
+	).Scan(&v.FlagKey, &v.Version, &v.Action, &v.Actor.Type, &v.Actor.ID, &snapshot, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get flag version: %w", err)
+	}
+	if err := json.Unmarshal([]byte(snapshot), &v.Snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return &v, nil
+}
+
+// RestoreFlagVersion replaces the flag's configuration and rules with the
+// snapshot from the given version, recreating the flag if it was deleted.
+// Rules keep their original IDs. Returns the restored flag and the flag as it
+// was before the restore (nil if it didn't exist).
+func (s *SQLiteStore) RestoreFlagVersion(ctx context.Context, actor models.Actor, key string, version int) (restored, previous *models.Flag, err error) {
+	ctx, done := s.track(ctx, "restore_flag_version")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	out := s.outbox()
+	defer out.release()
+
+	v, err := getFlagVersion(ctx, tx, key, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v == nil {
+		return nil, nil, ErrVersionNotFound
+	}
+	snap := v.Snapshot
+
+	previous, err = getFlag(ctx, tx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Segments may have been deleted since the snapshot was taken
+	for _, r := range snap.Rules {
+		if err := validateSegmentKeys(ctx, tx, r.SegmentKeys); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	if previous == nil {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO flags (key, type, description, enabled, default_value, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			key, snap.Type, snap.Description, snap.Enabled, string(snap.DefaultValue), now, now,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE flags SET type = ?, description = ?, enabled = ?, default_value = ?, updated_at = ?
+			 WHERE key = ?`,
+			snap.Type, snap.Description, snap.Enabled, string(snap.DefaultValue), now, key,
+		)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("restore flag: %w", err)
+	}
+
+	// Replace all rules (conditions and rule_segments cascade). A restored
+	// rule's version must move past both its current and snapshot versions
+	// so stale If-Match values from either are rejected.
+	ruleVersions := map[int64]int{}
+	if previous != nil {
+		for _, r := range previous.Rules {
+			ruleVersions[r.ID] = r.Version
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rules WHERE flag_key = ?`, key); err != nil {
+		return nil, nil, fmt.Errorf("delete rules: %w", err)
+	}
+	for _, r := range snap.Rules {
+		r.Version = max(r.Version, ruleVersions[r.ID]) + 1
+		if err := insertRuleWithID(ctx, tx, key, &r, now); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	restored, err = getFlag(ctx, tx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	action := "flag.restore"
+	if err := recordVersion(ctx, tx, actor, action, restored); err != nil {
+		return nil, nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, action, "flag", key, previous, restored); err != nil {
+		return nil, nil, err
+	}
+	if err := out.add(ctx, tx, models.FlagReplacedEvents(previous, restored)...); err != nil {
+		return nil, nil, err
+	}
+	if err := out.commit(tx); err != nil {
+		return nil, nil, err
+	}
+	return restored, previous, nil
+}
+
+// insertRuleWithID inserts a rule with its conditions and segment references,
+// keeping the rule's existing ID. A rule without an ID is given a new one.
+func insertRuleWithID(ctx context.Context, tx *sql.Tx, flagKey string, r *models.Rule, now time.Time) error {
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO rules (id, flag_key, description, value, priority, rollout_percentage, version, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sql.NullInt64{Int64: r.ID, Valid: r.ID != 0}, flagKey, r.Description, string(r.Value),
+		r.Priority, r.RolloutPercentage, r.Version, r.CreatedAt, now,
+	)
+	if err != nil {
+		return fmt.Errorf("insert rule: %w", err)
+	}
+	if r.ID == 0 {
+		r.ID, _ = res.LastInsertId()
+	}
+	for _, c := range r.Conditions {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO conditions (rule_id, attribute, operator, value, created_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			r.ID, c.Attribute, c.Operator, string(c.Value), now,
+		); err != nil {
+			return fmt.Errorf("insert condition: %w", err)
+		}
+	}
+	for _, sk := range r.SegmentKeys {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO rule_segments (rule_id, segment_key) VALUES (?, ?)`, r.ID, sk,
+		); err != nil {
+			return fmt.Errorf("insert rule_segment: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+func (s *SQLiteStore) CreateWebhook(ctx context.Context, actor models.Actor, w *models.Webhook) error {
+	ctx, done := s.track(ctx, "create_webhook")
+	defer done()
+	w.CreatedAt = time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO webhooks (id, url, events, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		w.ID, w.URL, strings.Join(w.Events, ","), w.Secret, w.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "webhook.create", "webhook", w.ID, nil, withoutSecret(w)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withoutSecret returns a copy of w safe to record in the audit log.
+func withoutSecret(w *models.Webhook) *models.Webhook {
+	c := *w
+	c.Secret = ""
+	return &c
+}
+
+const webhookColumns = `id, url, events, secret, created_at`
+
+func scanWebhook(scan func(dest ...any) error) (*models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	if err := scan(&w.ID, &w.URL, &events, &w.Secret, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = []string{}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return &w, nil
+}
+
+// GetWebhook returns a webhook, including its secret, or nil if not found.
+func (s *SQLiteStore) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	ctx, done := s.track(ctx, "get_webhook")
+	defer done()
+	w, err := scanWebhook(s.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get webhook: %w", err)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns all webhooks, including their secrets.
+func (s *SQLiteStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, done := s.track(ctx, "list_webhooks")
+	defer done()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hooks = append(hooks, *w)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func (s *SQLiteStore) DeleteWebhook(ctx context.Context, actor models.Actor, id string) error {
+	ctx, done := s.track(ctx, "delete_webhook")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := scanWebhook(tx.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("get webhook: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	if err := writeAudit(ctx, tx, actor, "webhook.delete", "webhook", id, withoutSecret(before), nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// webhookEvent is the JSON body POSTed to webhook endpoints.
+type webhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// enqueueWebhookDeliveries adds a pending delivery of a logged event, due
+// now, for every webhook subscribed to its type. It runs in the transaction
+// of the change, so deliveries are queued if and only if it commits.
+func enqueueWebhookDeliveries(ctx context.Context, tx *sql.Tx, e *models.ChangeEvent) error {
+	rows, err := tx.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks`)
+	if err != nil {
+		return fmt.Errorf("list webhooks: %w", err)
+	}
+	var hooks []*models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan webhook: %w", err)
+		}
+		if w.Wants(e.Type) {
+			hooks = append(hooks, w)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list webhooks: %w", err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	id := strconv.FormatInt(e.Seq, 10)
+	payload, err := json.Marshal(webhookEvent{ID: id, Type: e.Type, Data: e.Data, CreatedAt: e.CreatedAt})
+	if err != nil {
+		return fmt.Errorf("encode webhook event: %w", err)
+	}
+	for _, w := range hooks {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			w.ID, id, e.Type, string(payload), models.DeliveryPending, e.CreatedAt, e.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("enqueue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_error, created_at, delivered_at`
+
+func scanDelivery(scan func(dest ...any) error) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	var next, delivered sql.NullTime
+	if err := scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&next, &d.LastError, &d.CreatedAt, &delivered); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return &d, nil
+}
+
+func queryDeliveries(ctx context.Context, q querier, query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due at now, oldest first.
+func (s *SQLiteStore) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := s.track(ctx, "due_webhook_deliveries")
+	defer done()
+	return queryDeliveries(ctx, s.db,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// RecordWebhookAttempt logs an attempt and moves the delivery to status.
+// nextAttemptAt is only used when status is pending.
+func (s *SQLiteStore) RecordWebhookAttempt(ctx context.Context, id int64, attempt models.WebhookAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) error {
+	ctx, done := s.track(ctx, "record_webhook_attempt")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		id, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMS, attempt.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("insert webhook attempt: %w", err)
+	}
+
+	var next, delivered any
+	switch status {
+	case models.DeliveryPending:
+		next = nextAttemptAt.UTC()
+	case models.DeliveryDelivered:
+		delivered = attempt.CreatedAt
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, delivered_at = ?
+		 WHERE id = ?`,
+		status, attempt.Attempt, next, attempt.Error, delivered, id,
+	); err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries, newest
+// first, optionally filtered by status.
+func (s *SQLiteStore) ListWebhookDeliveries(ctx context.Context, webhookID string, status models.DeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := s.track(ctx, "list_webhook_deliveries")
+	defer done()
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = ?`
+	args := []any{webhookID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+	return queryDeliveries(ctx, s.db, query, args...)
+}
+
+// GetWebhookDelivery returns a delivery with its attempt log, or nil.
+func (s *SQLiteStore) GetWebhookDelivery(ctx context.Context, webhookID string, id int64) (*models.WebhookDelivery, error) {
+	ctx, done := s.track(ctx, "get_webhook_delivery")
+	defer done()
+	return getWebhookDelivery(ctx, s.db, webhookID, id)
+}
+
+func getWebhookDelivery(ctx context.Context, q querier, webhookID string, id int64) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(q.QueryRowContext(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ? AND webhook_id = ?`, id, webhookID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get webhook delivery: %w", err)
+	}
+
+	rows, err := q.QueryContext(ctx,
+		`SELECT attempt, status_code, error, duration_ms, created_at
+		 FROM webhook_delivery_attempts WHERE delivery_id = ? ORDER BY attempt`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook attempts: %w", err)
+	}
+	defer rows.Close()
+	d.AttemptLog = []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.DurationMS, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook attempt: %w", err)
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return d, rows.Err()
+}
+
+// RedeliverWebhookDelivery puts a delivery back in the queue, due now,
+// whatever its status. Its attempt count carries on from where it was.
+func (s *SQLiteStore) RedeliverWebhookDelivery(ctx context.Context, actor models.Actor, webhookID string, id int64) (*models.WebhookDelivery, error) {
+	ctx, done := s.track(ctx, "redeliver_webhook_delivery")
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getWebhookDelivery(ctx, tx, webhookID, id)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?, delivered_at = NULL WHERE id = ?`,
+		models.DeliveryPending, time.Now().UTC(), id,
+	); err != nil {
+		return nil, fmt.Errorf("redeliver webhook delivery: %w", err)
+	}
+	after, err := getWebhookDelivery(ctx, tx, webhookID, id)
+	if err != nil {
+		return nil, err
+	}
+	audit := func(d *models.WebhookDelivery) map[string]any {
+		return map[string]any{"delivery_id": d.ID, "status": d.Status, "attempts": d.Attempts}
+	}
+	if err := writeAudit(ctx, tx, actor, "webhook.redeliver", "webhook", webhookID, audit(before), audit(after)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return after, nil
+}
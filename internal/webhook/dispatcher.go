@@ -0,0 +1,236 @@
+// Package webhook delivers change events to registered endpoints from the
+// store's outbox, signing each request and retrying failures with
+// exponential backoff until the delivery succeeds or runs out of attempts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Flaggy-Event"
+	HeaderDelivery  = "X-Flaggy-Delivery"
+	HeaderTimestamp = "X-Flaggy-Timestamp"
+	HeaderSignature = "X-Flaggy-Signature"
+)
+
+// Store is the subset of store.Webhooks the dispatcher needs.
+type Store interface {
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, attempt models.WebhookAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) error
+}
+
+// Options configures a Dispatcher. Zero values fall back to defaults.
+type Options struct {
+	MaxAttempts  int           // Attempts before a delivery is dead (default 8)
+	RetryBase    time.Duration // Wait after the first failure, doubled after each one (default 30s)
+	MaxBackoff   time.Duration // Cap on the wait between attempts (default 1h)
+	Timeout      time.Duration // Per-request timeout (default 10s)
+	PollInterval time.Duration // How often to look for due retries (default 5s)
+	Client       *http.Client  // Optional; built from Timeout if nil
+}
+
+func (opts Options) withDefaults() Options {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+	return opts
+}
+
+// batchSize bounds how many due deliveries are loaded per pass.
+const batchSize = 100
+
+// Dispatcher works through the outbox from a single background goroutine.
+// New events are picked up on Notify; retries on the next poll after they
+// fall due.
+type Dispatcher struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts a dispatcher. Call Close to stop it.
+func New(s Store, opts Options) *Dispatcher {
+	d := &Dispatcher{
+		store: s,
+		opts:  opts.withDefaults(),
+		now:   time.Now,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Notify tells the dispatcher that new deliveries are queued. It never
+// blocks and is safe on a nil Dispatcher.
+func (d *Dispatcher) Notify() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the dispatcher, waiting for an in-flight pass to finish.
+// Undelivered entries stay in the outbox for the next start.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() { close(d.stop) })
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDue()
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// deliverDue attempts every due delivery, a batch at a time.
+func (d *Dispatcher) deliverDue() {
+	for {
+		due, err := d.store.DueWebhookDeliveries(context.Background(), d.now().UTC(), batchSize)
+		if err != nil {
+			slog.Error("failed to load webhook deliveries", "error", err)
+			return
+		}
+		for i := range due {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+			d.attempt(&due[i])
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(del *models.WebhookDelivery) {
+	hook, err := d.store.GetWebhook(context.Background(), del.WebhookID)
+	if err != nil {
+		slog.Error("failed to load webhook", "webhook", del.WebhookID, "error", err)
+		return
+	}
+	if hook == nil {
+		return // Deleted since the event was queued; its deliveries go with it.
+	}
+
+	start := d.now()
+	a := models.WebhookAttempt{Attempt: del.Attempts + 1, CreatedAt: start.UTC()}
+	code, err := d.post(hook, del, start)
+	a.DurationMS = d.now().Sub(start).Milliseconds()
+	a.StatusCode = code
+	if err == nil && (code < 200 || code > 299) {
+		err = fmt.Errorf("endpoint returned %d", code)
+	}
+
+	status, next := models.DeliveryDelivered, time.Time{}
+	if err != nil {
+		a.Error = err.Error()
+		status = models.DeliveryPending
+		next = start.Add(Backoff(d.opts.RetryBase, d.opts.MaxBackoff, a.Attempt))
+		if a.Attempt >= d.opts.MaxAttempts {
+			status = models.DeliveryDead
+		}
+		slog.Warn("webhook delivery failed", "webhook", hook.ID, "delivery", del.ID,
+			"attempt", a.Attempt, "status", status, "error", err)
+	}
+	if err := d.store.RecordWebhookAttempt(context.Background(), del.ID, a, status, next); err != nil {
+		slog.Error("failed to record webhook attempt", "delivery", del.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) post(hook *models.Webhook, del *models.WebhookDelivery, now time.Time) (int, error) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "flaggy-webhooks")
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(del.ID, 10))
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, ts, del.Payload))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Flaggy-Signature value for a payload sent at ts (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256 of "<ts>.<body>" under secret.
+// Receivers should recompute it and reject stale timestamps.
+func Sign(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the wait after the given failed attempt (1-based): base,
+// doubled for each earlier failure, capped at max.
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	return min(wait, max)
+}
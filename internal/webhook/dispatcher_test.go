@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/getflaggy/flaggy/internal/models"
+)
+
+type recorded struct {
+	id      int64
+	attempt models.WebhookAttempt
+	status  models.DeliveryStatus
+	next    time.Time
+}
+
+type fakeStore struct {
+	mu       sync.Mutex
+	hooks    map[string]*models.Webhook
+	due      []models.WebhookDelivery
+	attempts []recorded
+}
+
+func (f *fakeStore) GetWebhook(_ context.Context, id string) (*models.Webhook, error) {
+	return f.hooks[id], nil
+}
+
+func (f *fakeStore) DueWebhookDeliveries(context.Context, time.Time, int) ([]models.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeStore) RecordWebhookAttempt(_ context.Context, id int64, a models.WebhookAttempt, status models.DeliveryStatus, next time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, recorded{id, a, status, next})
+	return nil
+}
+
+func newTestDispatcher(url string, opts Options) (*Dispatcher, *fakeStore, time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	fs := &fakeStore{hooks: map[string]*models.Webhook{
+		"whk_1": {ID: "whk_1", URL: url, Secret: "0123456789abcdef"},
+	}}
+	d := &Dispatcher{store: fs, opts: opts.withDefaults(), now: func() time.Time { return now }}
+	return d, fs, now
+}
+
+func delivery(attempts int) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID: 7, WebhookID: "whk_1", EventType: "flag_updated", Attempts: attempts,
+		Payload: []byte(`{"type":"flag_updated"}`),
+	}
+}
+
+func TestAttempt_SignsAndMarksDelivered(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d, fs, now := newTestDispatcher(srv.URL, Options{})
+	d.attempt(delivery(0))
+
+	require.NotNil(t, got)
+	assert.Equal(t, "flag_updated", got.Header.Get(HeaderEvent))
+	assert.Equal(t, "7", got.Header.Get(HeaderDelivery))
+	assert.Equal(t, "1700000000", got.Header.Get(HeaderTimestamp))
+	assert.Equal(t, Sign("0123456789abcdef", "1700000000", body), got.Header.Get(HeaderSignature))
+	assert.JSONEq(t, `{"type":"flag_updated"}`, string(body))
+
+	require.Len(t, fs.attempts, 1)
+	r := fs.attempts[0]
+	assert.Equal(t, models.DeliveryDelivered, r.status)
+	assert.Equal(t, 1, r.attempt.Attempt)
+	assert.Equal(t, http.StatusNoContent, r.attempt.StatusCode)
+	assert.Empty(t, r.attempt.Error)
+	assert.Equal(t, now.UTC(), r.attempt.CreatedAt)
+}
+
+func TestAttempt_FailureSchedulesRetryThenDies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	d, fs, now := newTestDispatcher(srv.URL, Options{MaxAttempts: 3, RetryBase: time.Minute})
+
+	d.attempt(delivery(1))
+	require.Len(t, fs.attempts, 1)
+	r := fs.attempts[0]
+	assert.Equal(t, models.DeliveryPending, r.status)
+	assert.Equal(t, 2, r.attempt.Attempt)
+	assert.Equal(t, http.StatusBadGateway, r.attempt.StatusCode)
+	assert.Equal(t, "endpoint returned 502", r.attempt.Error)
+	assert.Equal(t, now.Add(2*time.Minute), r.next)
+
+	d.attempt(delivery(2))
+	require.Len(t, fs.attempts, 2)
+	assert.Equal(t, models.DeliveryDead, fs.attempts[1].status)
+}
+
+func TestAttempt_ConnectionErrorIsRetried(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	d, fs, _ := newTestDispatcher(srv.URL, Options{})
+	d.attempt(delivery(0))
+
+	require.Len(t, fs.attempts, 1)
+	assert.Equal(t, models.DeliveryPending, fs.attempts[0].status)
+	assert.Zero(t, fs.attempts[0].attempt.StatusCode)
+	assert.NotEmpty(t, fs.attempts[0].attempt.Error)
+}
+
+func TestAttempt_DeletedWebhookIsSkipped(t *testing.T) {
+	d, fs, _ := newTestDispatcher("http://127.0.0.1:1", Options{})
+	del := delivery(0)
+	del.WebhookID = "whk_gone"
+	d.attempt(del)
+	assert.Empty(t, fs.attempts)
+}
+
+func TestDispatcher_NotifyDeliversQueued(t *testing.T) {
+	hits := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- struct{}{}
+	}))
+	defer srv.Close()
+
+	fs := &fakeStore{hooks: map[string]*models.Webhook{
+		"whk_1": {ID: "whk_1", URL: srv.URL, Secret: "0123456789abcdef"},
+	}}
+	d := New(fs, Options{PollInterval: time.Hour})
+	defer d.Close()
+
+	fs.mu.Lock()
+	fs.due = []models.WebhookDelivery{*delivery(0)}
+	fs.mu.Unlock()
+	d.Notify()
+
+	select {
+	case <-hits:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery was not sent after Notify")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t,
+		"sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+		Sign("secret", "1700000000", []byte("{}")))
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, 5*time.Minute
+	assert.Equal(t, 30*time.Second, Backoff(base, max, 1))
+	assert.Equal(t, time.Minute, Backoff(base, max, 2))
+	assert.Equal(t, 4*time.Minute, Backoff(base, max, 4))
+	assert.Equal(t, max, Backoff(base, max, 5))
+	assert.Equal(t, max, Backoff(base, max, 60))
+}
+
+func TestNotify_NilSafe(t *testing.T) {
+	var d *Dispatcher
+	d.Notify()
+}
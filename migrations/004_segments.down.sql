@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rule_segments;
+DROP TABLE IF EXISTS segment_conditions;
+DROP TABLE IF EXISTS segments;
@@ -0,0 +1,11 @@
+-- Immutable flag snapshots. No foreign key to flags: history outlives the flag.
+CREATE TABLE IF NOT EXISTS flag_versions (
+    flag_key   TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    action     TEXT NOT NULL,
+    actor_type TEXT NOT NULL,
+    actor_id   TEXT NOT NULL,
+    snapshot   TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (flag_key, version)
+);
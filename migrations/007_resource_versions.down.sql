@@ -0,0 +1,3 @@
+ALTER TABLE flags DROP COLUMN version;
+ALTER TABLE rules DROP COLUMN version;
+ALTER TABLE segments DROP COLUMN version;
@@ -0,0 +1,8 @@
+-- Version counters for optimistic concurrency (ETag / If-Match).
+-- A flag's version is its latest flag_versions entry; rules and segments count their own updates.
+ALTER TABLE flags ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE rules ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE segments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+UPDATE flags SET version = COALESCE(
+    (SELECT MAX(version) FROM flag_versions WHERE flag_versions.flag_key = flags.key), 1);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS change_request_reviews;
+DROP TABLE IF EXISTS change_requests;
+DROP TABLE IF EXISTS environment_policies;
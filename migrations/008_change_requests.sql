@@ -0,0 +1,40 @@
+-- Per-environment write policy. No row means direct writes are allowed.
+CREATE TABLE IF NOT EXISTS environment_policies (
+    environment         TEXT PRIMARY KEY,
+    required_approvals  INTEGER NOT NULL DEFAULT 1,
+    allow_direct_writes BOOLEAN NOT NULL DEFAULT 1,
+    updated_at          DATETIME NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE TABLE IF NOT EXISTS change_requests (
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment        TEXT NOT NULL,
+    resource_type      TEXT NOT NULL,
+    action             TEXT NOT NULL,
+    resource_key       TEXT NOT NULL,
+    rule_id            INTEGER NOT NULL DEFAULT 0,
+    payload            TEXT,
+    base_version       INTEGER NOT NULL DEFAULT 0,
+    diff               TEXT NOT NULL,
+    comment            TEXT NOT NULL DEFAULT '',
+    status             TEXT NOT NULL DEFAULT 'pending',
+    required_approvals INTEGER NOT NULL,
+    proposer_type      TEXT NOT NULL,
+    proposer_id        TEXT NOT NULL,
+    apply_error        TEXT NOT NULL DEFAULT '',
+    created_at         DATETIME NOT NULL DEFAULT (datetime('now')),
+    updated_at         DATETIME NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_requests_status ON change_requests(status);
+
+-- One review per actor per change request.
+CREATE TABLE IF NOT EXISTS change_request_reviews (
+    change_request_id INTEGER NOT NULL REFERENCES change_requests(id) ON DELETE CASCADE,
+    actor_type        TEXT NOT NULL,
+    actor_id          TEXT NOT NULL,
+    decision          TEXT NOT NULL,
+    comment           TEXT NOT NULL DEFAULT '',
+    created_at        DATETIME NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (change_request_id, actor_type, actor_id)
+);
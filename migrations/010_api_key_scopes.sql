@@ -0,0 +1,3 @@
+-- Comma-separated scopes. Keys created before scopes existed could call both
+-- client routes, so they keep exactly that.
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT 'evaluate,stream';
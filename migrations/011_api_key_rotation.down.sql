@@ -0,0 +1,19 @@
+-- replaced_by is a foreign key, which SQLite can't drop: rebuild the table.
+-- flaggy:foreign_keys=off
+CREATE TABLE api_keys_before_rotation (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL,
+    environment  TEXT NOT NULL CHECK(environment IN ('live', 'test', 'staging')),
+    prefix       TEXT NOT NULL,
+    hashed_key   TEXT NOT NULL UNIQUE,
+    revoked      BOOLEAN NOT NULL DEFAULT 0,
+    created_at   DATETIME NOT NULL DEFAULT (datetime('now')),
+    last_used_at DATETIME,
+    scopes       TEXT NOT NULL DEFAULT 'evaluate,stream'
+);
+INSERT INTO api_keys_before_rotation (id, name, environment, prefix, hashed_key, revoked, created_at, last_used_at, scopes)
+SELECT id, name, environment, prefix, hashed_key, revoked, created_at, last_used_at, scopes FROM api_keys;
+DROP TABLE api_keys;
+ALTER TABLE api_keys_before_rotation RENAME TO api_keys;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_hashed ON api_keys(hashed_key) WHERE revoked = 0;
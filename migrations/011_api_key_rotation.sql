@@ -0,0 +1,4 @@
+ALTER TABLE api_keys ADD COLUMN expires_at DATETIME;
+
+-- Set when the key is rotated; the key keeps working until expires_at.
+ALTER TABLE api_keys ADD COLUMN replaced_by TEXT REFERENCES api_keys(id);
@@ -0,0 +1,2 @@
+ALTER TABLE api_keys DROP COLUMN rate_limit;
+ALTER TABLE api_keys DROP COLUMN rate_burst;
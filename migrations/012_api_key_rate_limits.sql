@@ -0,0 +1,3 @@
+-- Requests per second and burst size. 0 means the server-wide default.
+ALTER TABLE api_keys ADD COLUMN rate_limit REAL NOT NULL DEFAULT 0;
+ALTER TABLE api_keys ADD COLUMN rate_burst INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Change events published to SSE clients, kept for a while so that
+-- reconnecting clients can resume from Last-Event-ID.
+CREATE TABLE IF NOT EXISTS events (
+    seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+    type       TEXT NOT NULL,
+    data       TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE events DROP COLUMN flag_key;
+ALTER TABLE events DROP COLUMN environment;
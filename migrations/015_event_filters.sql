@@ -0,0 +1,3 @@
+-- Columns SSE subscriptions filter on when replaying events.
+ALTER TABLE events ADD COLUMN flag_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN environment TEXT NOT NULL DEFAULT '';
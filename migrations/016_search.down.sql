@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_flags_created_at;
+DROP INDEX IF EXISTS idx_flags_updated_at;
+DROP INDEX IF EXISTS idx_segments_created_at;
+DROP INDEX IF EXISTS idx_segments_updated_at;
+
+DROP TRIGGER IF EXISTS flags_search_insert;
+DROP TRIGGER IF EXISTS flags_search_update;
+DROP TRIGGER IF EXISTS flags_search_delete;
+DROP TABLE IF EXISTS flags_search;
+
+DROP TRIGGER IF EXISTS segments_search_insert;
+DROP TRIGGER IF EXISTS segments_search_update;
+DROP TRIGGER IF EXISTS segments_search_delete;
+DROP TABLE IF EXISTS segments_search;
@@ -0,0 +1,37 @@
+-- Trigram indexes for substring search over keys and descriptions, kept in
+-- sync by triggers. Rows are matched by key: rowids of these tables can
+-- change on VACUUM.
+CREATE VIRTUAL TABLE IF NOT EXISTS flags_search USING fts5(key, description, tokenize = 'trigram');
+INSERT INTO flags_search (key, description) SELECT key, description FROM flags;
+
+CREATE TRIGGER IF NOT EXISTS flags_search_insert AFTER INSERT ON flags BEGIN
+    INSERT INTO flags_search (key, description) VALUES (new.key, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS flags_search_update AFTER UPDATE OF description ON flags
+WHEN old.description IS NOT new.description BEGIN
+    DELETE FROM flags_search WHERE key = old.key;
+    INSERT INTO flags_search (key, description) VALUES (new.key, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS flags_search_delete AFTER DELETE ON flags BEGIN
+    DELETE FROM flags_search WHERE key = old.key;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS segments_search USING fts5(key, description, tokenize = 'trigram');
+INSERT INTO segments_search (key, description) SELECT key, description FROM segments;
+
+CREATE TRIGGER IF NOT EXISTS segments_search_insert AFTER INSERT ON segments BEGIN
+    INSERT INTO segments_search (key, description) VALUES (new.key, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS segments_search_update AFTER UPDATE OF description ON segments
+WHEN old.description IS NOT new.description BEGIN
+    DELETE FROM segments_search WHERE key = old.key;
+    INSERT INTO segments_search (key, description) VALUES (new.key, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS segments_search_delete AFTER DELETE ON segments BEGIN
+    DELETE FROM segments_search WHERE key = old.key;
+END;
+
+CREATE INDEX IF NOT EXISTS idx_flags_created_at ON flags(created_at, key);
+CREATE INDEX IF NOT EXISTS idx_flags_updated_at ON flags(updated_at, key);
+CREATE INDEX IF NOT EXISTS idx_segments_created_at ON segments(created_at, key);
+CREATE INDEX IF NOT EXISTS idx_segments_updated_at ON segments(updated_at, key);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS flag_templates (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    type        TEXT NOT NULL CHECK(type IN ('boolean', 'string', 'number', 'json')),
+    definition  TEXT NOT NULL, -- JSON: default_value, rules and defaults
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL
+);